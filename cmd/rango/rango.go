@@ -2,11 +2,18 @@ package main
 
 import (
 	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"math/rand"
@@ -15,7 +22,9 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/openware/rango/pkg/admin"
 	"github.com/openware/rango/pkg/auth"
+	"github.com/openware/rango/pkg/message"
 	"github.com/openware/rango/pkg/metrics"
 	"github.com/openware/rango/pkg/routing"
 	"github.com/openware/rango/pkg/upstream"
@@ -26,6 +35,81 @@ var (
 	amqpAddr = flag.String("amqp-addr", "", "AMQP server address")
 	pubKey   = flag.String("pubKey", "config/rsa-key.pub", "Path to public key")
 	exName   = flag.String("exchange", "peatio.events.ranger", "Exchange name of upstream messages")
+	lazySrc  = flag.Bool("lazy-source", false, "Bind the queue to the routing keys of the public streams only while they have subscribers")
+	groups   = flag.String("groups", "", "Path to a JSON file defining group streams")
+	tlsCert  = flag.String("tls-cert", "", "Path to the TLS certificate of the server, TLS is disabled if empty")
+	tlsKey   = flag.String("tls-key", "", "Path to the TLS key of the server")
+	clientCA = flag.String("tls-client-ca", "", "Path to the CA certificates verifying the client certificates, they are not requested if empty")
+	certUID  = flag.String("cert-uid-field", "", "Field of the client certificate giving the UID of connections without token: cn, o, ou, dns or email")
+	certTags = flag.String("cert-tags", "", "Comma separated client certificate fields captured as connection tags, like service=ou")
+	uidHdrs  = flag.String("uid-headers", "JwtUID", "Comma separated request headers giving the UID of a connection, the first non-empty one wins")
+	reqAuth  = flag.Bool("require-auth", false, "Reject the connections without UID with 401 instead of accepting them as anonymous")
+	delegate = flag.String("delegations", "", "Path to a JSON file listing the users each account may act on behalf of")
+	pprofOn  = flag.Bool("pprof", false, "Serve the pprof endpoints under /debug/pprof/ on the admin port")
+	pprofIPs = flag.String("pprof-allowlist", "127.0.0.1,::1", "Comma separated IPs and CIDRs allowed to reach the pprof endpoints")
+	config   = flag.String("config", "", "Path to a JSON file of the settings reloaded on SIGHUP, overriding the flags")
+	origins  = flag.String("allowed-origins", "", "Comma separated origins allowed to connect, like https://app.example.com, the host itself if empty")
+	pingData = flag.String("ping-payload", "", "Payload of the pings: empty, time for the server time or metadata for the time and frame sequence")
+	envShape = flag.String("envelope", "object", "Shape of the outbound stream messages: object, array or fields")
+	expiry   = flag.String("token-expiry", "", "Behavior when the token of a connection expires: anonymous or close, nothing if empty")
+	shakeTTL = flag.Duration("handshake-timeout", 10*time.Second, "Maximum duration of the websocket handshake of connections, 0 for unlimited")
+	lifetime = flag.Duration("max-conn-lifetime", 0, "Maximum lifetime of websocket connections, 0 for unlimited")
+	maxFPS   = flag.Int("max-frames-per-second", 0, "Maximum number of frames written to a websocket connection per second, 0 for unlimited")
+	candles  = flag.String("candle-intervals", "", "Comma separated intervals of the candles built from trades, like 1m,5m")
+	ackStrs  = flag.String("ack-streams", "", "Comma separated private streams requiring delivery acknowledgement")
+	ackWin   = flag.Duration("ack-window", time.Minute, "Duration during which unacknowledged messages are redelivered")
+	maxSubs  = flag.Int("max-subscriptions", 0, "Maximum number of subscriptions across all clients, 0 for unlimited")
+	subRate  = flag.Int("max-subscribe-rate", 0, "Maximum number of subscribe and unsubscribe requests per second of a connection, 0 for unlimited")
+	bufBytes = flag.Int64("max-buffered-bytes", 0, "Maximum size in bytes of the messages buffered for a connection, 0 for no limit")
+	privDel  = flag.String("private-delivery", "all", "Connections of a user receiving its private messages: all or latest, the most recently active one")
+	dropMax  = flag.Float64("max-drop-rate", 0, "Ratio of the messages dropped for slow connections above which /ready reports the instance overloaded, 0 disables the check")
+	dropWin  = flag.Duration("drop-rate-window", 10*time.Second, "Duration over which the ratio of dropped messages is measured")
+	slowPol  = flag.String("slow-client-policy", "disconnect", "Behavior when the send buffer of a connection is full: disconnect or drop")
+	reqSubs  = flag.Int("max-request-streams", 0, "Maximum number of distinct streams of a subscribe request, 0 for unlimited")
+	dupRes   = flag.String("duplicate-resume", "", "Handling of the connections resuming the identity of a live connection: reject-new, close-old, or accept them all if empty")
+	overflow = flag.String("streams-overflow", "reject", "Policy for subscribe requests with too many streams: reject or truncate")
+	quotaStr = flag.String("stream-quotas", "", "Comma separated maximum numbers of subscriptions of a connection to the streams matching patterns, like *.ob-inc=5")
+	subStrs  = flag.Int("subscription-streams", 100, "Maximum number of streams with the most subscriptions exported with their own metric label, the others are labelled other")
+	metStrs  = flag.String("metric-streams", "", "Comma separated streams always having their own label in the per-stream metrics")
+	subCount = flag.Bool("subscription-counts", false, "Include the subscription counts of the connection in total, by scope and against each quota in the subscribe and unsubscribe acknowledgements")
+	caughtUp = flag.Bool("caught-up", false, "Send a caught_up event to the subscribers of a public stream once its replayed messages and snapshot are sent")
+	replayN  = flag.Int("replay-size", 0, "Number of recent messages of each public stream kept for the subscriptions asking for the last messages, 0 disables the replay")
+	latStrs  = flag.Int("latency-streams", 100, "Maximum number of streams whose delivery latency has its own metric label, the others are labelled other")
+	fireRate = flag.Int("firehose-rate", 100, "Maximum number of messages per second copied to a firehose connection, 0 for unlimited")
+	pubToken = flag.String("publish-token", "", "Bearer token enabling the publish endpoint")
+	batchWin = flag.Duration("batch-window", 0, "Duration during which messages of clients in batch mode are accumulated, 0 disables batch mode")
+	dictFile = flag.String("compression-dict", "", "Path of a preset dictionary compressing the messages of rango.dict connections")
+	batchMin = flag.Int("batch-min-size", 10, "Minimum number of accumulated messages sent as a compressed batch")
+	compThr  = flag.Int("compression-threshold", 0, "Minimum size in bytes of the messages compressed for the clients supporting permessage-deflate, 0 only compresses the batches")
+	compStrs = flag.String("compress-streams", "", "Comma separated patterns of the streams whose messages are always compressed for the clients supporting permessage-deflate, like *.ob-inc")
+	rawStrs  = flag.String("uncompressed-streams", "", "Comma separated patterns of the streams whose messages are never compressed, like *.tickers")
+	sizeStrs = flag.String("message-size-limits", "", "Comma separated maximum message sizes by event type, like tickers=1024,ob-snap=1048576")
+	dedupStr = flag.String("dedup-streams", "", "Comma separated streams whose duplicate messages are dropped")
+	dedupWin = flag.Duration("dedup-window", 0, "Duration during which a duplicate message is dropped, 0 disables the deduplication")
+	dedupMax = flag.Int("dedup-size", 10000, "Maximum number of message hashes remembered for the deduplication")
+	ingRate  = flag.Int("ingress-rate", 0, "Maximum number of messages per second of each public stream received from the source, 0 for unlimited")
+	ingPol   = flag.String("ingress-policy", "drop", "Handling of the messages above the ingress rate: drop, or conflate to route the latest one the next second")
+	tagStrs  = flag.String("tag-headers", "", "Comma separated request headers captured as connection tags, like region=X-Region,tier=X-Client-Tier")
+	maxTags  = flag.Int("max-tag-values", 100, "Maximum number of distinct values of a connection tag, 0 for unlimited")
+	defaults = flag.String("default-streams", "", "Comma separated streams every client is subscribed to on connect")
+	prioStrs = flag.String("priority-streams", "", "Comma separated streams written to clients before the others")
+	spillStr = flag.String("spill-streams", "", "Comma separated streams spilled to disk when a client is too slow")
+	spillDir = flag.String("spill-dir", "", "Directory of spilled messages, defaults to the temporary directory")
+	spillMax = flag.Int64("spill-max-bytes", 10<<20, "Maximum size on disk of the spilled messages of a client")
+	state    = flag.String("state-file", "", "File to save subscriptions to on shutdown and restore them from on startup")
+	subWait  = flag.Duration("subscribe-deadline", 0, "Duration given to connections without initial streams to subscribe, 0 for unlimited")
+	halfOpen = flag.Duration("half-open-timeout", 0, "Maximum duration of a write or without pong before closing a connection, 0 for the defaults")
+	idleTTL  = flag.Duration("idle-stream-ttl", 0, "Duration after which the snapshot of a stream without subscribers nor messages is dropped, 0 to keep it")
+	listed   = flag.String("listed-streams", "", "Comma separated public streams always listed by the streams request")
+	listTTL  = flag.Duration("listed-stream-ttl", 10*time.Minute, "Duration without message after which a public stream is no longer listed, 0 to list it forever")
+	staleTTL = flag.Duration("stale-threshold", 0, "Duration without message after which subscribers are told a stream is stale, 0 to disable")
+	hbPeriod = flag.Duration("heartbeat-interval", 0, "Interval of the heartbeat stream messages, 0 to disable")
+	tckPer   = flag.Duration("all-tickers-interval", 0, "Interval of the allTickers stream messages, 0 to disable")
+	logRate  = flag.Int("log-sample-rate", 1, "Log one received message out of this number at debug level")
+	logSize  = flag.Int("log-max-size", 0, "Maximum size of a logged message, 0 for no limit")
+	upgrades = flag.Int("max-upgrades", 0, "Maximum number of concurrent connection upgrades, 0 for unlimited")
+	upQueue  = flag.Int("upgrade-queue", 1000, "Number of connection upgrades waiting for their turn")
+	upWait   = flag.Duration("upgrade-queue-wait", 5*time.Second, "Maximum wait of a queued connection upgrade")
 )
 
 const prefix = "Bearer "
@@ -41,26 +125,63 @@ func token(r *http.Request) string {
 	return authHeader[len(prefix):]
 }
 
-func authHandler(h httpHanlder, key *rsa.PublicKey, mustAuth bool) httpHanlder {
+// onBehalfOf returns the user a request acts on behalf of, the token claim
+// takes precedence over the header.
+func onBehalfOf(r *http.Request, claim string) string {
+	if claim != "" {
+		return claim
+	}
+	return r.Header.Get("On-Behalf-Of")
+}
+
+func authHandler(h httpHanlder, hub *routing.Hub, key *rsa.PublicKey, mustAuth bool) httpHanlder {
 	return func(w http.ResponseWriter, r *http.Request) {
 		auth, err := auth.ParseAndValidate(token(r), key)
+		if err != nil {
+			r.Header.Del("JwtUID")
+		}
 
-		if err != nil && mustAuth {
+		// The UID may be given by another header of the UID headers.
+		if err != nil && mustAuth && hub.RequestUID(r) == "" {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
+		r.Header.Del("JwtOnBehalfOf")
+		r.Header.Del("JwtExpiry")
+		r.Header.Del("JwtStreams")
 		if err == nil {
 			r.Header.Set("JwtUID", auth.UID)
-		} else {
-			r.Header.Del("JwtUID")
+			if auth.ExpiresAt != 0 {
+				r.Header.Set("JwtExpiry", strconv.FormatInt(auth.ExpiresAt, 10))
+			}
+			if target := onBehalfOf(r, auth.OnBehalfOf); target != "" {
+				r.Header.Set("JwtOnBehalfOf", target)
+			}
+			if auth.Streams != nil {
+				r.Header.Set("JwtStreams", strings.Join(auth.Streams, ","))
+			}
 		}
 		h(w, r)
 		return
 	}
 }
 
+func tokenHandler(h httpHanlder, secret string) httpHanlder {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(token(r)), []byte(secret)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
 func setupLogger() {
+	if strings.ToLower(os.Getenv("LOG_FORMAT")) == "console" {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	}
+
 	logLevel, ok := os.LookupEnv("LOG_LEVEL")
 	if ok {
 		level, err := zerolog.ParseLevel(strings.ToLower(logLevel))
@@ -123,6 +244,243 @@ func getServerAddress() string {
 	return fmt.Sprintf("%s:%s", host, port)
 }
 
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func parseIntervals(s string) ([]time.Duration, error) {
+	var intervals []time.Duration
+	for _, v := range splitList(s) {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		if d < time.Second || d%time.Second != 0 {
+			return nil, fmt.Errorf("invalid interval %s, must be a number of seconds", v)
+		}
+		intervals = append(intervals, d)
+	}
+	return intervals, nil
+}
+
+func parseSizeLimits(s string) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, v := range splitList(s) {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid size limit %s", v)
+		}
+		size, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		limits[kv[0]] = size
+	}
+	return limits, nil
+}
+
+func parseQuotas(s string) (map[string]int, error) {
+	quotas := map[string]int{}
+	for _, v := range splitList(s) {
+		i := strings.LastIndex(v, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid stream quota %s", v)
+		}
+		if _, err := path.Match(v[:i], ""); err != nil {
+			return nil, fmt.Errorf("invalid stream quota pattern %s", v[:i])
+		}
+		max, err := strconv.Atoi(v[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		quotas[v[:i]] = max
+	}
+	return quotas, nil
+}
+
+func parseTagHeaders(s string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, v := range splitList(s) {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid tag header %s", v)
+		}
+		headers[kv[0]] = kv[1]
+	}
+	return headers, nil
+}
+
+func parseCertTags(s string) (map[string]string, error) {
+	fields, err := parseTagHeaders(s)
+	if err != nil {
+		return nil, err
+	}
+	for tag, field := range fields {
+		if !routing.ValidCertificateField(field) {
+			return nil, fmt.Errorf("invalid certificate field %s of tag %s", field, tag)
+		}
+	}
+	return fields, nil
+}
+
+func getPublishToken() string {
+	if *pubToken != "" {
+		return *pubToken
+	}
+	return os.Getenv("PUBLISH_TOKEN")
+}
+
+func loadGroups(hub *routing.Hub, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	groups := map[string][]string{}
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return err
+	}
+
+	for name, members := range groups {
+		hub.SetGroup(name, members)
+	}
+	return nil
+}
+
+func loadDelegations(path string) (routing.Authorizer, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	delegations := routing.Delegations{}
+	if err := json.Unmarshal(data, &delegations); err != nil {
+		return nil, err
+	}
+	return delegations, nil
+}
+
+// configFile holds the settings of the config file, the flags give the ones
+// it omits.
+type configFile struct {
+	MaxSubscriptions  *int           `json:"max_subscriptions"`
+	MaxSubscribeRate  *int           `json:"max_subscribe_rate"`
+	MessageSizeLimits map[string]int `json:"message_size_limits"`
+	AllowedOrigins    []string       `json:"allowed_origins"`
+}
+
+// loadConfig returns the reloadable settings of the hub from the flags, the
+// config file and the delegations file.
+func loadConfig() (routing.Config, error) {
+	limits, err := parseSizeLimits(*sizeStrs)
+	if err != nil {
+		return routing.Config{}, fmt.Errorf("parsing message size limits failed: %w", err)
+	}
+	authorizer, err := loadDelegations(*delegate)
+	if err != nil {
+		return routing.Config{}, fmt.Errorf("loading delegations failed: %w", err)
+	}
+	cfg := routing.Config{
+		MaxSubscriptions:  *maxSubs,
+		MaxSubscribeRate:  *subRate,
+		MessageSizeLimits: limits,
+		Authorizer:        authorizer,
+		AllowedOrigins:    splitList(*origins),
+	}
+	if *config == "" {
+		return cfg, nil
+	}
+
+	data, err := ioutil.ReadFile(*config)
+	if err != nil {
+		return cfg, err
+	}
+	var file configFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return cfg, fmt.Errorf("parsing config failed: %w", err)
+	}
+	if file.MaxSubscriptions != nil {
+		cfg.MaxSubscriptions = *file.MaxSubscriptions
+	}
+	if file.MaxSubscribeRate != nil {
+		cfg.MaxSubscribeRate = *file.MaxSubscribeRate
+	}
+	if file.MessageSizeLimits != nil {
+		cfg.MessageSizeLimits = file.MessageSizeLimits
+	}
+	if file.AllowedOrigins != nil {
+		cfg.AllowedOrigins = file.AllowedOrigins
+	}
+	return cfg, nil
+}
+
+// reload applies the config files to the running hub.
+func reload(hub *routing.Hub) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	hub.Reload(cfg)
+	log.Info().Msg("Configuration reloaded")
+	return nil
+}
+
+func reloadOnSignal(hub *routing.Hub) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		if err := reload(hub); err != nil {
+			log.Error().Msgf("Reloading configuration failed: %s", err.Error())
+		}
+	}
+}
+
+func loadState(hub *routing.Hub, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return hub.ImportState(data)
+}
+
+func saveStateOnExit(hub *routing.Hub, path string) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+
+	// The readers stop queuing requests, so the exported subscriptions do
+	// not change anymore.
+	hub.Shutdown()
+	if path != "" {
+		data, err := hub.ExportState()
+		if err == nil {
+			err = ioutil.WriteFile(path, data, 0600)
+		}
+		if err != nil {
+			log.Error().Msgf("Saving state failed: %s", err.Error())
+		}
+	}
+	os.Exit(0)
+}
+
 func main() {
 	flag.Parse()
 
@@ -131,6 +489,162 @@ func main() {
 	metrics.Enable()
 
 	hub := routing.NewHub()
+	hub.HandshakeTimeout = *shakeTTL
+	hub.UIDHeaders = splitList(*uidHdrs)
+	hub.RequireAuth = *reqAuth
+	hub.MaxConnLifetime = *lifetime
+	hub.MaxFramesPerSecond = *maxFPS
+	switch *expiry {
+	case "", routing.TokenExpiryAnonymous, routing.TokenExpiryClose:
+		hub.TokenExpiry = *expiry
+	default:
+		log.Fatal().Msgf("Invalid token expiry behavior: %s", *expiry)
+		return
+	}
+	envelope, err := message.NewEnvelopeEncoder(*envShape)
+	if err != nil {
+		log.Fatal().Msgf("Invalid envelope: %s", err.Error())
+		return
+	}
+	hub.Envelope = envelope
+	pingPayload, err := routing.NewPingPayload(*pingData)
+	if err != nil {
+		log.Fatal().Msgf("Invalid ping payload: %s", err.Error())
+		return
+	}
+	hub.PingPayload = pingPayload
+	hub.SubscribeDeadline = *subWait
+	hub.HalfOpenTimeout = *halfOpen
+	hub.HeartbeatInterval = *hbPeriod
+	hub.AllTickersInterval = *tckPer
+	hub.IdleStreamTTL = *idleTTL
+	hub.StaleThreshold = *staleTTL
+	hub.ListedStreams = splitList(*listed)
+	hub.ListedStreamTTL = *listTTL
+	hub.LogSampleRate = *logRate
+	hub.LogMaxSize = *logSize
+	hub.AckStreams = splitList(*ackStrs)
+	hub.AckWindow = *ackWin
+	hub.FirehoseRate = *fireRate
+	hub.LatencyStreams = *latStrs
+	hub.ReplaySize = *replayN
+	hub.CaughtUp = *caughtUp
+	hub.SubscriptionCounts = *subCount
+	hub.SubscriptionStreams = *subStrs
+	hub.MetricStreams = splitList(*metStrs)
+	hub.MaxBufferedBytes = *bufBytes
+	switch *privDel {
+	case routing.PrivateDeliveryAll, routing.PrivateDeliveryLatest:
+		hub.PrivateDelivery = *privDel
+	default:
+		log.Fatal().Msgf("Invalid private delivery: %s", *privDel)
+		return
+	}
+	switch *slowPol {
+	case routing.SlowClientDisconnect, routing.SlowClientDrop:
+		hub.SlowClientPolicy = *slowPol
+	default:
+		log.Fatal().Msgf("Invalid slow client policy: %s", *slowPol)
+		return
+	}
+	hub.MaxDropRate = *dropMax
+	hub.DropRateWindow = *dropWin
+	hub.MaxRequestStreams = *reqSubs
+	switch *overflow {
+	case routing.StreamsOverflowReject, routing.StreamsOverflowTruncate:
+		hub.StreamsOverflow = *overflow
+	default:
+		log.Fatal().Msgf("Invalid streams overflow policy: %s", *overflow)
+		return
+	}
+	switch *dupRes {
+	case "", routing.DuplicateResumeRejectNew, routing.DuplicateResumeCloseOld:
+		hub.DuplicateResume = *dupRes
+	default:
+		log.Fatal().Msgf("Invalid duplicate resume policy: %s", *dupRes)
+		return
+	}
+	quotas, err := parseQuotas(*quotaStr)
+	if err != nil {
+		log.Fatal().Msgf("Parsing stream quotas failed: %s", err.Error())
+		return
+	}
+	hub.StreamQuotas = quotas
+	hub.BatchWindow = *batchWin
+	hub.BatchMinSize = *batchMin
+	hub.CompressionThreshold = *compThr
+	hub.CompressStreams = splitList(*compStrs)
+	hub.UncompressedStreams = splitList(*rawStrs)
+	if *dictFile != "" {
+		dict, err := ioutil.ReadFile(*dictFile)
+		if err != nil {
+			log.Fatal().Msgf("Loading compression dictionary failed: %s", err.Error())
+			return
+		}
+		hub.CompressionDict = dict
+	}
+	hub.DefaultStreams = splitList(*defaults)
+	hub.PriorityStreams = splitList(*prioStrs)
+	hub.SpillStreams = splitList(*spillStr)
+	hub.SpillDir = *spillDir
+	hub.SpillMaxBytes = *spillMax
+	intervals, err := parseIntervals(*candles)
+	if err != nil {
+		log.Fatal().Msgf("Parsing candle intervals failed: %s", err.Error())
+		return
+	}
+	hub.CandleIntervals = intervals
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal().Msgf("Loading configuration failed: %s", err.Error())
+		return
+	}
+	hub.Reload(cfg)
+	hub.DedupStreams = splitList(*dedupStr)
+	hub.DedupWindow = *dedupWin
+	hub.DedupSize = *dedupMax
+	hub.IngressRate = *ingRate
+	switch *ingPol {
+	case routing.IngressDrop, routing.IngressConflate:
+		hub.IngressPolicy = *ingPol
+	default:
+		log.Fatal().Msgf("Invalid ingress policy: %s", *ingPol)
+		return
+	}
+
+	tagHeaders, err := parseTagHeaders(*tagStrs)
+	if err != nil {
+		log.Fatal().Msgf("Parsing tag headers failed: %s", err.Error())
+		return
+	}
+	hub.TagHeaders = tagHeaders
+
+	if *certUID != "" && !routing.ValidCertificateField(*certUID) {
+		log.Fatal().Msgf("Invalid certificate UID field: %s", *certUID)
+		return
+	}
+	hub.CertUIDField = *certUID
+	certTagFields, err := parseCertTags(*certTags)
+	if err != nil {
+		log.Fatal().Msgf("Parsing certificate tags failed: %s", err.Error())
+		return
+	}
+	hub.CertTags = certTagFields
+	hub.MaxTagValues = *maxTags
+
+	if err := loadGroups(hub, *groups); err != nil {
+		log.Fatal().Msgf("Loading groups failed: %s", err.Error())
+		return
+	}
+
+	if err := loadState(hub, *state); err != nil {
+		log.Fatal().Msgf("Loading state failed: %s", err.Error())
+		return
+	}
+	go saveStateOnExit(hub, *state)
+	go reloadOnSignal(hub)
+
 	pub, err := getPublicKey()
 	if err != nil {
 		log.Error().Msgf("Loading public key failed: %s", err.Error())
@@ -145,29 +659,90 @@ func main() {
 		log.Fatal().Msgf("creating new AMQP session failed: %s", err.Error())
 		return
 	}
-	ach, err := mq.Stream(*exName, qName)
+	// A lazy source binds the public routing keys while they have subscribers.
+	keys := []string{"#"}
+	if *lazySrc {
+		keys = []string{"private.#", "global.#"}
+	}
+	ach, err := mq.StreamKeys(*exName, qName, keys)
 	defer mq.Close(qName)
 
 	if err != nil {
 		log.Fatal().Msgf("AMQP init failed: %s", err.Error())
 		return
 	}
+	if *lazySrc {
+		lazy := routing.NewLazySource(hub, mq.Bindings(*exName, qName))
+		go lazy.Run()
+	}
 
 	go hub.ListenWebsocketEvents()
 	go hub.ListenAMQP(ach)
+	go hub.SendHeartbeats()
+	go hub.SendAllTickers()
+	go hub.CollectIdleStreams()
+	go hub.DetectStaleStreams()
+	go hub.MonitorDropRate()
+	go hub.RecordSubscriptionMetrics()
 
 	wsHandler := func(w http.ResponseWriter, r *http.Request) {
 		routing.NewClient(hub, w, r)
 	}
+	if *upgrades > 0 {
+		wsHandler = routing.NewUpgradeLimiter(*upgrades, *upQueue, *upWait).Handler(wsHandler)
+	}
+
+	// The public handlers are not registered on the default mux, which the
+	// pprof package registers its handlers on.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/private", authHandler(wsHandler, hub, pub, true))
+	mux.HandleFunc("/public", authHandler(wsHandler, hub, pub, false))
+	mux.HandleFunc("/", authHandler(wsHandler, hub, pub, false))
 
-	http.HandleFunc("/private", authHandler(wsHandler, pub, true))
-	http.HandleFunc("/public", authHandler(wsHandler, pub, false))
-	http.HandleFunc("/", authHandler(wsHandler, pub, false))
+	mux.HandleFunc("/snapshot", routing.SnapshotHandler(hub))
+	mux.HandleFunc("/streams", routing.StreamsHandler(hub))
+	mux.HandleFunc("/dictionary", routing.DictionaryHandler(hub))
+	mux.HandleFunc("/ready", routing.ReadinessHandler(hub))
 
-	go http.ListenAndServe(":4242", promhttp.Handler())
+	if secret := getPublishToken(); secret != "" {
+		mux.HandleFunc("/publish", tokenHandler(httpHanlder(routing.PublishHandler(hub)), secret))
+	}
+
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/", promhttp.Handler())
+	adminMux.HandleFunc("/admin/loglevel", admin.LogLevelHandler())
+	adminMux.HandleFunc("/admin/tags", routing.TagsHandler(hub))
+	adminMux.HandleFunc("/admin/rtt", routing.RTTHandler(hub))
+	adminMux.HandleFunc("/admin/liveness", routing.LivenessHandler(hub))
+	adminMux.HandleFunc("/admin/reauthorize", routing.ReauthorizeHandler(hub))
+	adminMux.HandleFunc("/admin/drain", routing.DrainHandler(hub))
+	adminMux.HandleFunc("/admin/redirect", routing.RedirectHandler(hub))
+	adminMux.HandleFunc("/admin/maintenance", routing.MaintenanceHandler(hub))
+	adminMux.HandleFunc("/admin/demand", routing.DemandHandler(hub))
+	adminMux.HandleFunc("/admin/reload", admin.ReloadHandler(func() error { return reload(hub) }))
+	adminMux.HandleFunc("/selftest", routing.SelftestHandler(hub))
+	pprofNets, err := admin.ParseAllowlist(*pprofIPs)
+	if err != nil {
+		log.Fatal().Msgf("Invalid pprof allowlist: %s", err.Error())
+		return
+	}
+	adminMux.Handle(admin.PprofPath, admin.PprofHandler(*pprofOn, pprofNets))
+	go http.ListenAndServe(":4242", adminMux)
 
 	log.Printf("Listenning on %s", getServerAddress())
-	err = http.ListenAndServe(getServerAddress(), nil)
+	server := routing.NewServer(getServerAddress(), mux, hub.HandshakeTimeout)
+	if *tlsCert == "" {
+		err = server.ListenAndServe()
+	} else {
+		if *clientCA != "" {
+			server.TLSConfig, err = routing.ClientAuthTLSConfig(*clientCA)
+			if err != nil {
+				log.Fatal().Msgf("Loading client CA failed: %s", err.Error())
+				return
+			}
+		}
+		err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+	}
 	if err != nil {
 		log.Fatal().Msg("ListenAndServe failed: " + err.Error())
 	}
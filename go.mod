@@ -9,4 +9,5 @@ require (
 	github.com/rs/zerolog v1.18.0
 	github.com/streadway/amqp v0.0.0-20200108173154-1c71cc93ed71
 	github.com/stretchr/testify v1.5.1
+	google.golang.org/protobuf v1.21.0
 )
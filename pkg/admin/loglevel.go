@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// LogLevelHandler returns the global log level on GET and changes it on PUT
+// or POST with the level parameter, e.g. PUT /admin/loglevel?level=debug
+func LogLevelHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			level, err := zerolog.ParseLevel(strings.ToLower(r.FormValue("level")))
+			if err != nil || r.FormValue("level") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "invalid level %q\n", r.FormValue("level"))
+				return
+			}
+			log.Warn().Msgf("Changing log level to %s", level)
+			zerolog.SetGlobalLevel(level)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		fmt.Fprintln(w, zerolog.GlobalLevel())
+	}
+}
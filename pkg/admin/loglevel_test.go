@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+	handler := LogLevelHandler()
+
+	call := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	t.Run("returns the current level", func(t *testing.T) {
+		w := call(http.MethodGet, "/admin/loglevel")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "info\n", w.Body.String())
+	})
+
+	t.Run("changes which lines are emitted", func(t *testing.T) {
+		logger.Info().Msg("first")
+		assert.Contains(t, buf.String(), "first")
+
+		w := call(http.MethodPut, "/admin/loglevel?level=warn")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "warn\n", w.Body.String())
+
+		buf.Reset()
+		logger.Info().Msg("second")
+		logger.Warn().Msg("third")
+		assert.NotContains(t, buf.String(), "second")
+		assert.Contains(t, buf.String(), "third")
+
+		call(http.MethodPost, "/admin/loglevel?level=DEBUG")
+		buf.Reset()
+		logger.Debug().Msg("fourth")
+		assert.Contains(t, buf.String(), "fourth")
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, call(http.MethodPut, "/admin/loglevel?level=loud").Code)
+		assert.Equal(t, http.StatusBadRequest, call(http.MethodPut, "/admin/loglevel").Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, call(http.MethodDelete, "/admin/loglevel").Code)
+		assert.Equal(t, zerolog.DebugLevel, zerolog.GlobalLevel())
+	})
+}
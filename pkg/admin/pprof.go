@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// PprofPath is the path of the pprof endpoints, like /debug/pprof/goroutine.
+const PprofPath = "/debug/pprof/"
+
+// PprofHandler returns a handler serving the pprof endpoints under PprofPath
+// to the clients of the allowed networks. It answers 404 if not enabled, the
+// profiles must not be reachable by default.
+func PprofHandler(enabled bool, allowed []*net.IPNet) http.Handler {
+	if !enabled {
+		return http.NotFoundHandler()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(PprofPath, pprof.Index)
+	mux.HandleFunc(PprofPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(PprofPath+"profile", pprof.Profile)
+	mux.HandleFunc(PprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(PprofPath+"trace", pprof.Trace)
+	return AllowIPs(allowed, mux)
+}
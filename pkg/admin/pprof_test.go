@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPprofHandler(t *testing.T) {
+	allowed, err := ParseAllowlist("127.0.0.1, 10.0.0.0/8,::1")
+	require.NoError(t, err)
+
+	call := func(handler http.Handler, remote, target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("serves the profiles when enabled", func(t *testing.T) {
+		handler := PprofHandler(true, allowed)
+		for _, remote := range []string{"127.0.0.1:5000", "10.1.2.3:5000", "[::1]:5000"} {
+			w := call(handler, remote, "/debug/pprof/")
+			assert.Equal(t, http.StatusOK, w.Code, remote)
+			assert.Contains(t, w.Body.String(), "goroutine", remote)
+		}
+		w := call(handler, "127.0.0.1:5000", "/debug/pprof/goroutine?debug=1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "goroutine profile")
+		assert.Equal(t, http.StatusOK, call(handler, "127.0.0.1:5000", "/debug/pprof/cmdline").Code)
+	})
+
+	t.Run("rejects the clients outside the allowlist", func(t *testing.T) {
+		handler := PprofHandler(true, allowed)
+		assert.Equal(t, http.StatusForbidden, call(handler, "192.168.1.1:5000", "/debug/pprof/").Code)
+		assert.Equal(t, http.StatusForbidden, call(handler, "192.168.1.1:5000", "/debug/pprof/goroutine").Code)
+	})
+
+	t.Run("is absent when disabled", func(t *testing.T) {
+		handler := PprofHandler(false, allowed)
+		assert.Equal(t, http.StatusNotFound, call(handler, "127.0.0.1:5000", "/debug/pprof/").Code)
+		assert.Equal(t, http.StatusNotFound, call(handler, "127.0.0.1:5000", "/debug/pprof/goroutine").Code)
+	})
+}
+
+func TestParseAllowlist(t *testing.T) {
+	nets, err := ParseAllowlist("")
+	require.NoError(t, err)
+	assert.Empty(t, nets)
+
+	for _, list := range []string{"localhost", "10.0.0.0/33", "1.2.3"} {
+		_, err := ParseAllowlist(list)
+		assert.Error(t, err, list)
+	}
+}
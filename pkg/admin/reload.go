@@ -0,0 +1,24 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ReloadHandler calls reload on POST, e.g. POST /admin/reload, and replies
+// with the error if it failed.
+func ReloadHandler(reload func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := reload(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "reload failed: %s\n", err.Error())
+			return
+		}
+		fmt.Fprintln(w, "reloaded")
+	}
+}
@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadHandler(t *testing.T) {
+	var err error
+	calls := 0
+	handler := ReloadHandler(func() error {
+		calls++
+		return err
+	})
+
+	call := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, "/admin/reload", nil))
+		return w
+	}
+
+	t.Run("reloads on POST", func(t *testing.T) {
+		w := call(http.MethodPost)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "reloaded\n", w.Body.String())
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("reports a failed reload", func(t *testing.T) {
+		err = errors.New("invalid config")
+		w := call(http.MethodPost)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, "reload failed: invalid config\n", w.Body.String())
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		w := call(http.MethodGet)
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, 2, calls)
+	})
+}
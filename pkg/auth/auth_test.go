@@ -70,4 +70,44 @@ func TestAuth_JWT(t *testing.T) {
 			t.Fatal(err)
 		}
 	})
+
+	t.Run("should parse the on behalf of claim", func(t *testing.T) {
+		token, err := ForgeToken("uid", "email", "role", 3, ks.PrivateKey, jwt.MapClaims{"on_behalf_of": "target"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth, err := ParseAndValidate(token, ks.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth.OnBehalfOf != "target" {
+			t.Errorf("expected: target actual: %s", auth.OnBehalfOf)
+		}
+	})
+
+	t.Run("should parse the streams claim", func(t *testing.T) {
+		token, err := ForgeToken("uid", "email", "role", 3, ks.PrivateKey, jwt.MapClaims{"streams": []string{"btcusd.trades", "order"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth, err := ParseAndValidate(token, ks.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(auth.Streams) != 2 || auth.Streams[0] != "btcusd.trades" || auth.Streams[1] != "order" {
+			t.Errorf("expected: [btcusd.trades order] actual: %v", auth.Streams)
+		}
+
+		token, err = ForgeToken("uid", "email", "role", 3, ks.PrivateKey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth, err = ParseAndValidate(token, ks.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth.Streams != nil {
+			t.Errorf("expected no streams actual: %v", auth.Streams)
+		}
+	})
 }
@@ -16,6 +16,12 @@ type Auth struct {
 	Level    json.Number `json:"level"`
 	Audience []string    `json:"aud,omitempty"`
 
+	// User the token holder acts on behalf of, if delegated
+	OnBehalfOf string `json:"on_behalf_of,omitempty"`
+
+	// Streams the token holder may subscribe to, unrestricted if nil
+	Streams []string `json:"streams,omitempty"`
+
 	jwt.StandardClaims
 }
 
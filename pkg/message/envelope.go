@@ -0,0 +1,81 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Envelope is an outbound message of a stream, MsgID is set for messages
+// waiting for an acknowledgement only. CorrelationID is the identifier given by
+// the source to the message, if any.
+type Envelope struct {
+	Stream        string
+	Data          interface{}
+	MsgID         uint64
+	CorrelationID string
+}
+
+// EnvelopeEncoder encodes the outbound messages of the streams.
+type EnvelopeEncoder interface {
+	Encode(e Envelope) ([]byte, error)
+}
+
+// ObjectEnvelope encodes a message as
+// {"stream":data,"msg_id":1,"correlation_id":"id"}, it is the default shape.
+type ObjectEnvelope struct{}
+
+func (ObjectEnvelope) Encode(e Envelope) ([]byte, error) {
+	if e.MsgID == 0 && e.CorrelationID == "" {
+		return PackOutgoingEvent(e.Stream, e.Data)
+	}
+	m := map[string]interface{}{e.Stream: e.Data}
+	if e.MsgID != 0 {
+		m["msg_id"] = e.MsgID
+	}
+	if e.CorrelationID != "" {
+		m["correlation_id"] = e.CorrelationID
+	}
+	return json.Marshal(m)
+}
+
+// ArrayEnvelope encodes a message as ["stream",data,1,"id"], the message ID is 0
+// when only the correlation ID is set.
+type ArrayEnvelope struct{}
+
+func (ArrayEnvelope) Encode(e Envelope) ([]byte, error) {
+	switch {
+	case e.CorrelationID != "":
+		return json.Marshal([]interface{}{e.Stream, e.Data, e.MsgID, e.CorrelationID})
+	case e.MsgID != 0:
+		return json.Marshal([]interface{}{e.Stream, e.Data, e.MsgID})
+	default:
+		return json.Marshal([]interface{}{e.Stream, e.Data})
+	}
+}
+
+// FieldsEnvelope encodes a message as
+// {"stream":"stream","data":data,"msg_id":1,"correlation_id":"id"}.
+type FieldsEnvelope struct{}
+
+func (FieldsEnvelope) Encode(e Envelope) ([]byte, error) {
+	return json.Marshal(struct {
+		Stream        string      `json:"stream"`
+		Data          interface{} `json:"data"`
+		MsgID         uint64      `json:"msg_id,omitempty"`
+		CorrelationID string      `json:"correlation_id,omitempty"`
+	}{e.Stream, e.Data, e.MsgID, e.CorrelationID})
+}
+
+// NewEnvelopeEncoder returns the encoder of a shape: object, array or fields.
+func NewEnvelopeEncoder(shape string) (EnvelopeEncoder, error) {
+	switch shape {
+	case "", "object":
+		return ObjectEnvelope{}, nil
+	case "array":
+		return ArrayEnvelope{}, nil
+	case "fields":
+		return FieldsEnvelope{}, nil
+	default:
+		return nil, fmt.Errorf("unknown envelope shape: %s", shape)
+	}
+}
@@ -0,0 +1,53 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeEncoders(t *testing.T) {
+	data := map[string]interface{}{"price": "9120.0"}
+
+	tests := []struct {
+		shape           string
+		plain           string
+		withID          string
+		withCorrelation string
+	}{
+		{"object", `{"btcusd.trades":{"price":"9120.0"}}`, `{"btcusd.trades":{"price":"9120.0"},"msg_id":42}`, `{"btcusd.trades":{"price":"9120.0"},"correlation_id":"trace-1"}`},
+		{"array", `["btcusd.trades",{"price":"9120.0"}]`, `["btcusd.trades",{"price":"9120.0"},42]`, `["btcusd.trades",{"price":"9120.0"},0,"trace-1"]`},
+		{"fields", `{"stream":"btcusd.trades","data":{"price":"9120.0"}}`, `{"stream":"btcusd.trades","data":{"price":"9120.0"},"msg_id":42}`, `{"stream":"btcusd.trades","data":{"price":"9120.0"},"correlation_id":"trace-1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shape, func(t *testing.T) {
+			enc, err := NewEnvelopeEncoder(tt.shape)
+			require.NoError(t, err)
+
+			b, err := enc.Encode(Envelope{Stream: "btcusd.trades", Data: data})
+			require.NoError(t, err)
+			assert.Equal(t, tt.plain, string(b))
+
+			b, err = enc.Encode(Envelope{Stream: "btcusd.trades", Data: data, MsgID: 42})
+			require.NoError(t, err)
+			assert.Equal(t, tt.withID, string(b))
+
+			b, err = enc.Encode(Envelope{Stream: "btcusd.trades", Data: data, CorrelationID: "trace-1"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.withCorrelation, string(b))
+		})
+	}
+
+	t.Run("object is the default", func(t *testing.T) {
+		enc, err := NewEnvelopeEncoder("")
+		require.NoError(t, err)
+		assert.Equal(t, ObjectEnvelope{}, enc)
+	})
+
+	t.Run("unknown shape", func(t *testing.T) {
+		_, err := NewEnvelopeEncoder("xml")
+		assert.EqualError(t, err, "unknown envelope shape: xml")
+	})
+}
@@ -7,6 +7,38 @@ import (
 type Request struct {
 	Method  string
 	Streams []string
+	ID      uint64
+
+	// Streams subscribed without their initial snapshot
+	NoSnapshot []string
+
+	// Streams subscribed with deltas between consecutive messages
+	Delta []string
+
+	// Delivery conditions of the subscribed streams by stream
+	Conditions map[string]*Condition
+
+	// Number of recent messages replayed on subscription by stream
+	Last map[string]int
+
+	// Confirm the subscriptions with a single response listing the streams
+	// which failed, instead of an error for each of them
+	Consolidated bool
+
+	// Number of messages granted to the connection by a credit request
+	Credits int64
+
+	// Logical session of the connection the request belongs to, the
+	// connection itself if empty
+	Session string
+}
+
+// Condition restricts the messages delivered on a subscription to the ones
+// whose numeric field compares to the value, like price > 50000.
+type Condition struct {
+	Field string
+	Op    string
+	Value float64
 }
 
 func PackOutgoingResponse(err error, message interface{}) ([]byte, error) {
@@ -4,9 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"reflect"
 )
 
+// Maximum number of messages granted by a credit request.
+const maxCredits = 1 << 30
+
+// Maximum length of the session ID of a request.
+const maxSessionIDLength = 64
+
 func ParseRequest(msg []byte) (Request, error) {
 	request, err := Parse(msg)
 	if err != nil {
@@ -18,30 +23,90 @@ func ParseRequest(msg []byte) (Request, error) {
 
 func Parse(msg []byte) (Request, error) {
 	var v map[string]interface{}
-	var parsed Request
 
 	if err := json.Unmarshal(msg, &v); err != nil {
-		return parsed, fmt.Errorf("Could not parse message: %w", err)
+		return Request{}, fmt.Errorf("Could not parse message: %w", err)
+	}
+	return parseFields(v)
+}
+
+// parseFields parses a request from its decoded fields.
+func parseFields(v map[string]interface{}) (Request, error) {
+	var parsed Request
+
+	if session, ok := v["session"]; ok {
+		id, ok := session.(string)
+		if !ok || id == "" || len(id) > maxSessionIDLength {
+			return parsed, errors.New("Could not parse session: Invalid session")
+		}
+		parsed.Session = id
 	}
 
 	switch v["event"] {
-	case "subscribe":
-		parsed.Method = "subscribe"
-		switch reflect.TypeOf(v["streams"]).Kind() {
-		case reflect.Slice:
-			streams := reflect.ValueOf(v["streams"])
-			for i := 0; i < streams.Len(); i++ {
-				parsed.Streams = append(parsed.Streams, streams.Index(i).Interface().(string))
+	case "subscribe", "set":
+		parsed.Method = v["event"].(string)
+		switch consolidated := v["consolidated"].(type) {
+		case nil:
+		case bool:
+			parsed.Consolidated = consolidated
+		default:
+			return parsed, errors.New("Could not parse subscribe: Invalid consolidated")
+		}
+		streams, ok := v["streams"].([]interface{})
+		if !ok {
+			return parsed, fmt.Errorf("Could not parse %s: Invalid streams", parsed.Method)
+		}
+		for _, s := range streams {
+			if err := parsed.parseSubscribeStream(s); err != nil {
+				return parsed, err
 			}
 		}
 	case "unsubscribe":
 		parsed.Method = "unsubscribe"
-		switch reflect.TypeOf(v["streams"]).Kind() {
-		case reflect.Slice:
-			streams := reflect.ValueOf(v["streams"])
-			for i := 0; i < streams.Len(); i++ {
-				parsed.Streams = append(parsed.Streams, streams.Index(i).Interface().(string))
+		streams, ok := v["streams"].([]interface{})
+		if !ok {
+			return parsed, errors.New("Could not parse unsubscribe: Invalid streams")
+		}
+		for _, s := range streams {
+			name, ok := s.(string)
+			if !ok {
+				return parsed, errors.New("Could not parse unsubscribe: Invalid stream")
 			}
+			parsed.Streams = append(parsed.Streams, name)
+		}
+	case "ack":
+		parsed.Method = "ack"
+		id, ok := v["id"].(float64)
+		if !ok || id < 0 {
+			return parsed, errors.New("Could not parse ack: Invalid id")
+		}
+		parsed.ID = uint64(id)
+	case "credit":
+		parsed.Method = "credit"
+		n, ok := v["n"].(float64)
+		if !ok || n < 1 || n > maxCredits || n != float64(int64(n)) {
+			return parsed, errors.New("Could not parse credit: Invalid n")
+		}
+		parsed.Credits = int64(n)
+	case "resync":
+		parsed.Method = "resync"
+		stream, ok := v["stream"].(string)
+		if !ok || stream == "" {
+			return parsed, errors.New("Could not parse resync: Invalid stream")
+		}
+		parsed.Streams = []string{stream}
+	case "whoami":
+		parsed.Method = "whoami"
+	case "limits":
+		parsed.Method = "limits"
+	case "firehose":
+		parsed.Method = "firehose"
+	case "streams":
+		parsed.Method = "streams"
+	case "close_session":
+		parsed.Method = "close_session"
+		if parsed.Session == "" {
+			return parsed, errors.New("Could not parse close_session: Missing session")
 		}
 	default:
 		return parsed, errors.New("Could not parse Type: Invalid event")
@@ -49,3 +114,97 @@ func Parse(msg []byte) (Request, error) {
 
 	return parsed, nil
 }
+
+// parseSubscribeStream adds a stream given either by name or as an object
+// with options, like {"stream":"btcusd.ob","snapshot":false},
+// {"stream":"btcusd.tickers","delta":true},
+// {"stream":"btcusd.tickers","when":{"field":"last","op":">","value":50000}}
+// or {"stream":"btcusd.trades","last":5}.
+func (r *Request) parseSubscribeStream(s interface{}) error {
+	switch s := s.(type) {
+	case string:
+		r.Streams = append(r.Streams, s)
+	case map[string]interface{}:
+		name, ok := s["stream"].(string)
+		if !ok {
+			return errors.New("Could not parse subscribe: Invalid stream")
+		}
+		r.Streams = append(r.Streams, name)
+
+		switch snapshot := s["snapshot"].(type) {
+		case nil:
+		case bool:
+			if !snapshot {
+				r.NoSnapshot = append(r.NoSnapshot, name)
+			}
+		default:
+			return errors.New("Could not parse subscribe: Invalid snapshot")
+		}
+
+		switch delta := s["delta"].(type) {
+		case nil:
+		case bool:
+			if delta {
+				r.Delta = append(r.Delta, name)
+			}
+		default:
+			return errors.New("Could not parse subscribe: Invalid delta")
+		}
+
+		switch last := s["last"].(type) {
+		case nil:
+		case float64:
+			if last < 0 || last != float64(int(last)) {
+				return errors.New("Could not parse subscribe: Invalid last")
+			}
+			if r.Last == nil {
+				r.Last = make(map[string]int)
+			}
+			r.Last[name] = int(last)
+		default:
+			return errors.New("Could not parse subscribe: Invalid last")
+		}
+
+		if when, ok := s["when"]; ok {
+			cond, err := parseCondition(when)
+			if err != nil {
+				return err
+			}
+			if r.Conditions == nil {
+				r.Conditions = make(map[string]*Condition)
+			}
+			r.Conditions[name] = cond
+		}
+	default:
+		return errors.New("Could not parse subscribe: Invalid stream")
+	}
+	return nil
+}
+
+// parseCondition parses a delivery condition, like
+// {"field":"last","op":">","value":50000}.
+func parseCondition(v interface{}) (*Condition, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Could not parse subscribe: Invalid condition")
+	}
+
+	field, ok := m["field"].(string)
+	if !ok || field == "" {
+		return nil, errors.New("Could not parse subscribe: Invalid condition field")
+	}
+
+	op, _ := m["op"].(string)
+	switch op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return nil, errors.New("Could not parse subscribe: Invalid condition operator")
+	}
+
+	value, ok := m["value"].(float64)
+	if !ok {
+		return nil, errors.New("Could not parse subscribe: Invalid condition value")
+	}
+
+	return &Condition{Field: field, Op: op, Value: value}, nil
+}
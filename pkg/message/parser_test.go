@@ -0,0 +1,36 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStreams(t *testing.T) {
+	t.Run("parses the streams of a request", func(t *testing.T) {
+		req, err := ParseRequest([]byte(`{"event":"set","streams":["btcusd.trades"]}`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"btcusd.trades"}, req.Streams)
+
+		req, err = ParseRequest([]byte(`{"event":"set","streams":[]}`))
+		require.NoError(t, err)
+		assert.Empty(t, req.Streams)
+	})
+
+	t.Run("rejects requests without streams", func(t *testing.T) {
+		_, err := ParseRequest([]byte(`{"event":"set"}`))
+		assert.EqualError(t, err, "Could not parse set: Invalid streams")
+		_, err = ParseRequest([]byte(`{"event":"subscribe"}`))
+		assert.EqualError(t, err, "Could not parse subscribe: Invalid streams")
+		_, err = ParseRequest([]byte(`{"event":"unsubscribe"}`))
+		assert.EqualError(t, err, "Could not parse unsubscribe: Invalid streams")
+	})
+
+	t.Run("rejects streams which are not an array", func(t *testing.T) {
+		_, err := ParseRequest([]byte(`{"event":"subscribe","streams":"btcusd.trades"}`))
+		assert.EqualError(t, err, "Could not parse subscribe: Invalid streams")
+		_, err = ParseRequest([]byte(`{"event":"unsubscribe","streams":[1]}`))
+		assert.EqualError(t, err, "Could not parse unsubscribe: Invalid stream")
+	})
+}
@@ -0,0 +1,151 @@
+package message
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the messages of rango.proto.
+const (
+	frameStream  protowire.Number = 1
+	frameSeq     protowire.Number = 2
+	framePayload protowire.Number = 3
+
+	requestEvent   protowire.Number = 1
+	requestStreams protowire.Number = 2
+	requestID      protowire.Number = 3
+	requestSession protowire.Number = 4
+)
+
+// Frame is a message sent to a client negotiating protobuf, see rango.proto.
+type Frame struct {
+	Stream  string
+	Seq     uint64
+	Payload []byte
+}
+
+// EncodeFrame returns the protobuf encoding of a frame.
+func EncodeFrame(f Frame) []byte {
+	b := make([]byte, 0, len(f.Stream)+len(f.Payload)+16)
+	if f.Stream != "" {
+		b = protowire.AppendTag(b, frameStream, protowire.BytesType)
+		b = protowire.AppendString(b, f.Stream)
+	}
+	if f.Seq != 0 {
+		b = protowire.AppendTag(b, frameSeq, protowire.VarintType)
+		b = protowire.AppendVarint(b, f.Seq)
+	}
+	if len(f.Payload) != 0 {
+		b = protowire.AppendTag(b, framePayload, protowire.BytesType)
+		b = protowire.AppendBytes(b, f.Payload)
+	}
+	return b
+}
+
+// DecodeFrame decodes a frame from its protobuf encoding.
+func DecodeFrame(b []byte) (Frame, error) {
+	var f Frame
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == frameStream && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			f.Stream = v
+			return n
+		case num == frameSeq && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			f.Seq = v
+			return n
+		case num == framePayload && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			f.Payload = append([]byte(nil), v...)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	if err != nil {
+		return f, fmt.Errorf("Could not parse frame: %w", err)
+	}
+	return f, nil
+}
+
+// EncodeProtoRequest returns the protobuf encoding of a request with its
+// event, streams, ack ID and session.
+func EncodeProtoRequest(event string, streams []string, id uint64, session string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, requestEvent, protowire.BytesType)
+	b = protowire.AppendString(b, event)
+	for _, s := range streams {
+		b = protowire.AppendTag(b, requestStreams, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	if id != 0 {
+		b = protowire.AppendTag(b, requestID, protowire.VarintType)
+		b = protowire.AppendVarint(b, id)
+	}
+	if session != "" {
+		b = protowire.AppendTag(b, requestSession, protowire.BytesType)
+		b = protowire.AppendString(b, session)
+	}
+	return b
+}
+
+// ParseProtoRequest parses a request encoded with protobuf, it is validated
+// like its JSON form.
+func ParseProtoRequest(msg []byte) (Request, error) {
+	streams := []interface{}{}
+	v := map[string]interface{}{}
+	err := consumeFields(msg, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == requestEvent && typ == protowire.BytesType:
+			s, n := protowire.ConsumeString(b)
+			v["event"] = s
+			return n
+		case num == requestStreams && typ == protowire.BytesType:
+			s, n := protowire.ConsumeString(b)
+			streams = append(streams, s)
+			return n
+		case num == requestID && typ == protowire.VarintType:
+			id, n := protowire.ConsumeVarint(b)
+			v["id"] = float64(id)
+			return n
+		case num == requestSession && typ == protowire.BytesType:
+			s, n := protowire.ConsumeString(b)
+			v["session"] = s
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	if err != nil {
+		return Request{}, fmt.Errorf("Could not parse message: %w", err)
+	}
+
+	v["streams"] = streams
+	if len(streams) != 0 {
+		v["stream"] = streams[0]
+	}
+	if _, ok := v["id"]; !ok {
+		v["id"] = float64(0)
+	}
+	return parseFields(v)
+}
+
+// consumeFields calls fn with the number, type and remaining bytes of each
+// field of a message, fn returns the length of the field value. Unknown fields
+// must be skipped by fn.
+func consumeFields(b []byte, fn func(protowire.Number, protowire.Type, []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n = fn(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrame(t *testing.T) {
+	f := Frame{Stream: "btcusd.trades", Seq: 300, Payload: []byte(`{"btcusd.trades":1}`)}
+	b := EncodeFrame(f)
+	assert.Equal(t, []byte{0x0a, 13}, b[:2])
+
+	decoded, err := DecodeFrame(b)
+	require.NoError(t, err)
+	assert.Equal(t, f, decoded)
+
+	_, err = DecodeFrame([]byte{0x0a, 13, 'b'})
+	assert.Error(t, err)
+}
+
+func TestParseProtoRequest(t *testing.T) {
+	t.Run("subscribe", func(t *testing.T) {
+		req, err := ParseProtoRequest(EncodeProtoRequest("subscribe", []string{"btcusd.trades", "order"}, 0, "a"))
+		require.NoError(t, err)
+		assert.Equal(t, Request{Method: "subscribe", Streams: []string{"btcusd.trades", "order"}, Session: "a"}, req)
+	})
+
+	t.Run("ack", func(t *testing.T) {
+		req, err := ParseProtoRequest(EncodeProtoRequest("ack", nil, 42, ""))
+		require.NoError(t, err)
+		assert.Equal(t, Request{Method: "ack", ID: 42}, req)
+	})
+
+	t.Run("resync", func(t *testing.T) {
+		req, err := ParseProtoRequest(EncodeProtoRequest("resync", []string{"btcusd.ob-inc"}, 0, ""))
+		require.NoError(t, err)
+		assert.Equal(t, Request{Method: "resync", Streams: []string{"btcusd.ob-inc"}}, req)
+	})
+
+	t.Run("skips unknown fields", func(t *testing.T) {
+		b := append([]byte{0x78, 0x01}, EncodeProtoRequest("whoami", nil, 0, "")...)
+		req, err := ParseProtoRequest(b)
+		require.NoError(t, err)
+		assert.Equal(t, "whoami", req.Method)
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		_, err := ParseProtoRequest(EncodeProtoRequest("publish", nil, 0, ""))
+		assert.EqualError(t, err, "Could not parse Type: Invalid event")
+
+		_, err = ParseProtoRequest(EncodeProtoRequest("resync", nil, 0, ""))
+		assert.Error(t, err)
+
+		_, err = ParseProtoRequest([]byte{0x0a, 10, 's'})
+		assert.Error(t, err)
+	})
+}
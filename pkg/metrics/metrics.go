@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -8,8 +10,20 @@ import (
 var defaultMetrics *Metrics
 
 type Metrics struct {
-	clients prometheus.Gauge
-	subs    *prometheus.GaugeVec
+	clients     prometheus.Gauge
+	subs        *prometheus.GaugeVec
+	writeErrors *prometheus.CounterVec
+	oversized   *prometheus.CounterVec
+	duplicates  *prometheus.CounterVec
+	ingress     *prometheus.CounterVec
+	tags        *prometheus.GaugeVec
+	requests    prometheus.Gauge
+	rtt         prometheus.Histogram
+	pongs       prometheus.Counter
+	lastPong    prometheus.Gauge
+	latency     *prometheus.HistogramVec
+	dropRate    prometheus.Gauge
+	overloaded  prometheus.Gauge
 }
 
 func Enable() {
@@ -32,6 +46,98 @@ func registerMetrics() {
 		},
 		[]string{"type", "topic"},
 	)
+
+	defaultMetrics.writeErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rango_client_write_errors_total",
+			Help: "Number of failed writes to clients by type of frame",
+		},
+		[]string{"type"},
+	)
+
+	defaultMetrics.oversized = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rango_hub_oversized_messages_total",
+			Help: "Number of messages dropped for exceeding the size limit of their category",
+		},
+		[]string{"category"},
+	)
+
+	defaultMetrics.duplicates = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rango_hub_duplicate_messages_total",
+			Help: "Number of messages dropped as duplicates of a recent message",
+		},
+		[]string{"topic"},
+	)
+
+	defaultMetrics.ingress = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rango_hub_ingress_dropped_messages_total",
+			Help: "Number of messages dropped or conflated for exceeding the ingress rate of their stream",
+		},
+		[]string{"topic"},
+	)
+
+	defaultMetrics.tags = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rango_hub_clients_by_tag_count",
+			Help: "Number of clients currently connected by connection tag",
+		},
+		[]string{"tag", "value"},
+	)
+
+	defaultMetrics.rtt = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "rango_client_ping_rtt_seconds",
+			Help:    "Round-trip time between a ping to a client and its pong",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+		},
+	)
+
+	defaultMetrics.pongs = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rango_client_pongs_total",
+			Help: "Number of pongs received from clients",
+		},
+	)
+
+	defaultMetrics.lastPong = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rango_client_last_pong_timestamp_seconds",
+			Help: "Time of the last pong received from a client",
+		},
+	)
+
+	defaultMetrics.latency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "rango_delivery_latency_seconds",
+			Help:    "Time between the ingestion of a message and its write to a client by stream",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		},
+		[]string{"stream"},
+	)
+
+	defaultMetrics.dropRate = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rango_send_drop_ratio",
+			Help: "Ratio of the messages dropped for not fitting in the send buffer of a client during the last window",
+		},
+	)
+
+	defaultMetrics.overloaded = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rango_overloaded",
+			Help: "1 if the drop ratio of the last window exceeds the threshold, 0 otherwise",
+		},
+	)
+
+	defaultMetrics.requests = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rango_requests_queue_depth",
+			Help: "Number of client requests waiting for the hub",
+		},
+	)
 }
 
 func RecordHubClientNew() {
@@ -48,16 +154,110 @@ func RecordHubClientClose() {
 	defaultMetrics.clients.Dec()
 }
 
-func RecordHubSubscription(typ, topic string) {
+// RecordHubSubscriptions sets the number of subscriptions of each topic by
+// type, the topics not given anymore are removed.
+func RecordHubSubscriptions(counts map[string]map[string]int) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.subs.Reset()
+	for typ, topics := range counts {
+		for topic, count := range topics {
+			defaultMetrics.subs.WithLabelValues(typ, topic).Set(float64(count))
+		}
+	}
+}
+
+func RecordClientWriteError(typ string) {
 	if defaultMetrics == nil {
 		return
 	}
-	defaultMetrics.subs.WithLabelValues(typ, topic).Inc()
+	defaultMetrics.writeErrors.WithLabelValues(typ).Inc()
 }
 
-func RecordHubUnsubscription(typ, topic string) {
+func RecordOversizedMessage(category string) {
 	if defaultMetrics == nil {
 		return
 	}
-	defaultMetrics.subs.WithLabelValues(typ, topic).Dec()
+	defaultMetrics.oversized.WithLabelValues(category).Inc()
+}
+
+func RecordDuplicateMessage(topic string) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.duplicates.WithLabelValues(topic).Inc()
+}
+
+func RecordIngressDrop(topic string) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.ingress.WithLabelValues(topic).Inc()
+}
+
+// ForgetStream deletes the per-stream series of a stream which lost its own
+// label, its next messages are counted as other.
+func ForgetStream(stream string) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.latency.DeleteLabelValues(stream)
+	defaultMetrics.duplicates.DeleteLabelValues(stream)
+	defaultMetrics.ingress.DeleteLabelValues(stream)
+}
+
+func RecordClientTag(tag, value string) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.tags.WithLabelValues(tag, value).Inc()
+}
+
+func ReleaseClientTag(tag, value string) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.tags.WithLabelValues(tag, value).Dec()
+}
+
+func RecordRequestsQueueDepth(depth int) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.requests.Set(float64(depth))
+}
+
+func RecordPingRTT(rtt time.Duration) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.rtt.Observe(rtt.Seconds())
+}
+
+func RecordPong(at time.Time) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.pongs.Inc()
+	defaultMetrics.lastPong.Set(float64(at.UnixNano()) / float64(time.Second))
+}
+
+func RecordDeliveryLatency(stream string, latency time.Duration) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.latency.WithLabelValues(stream).Observe(latency.Seconds())
+}
+
+func RecordDropRate(rate float64, overloaded bool) {
+	if defaultMetrics == nil {
+		return
+	}
+	defaultMetrics.dropRate.Set(rate)
+	if overloaded {
+		defaultMetrics.overloaded.Set(1)
+	} else {
+		defaultMetrics.overloaded.Set(0)
+	}
 }
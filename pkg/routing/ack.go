@@ -0,0 +1,139 @@
+package routing
+
+import (
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of unacknowledged messages kept per resume identity.
+var maxUnackedMessages = 1000
+
+// unackedMessage is a message of an acknowledged stream waiting for the
+// client to confirm its delivery.
+type unackedMessage struct {
+	id     uint64
+	stream string
+	body   string
+	sentAt time.Time
+}
+
+// resumeIdentity returns the key identifying a client across reconnections,
+// only authenticated clients can resume.
+func resumeIdentity(uid, resume string) string {
+	if uid == "" || resume == "" {
+		return ""
+	}
+	return uid + ":" + resume
+}
+
+func (h *Hub) isAckStream(stream string) bool {
+	return contains(h.AckStreams, stream)
+}
+
+// broadcastAcked sends a private message with a message ID to each recipient
+// of the topic, see privateRecipients, and keeps it until the client
+// acknowledges it. Clients without a resume identity receive the message
+// without ID.
+func (h *Hub) broadcastAcked(topic *Topic, msg *Event) {
+	now := h.Clock.Now()
+	h.pruneUnacked(now)
+
+	for _, client := range h.privateRecipients(topic) {
+		if !topic.matches(client, msg.Body) {
+			continue
+		}
+		resumeID := client.GetResumeID()
+		if resumeID == "" {
+			body, err := h.encodeEvent(msg.Topic, msg)
+			if err != nil {
+				log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+				return
+			}
+			client.SendStream(msg.Topic, body)
+			continue
+		}
+
+		h.lastMsgID++
+		b, err := h.Envelope.Encode(message.Envelope{Stream: msg.Topic, Data: msg.Body, MsgID: h.lastMsgID, CorrelationID: msg.CorrelationID})
+		if err != nil {
+			log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+			return
+		}
+		body := string(b)
+
+		pending := append(h.unacked[resumeID], unackedMessage{
+			id:     h.lastMsgID,
+			stream: msg.Topic,
+			body:   string(body),
+			sentAt: now,
+		})
+		if len(pending) > maxUnackedMessages {
+			pending = pending[len(pending)-maxUnackedMessages:]
+		}
+		h.unacked[resumeID] = pending
+
+		client.SendStream(msg.Topic, string(body))
+	}
+}
+
+// pruneUnacked drops the messages sent before the acknowledgement window,
+// it runs at most once per window.
+func (h *Hub) pruneUnacked(now time.Time) {
+	if now.Sub(h.lastUnackedPrune) < h.AckWindow {
+		return
+	}
+	h.lastUnackedPrune = now
+
+	for resumeID, pending := range h.unacked {
+		i := 0
+		for i < len(pending) && now.Sub(pending[i].sentAt) > h.AckWindow {
+			i++
+		}
+		if i == len(pending) {
+			delete(h.unacked, resumeID)
+		} else {
+			h.unacked[resumeID] = pending[i:]
+		}
+	}
+}
+
+func (h *Hub) handleAck(req *Request) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	resumeID := req.client.GetResumeID()
+	pending := h.unacked[resumeID]
+	for i, m := range pending {
+		if m.id == req.ID {
+			pending = append(pending[:i], pending[i+1:]...)
+			break
+		}
+	}
+
+	if len(pending) == 0 {
+		delete(h.unacked, resumeID)
+	} else {
+		h.unacked[resumeID] = pending
+	}
+}
+
+// redeliverUnacked sends again to a reconnecting client the messages it did
+// not acknowledge within the acknowledgement window.
+func (h *Hub) redeliverUnacked(client IClient) {
+	resumeID := client.GetResumeID()
+	if resumeID == "" {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.Clock.Now()
+	for _, m := range h.unacked[resumeID] {
+		if now.Sub(m.sentAt) <= h.AckWindow {
+			client.SendStream(m.stream, m.body)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readJSON(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &m), string(data))
+	return m
+}
+
+func TestAckRedelivery(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.AckStreams = []string{"order"}
+	go h.ListenWebsocketEvents()
+
+	header := http.Header{"JwtUID": []string{"UIDABC00001"}}
+	order := func(id int) {
+		h.routeMessage(&Event{
+			Scope:  "private",
+			Stream: "UIDABC00001",
+			Type:   "order",
+			Topic:  "order",
+			Body:   map[string]interface{}{"id": id},
+		})
+	}
+
+	conn, teardown := dial(t, h, "/?stream=order&resume=r1", header)
+	assert.Contains(t, readJSON(t, conn), "success")
+
+	order(1)
+	order(2)
+	first := readJSON(t, conn)
+	assert.Equal(t, map[string]interface{}{"id": 1.0}, first["order"])
+	second := readJSON(t, conn)
+	assert.Equal(t, map[string]interface{}{"id": 2.0}, second["order"])
+
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "ack", "id": first["msg_id"]}))
+	// Requests are handled in order, the ack is processed once subscribed.
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "subscribe", "streams": []string{"trade"}}))
+	assert.Contains(t, readJSON(t, conn), "success")
+	teardown()
+
+	t.Run("redelivers unacked messages on reconnect", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/?stream=order&resume=r1", header)
+		defer teardown()
+
+		assert.Contains(t, readJSON(t, conn), "success")
+		assert.Equal(t, second, readJSON(t, conn))
+
+		// No other message must follow the redelivered one.
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, _, err := conn.ReadMessage()
+		assert.Error(t, err)
+	})
+
+	t.Run("does not redeliver to another resume identity", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/?stream=order&resume=r2", header)
+		defer teardown()
+
+		assert.Contains(t, readJSON(t, conn), "success")
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, _, err := conn.ReadMessage()
+		assert.Error(t, err)
+	})
+
+	t.Run("does not redeliver after the window", func(t *testing.T) {
+		clock.Advance(2 * h.AckWindow)
+
+		conn, teardown := dial(t, h, "/?stream=order&resume=r1", header)
+		defer teardown()
+
+		assert.Contains(t, readJSON(t, conn), "success")
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, _, err := conn.ReadMessage()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"sort"
+	"strings"
+)
+
+// Pseudo public stream receiving periodically the latest ticker of every
+// market from the hub.
+const allTickersStream = "allTickers"
+
+// recordTicker keeps the body of a tickers event as the latest ticker of its
+// market, the hub mutex must be held.
+func (h *Hub) recordTicker(msg *Event) {
+	if h.AllTickersInterval <= 0 {
+		return
+	}
+	h.tickers[msg.Topic] = msg.Body
+	h.touchStream(msg.Topic)
+}
+
+// allTickers returns the latest ticker of each market by market name, like
+// [{"market":"btcusd","ticker":{"last":"9120.0"}}]. The hub mutex must be held.
+func (h *Hub) allTickers() []interface{} {
+	streams := make([]string, 0, len(h.tickers))
+	for stream := range h.tickers {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+
+	tickers := make([]interface{}, 0, len(streams))
+	for _, stream := range streams {
+		tickers = append(tickers, map[string]interface{}{
+			"market": strings.TrimSuffix(stream, ".tickers"),
+			"ticker": h.tickers[stream],
+		})
+	}
+	return tickers
+}
+
+// SendAllTickers broadcasts the latest ticker of every market to the
+// subscribers of the allTickers stream every AllTickersInterval, once a ticker
+// is received.
+func (h *Hub) SendAllTickers() {
+	if h.AllTickersInterval <= 0 {
+		return
+	}
+
+	ticker := h.Clock.NewTicker(h.AllTickersInterval)
+	defer ticker.Stop()
+
+	for range ticker.C() {
+		h.mutex.Lock()
+		if len(h.tickers) > 0 {
+			data := h.allTickers()
+			h.broadcastPublic(allTickersStream, string(h.eventMust(allTickersStream, data)), data)
+		}
+		h.mutex.Unlock()
+	}
+}
@@ -0,0 +1,80 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAllTickers(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.AllTickersInterval = 5 * time.Second
+
+	newClient := func(streams ...string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return("")
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+		return c
+	}
+	subscriber := newClient("allTickers")
+	other := newClient("btcusd.tickers")
+
+	received := func() []string {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+
+		var bodies []string
+		for _, call := range subscriber.Calls {
+			if call.Method == "SendStream" && call.Arguments[0] == "allTickers" {
+				bodies = append(bodies, call.Arguments[1].(string))
+			}
+		}
+		return bodies
+	}
+	ticker := func(market, last string) {
+		h.routeMessage(&Event{Scope: "public", Stream: market, Type: "tickers", Topic: market + ".tickers", Body: map[string]interface{}{"last": last}})
+	}
+
+	go h.SendAllTickers()
+	clock.WaitForWaiters(t, 1)
+
+	t.Run("sends nothing before the first ticker", func(t *testing.T) {
+		clock.Advance(h.AllTickersInterval)
+		time.Sleep(10 * time.Millisecond)
+		assert.Empty(t, received())
+	})
+
+	t.Run("sends the latest ticker of every market at the interval", func(t *testing.T) {
+		ticker("ethusd", "201.5")
+		ticker("btcusd", "9120.0")
+		ticker("btcusd", "9121.0")
+		assert.Empty(t, received())
+
+		clock.Advance(h.AllTickersInterval)
+		waitFor(t, func() bool { return len(received()) == 1 })
+		assert.Equal(t, `{"allTickers":[{"market":"btcusd","ticker":{"last":"9121.0"}},{"market":"ethusd","ticker":{"last":"201.5"}}]}`, received()[0])
+
+		ticker("ethusd", "202.0")
+		clock.Advance(h.AllTickersInterval)
+		waitFor(t, func() bool { return len(received()) == 2 })
+		assert.Equal(t, `{"allTickers":[{"market":"btcusd","ticker":{"last":"9121.0"}},{"market":"ethusd","ticker":{"last":"202.0"}}]}`, received()[1])
+	})
+
+	t.Run("drops the ticker of a retired market", func(t *testing.T) {
+		h.RetireStream("ethusd.tickers")
+		clock.Advance(h.AllTickersInterval)
+		waitFor(t, func() bool { return len(received()) == 3 })
+		assert.Equal(t, `{"allTickers":[{"market":"btcusd","ticker":{"last":"9121.0"}}]}`, received()[2])
+	})
+
+	other.AssertNotCalled(t, "SendStream", "allTickers", mock.Anything)
+}
@@ -0,0 +1,101 @@
+package routing
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// authDecision is a decision of the StreamAuthorizer remembered for the
+// AuthorizationTTL.
+type authDecision struct {
+	allowed bool
+	at      time.Time
+}
+
+// authKey identifies the decisions of the StreamAuthorizer on the subscriptions
+// of a user to a stream, from connections with the same actor and tags.
+type authKey struct {
+	stream string
+	conn   string
+}
+
+// newAuthKey returns the key of the decision on the subscription of the
+// client to the stream. The actor and the tags of the connection are part of
+// it, as the StreamAuthorizer may read them from the connection context.
+func newAuthKey(client IClient, stream string) authKey {
+	c, ok := churnClient(client).(*Client)
+	if !ok {
+		return authKey{stream: stream}
+	}
+
+	fields := make([]string, 0, len(c.tags))
+	for tag, value := range c.tags {
+		fields = append(fields, tag+"="+value)
+	}
+	sort.Strings(fields)
+	return authKey{stream: stream, conn: c.actorUID + "|" + strings.Join(fields, ",")}
+}
+
+// canSubscribe returns the decision of the StreamAuthorizer on the
+// subscription of the user to the private stream. With an AuthorizationTTL
+// the decision is reused during the TTL for the subscriptions of the user to
+// the stream from connections with the same actor and tags, see newAuthKey.
+// The hub mutex must be held.
+func (h *Hub) canSubscribe(client IClient, uid, stream string) bool {
+	if h.AuthorizationTTL <= 0 {
+		return h.StreamAuthorizer.CanSubscribe(clientContext(client), uid, stream)
+	}
+
+	now := h.Clock.Now()
+	if now.Sub(h.authPruned) >= h.AuthorizationTTL {
+		h.pruneAuthDecisions(now)
+	}
+	key := newAuthKey(client, stream)
+	if d, ok := h.authDecisions[uid][key]; ok && now.Sub(d.at) < h.AuthorizationTTL {
+		return d.allowed
+	}
+
+	allowed := h.StreamAuthorizer.CanSubscribe(clientContext(client), uid, stream)
+	decisions, ok := h.authDecisions[uid]
+	if !ok {
+		decisions = make(map[authKey]authDecision)
+		h.authDecisions[uid] = decisions
+	}
+	decisions[key] = authDecision{allowed: allowed, at: now}
+	return allowed
+}
+
+// pruneAuthDecisions forgets the expired decisions, the hub mutex must be
+// held.
+func (h *Hub) pruneAuthDecisions(now time.Time) {
+	h.authPruned = now
+	for uid, decisions := range h.authDecisions {
+		for key, d := range decisions {
+			if now.Sub(d.at) >= h.AuthorizationTTL {
+				delete(decisions, key)
+			}
+		}
+		if len(decisions) == 0 {
+			delete(h.authDecisions, uid)
+		}
+	}
+}
+
+// InvalidateAuthorization forgets the cached decisions of the StreamAuthorizer
+// on the subscriptions of a user, or of all the users if uid is empty, so that
+// the next subscriptions ask it again. Reauthorize invalidates them first.
+func (h *Hub) InvalidateAuthorization(uid string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.invalidateAuthorization(uid)
+}
+
+func (h *Hub) invalidateAuthorization(uid string) {
+	if uid == "" {
+		h.authDecisions = make(map[string]map[authKey]authDecision)
+		return
+	}
+	delete(h.authDecisions, uid)
+}
@@ -0,0 +1,113 @@
+package routing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// countingAuthorizer counts the decisions asked to a StreamAuthorizer.
+type countingAuthorizer struct {
+	StreamAuthorizer
+	calls int
+}
+
+func (a *countingAuthorizer) CanSubscribe(ctx context.Context, uid, stream string) bool {
+	a.calls++
+	return a.StreamAuthorizer.CanSubscribe(ctx, uid, stream)
+}
+
+func TestAuthorizationCache(t *testing.T) {
+	clock := newFakeClock()
+	g := &grants{streams: map[string][]string{"UIDABC00001": {"order"}}}
+	auth := &countingAuthorizer{StreamAuthorizer: g}
+	h := NewHub()
+	h.Clock = clock
+	h.StreamAuthorizer = auth
+	h.AuthorizationTTL = time.Minute
+
+	subscribe := func(stream string) bool {
+		subscribed := false
+		c := &MockedClient{}
+		c.On("GetUID").Return("UIDABC00001")
+		c.On("GetSubscriptions").Return([]string{})
+		c.On("SubscribePrivate", mock.Anything).Run(func(mock.Arguments) { subscribed = true }).Return()
+		c.On("UnsubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{stream}}})
+		h.unsubscribeAll(c)
+		return subscribed
+	}
+
+	t.Run("reuses an allow within the TTL", func(t *testing.T) {
+		assert.True(t, subscribe("order"))
+		g.set("UIDABC00001")
+		assert.True(t, subscribe("order"))
+		assert.Equal(t, 1, auth.calls)
+	})
+
+	t.Run("reuses a deny within the TTL", func(t *testing.T) {
+		assert.False(t, subscribe("trade"))
+		g.set("UIDABC00001", "trade")
+		assert.False(t, subscribe("trade"))
+		assert.Equal(t, 2, auth.calls)
+	})
+
+	t.Run("asks again after the TTL", func(t *testing.T) {
+		clock.Advance(time.Minute)
+		assert.True(t, subscribe("trade"))
+		assert.False(t, subscribe("order"))
+		assert.Equal(t, 4, auth.calls)
+		assert.Len(t, h.authDecisions["UIDABC00001"], 2)
+	})
+
+	t.Run("asks again once invalidated", func(t *testing.T) {
+		g.set("UIDABC00001", "order")
+		h.InvalidateAuthorization("UIDABC00001")
+		assert.True(t, subscribe("order"))
+		assert.Equal(t, 5, auth.calls)
+
+		g.set("UIDABC00001")
+		h.Reauthorize("UIDABC00001")
+		assert.False(t, subscribe("order"))
+		assert.Equal(t, 6, auth.calls)
+	})
+
+	t.Run("forgets the expired decisions", func(t *testing.T) {
+		clock.Advance(time.Minute)
+		subscribe("order")
+		assert.Equal(t, map[string]map[authKey]authDecision{
+			"UIDABC00001": {{stream: "order"}: {allowed: false, at: clock.Now()}},
+		}, h.authDecisions)
+	})
+}
+
+func TestAuthorizationCacheConnections(t *testing.T) {
+	auth := &countingAuthorizer{StreamAuthorizer: &regionAuthorizer{region: "eu", ctx: make(chan context.Context, 10)}}
+	h := NewHub()
+	h.StreamAuthorizer = auth
+	h.AuthorizationTTL = time.Minute
+
+	subscribe := func(region string) bool {
+		c := &Client{
+			hub:     h,
+			send:    make(chan outbound, maxBufferedMessages),
+			UID:     "UIDABC00001",
+			pubSub:  []string{},
+			privSub: []string{},
+			tags:    map[string]string{"region": region},
+		}
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"order"}}})
+		return contains(c.GetSubscriptions(), "order")
+	}
+
+	assert.True(t, subscribe("eu"))
+	assert.False(t, subscribe("us"))
+	assert.True(t, subscribe("eu"))
+	assert.False(t, subscribe("us"))
+	assert.Equal(t, 2, auth.calls)
+}
@@ -0,0 +1,55 @@
+package routing
+
+import (
+	"bytes"
+
+	"github.com/gorilla/websocket"
+)
+
+// compressUpgrader negotiates the compression of the frames with the clients
+// in batch mode or when the hub has a CompressionThreshold.
+var compressUpgrader = websocket.Upgrader{
+	ReadBufferSize:    1024,
+	WriteBufferSize:   1024,
+	EnableCompression: true,
+	Subprotocols:      subprotocols,
+}
+
+// wantsBatch returns true if the client asked for batch mode with the batch
+// query parameter and the hub allows it.
+func (h *Hub) wantsBatch(query string) bool {
+	return h.BatchWindow > 0 && query == "true"
+}
+
+// flushBatch writes the accumulated messages of a client in batch mode. At
+// least BatchMinSize messages are written as a single compressed frame, one
+// message per line, fewer are written uncompressed one by one.
+func (c *Client) flushBatch() error {
+	batch := c.batch
+	c.batch = nil
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if len(batch) < c.hub.BatchMinSize {
+		for _, message := range batch {
+			if err := c.writeFrame(message.data, c.compresses(message.topic, message.data)); err != nil {
+				return err
+			}
+			c.recordLatency(message)
+		}
+		return nil
+	}
+
+	lines := make([][]byte, len(batch))
+	for i, message := range batch {
+		lines[i] = message.data
+	}
+	if err := c.writeFrame(bytes.Join(lines, newline), true); err != nil {
+		return err
+	}
+	for _, message := range batch {
+		c.recordLatency(message)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package routing
+
+// Message is a message of a broadcast batch, routed like a message of the
+// source with a routing key like public.eurusd.trades.
+type Message struct {
+	RoutingKey string
+	Body       interface{}
+}
+
+// BroadcastBatch delivers the messages in order, each client receives the
+// messages of the batch it is subscribed to without other messages of the hub
+// in between. Nothing is delivered if a routing key is invalid.
+func (h *Hub) BroadcastBatch(messages []Message) error {
+	at := h.Clock.Now()
+	events := make([]*Event, len(messages))
+	for i, m := range messages {
+		ev, err := newEvent(m.RoutingKey, m.Body)
+		if err != nil {
+			return err
+		}
+		ev.At = at
+		events[i] = ev
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, ev := range events {
+		h.route(ev)
+	}
+	return nil
+}
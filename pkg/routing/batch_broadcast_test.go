@@ -0,0 +1,87 @@
+package routing
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcastBatch(t *testing.T) {
+	h := NewHub()
+	streams := []string{"eurusd.trades", "eurusd.tickers"}
+
+	c := &MockedClient{}
+	c.On("GetUID").Return("")
+	c.On("GetSubscriptions").Return(streams)
+	c.On("SubscribePublic", mock.Anything).Return()
+	c.On("Send", mock.Anything).Return()
+	c.On("SendStream", mock.Anything, mock.Anything).Return()
+	h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+
+	t.Run("delivers each batch contiguously in order", func(t *testing.T) {
+		const batches = 50
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				h.routeMessage(&Event{
+					Scope:  "public",
+					Stream: "eurusd",
+					Type:   "trades",
+					Topic:  "eurusd.trades",
+					Body:   "noise",
+				})
+			}
+		}()
+
+		for i := 0; i < batches; i++ {
+			require.NoError(t, h.BroadcastBatch([]Message{
+				{RoutingKey: "public.eurusd.trades", Body: fmt.Sprintf("%d-0", i)},
+				{RoutingKey: "public.eurusd.tickers", Body: fmt.Sprintf("%d-1", i)},
+				{RoutingKey: "public.eurusd.trades", Body: fmt.Sprintf("%d-2", i)},
+			}))
+		}
+		wg.Wait()
+
+		sent := []string{}
+		for _, call := range c.Calls {
+			if call.Method == "SendStream" {
+				sent = append(sent, call.Arguments.String(1))
+			}
+		}
+		for i := 0; i < batches; i++ {
+			first := fmt.Sprintf(`{"eurusd.trades":"%d-0"}`, i)
+			j := indexOf(sent, first)
+			require.True(t, j >= 0 && j+2 < len(sent), "batch %d not delivered", i)
+			assert.Equal(t, []string{
+				first,
+				fmt.Sprintf(`{"eurusd.tickers":"%d-1"}`, i),
+				fmt.Sprintf(`{"eurusd.trades":"%d-2"}`, i),
+			}, sent[j:j+3])
+		}
+	})
+
+	t.Run("delivers nothing if a routing key is invalid", func(t *testing.T) {
+		err := h.BroadcastBatch([]Message{
+			{RoutingKey: "public.eurusd.trades", Body: "valid"},
+			{RoutingKey: "invalid", Body: "invalid"},
+		})
+		assert.Error(t, err)
+		c.AssertNotCalled(t, "SendStream", "eurusd.trades", `{"eurusd.trades":"valid"}`)
+	})
+}
+
+func indexOf(list []string, el string) int {
+	for i, l := range list {
+		if l == el {
+			return i
+		}
+	}
+	return -1
+}
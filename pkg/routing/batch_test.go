@@ -0,0 +1,111 @@
+package routing
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingConn counts the bytes read from the wire.
+type countingConn struct {
+	net.Conn
+	read int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+// receiveTrades connects with a compression capable client, publishes
+// repetitive trades and returns the received messages with the bytes read.
+func receiveTrades(t testing.TB, h *Hub, path string, count int) ([]string, int64) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+	defer srv.Close()
+
+	var counted *countingConn
+	dialer := websocket.Dialer{
+		EnableCompression: true,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			counted = &countingConn{Conn: conn}
+			return counted, err
+		},
+	}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	require.NoError(t, err)
+	start := atomic.LoadInt64(&counted.read)
+
+	for i := 0; i < count; i++ {
+		h.routeMessage(&Event{
+			Scope:  "public",
+			Stream: "eurusd",
+			Type:   "trades",
+			Topic:  "eurusd.trades",
+			Body:   map[string]interface{}{"price": "1.1", "amount": "100.0", "side": "buy", "id": i},
+		})
+	}
+
+	messages := []string{}
+	for len(messages) < count {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		messages = append(messages, strings.Split(string(data), "\n")...)
+	}
+	return messages, atomic.LoadInt64(&counted.read) - start
+}
+
+func TestBatchMode(t *testing.T) {
+	h := NewHub()
+	h.BatchWindow = 20 * time.Millisecond
+	h.BatchMinSize = 10
+	go h.ListenWebsocketEvents()
+
+	expected := make([]string, 100)
+	for i := range expected {
+		expected[i] = fmt.Sprintf(`{"eurusd.trades":{"amount":"100.0","id":%d,"price":"1.1","side":"buy"}}`, i)
+	}
+
+	plain, plainBytes := receiveTrades(t, h, "/?stream=eurusd.trades", 100)
+	batched, batchedBytes := receiveTrades(t, h, "/?stream=eurusd.trades&batch=true", 100)
+
+	assert.Equal(t, expected, plain)
+	assert.Equal(t, expected, batched)
+	assert.True(t, batchedBytes*4 < plainBytes, "batched %d bytes, plain %d bytes", batchedBytes, plainBytes)
+}
+
+func BenchmarkBatchMode(b *testing.B) {
+	h := NewHub()
+	h.BatchWindow = 20 * time.Millisecond
+	h.BatchMinSize = 10
+	go h.ListenWebsocketEvents()
+
+	for _, path := range []string{"/?stream=eurusd.trades", "/?stream=eurusd.trades&batch=true"} {
+		b.Run(path, func(b *testing.B) {
+			var total int64
+			for i := 0; i < b.N; i++ {
+				_, n := receiveTrades(b, h, path, 100)
+				total += n
+			}
+			b.ReportMetric(float64(total)/float64(b.N), "wire-bytes/op")
+		})
+	}
+}
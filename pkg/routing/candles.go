@@ -0,0 +1,132 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// candle is the OHLCV state of a market during one interval.
+type candle struct {
+	start  int64
+	open   float64
+	high   float64
+	low    float64
+	close  float64
+	volume float64
+}
+
+// trade is the part of a trade used to build candles.
+type trade struct {
+	date   int64
+	price  float64
+	amount float64
+}
+
+// candleStream returns the public stream of the candles of a market, like
+// btcusd.kline-5m.
+func candleStream(market string, interval time.Duration) string {
+	var label string
+	switch {
+	case interval%(24*time.Hour) == 0:
+		label = fmt.Sprintf("%dd", interval/(24*time.Hour))
+	case interval%time.Hour == 0:
+		label = fmt.Sprintf("%dh", interval/time.Hour)
+	case interval%time.Minute == 0:
+		label = fmt.Sprintf("%dm", interval/time.Minute)
+	default:
+		label = fmt.Sprintf("%ds", interval/time.Second)
+	}
+	return market + ".kline-" + label
+}
+
+// aggregateTrades updates the candles of the market of a trades event and
+// broadcasts them as [start, open, high, low, close, volume]. Trades older than
+// the current candle are ignored. The hub mutex must be held.
+func (h *Hub) aggregateTrades(msg *Event) {
+	if len(h.CandleIntervals) == 0 {
+		return
+	}
+
+	for _, t := range parseTrades(msg.Body) {
+		for _, interval := range h.CandleIntervals {
+			stream := candleStream(msg.Stream, interval)
+			start := t.date - t.date%int64(interval/time.Second)
+
+			c, ok := h.candles[stream]
+			if ok && start < c.start {
+				continue
+			}
+			if !ok || start > c.start {
+				c = &candle{start: start, open: t.price, high: t.price, low: t.price}
+				h.candles[stream] = c
+			}
+
+			if t.price > c.high {
+				c.high = t.price
+			}
+			if t.price < c.low {
+				c.low = t.price
+			}
+			c.close = t.price
+			c.volume += t.amount
+			h.touchStream(stream)
+
+			data := []interface{}{c.start, c.open, c.high, c.low, c.close, c.volume}
+			body, err := h.encode(stream, data)
+			if err != nil {
+				log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+				return
+			}
+			h.broadcastPublic(stream, body, data)
+		}
+	}
+}
+
+// parseTrades returns the valid trades of a trades event body, like
+// {"trades":[{"price":"9120.0","amount":"0.01","date":1588000000}]}.
+func parseTrades(body interface{}) []trade {
+	m, ok := body.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	list, ok := m["trades"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	trades := make([]trade, 0, len(list))
+	for _, item := range list {
+		t, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		date, ok1 := toFloat(t["date"])
+		price, ok2 := toFloat(t["price"])
+		amount, ok3 := toFloat(t["amount"])
+		if !ok1 || !ok2 || !ok3 {
+			log.Warn().Msgf("Ignoring invalid trade: %v", t)
+			continue
+		}
+		trades = append(trades, trade{date: int64(date), price: price, amount: amount})
+	}
+	return trades
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
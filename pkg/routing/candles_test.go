@@ -0,0 +1,85 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCandleStream(t *testing.T) {
+	assert.Equal(t, "btcusd.kline-1m", candleStream("btcusd", time.Minute))
+	assert.Equal(t, "btcusd.kline-5m", candleStream("btcusd", 5*time.Minute))
+	assert.Equal(t, "btcusd.kline-4h", candleStream("btcusd", 4*time.Hour))
+	assert.Equal(t, "btcusd.kline-1d", candleStream("btcusd", 24*time.Hour))
+	assert.Equal(t, "btcusd.kline-30s", candleStream("btcusd", 30*time.Second))
+}
+
+func TestCandles(t *testing.T) {
+	h := NewHub()
+	h.CandleIntervals = []time.Duration{time.Minute, 5 * time.Minute}
+
+	c := &MockedClient{}
+	c.On("GetUID").Return("")
+	c.On("GetSubscriptions").Return([]string{"btcusd.kline-1m", "btcusd.kline-5m"})
+	c.On("SubscribePublic", mock.Anything).Return()
+	c.On("Send", mock.Anything).Return()
+	c.On("SendStream", mock.Anything, mock.Anything).Return()
+	h.handleSubscribe(&Request{
+		client:  c,
+		Request: message.Request{Streams: []string{"btcusd.kline-1m", "btcusd.kline-5m"}},
+	})
+
+	trades := func(market string, trades ...map[string]interface{}) {
+		list := make([]interface{}, len(trades))
+		for i, t := range trades {
+			list[i] = t
+		}
+		h.routeMessage(&Event{
+			Scope:  "public",
+			Stream: market,
+			Type:   "trades",
+			Topic:  market + ".trades",
+			Body:   map[string]interface{}{"trades": list},
+		})
+	}
+	tr := func(date int, price, amount string) map[string]interface{} {
+		return map[string]interface{}{"date": float64(date), "price": price, "amount": amount}
+	}
+
+	t.Run("opens a candle with the first trade", func(t *testing.T) {
+		trades("btcusd", tr(1588000020, "100", "1"))
+		c.AssertCalled(t, "SendStream", "btcusd.kline-1m", `{"btcusd.kline-1m":[1588000020,100,100,100,100,1]}`)
+		c.AssertCalled(t, "SendStream", "btcusd.kline-5m", `{"btcusd.kline-5m":[1587999900,100,100,100,100,1]}`)
+	})
+
+	t.Run("updates the candle with the following trades", func(t *testing.T) {
+		trades("btcusd", tr(1588000030, "120", "0.5"), tr(1588000040, "90", "2"))
+		c.AssertCalled(t, "SendStream", "btcusd.kline-1m", `{"btcusd.kline-1m":[1588000020,100,120,100,120,1.5]}`)
+		c.AssertCalled(t, "SendStream", "btcusd.kline-1m", `{"btcusd.kline-1m":[1588000020,100,120,90,90,3.5]}`)
+		c.AssertCalled(t, "SendStream", "btcusd.kline-5m", `{"btcusd.kline-5m":[1587999900,100,120,90,90,3.5]}`)
+	})
+
+	t.Run("opens a new candle on the next interval", func(t *testing.T) {
+		trades("btcusd", tr(1588000080, "95", "1"))
+		c.AssertCalled(t, "SendStream", "btcusd.kline-1m", `{"btcusd.kline-1m":[1588000080,95,95,95,95,1]}`)
+		c.AssertCalled(t, "SendStream", "btcusd.kline-5m", `{"btcusd.kline-5m":[1587999900,100,120,90,95,4.5]}`)
+	})
+
+	t.Run("ignores trades older than the current candle", func(t *testing.T) {
+		trades("btcusd", tr(1588000030, "1000", "1"))
+		c.AssertNotCalled(t, "SendStream", "btcusd.kline-1m", mock.MatchedBy(func(m string) bool {
+			return strings.Contains(m, "1000")
+		}))
+	})
+
+	t.Run("keeps the candles of each market", func(t *testing.T) {
+		trades("ethusd", tr(1588000090, "10", "3"))
+		c.AssertNotCalled(t, "SendStream", "ethusd.kline-1m", mock.Anything)
+		assert.Equal(t, &candle{start: 1588000080, open: 10, high: 10, low: 10, close: 10, volume: 3}, h.candles["ethusd.kline-1m"])
+		assert.Equal(t, 95.0, h.candles["btcusd.kline-1m"].close)
+	})
+}
@@ -0,0 +1,27 @@
+package routing
+
+import (
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+)
+
+// sendCaughtUp tells a new subscriber of a public stream that the replayed
+// messages and the snapshot of the stream were sent, the next messages are
+// live, like {"event":"caught_up","stream":"btcusd.ob-inc"}. The hub mutex
+// must be held, so that no live message comes before.
+func (h *Hub) sendCaughtUp(client IClient, stream string) {
+	if !h.CaughtUp {
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"event":  "caught_up",
+		"stream": stream,
+	})
+	if err != nil {
+		log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+		return
+	}
+	client.SendStream(stream, string(b))
+}
@@ -0,0 +1,82 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaughtUp(t *testing.T) {
+	h := NewHub()
+	h.CaughtUp = true
+	h.ReplaySize = 2
+	route := func(typ, topic string, body interface{}) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: typ, Topic: topic, Body: body})
+	}
+	route("trades", "btcusd.trades", 1.0)
+	route("ob-snap", "btcusd.ob-inc", "snapshot")
+	route("ob-inc", "btcusd.ob-inc", "increment")
+
+	c := &Client{
+		hub:      h,
+		send:     make(chan outbound, maxBufferedMessages),
+		priority: make(chan outbound, maxBufferedMessages),
+		pubSub:   []string{},
+		privSub:  []string{},
+	}
+	received := func() []string {
+		var messages []string
+		for len(c.send) > 0 {
+			messages = append(messages, string((<-c.send).data))
+		}
+		return messages
+	}
+	subscribe := func(t *testing.T, req string) []string {
+		parsed, err := message.ParseRequest([]byte(req))
+		require.NoError(t, err)
+		h.handleRequest(&Request{client: c, Request: parsed})
+		return received()
+	}
+
+	t.Run("follows the snapshot and its increments", func(t *testing.T) {
+		messages := subscribe(t, `{"event":"subscribe","streams":["btcusd.ob-inc"]}`)
+		require.Len(t, messages, 4)
+		assert.Equal(t, []string{
+			`{"btcusd.ob-snap":"snapshot"}`,
+			`{"btcusd.ob-inc":"increment"}`,
+			`{"event":"caught_up","stream":"btcusd.ob-inc"}`,
+		}, messages[:3])
+		assert.Contains(t, messages[3], "subscribed")
+	})
+
+	t.Run("follows the replayed messages", func(t *testing.T) {
+		messages := subscribe(t, `{"event":"subscribe","streams":[{"stream":"btcusd.trades","last":2}]}`)
+		require.Len(t, messages, 3)
+		assert.Equal(t, []string{
+			`{"btcusd.trades":1}`,
+			`{"event":"caught_up","stream":"btcusd.trades"}`,
+		}, messages[:2])
+	})
+
+	t.Run("is sent once before the live messages", func(t *testing.T) {
+		route("ob-inc", "btcusd.ob-inc", "live")
+		route("trades", "btcusd.trades", 2.0)
+		assert.Equal(t, []string{`{"btcusd.ob-inc":"live"}`, `{"btcusd.trades":2}`}, received())
+	})
+
+	t.Run("is not sent for private streams", func(t *testing.T) {
+		c.UID = "UIDABC00001"
+		messages := subscribe(t, `{"event":"subscribe","streams":["order"]}`)
+		require.Len(t, messages, 1)
+		assert.Contains(t, messages[0], "subscribed")
+	})
+
+	t.Run("is not sent by default", func(t *testing.T) {
+		h.CaughtUp = false
+		messages := subscribe(t, `{"event":"subscribe","streams":["btcusd.ob-inc"]}`)
+		assert.Equal(t, []string{`{"btcusd.ob-snap":"snapshot"}`, `{"btcusd.ob-inc":"increment"}`, `{"btcusd.ob-inc":"live"}`}, messages[:3])
+		assert.Len(t, messages, 4)
+	})
+}
@@ -0,0 +1,85 @@
+package routing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// ClientAuthTLSConfig returns a TLS server config verifying the client
+// certificates given by the clients against the CA certificates of a PEM file.
+// Clients without certificate are still accepted.
+func ClientAuthTLSConfig(caFile string) (*tls.Config, error) {
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no CA certificate found")
+	}
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}, nil
+}
+
+// peerCertificate returns the verified TLS client certificate of a request,
+// nil if the request has none.
+func peerCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// Fields of a client certificate, see certificateField.
+var certificateFields = []string{"cn", "o", "ou", "dns", "email"}
+
+// certificateField returns a field of a client certificate: cn for the common
+// name, o and ou for the first organization and organizational unit, dns and
+// email for the first DNS and email subject alternative names.
+func certificateField(cert *x509.Certificate, field string) string {
+	first := func(values []string) string {
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	}
+
+	switch field {
+	case "cn":
+		return cert.Subject.CommonName
+	case "o":
+		return first(cert.Subject.Organization)
+	case "ou":
+		return first(cert.Subject.OrganizationalUnit)
+	case "dns":
+		return first(cert.DNSNames)
+	case "email":
+		return first(cert.EmailAddresses)
+	default:
+		return ""
+	}
+}
+
+// certificateUID returns the UID of a request from the CertUIDField of its
+// verified client certificate, empty if none.
+func (h *Hub) certificateUID(r *http.Request) string {
+	if h.CertUIDField == "" {
+		return ""
+	}
+	cert := peerCertificate(r)
+	if cert == nil {
+		return ""
+	}
+	return certificateField(cert, h.CertUIDField)
+}
+
+// ValidCertificateField returns true if the field of client certificates is
+// known, see certificateField.
+func ValidCertificateField(field string) bool {
+	return contains(certificateFields, field)
+}
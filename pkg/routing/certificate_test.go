@@ -0,0 +1,99 @@
+package routing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCertificate returns a certificate of the subject signed by the parent, it
+// is self-signed if parent is nil.
+func newCertificate(t *testing.T, subject pkix.Name, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		EmailAddresses:        []string{"service@example.com"},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	h := NewHub()
+	h.CertUIDField = "cn"
+	h.CertTags = map[string]string{"service": "ou", "contact": "email"}
+	go h.ListenWebsocketEvents()
+
+	ca := newCertificate(t, pkix.Name{CommonName: "Rango test CA"}, nil)
+	client := newCertificate(t, pkix.Name{CommonName: "UIDABC00001", OrganizationalUnit: []string{"market-maker"}}, &ca)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Leaf)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+	srv.TLS = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+	srv.StartTLS()
+	defer srv.Close()
+
+	whoami := func(t *testing.T, certs []tls.Certificate) map[string]interface{} {
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.Certificate())
+		dialer := websocket.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}
+
+		conn, _, err := dialer.Dial("wss"+strings.TrimPrefix(srv.URL, "https"), nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Contains(t, readJSON(t, conn), "success")
+
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "whoami"}))
+		return readJSON(t, conn)
+	}
+
+	t.Run("takes the UID and tags from the client certificate", func(t *testing.T) {
+		res := whoami(t, []tls.Certificate{client})
+		assert.Equal(t, "UIDABC00001", res["uid"])
+		assert.Equal(t, map[string]interface{}{"service": "market-maker", "contact": "service@example.com"}, res["tags"])
+	})
+
+	t.Run("connections without certificate stay anonymous", func(t *testing.T) {
+		res := whoami(t, nil)
+		assert.Equal(t, "", res["uid"])
+		assert.Nil(t, res["tags"])
+	})
+
+	t.Run("ignores certificates of other authorities", func(t *testing.T) {
+		other := newCertificate(t, pkix.Name{CommonName: "UIDABC00002"}, nil)
+		assert.Equal(t, "", whoami(t, []tls.Certificate{other})["uid"])
+	})
+}
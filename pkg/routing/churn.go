@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// churnWindow counts the subscription changes of a connection during one
+// second.
+type churnWindow struct {
+	start time.Time
+	count int
+}
+
+// allowChurn returns true if the client may change its subscriptions, it
+// replies with a rate limit error otherwise. Only the subscription requests
+// count, the initial streams of a connection do not.
+func (h *Hub) allowChurn(req *Request) bool {
+	rate := h.subscribeRate()
+	if rate <= 0 {
+		return true
+	}
+
+	now := h.Clock.Now()
+	client := churnClient(req.client)
+	w, ok := h.churn[client]
+	if !ok || now.Sub(w.start) >= time.Second {
+		w = &churnWindow{start: now}
+		h.churn[client] = w
+	}
+
+	if w.count >= rate {
+		log.Warn().Msgf("Subscription rate limit exceeded (%s)", req.client.GetUID())
+		req.client.Send(responseMust(errors.New("subscription rate limit exceeded"), nil))
+		return false
+	}
+	w.count++
+	return true
+}
+
+// churnClient returns the client whose rate applies to a client, the sessions
+// of a connection share its rate.
+func churnClient(client IClient) IClient {
+	if s, ok := client.(*session); ok {
+		return s.client
+	}
+	return client
+}
+
+// handleLimits replies with the subscription rate budget of the client, like
+// {"event":"limits","limit":4,"messages_remaining":3,"reset_at":1588000000500}.
+// reset_at is the time in milliseconds the budget is restored, it is omitted
+// while the budget is full. The request does not consume the budget.
+func (h *Hub) handleLimits(req *Request) {
+	rate := h.subscribeRate()
+	status := map[string]interface{}{
+		"event": "limits",
+		"limit": rate,
+	}
+	if rate > 0 {
+		remaining := rate
+		if w, ok := h.churn[churnClient(req.client)]; ok && h.Clock.Now().Sub(w.start) < time.Second {
+			remaining -= w.count
+			status["reset_at"] = w.start.Add(time.Second).UnixNano() / int64(time.Millisecond)
+		}
+		status["messages_remaining"] = remaining
+	}
+
+	b, err := json.Marshal(status)
+	if err != nil {
+		log.Error().Msgf("Limits status encoding failed: %s", err.Error())
+		return
+	}
+	req.client.Send(string(b))
+}
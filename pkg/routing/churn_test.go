@@ -0,0 +1,133 @@
+package routing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMaxSubscribeRate(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.MaxSubscribeRate = 4
+
+	newClient := func() *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return("")
+		c.On("GetSubscriptions").Return([]string{})
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("UnsubscribePublic", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		return c
+	}
+	request := func(c IClient, method string) {
+		h.handleRequest(&Request{
+			client:  c,
+			Request: message.Request{Method: method, Streams: []string{"eurusd.trades"}},
+		})
+	}
+	cycle := func(c IClient, n int) {
+		for i := 0; i < n; i++ {
+			request(c, "subscribe")
+			request(c, "unsubscribe")
+		}
+	}
+	rejected := `{"error":"subscription rate limit exceeded"}`
+
+	t.Run("throttles requests beyond the rate", func(t *testing.T) {
+		c := newClient()
+		cycle(c, 5)
+
+		c.AssertNumberOfCalls(t, "SubscribePublic", 2)
+		c.AssertNumberOfCalls(t, "UnsubscribePublic", 2)
+		c.AssertCalled(t, "Send", rejected)
+		assert.Equal(t, 0, len(h.PublicTopics))
+	})
+
+	t.Run("allows requests again the next second", func(t *testing.T) {
+		c := newClient()
+		cycle(c, 3)
+		clock.Advance(time.Second)
+		cycle(c, 2)
+
+		c.AssertNumberOfCalls(t, "SubscribePublic", 4)
+		c.AssertNumberOfCalls(t, "UnsubscribePublic", 4)
+	})
+
+	t.Run("counts the requests of each client", func(t *testing.T) {
+		c1, c2 := newClient(), newClient()
+		cycle(c1, 2)
+		cycle(c2, 2)
+
+		c1.AssertNotCalled(t, "Send", rejected)
+		c2.AssertNotCalled(t, "Send", rejected)
+	})
+
+	t.Run("does not limit without rate", func(t *testing.T) {
+		h.MaxSubscribeRate = 0
+		defer func() { h.MaxSubscribeRate = 4 }()
+
+		c := newClient()
+		cycle(c, 10)
+		c.AssertNumberOfCalls(t, "SubscribePublic", 10)
+		c.AssertNotCalled(t, "Send", rejected)
+	})
+}
+
+func TestLimitsStatus(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.MaxSubscribeRate = 3
+
+	c := &MockedClient{}
+	c.On("GetUID").Return("")
+	c.On("GetSubscriptions").Return([]string{})
+	c.On("SubscribePublic", mock.Anything).Return()
+	c.On("Send", mock.Anything).Return()
+
+	limits := func(t *testing.T) string {
+		h.handleRequest(&Request{client: c, Request: message.Request{Method: "limits"}})
+		return c.Calls[len(c.Calls)-1].Arguments.String(0)
+	}
+	subscribe := func() {
+		h.handleRequest(&Request{client: c, Request: message.Request{Method: "subscribe", Streams: []string{"eurusd.trades"}}})
+	}
+	start := clock.Now()
+	resetAt := start.Add(time.Second).UnixNano() / int64(time.Millisecond)
+
+	t.Run("reports a full budget before any request", func(t *testing.T) {
+		assert.JSONEq(t, `{"event":"limits","limit":3,"messages_remaining":3}`, limits(t))
+	})
+
+	t.Run("reflects the consumed budget", func(t *testing.T) {
+		subscribe()
+		subscribe()
+		assert.JSONEq(t, fmt.Sprintf(`{"event":"limits","limit":3,"messages_remaining":1,"reset_at":%d}`, resetAt), limits(t))
+
+		subscribe()
+		subscribe()
+		assert.JSONEq(t, fmt.Sprintf(`{"event":"limits","limit":3,"messages_remaining":0,"reset_at":%d}`, resetAt), limits(t))
+	})
+
+	t.Run("is restored after the window", func(t *testing.T) {
+		clock.Advance(time.Second)
+		assert.JSONEq(t, `{"event":"limits","limit":3,"messages_remaining":3}`, limits(t))
+	})
+
+	t.Run("starts a new window with the next request", func(t *testing.T) {
+		subscribe()
+		resetAt := clock.Now().Add(time.Second).UnixNano() / int64(time.Millisecond)
+		assert.JSONEq(t, fmt.Sprintf(`{"event":"limits","limit":3,"messages_remaining":2,"reset_at":%d}`, resetAt), limits(t))
+	})
+
+	t.Run("reports no limit without rate", func(t *testing.T) {
+		h.MaxSubscribeRate = 0
+		assert.JSONEq(t, `{"event":"limits","limit":0}`, limits(t))
+	})
+}
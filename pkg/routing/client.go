@@ -2,8 +2,17 @@ package routing
 
 import (
 	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -26,6 +35,35 @@ const (
 	maxMessageSize = 512
 )
 
+// Close codes sent to the peer, one per reason, in the 4000-4999 range left to
+// applications so that clients can react without parsing the reason. They are
+// documented in the README and must not change.
+const (
+	// The connection lifetime is exceeded, the peer should reconnect.
+	closeReconnect = 4000
+
+	// The peer did not subscribe in time.
+	closeNoSubscription = 4001
+
+	// The peer did not answer the pings in time.
+	closeNoPong = 4002
+
+	// The send buffer of the peer is full.
+	closeSlowConsumer = 4003
+
+	// The token of the peer expired.
+	closeTokenExpired = 4004
+
+	// The resume identity of the peer is taken by another connection.
+	closeDuplicateResume = 4005
+
+	// The peer is redirected to another instance.
+	closeRedirected = 4006
+
+	// The peer is closed during maintenance.
+	closeMaintenance = 4007
+)
+
 var (
 	newline = []byte{'\n'}
 	space   = []byte{' '}
@@ -34,6 +72,7 @@ var (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    subprotocols,
 }
 
 var maxBufferedMessages = 256
@@ -41,8 +80,12 @@ var maxBufferedMessages = 256
 // FIXME: IClient looks very wrong.
 type IClient interface {
 	Send(string)
+	SendStream(string, string)
 	Close()
+	CloseWithCode(int, string)
+	Downgrade()
 	GetUID() string
+	GetResumeID() string
 	GetSubscriptions() []string
 	SubscribePublic(string)
 	SubscribePrivate(string)
@@ -52,11 +95,60 @@ type IClient interface {
 
 // Client is a middleman between the websocket connection and the hub.
 type Client struct {
+	// Time of the last pong received in nanoseconds, accessed atomically
+	lastPong int64
+
+	// Sequence number of the last protobuf frame, accessed atomically
+	frameSeq uint64
+
+	// Time of the last message or pong received in nanoseconds, accessed
+	// atomically
+	lastActive int64
+
+	// Delivery latency of the last message written in nanoseconds, accessed
+	// atomically
+	latency int64
+
+	// Set to 1 once the client subscribed to a stream, accessed atomically
+	subscribed int32
+
+	// Set to 1 once the client is downgraded to anonymous, accessed atomically
+	downgraded int32
+
+	// Set to 1 once the client granted credits, its stream messages are then
+	// only written within the credits left, accessed atomically
+	creditFlow int32
+	credits    int64
+
 	hub *Hub
 
 	// User ID if authorized
 	UID string
 
+	// User ID of the account acting on behalf of UID, if delegated
+	actorUID string
+
+	// Streams of the streams claim of the token, the client may only
+	// subscribe to them, unrestricted if nil
+	tokenStreams []string
+
+	// Expiry of the token authenticating UID, zero if none
+	expiresAt time.Time
+
+	// Identity of the client across reconnections
+	resumeID string
+
+	// Random identifier of the connection
+	connID string
+
+	// Metadata of the connection from the request headers, by tag name
+	tags map[string]string
+
+	// Context of the connection passed to the hooks, canceled once the
+	// connection is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	pubSub  []string
 	privSub []string
 
@@ -64,38 +156,214 @@ type Client struct {
 	conn *websocket.Conn
 
 	// Buffered channel of outbound messages.
-	send chan []byte
+	send chan outbound
+
+	// Buffered channel of outbound messages written before the others.
+	priority chan outbound
+
+	// Overflow of the send buffer for spilled streams
+	spill *spillQueue
+
+	// Set if the client negotiated protobuf, its messages are sent as frames
+	// of rango.proto in binary websocket messages
+	protobuf bool
+
+	// Compressor of the messages if the client negotiated rango.dict, and its
+	// output, only used by the writer
+	deflater *flate.Writer
+	deflated bytes.Buffer
+
+	// Messages accumulated during the batch window, only used by the writer
+	batching bool
+	batch    []outbound
+
+	closeOnce sync.Once
+
+	// Serializes the writes of data frames, the writer and the close paths
+	// write them
+	writeMutex sync.Mutex
+
+	// Guards the subscribed streams, which the hub changes while other
+	// goroutines read them
+	subsMutex sync.Mutex
+
+	// Time the last ping was sent, 0 once its pong was received, and the last
+	// round-trip time in nanoseconds
+	pingSentAt int64
+	rtt        int64
+
+	// Size of the messages in the send buffers
+	bufferedBytes int64
+
+	// Set once the client was warned its send buffer is filling up
+	slowWarned int32
+
+	// Set once the connection of the client is closed for being too slow
+	slowClosed int32
+
+	// Number of messages dropped for the client, accessed atomically
+	drops int64
+
+	// Set by the hub once the client is unregistered and its send channel
+	// closed, guarded by the hub mutex
+	unregistered bool
+
+	// Signaled when the client grants credits, wakes up the writer
+	credited chan struct{}
+
+	// Logical sessions multiplexed over the connection by ID
+	sessions      map[string]*session
+	sessionsMutex sync.Mutex
 }
 
 // NewClient handles websocket requests from the peer.
 func NewClient(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if !websocket.IsWebSocketUpgrade(r) {
+		w.Header().Set("Upgrade", "websocket")
+		writeError(w, http.StatusUpgradeRequired, errors.New("websocket upgrade required"))
+		return
+	}
+
+	uid, actor := hub.RequestUID(r), ""
+	if target := r.Header.Get("JwtOnBehalfOf"); target != "" {
+		if !hub.canImpersonate(r.Context(), uid, target) {
+			log.Warn().Msgf("Delegation of %s to %s rejected", target, uid)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		uid, actor = target, uid
+	}
+	if uid == "" && hub.RequireAuth {
+		log.Warn().Msg("Anonymous connection rejected")
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	if hub.resumeTaken(resumeIdentity(uid, r.URL.Query().Get("resume"))) {
+		rejectDuplicateResume(w, uid)
+		return
+	}
+
+	initial, err := parseSubscribeBody(r)
+	if err != nil {
+		log.Warn().Msgf("Invalid subscribe body: %s", err.Error())
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, batching := upgrader, hub.wantsBatch(r.URL.Query().Get("batch"))
+	if batching || hub.CompressionThreshold > 0 || len(hub.CompressStreams) > 0 {
+		u = compressUpgrader
+	}
+	u.HandshakeTimeout = hub.HandshakeTimeout
+	u.CheckOrigin = hub.checkOrigin
+	u.Subprotocols = hub.upgradeSubprotocols()
+	conn, err := u.Upgrade(w, r, hub.upgradeHeader())
 	if err != nil {
 		log.Error().Msg("Websocket upgrade failed: " + err.Error())
 		return
 	}
+	conn.EnableWriteCompression(false)
+	protobuf := conn.Subprotocol() == subprotocolProto
+	compressed := conn.Subprotocol() == subprotocolDict
+	if on, message := hub.Maintenance(); on {
+		log.Info().Msgf("Connection refused during maintenance (%s)", uid)
+		refused := &Client{hub: hub, conn: conn, protobuf: protobuf}
+		if compressed {
+			refused.deflater = newDeflater(hub.CompressionDict)
+		}
+		refused.closeMaintenance(maintenanceNotice(message))
+		return
+	}
 	client := &Client{
-		hub:     hub,
-		conn:    conn,
-		send:    make(chan []byte, maxBufferedMessages),
-		UID:     r.Header.Get("JwtUID"),
-		pubSub:  []string{},
-		privSub: []string{},
+		hub:      hub,
+		conn:     conn,
+		send:     make(chan outbound, maxBufferedMessages),
+		priority: make(chan outbound, maxBufferedMessages),
+		credited: make(chan struct{}, 1),
+		UID:      uid,
+		actorUID: actor,
+		pubSub:   []string{},
+		privSub:  []string{},
+		lastPong: hub.Clock.Now().UnixNano(),
+		protobuf: protobuf,
+		batching: batching && !protobuf && !compressed,
+		connID:   newConnID(),
+		tags:     hub.captureTags(r),
+	}
+	client.lastActive = client.lastPong
+	client.ctx, client.cancel = context.WithCancel(hub.ctx)
+	client.ctx = context.WithValue(client.ctx, clientKey{}, client)
+	if compressed {
+		client.deflater = newDeflater(hub.CompressionDict)
+	}
+	client.resumeID = resumeIdentity(client.UID, r.URL.Query().Get("resume"))
+	if !hub.claimResume(client) {
+		log.Warn().Msgf("Duplicate resume identity, connection closed (%s)", client.UID)
+		client.CloseWithCode(closeDuplicateResume, "resume identity in use")
+		client.cancel()
+		hub.releaseTags(client.tags)
+		return
+	}
+	client.tokenStreams = requestTokenStreams(r)
+	if exp, err := strconv.ParseInt(r.Header.Get("JwtExpiry"), 10, 64); err == nil && client.UID != "" {
+		client.expiresAt = time.Unix(exp, 0)
+	}
+	if len(hub.SpillStreams) != 0 && hub.SpillMaxBytes > 0 {
+		client.spill = newSpillQueue(hub.SpillDir, hub.SpillMaxBytes)
 	}
 
 	if client.UID == "" {
 		log.Info().Msgf("New anonymous connection")
+	} else if client.actorUID != "" {
+		log.Info().Msgf("New delegated connection: %s acting as %s", client.actorUID, client.UID)
 	} else {
 		log.Info().Msgf("New authenticated connection: %s", client.UID)
 	}
 
-	hub.handleSubscribe(&Request{
+	streams := append(parseStreamsFromURI(r.RequestURI), initial.Streams...)
+	restored := hub.restoredStreams(client.resumeID)
+	streams = append(streams, restored...)
+	if len(streams) == 0 {
+		streams = append(streams, client.tokenStreams...)
+	}
+	req := &Request{
 		client: client,
 		Request: msg.Request{
-			Streams: parseStreamsFromURI(r.RequestURI),
+			Streams:    streams,
+			NoSnapshot: initial.NoSnapshot,
+			Delta:      initial.Delta,
+			Conditions: initial.Conditions,
+			Last:       initial.Last,
+			// The restored subscriptions are confirmed at once.
+			Consolidated: initial.Consolidated || len(restored) != 0,
 		},
-	})
+	}
+	// The initial streams are limited like a subscribe request, the default
+	// streams are still subscribed when they are rejected.
+	if !hub.capStreams(req) {
+		req.Streams = nil
+	}
+	explicit := len(req.Streams) != 0
+	for _, s := range hub.DefaultStreams {
+		if client.UID != "" || !isPrivateStream(s) {
+			req.Streams = append(req.Streams, s)
+		}
+	}
+
+	hub.handleSubscribe(req)
 
+	// Clients given initial streams are exempt from the subscribe deadline,
+	// the default streams do not count.
+	if explicit {
+		atomic.StoreInt32(&client.subscribed, 1)
+	} else {
+		atomic.StoreInt32(&client.subscribed, 0)
+	}
+
+	hub.redeliverUnacked(client)
+
+	hub.addConnection(client)
 	metrics.RecordHubClientNew()
 
 	// Allow collection of memory referenced by the caller by doing all work in
@@ -105,60 +373,177 @@ func NewClient(hub *Hub, w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *Client) Send(s string) {
-	if len(c.send) == maxBufferedMessages {
-		log.Warn().Msg("Closing slow websocket connection")
-		c.conn.Close()
-	} else {
-		c.send <- []byte(s)
+	c.enqueue(outbound{data: c.frame("", []byte(s))})
+}
+
+// enqueue adds a message to the send buffer without blocking, the slow client
+// policy applies if it is full.
+func (c *Client) enqueue(m outbound) {
+	c.warnSlowConsumer(len(c.send))
+	if !c.reserve(m.data) {
+		c.overflow()
+		return
+	}
+	lane := c.send
+	if m.topic == "" {
+		lane = c.replyLane()
+	}
+	select {
+	case lane <- m:
+		atomic.AddInt64(&c.hub.buffered, 1)
+	default:
+		c.release(m.data)
+		c.overflow()
 	}
 }
 
+// SendStream sends a message of a stream. Messages of priority streams are
+// written before the messages of other streams. Messages of spilled streams not
+// fitting in the send buffer are queued on disk instead of closing the
+// connection, until the disk queue is full.
+func (c *Client) SendStream(stream, s string) {
+	c.sendStreamBytes(stream, []byte(s))
+}
+
+// sendStreamBytes sends a message of a stream like SendStream, the message is
+// shared with the other subscribers and must not be modified.
+func (c *Client) sendStreamBytes(stream string, b []byte) {
+	m := c.hub.stamp(stream, c.frame(stream, b))
+	if c.priority != nil && contains(c.hub.PriorityStreams, stream) {
+		if !c.reserve(m.data) {
+			c.overflow()
+			return
+		}
+		select {
+		case c.priority <- m:
+			atomic.AddInt64(&c.hub.buffered, 1)
+		default:
+			c.release(m.data)
+			c.overflow()
+		}
+		return
+	}
+
+	if c.spill != nil && contains(c.hub.SpillStreams, stream) {
+		spilled, err := c.spill.push(len(c.send) == maxBufferedMessages || !c.fits(m.data), m.data)
+		if err != nil {
+			log.Warn().Msgf("Spilling failed: %s", err.Error())
+			c.overflow()
+			return
+		}
+		if spilled {
+			return
+		}
+	}
+	c.enqueue(m)
+}
+
 func (c *Client) Close() {
 	close(c.send)
 }
 
+// CloseWithCode tells the peer why the connection is closed with a message
+// like {"event":"disconnect","reason":"token expired"}, since browsers often
+// cannot read the reason of a close frame, then sends a close frame with the
+// code and reason and closes the connection. It may be called from any
+// goroutine, the message is written with writeFrame and the close frame as a
+// control frame, only the first call has an effect.
+func (c *Client) CloseWithCode(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.writeFrame(c.frame("", disconnectMessage(reason)), false)
+		msg := websocket.FormatCloseMessage(code, reason)
+		err := c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.writeTimeout()))
+		if err != nil {
+			log.Debug().Msgf("Close frame write failed (%s): %s", c.GetUID(), err.Error())
+		}
+		c.conn.Close()
+	})
+}
+
+// Downgrade makes the client anonymous, the hub must have unsubscribed it
+// from its private streams first.
+func (c *Client) Downgrade() {
+	atomic.StoreInt32(&c.downgraded, 1)
+}
+
 func (c *Client) GetUID() string {
+	if atomic.LoadInt32(&c.downgraded) == 1 {
+		return ""
+	}
 	return c.UID
 }
 
+func (c *Client) GetResumeID() string {
+	return c.resumeID
+}
+
+// GetSubscriptions returns a copy of the streams the client is subscribed to.
 func (c *Client) GetSubscriptions() []string {
-	return append(c.pubSub, c.privSub...)
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	streams := make([]string, 0, len(c.pubSub)+len(c.privSub))
+	return append(append(streams, c.pubSub...), c.privSub...)
 }
 
 func (c *Client) SubscribePublic(s string) {
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	atomic.StoreInt32(&c.subscribed, 1)
 	if !contains(c.pubSub, s) {
 		c.pubSub = append(c.pubSub, s)
 	}
 }
 
 func (c *Client) SubscribePrivate(s string) {
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	atomic.StoreInt32(&c.subscribed, 1)
 	if !contains(c.privSub, s) {
 		c.privSub = append(c.privSub, s)
 	}
 }
 
 func (c *Client) UnsubscribePublic(s string) {
-	l := make([]string, len(c.pubSub)-1)
-	i := 0
-	for _, el := range c.pubSub {
-		if s != el {
-			l[i] = el
-			i++
-		}
-	}
-	c.pubSub = l
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	c.pubSub = remove(c.pubSub, s)
 }
 
 func (c *Client) UnsubscribePrivate(s string) {
-	l := make([]string, len(c.privSub)-1)
-	i := 0
-	for _, el := range c.privSub {
-		if s != el {
-			l[i] = el
-			i++
-		}
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	c.privSub = remove(c.privSub, s)
+}
+
+func newConnID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		log.Error().Msgf("Generating connection ID failed: %s", err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// whoami returns the identity of the client as seen by the server.
+func (c *Client) whoami() []byte {
+	uid := c.GetUID()
+	res := map[string]interface{}{
+		"uid":           uid,
+		"authenticated": uid != "",
+		"conn_id":       c.connID,
+	}
+	if len(c.tags) != 0 {
+		res["tags"] = c.tags
+	}
+	body, err := json.Marshal(res)
+	if err != nil {
+		log.Panic().Msg(err.Error())
 	}
-	c.privSub = l
+	return body
 }
 
 func parseStreamsFromURI(uri string) []string {
@@ -186,15 +571,28 @@ func parseStreamsFromURI(uri string) []string {
 func (c *Client) read() {
 	defer func() {
 		log.Debug().Msgf("Closing client read (%s)", c.GetUID())
-		c.hub.Unregister <- c
+		c.hub.removeConnection(c)
+		c.hub.releaseResume(c)
+		for _, s := range c.removeSessions() {
+			c.hub.unregister(s)
+		}
+		c.hub.unregister(c)
+		c.hub.releaseTags(c.tags)
 		metrics.RecordHubClientClose()
 		c.conn.Close()
+		c.cancel()
 	}()
 
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	// Deadlines are enforced by the network stack and therefore use the wall
+	// clock, the hub clock is used to detect missing pongs in write.
+	c.conn.SetReadLimit(readLimit(c.conn.Subprotocol()))
+	c.conn.SetReadDeadline(time.Now().Add(c.pongTimeout()))
 	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		now := c.hub.Clock.Now()
+		c.recordPong(now)
+		c.recordLiveness(now)
+		c.recordActivity(now)
+		c.conn.SetReadDeadline(time.Now().Add(c.pongTimeout()))
 		return nil
 	})
 
@@ -206,27 +604,64 @@ func (c *Client) read() {
 			}
 			break
 		}
-		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
-		if len(message) == 0 {
+		c.recordActivity(c.hub.Clock.Now())
+		var req msg.Request
+		if c.protobuf {
+			c.hub.logReceived(message)
+			req, err = msg.ParseProtoRequest(message)
+		} else {
+			message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
+			if len(message) == 0 {
+				continue
+			}
+			c.hub.logReceived(message)
+
+			// handle ping
+			if string(message) == "ping" {
+				c.reply([]byte("pong"))
+				continue
+			}
+
+			req, err = msg.ParseRequest(message)
+		}
+		if err != nil {
+			c.reply(c.frame("", []byte(responseMust(err, nil))))
 			continue
 		}
-		if isDebug() {
-			log.Debug().Msgf("Received message %s", message)
+
+		if req.Method == "whoami" {
+			c.reply(c.frame("", c.whoami()))
+			continue
 		}
 
-		// handle ping
-		if string(message) == "ping" {
-			c.send <- []byte("pong")
+		if req.Method == "credit" {
+			c.grantCredits(req.Credits)
 			continue
 		}
 
-		req, err := msg.ParseRequest(message)
-		if err != nil {
-			c.send <- []byte(responseMust(err, nil))
+		if req.Session == "" {
+			if !c.hub.queueRequest(Request{client: c, Request: req}) {
+				break
+			}
 			continue
 		}
 
-		c.hub.Requests <- Request{c, req}
+		var s *session
+		if req.Method == "close_session" {
+			s = c.removeSession(req.Session)
+			if s == nil {
+				err = errors.New("unknown session")
+			}
+		} else {
+			s, err = c.session(req.Session)
+		}
+		if err != nil {
+			c.reply(c.frame("", []byte(responseMust(err, nil))))
+			continue
+		}
+		if !c.hub.queueRequest(Request{client: s, Request: req}) {
+			break
+		}
 	}
 }
 
@@ -236,36 +671,265 @@ func (c *Client) read() {
 // application ensures that there is at most one writer to a connection by
 // executing all writes from this goroutine.
 func (c *Client) write() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := c.hub.Clock.NewTicker(c.pingInterval())
+	var lifetime <-chan time.Time
+	if c.hub.MaxConnLifetime > 0 {
+		timer := c.hub.Clock.NewTimer(c.hub.MaxConnLifetime)
+		defer timer.Stop()
+		lifetime = timer.C()
+	}
+	var subscribeDeadline <-chan time.Time
+	if c.hub.SubscribeDeadline > 0 && atomic.LoadInt32(&c.subscribed) == 0 {
+		timer := c.hub.Clock.NewTimer(c.hub.SubscribeDeadline)
+		defer timer.Stop()
+		subscribeDeadline = timer.C()
+	}
+	var expiry <-chan time.Time
+	if c.hub.TokenExpiry != "" && !c.expiresAt.IsZero() {
+		timer := c.hub.Clock.NewTimer(c.expiresAt.Sub(c.hub.Clock.Now()))
+		defer timer.Stop()
+		expiry = timer.C()
+	}
+	var batchTimer Timer
+	var batchDone <-chan time.Time
+	limiter := c.newFrameLimiter()
+	var throttled <-chan time.Time
+	var alive bool
 	defer func() {
 		log.Debug().Msgf("Closing client write (%s)", c.GetUID())
 		ticker.Stop()
+		limiter.stop()
+		if batchTimer != nil {
+			batchTimer.Stop()
+		}
 		c.conn.Close()
+		if c.spill != nil {
+			c.spill.close()
+		}
 	}()
 
 	for {
+		// The send buffers are not read nor the batch flushed while the frame
+		// rate is capped.
+		send, priority, flush := c.send, c.priority, batchDone
+		if throttled != nil {
+			send, priority, flush = nil, nil, nil
+		}
+		// Without credits left only the priority messages are written.
+		if !c.hasCredit() {
+			send, flush = nil, nil
+		}
+
+		// Priority messages are written first, the order of each lane is kept.
 		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		case message := <-priority:
+			if err := c.writeOutbound(message); err != nil {
+				return
+			}
+			throttled = limiter.throttle()
+			continue
+		default:
+		}
+
+		select {
+		case message := <-priority:
+			if err := c.writeOutbound(message); err != nil {
+				return
+			}
+			throttled = limiter.throttle()
+
+		case <-throttled:
+			if throttled, alive = c.drainSpilled(limiter, nil); !alive {
+				return
+			}
+
+		case <-c.credited:
+			if throttled, alive = c.drainSpilled(limiter, throttled); !alive {
+				return
+			}
+
+		case <-lifetime:
+			log.Debug().Msgf("Connection lifetime exceeded (%s)", c.GetUID())
+			c.CloseWithCode(closeReconnect, "connection lifetime exceeded")
+			return
+
+		case <-expiry:
+			if !c.expireToken() {
+				return
+			}
+
+		case <-subscribeDeadline:
+			if atomic.LoadInt32(&c.subscribed) == 0 {
+				log.Debug().Msgf("No subscription before deadline (%s)", c.GetUID())
+				c.CloseWithCode(closeNoSubscription, "no subscription received")
+				return
+			}
+
+		case message, ok := <-send:
 			if !ok {
 				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.flushBatch()
+				// The close frame is a control frame, written like the one of
+				// CloseWithCode which may run at the same time.
+				c.conn.WriteControl(websocket.CloseMessage, []byte{}, time.Now().Add(c.writeTimeout()))
+				return
+			}
+			if message.topic != "" {
+				c.spendCredit()
+			}
+			if c.batching {
+				c.release(message.data)
+				c.batch = append(c.batch, message)
+				if batchDone == nil {
+					batchTimer = c.hub.Clock.NewTimer(c.hub.BatchWindow)
+					batchDone = batchTimer.C()
+				}
+				continue
+			}
+
+			if err := c.writeOutbound(message); err != nil {
+				return
+			}
+			if throttled, alive = c.drainSpilled(limiter, limiter.throttle()); !alive {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+		case <-flush:
+			batchTimer, batchDone = nil, nil
+			if err := c.flushBatch(); err != nil {
 				return
 			}
-			w.Write(message)
-			if err := w.Close(); err != nil {
+			if throttled, alive = c.drainSpilled(limiter, limiter.throttle()); !alive {
 				return
 			}
-		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+		case <-ticker.C():
+			lastPong := time.Unix(0, atomic.LoadInt64(&c.lastPong))
+			if c.hub.Clock.Now().Sub(lastPong) > c.pongTimeout() {
+				log.Info().Msgf("No pong received since %s, closing (%s)", lastPong, c.GetUID())
+				c.CloseWithCode(closeNoPong, "no pong received")
 				return
 			}
+			if err := c.writePing(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeTimeout returns the time allowed to write a message to the peer.
+func (c *Client) writeTimeout() time.Duration {
+	if t := c.hub.HalfOpenTimeout; t > 0 && t < writeWait {
+		return t
+	}
+	return writeWait
+}
+
+// pongTimeout returns the time allowed to read the next pong from the peer.
+func (c *Client) pongTimeout() time.Duration {
+	if t := c.hub.HalfOpenTimeout; t > 0 && t < pongWait {
+		return t
+	}
+	return pongWait
+}
+
+// pingInterval returns the period of the pings, less than the pong timeout.
+func (c *Client) pingInterval() time.Duration {
+	if t := c.pongTimeout(); t < pongWait {
+		return (t * 9) / 10
+	}
+	return pingPeriod
+}
+
+// writePing sends a ping with its own deadline, independent of the deadline
+// of data messages. It carries the payload of the PingPayload of the hub.
+func (c *Client) writePing() error {
+	c.recordPing()
+	err := c.conn.WriteControl(websocket.PingMessage, c.pingPayload(), time.Now().Add(c.writeTimeout()))
+	if err != nil {
+		log.Info().Msgf("Ping failed (%s): %s", c.GetUID(), err.Error())
+		metrics.RecordClientWriteError("ping")
+	}
+	return err
+}
+
+// writeOutbound writes a message taken from a send buffer and records its
+// delivery latency.
+func (c *Client) writeOutbound(m outbound) error {
+	c.release(m.data)
+	if err := c.writeFrame(m.data, c.compresses(m.topic, m.data)); err != nil {
+		return err
+	}
+	c.recordLatency(m)
+	return nil
+}
+
+func (c *Client) writeMessage(message []byte) error {
+	return c.writeFrame(message, c.compresses("", message))
+}
+
+// writeFrame writes a message in a single frame, compressed if compress is
+// true and the client negotiated the compression. The data frames of the
+// connection are all written here under the write mutex, so it may be called
+// from another goroutine than the writer, the other frames are control frames.
+func (c *Client) writeFrame(message []byte, compress bool) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.conn.EnableWriteCompression(compress)
+	c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout()))
+	messageType := websocket.TextMessage
+	if c.protobuf {
+		messageType = websocket.BinaryMessage
+	}
+	if c.deflater != nil {
+		message, messageType = c.deflate(message), websocket.BinaryMessage
+	}
+	w, err := c.conn.NextWriter(messageType)
+	if err == nil {
+		w.Write(message)
+		err = w.Close()
+	}
+	if err != nil {
+		log.Info().Msgf("Message write failed (%s): %s", c.GetUID(), err.Error())
+		metrics.RecordClientWriteError("data")
+	}
+	return err
+}
+
+// writeSpilled writes the messages queued on disk once the send buffer is
+// empty, within the credits left and the frame rate of the limiter. It returns
+// the throttle of the limiter if the frame rate cap is reached, and false if
+// the connection failed.
+func (c *Client) writeSpilled(limiter *frameLimiter) (<-chan time.Time, bool) {
+	if c.spill == nil {
+		return nil, true
+	}
+
+	for c.hasCredit() {
+		message, ok, err := c.spill.pop()
+		if err != nil {
+			log.Error().Msgf("Reading spilled message failed: %s", err.Error())
+			return nil, false
 		}
+		if !ok {
+			return nil, true
+		}
+		if err := c.writeMessage(message); err != nil {
+			return nil, false
+		}
+		c.spendCredit()
+		if throttled := limiter.throttle(); throttled != nil {
+			return throttled, true
+		}
+	}
+	return nil, true
+}
+
+// drainSpilled writes the messages queued on disk like writeSpilled, unless the
+// writer is throttled or the send buffer is not empty.
+func (c *Client) drainSpilled(limiter *frameLimiter, throttled <-chan time.Time) (<-chan time.Time, bool) {
+	if throttled != nil || len(c.send) != 0 {
+		return throttled, true
 	}
+	return c.writeSpilled(limiter)
 }
@@ -1,16 +1,101 @@
 package routing
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// dial starts a websocket server backed by the hub and connects to it.
+func dial(t *testing.T, h *Hub, path string, header http.Header) (*websocket.Conn, func()) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, header)
+	require.NoError(t, err)
+
+	return conn, func() {
+		conn.Close()
+		srv.Close()
+	}
+}
+
+// serveClient connects to a server running a client built by newClient, the
+// client writer starts once newClient returns.
+func serveClient(t *testing.T, newClient func(conn *websocket.Conn) *Client) (*websocket.Conn, func()) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		go newClient(conn).write()
+	}))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+
+	return conn, func() {
+		conn.Close()
+		srv.Close()
+	}
+}
+
+// pipeListener serves connections over synchronous in-memory pipes, a write
+// blocks until the peer reads it.
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	close(l.closed)
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+func (l *pipeListener) dial(string, string) (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, errors.New("listener closed")
+	}
+}
+
 func TestClient(t *testing.T) {
 	hub := NewHub()
 	client := &Client{
 		hub:     hub,
-		send:    make(chan []byte, 256),
+		send:    make(chan outbound, 256),
 		UID:     "UIDABC001",
 		pubSub:  []string{},
 		privSub: []string{},
@@ -60,6 +145,31 @@ func TestClient(t *testing.T) {
 	assert.Equal(t, []string{}, client.privSub)
 }
 
+func TestClientConcurrentSubscriptions(t *testing.T) {
+	c := &Client{pubSub: []string{}, privSub: []string{}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.SubscribePublic("a.x")
+			c.SubscribePrivate("order")
+			c.UnsubscribePublic("a.x")
+			c.UnsubscribePrivate("order")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		streams := c.GetSubscriptions()
+		streams = append(streams, "b.y")
+		assert.NotContains(t, c.GetSubscriptions(), "b.y")
+	}
+	<-done
+	assert.Empty(t, c.GetSubscriptions())
+
+	// Unsubscribing from a stream not subscribed to does nothing.
+	c.UnsubscribePublic("a.x")
+	assert.Empty(t, c.GetSubscriptions())
+}
+
 func TestParseStreamsFromURI(t *testing.T) {
 	assert.Equal(t, []string{}, parseStreamsFromURI("/?"))
 	assert.Equal(t, []string{}, parseStreamsFromURI(""))
@@ -67,3 +177,341 @@ func TestParseStreamsFromURI(t *testing.T) {
 	assert.Equal(t, []string{"aaa", "bbb"}, parseStreamsFromURI("/?stream=aaa,bbb"))
 	assert.Equal(t, []string{"aaa", "bbb"}, parseStreamsFromURI("/public/?stream=aaa,bbb"))
 }
+
+func TestNonWebsocketRequest(t *testing.T) {
+	h := NewHub()
+	w := httptest.NewRecorder()
+	NewClient(h, w, httptest.NewRequest(http.MethodGet, "/public?stream=eurusd.trades", nil))
+
+	assert.Equal(t, http.StatusUpgradeRequired, w.Code)
+	assert.Equal(t, "websocket", w.Header().Get("Upgrade"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"websocket upgrade required"}`, w.Body.String())
+	assert.Empty(t, h.PublicTopics)
+}
+
+func TestMaxConnLifetime(t *testing.T) {
+	h := NewHub()
+	h.MaxConnLifetime = 50 * time.Millisecond
+	go h.ListenWebsocketEvents()
+
+	start := time.Now()
+	conn, teardown := dial(t, h, "/", nil)
+	defer teardown()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var last []byte
+	var err error
+	for err == nil {
+		var data []byte
+		if _, data, err = conn.ReadMessage(); err == nil {
+			last = data
+		}
+	}
+
+	assert.JSONEq(t, `{"event":"disconnect","reason":"connection lifetime exceeded"}`, string(last))
+	assert.Equal(t, &websocket.CloseError{Code: closeReconnect, Text: "connection lifetime exceeded"}, err)
+	assert.True(t, time.Since(start) >= h.MaxConnLifetime)
+}
+
+func TestClientCloseWithCode(t *testing.T) {
+	h := NewHub()
+	clients := make(chan *Client, 1)
+	conn, teardown := serveClient(t, func(conn *websocket.Conn) *Client {
+		c := &Client{
+			hub:      h,
+			conn:     conn,
+			send:     make(chan outbound, maxBufferedMessages),
+			lastPong: h.Clock.Now().UnixNano(),
+		}
+		clients <- c
+		return c
+	})
+	defer teardown()
+	c := <-clients
+
+	// Concurrent calls must send a single close frame.
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			c.CloseWithCode(4000+i, "kicked")
+			done <- struct{}{}
+		}(i)
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	c.CloseWithCode(websocket.CloseNormalClosure, "again")
+
+	// The reason is sent first in a message.
+	assert.Equal(t, map[string]interface{}{"event": "disconnect", "reason": "kicked"}, readJSON(t, conn))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok, err.Error())
+	assert.True(t, closeErr.Code >= 4000 && closeErr.Code < 4003, err.Error())
+	assert.Equal(t, "kicked", closeErr.Text)
+}
+
+func TestCloseCodes(t *testing.T) {
+	// The codes are documented for the clients, they must not change.
+	codes := map[string]int{
+		"connection lifetime exceeded":   closeReconnect,
+		"no subscription received":       closeNoSubscription,
+		"no pong received":               closeNoPong,
+		"slow consumer":                  closeSlowConsumer,
+		"token expired":                  closeTokenExpired,
+		"resumed by another connection":  closeDuplicateResume,
+		"redirected to another instance": closeRedirected,
+		"maintenance":                    closeMaintenance,
+	}
+	assert.Equal(t, map[string]int{
+		"connection lifetime exceeded":   4000,
+		"no subscription received":       4001,
+		"no pong received":               4002,
+		"slow consumer":                  4003,
+		"token expired":                  4004,
+		"resumed by another connection":  4005,
+		"redirected to another instance": 4006,
+		"maintenance":                    4007,
+	}, codes)
+}
+
+func TestSubscribeDeadline(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.SubscribeDeadline = 10 * time.Second
+	go h.ListenWebsocketEvents()
+
+	waiters := 0
+	// connect returns a channel receiving the error closing the connection.
+	connect := func(path string, subscribe bool) (chan error, func()) {
+		conn, teardown := dial(t, h, path, nil)
+		assert.Contains(t, readJSON(t, conn), "success")
+		if subscribe {
+			require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "subscribe", "streams": []string{"eurusd.trades"}}))
+			assert.Contains(t, readJSON(t, conn), "success")
+		}
+
+		closed := make(chan error, 1)
+		go func() {
+			for {
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				if _, _, err := conn.ReadMessage(); err != nil {
+					closed <- err
+					return
+				}
+			}
+		}()
+		return closed, teardown
+	}
+
+	silent, teardown1 := connect("/", false)
+	defer teardown1()
+	waiters += 2
+	subscribing, teardown2 := connect("/", true)
+	defer teardown2()
+	waiters += 2
+	initial, teardown3 := connect("/?stream=eurusd.trades", false)
+	defer teardown3()
+	waiters++
+
+	clock.WaitForWaiters(t, waiters)
+	clock.Advance(h.SubscribeDeadline)
+
+	t.Run("closes a silent connection", func(t *testing.T) {
+		err := <-silent
+		assert.True(t, websocket.IsCloseError(err, closeNoSubscription), err.Error())
+	})
+
+	t.Run("keeps subscribed connections", func(t *testing.T) {
+		select {
+		case err := <-subscribing:
+			t.Fatalf("subscribing connection closed: %s", err)
+		case err := <-initial:
+			t.Fatalf("connection with initial streams closed: %s", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+func TestClientPriority(t *testing.T) {
+	h := NewHub()
+	h.PriorityStreams = []string{"order"}
+
+	conn, teardown := serveClient(t, func(conn *websocket.Conn) *Client {
+		c := &Client{
+			hub:      h,
+			conn:     conn,
+			send:     make(chan outbound, maxBufferedMessages),
+			priority: make(chan outbound, maxBufferedMessages),
+		}
+		for i := 0; i < 100; i++ {
+			c.SendStream("eurusd.tickers", fmt.Sprintf(`{"eurusd.tickers":%d}`, i))
+		}
+		c.SendStream("order", `{"order":1}`)
+		c.SendStream("order", `{"order":2}`)
+		return c
+	})
+	defer teardown()
+
+	expected := []string{`{"order":1}`, `{"order":2}`}
+	for i := 0; i < 100; i++ {
+		expected = append(expected, fmt.Sprintf(`{"eurusd.tickers":%d}`, i))
+	}
+	for _, e := range expected {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, m, err := conn.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, e, string(m))
+	}
+}
+
+func TestClientWriteErrors(t *testing.T) {
+	logs, restore := captureLogs(zerolog.DebugLevel)
+	defer restore()
+
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+
+	// start returns a client whose connection is broken, the logs of other
+	// tests are told apart with the client UID.
+	start := func(uid string) *Client {
+		clients := make(chan *Client, 1)
+		_, teardown := serveClient(t, func(conn *websocket.Conn) *Client {
+			c := &Client{
+				hub:      h,
+				conn:     conn,
+				send:     make(chan outbound, maxBufferedMessages),
+				UID:      uid,
+				lastPong: clock.Now().UnixNano(),
+			}
+			clients <- c
+			return c
+		})
+		defer teardown()
+
+		c := <-clients
+		c.conn.UnderlyingConn().Close()
+		return c
+	}
+	closed := func(uid string) func() bool {
+		return func() bool { return strings.Contains(logs.String(), "Closing client write ("+uid+")") }
+	}
+
+	t.Run("logs ping failures", func(t *testing.T) {
+		start("UIDPING")
+		clock.WaitForWaiters(t, 1)
+		clock.Advance(pingPeriod)
+
+		waitFor(t, closed("UIDPING"))
+		assert.Contains(t, logs.String(), "Ping failed (UIDPING)")
+		assert.NotContains(t, logs.String(), "Message write failed (UIDPING)")
+	})
+
+	t.Run("logs data write failures", func(t *testing.T) {
+		c := start("UIDDATA")
+		c.Send("hello")
+
+		waitFor(t, closed("UIDDATA"))
+		assert.Contains(t, logs.String(), "Message write failed (UIDDATA)")
+		assert.NotContains(t, logs.String(), "Ping failed (UIDDATA)")
+	})
+}
+
+func TestHalfOpenDetection(t *testing.T) {
+	// stall starts a client whose peer never reads, the returned channel is
+	// closed once the client writer stopped.
+	stall := func(t *testing.T, timeout time.Duration) (chan struct{}, func()) {
+		h := NewHub()
+		h.HalfOpenTimeout = timeout
+
+		l := newPipeListener()
+		clients := make(chan *Client, 1)
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			require.NoError(t, err)
+			clients <- &Client{
+				hub:      h,
+				conn:     conn,
+				send:     make(chan outbound, maxBufferedMessages),
+				lastPong: h.Clock.Now().UnixNano(),
+			}
+		})}
+		go srv.Serve(l)
+
+		dialer := websocket.Dialer{NetDial: l.dial}
+		conn, _, err := dialer.Dial("ws://pipe/", nil)
+		require.NoError(t, err)
+
+		c := <-clients
+		done := make(chan struct{})
+		go func() {
+			c.write()
+			close(done)
+		}()
+		c.Send("hello")
+
+		return done, func() {
+			conn.Close()
+			srv.Close()
+		}
+	}
+
+	t.Run("closes a stalled connection after the timeout", func(t *testing.T) {
+		done, teardown := stall(t, 50*time.Millisecond)
+		defer teardown()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("stalled connection not closed")
+		}
+	})
+
+	t.Run("keeps waiting without timeout", func(t *testing.T) {
+		done, teardown := stall(t, 0)
+		defer teardown()
+
+		select {
+		case <-done:
+			t.Fatal("stalled connection closed")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestWhoami(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+
+	whoami := func(t *testing.T, header http.Header) map[string]interface{} {
+		conn, teardown := dial(t, h, "/", header)
+		defer teardown()
+		assert.Contains(t, readJSON(t, conn), "success")
+
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "whoami"}))
+		res := readJSON(t, conn)
+		assert.Regexp(t, "^[0-9a-f]{16}$", res["conn_id"])
+		return res
+	}
+
+	t.Run("returns the UID of an authenticated connection", func(t *testing.T) {
+		res := whoami(t, http.Header{"JwtUID": []string{"UIDABC00001"}})
+		assert.Equal(t, "UIDABC00001", res["uid"])
+		assert.Equal(t, true, res["authenticated"])
+	})
+
+	t.Run("returns no UID for an anonymous connection", func(t *testing.T) {
+		res := whoami(t, nil)
+		assert.Equal(t, "", res["uid"])
+		assert.Equal(t, false, res["authenticated"])
+	})
+
+	t.Run("returns a different ID for each connection", func(t *testing.T) {
+		assert.NotEqual(t, whoami(t, nil)["conn_id"], whoami(t, nil)["conn_id"])
+	})
+}
@@ -0,0 +1,219 @@
+package routing
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a Clock only moving forward when advanced by the test.
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+type fakeWaiter struct {
+	clock   *fakeClock
+	c       chan time.Time
+	at      time.Time
+	period  time.Duration
+	stopped bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) NewTicker(d time.Duration) Ticker {
+	return fakeTicker{f.newWaiter(d, d)}
+}
+
+func (f *fakeClock) NewTimer(d time.Duration) Timer {
+	return f.newWaiter(d, 0)
+}
+
+func (f *fakeClock) newWaiter(d, period time.Duration) *fakeWaiter {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	w := &fakeWaiter{
+		clock:  f,
+		c:      make(chan time.Time, 1),
+		at:     f.now.Add(d),
+		period: period,
+	}
+	f.waiters = append(f.waiters, w)
+	return w
+}
+
+// Advance moves the clock forward and fires the expired tickers and timers.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.now = f.now.Add(d)
+	for _, w := range f.waiters {
+		for !w.stopped && !w.at.After(f.now) {
+			select {
+			case w.c <- w.at:
+			default:
+			}
+			if w.period == 0 {
+				w.stopped = true
+			} else {
+				w.at = w.at.Add(w.period)
+			}
+		}
+	}
+}
+
+// WaitForWaiters blocks until n tickers or timers have been created.
+func (f *fakeClock) WaitForWaiters(t *testing.T, n int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		f.mutex.Lock()
+		count := len(f.waiters)
+		f.mutex.Unlock()
+		if count >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d waiters on the clock", n)
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mutex.Lock()
+	defer w.clock.mutex.Unlock()
+
+	active := !w.stopped
+	w.stopped = true
+	return active
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := newFakeClock()
+	ticker := clock.NewTicker(time.Second)
+	timer := clock.NewTimer(2 * time.Second)
+
+	clock.Advance(time.Second)
+	require.Len(t, ticker.C(), 1)
+	require.Len(t, timer.C(), 0)
+	<-ticker.C()
+
+	clock.Advance(time.Second)
+	require.Len(t, ticker.C(), 1)
+	require.Len(t, timer.C(), 1)
+	assert.False(t, timer.Stop())
+}
+
+func TestClientPing(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	go h.ListenWebsocketEvents()
+
+	conn, teardown := dial(t, h, "/", nil)
+	defer teardown()
+
+	pings := make(chan struct{}, 10)
+	conn.SetPingHandler(func(string) error {
+		pings <- struct{}{}
+		return nil
+	})
+	closed := make(chan error, 1)
+	var last []byte
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				closed <- err
+				return
+			}
+			last = data
+		}
+	}()
+
+	clock.WaitForWaiters(t, 1)
+
+	t.Run("sends a ping every ping period", func(t *testing.T) {
+		clock.Advance(pingPeriod)
+		select {
+		case <-pings:
+		case <-time.After(time.Second):
+			t.Fatal("ping not received")
+		}
+	})
+
+	t.Run("closes the connection when no pong is received", func(t *testing.T) {
+		clock.Advance(pingPeriod)
+		select {
+		case err := <-closed:
+			assert.Equal(t, &websocket.CloseError{Code: closeNoPong, Text: "no pong received"}, err)
+			assert.JSONEq(t, `{"event":"disconnect","reason":"no pong received"}`, string(last))
+		case <-time.After(time.Second):
+			t.Fatal("connection not closed")
+		}
+		assert.Len(t, pings, 0)
+	})
+}
+
+func TestClientPong(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	go h.ListenWebsocketEvents()
+
+	conn, teardown := dial(t, h, "/", nil)
+	defer teardown()
+
+	pings := make(chan struct{}, 10)
+	conn.SetPingHandler(func(data string) error {
+		pings <- struct{}{}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeWait))
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	clock.WaitForWaiters(t, 1)
+
+	// The peer answering pings keeps the connection alive.
+	for i := 0; i < 3; i++ {
+		clock.Advance(pingPeriod)
+		select {
+		case <-pings:
+		case <-time.After(time.Second):
+			t.Fatalf("ping %d not received", i)
+		}
+		// Let the pong reach the server before moving the clock again.
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,34 @@
+package routing
+
+import "path"
+
+// compresses returns true if a message of the stream is compressed. The
+// messages of UncompressedStreams never are and the ones of CompressStreams
+// always are, the others if they are large enough, the compression of smaller
+// messages costs more CPU than it saves bytes. The messages deflated with the
+// preset dictionary are not compressed again.
+func (c *Client) compresses(stream string, message []byte) bool {
+	if c.deflater != nil {
+		return false
+	}
+	if stream != "" {
+		switch {
+		case matchesAny(c.hub.UncompressedStreams, stream):
+			return false
+		case matchesAny(c.hub.CompressStreams, stream):
+			return true
+		}
+	}
+	threshold := c.hub.CompressionThreshold
+	return threshold > 0 && len(message) >= threshold
+}
+
+// matchesAny returns true if the stream matches one of the patterns.
+func matchesAny(patterns []string, stream string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, stream); ok {
+			return true
+		}
+	}
+	return false
+}
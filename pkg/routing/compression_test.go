@@ -0,0 +1,178 @@
+package routing
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiatedContextTakeover(t *testing.T) {
+	h := NewHub()
+	h.BatchWindow = time.Millisecond
+	go h.ListenWebsocketEvents()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+	defer srv.Close()
+
+	connect := func(t *testing.T, path string) string {
+		dialer := websocket.Dialer{EnableCompression: true}
+		conn, res, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		return res.Header.Get("Sec-WebSocket-Extensions")
+	}
+
+	t.Run("negotiates no context takeover on both sides in batch mode", func(t *testing.T) {
+		ext := connect(t, "/?batch=true")
+		assert.Contains(t, ext, "permessage-deflate")
+		assert.Contains(t, ext, "server_no_context_takeover")
+		assert.Contains(t, ext, "client_no_context_takeover")
+	})
+
+	t.Run("does not negotiate compression otherwise", func(t *testing.T) {
+		assert.Empty(t, connect(t, "/"))
+	})
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	h := NewHub()
+	h.CompressionThreshold = 512
+	go h.ListenWebsocketEvents()
+	defer h.Shutdown()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+	defer srv.Close()
+
+	var counted *countingConn
+	dialer := websocket.Dialer{
+		EnableCompression: true,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			counted = &countingConn{Conn: conn}
+			return counted, err
+		},
+	}
+	conn, res, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/?stream=eurusd.trades", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Contains(t, res.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	assert.Contains(t, readJSON(t, conn), "success")
+
+	// receive routes a repetitive message and returns its size with the bytes
+	// read from the wire to receive it.
+	receive := func(t *testing.T, size int) (int, int64) {
+		start := atomic.LoadInt64(&counted.read)
+		h.routeMessage(&Event{
+			Scope:  "public",
+			Stream: "eurusd",
+			Type:   "trades",
+			Topic:  "eurusd.trades",
+			Body:   strings.Repeat("a", size),
+		})
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		return len(data), atomic.LoadInt64(&counted.read) - start
+	}
+
+	t.Run("sends small messages uncompressed", func(t *testing.T) {
+		size, read := receive(t, 100)
+		assert.True(t, size < h.CompressionThreshold)
+		assert.True(t, read > int64(size), "%d bytes read for %d", read, size)
+	})
+
+	t.Run("compresses large messages", func(t *testing.T) {
+		size, read := receive(t, 4096)
+		assert.True(t, read < int64(size)/4, "%d bytes read for %d", read, size)
+	})
+
+	t.Run("sends small messages uncompressed after large ones", func(t *testing.T) {
+		size, read := receive(t, 100)
+		assert.True(t, read > int64(size), "%d bytes read for %d", read, size)
+	})
+}
+
+func TestStreamCompression(t *testing.T) {
+	h := NewHub()
+	h.CompressionThreshold = 512
+	h.CompressStreams = []string{"*.ob-inc"}
+	h.UncompressedStreams = []string{"*.tickers"}
+	go h.ListenWebsocketEvents()
+	defer h.Shutdown()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+	defer srv.Close()
+
+	var counted *countingConn
+	dialer := websocket.Dialer{
+		EnableCompression: true,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			counted = &countingConn{Conn: conn}
+			return counted, err
+		},
+	}
+	h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "ob-snap", Topic: "btcusd.ob-inc", Body: "snapshot"})
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/?stream=btcusd.ob-inc&stream=btcusd.tickers", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Contains(t, readJSON(t, conn), "btcusd.ob-snap")
+	assert.Contains(t, readJSON(t, conn), "success")
+
+	// receive routes a repetitive message and returns its size with the bytes
+	// read from the wire to receive it.
+	receive := func(t *testing.T, typ string, size int) (int, int64) {
+		start := atomic.LoadInt64(&counted.read)
+		h.routeMessage(&Event{
+			Scope:  "public",
+			Stream: "btcusd",
+			Type:   typ,
+			Topic:  "btcusd." + typ,
+			Body:   strings.Repeat("a", size),
+		})
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		return len(data), atomic.LoadInt64(&counted.read) - start
+	}
+
+	t.Run("always compresses the order books", func(t *testing.T) {
+		size, read := receive(t, "ob-inc", 200)
+		assert.True(t, size < h.CompressionThreshold)
+		assert.True(t, read < int64(size)/2, "%d bytes read for %d", read, size)
+	})
+
+	t.Run("never compresses the tickers on the same connection", func(t *testing.T) {
+		size, read := receive(t, "tickers", 4096)
+		assert.True(t, read > int64(size), "%d bytes read for %d", read, size)
+	})
+
+	t.Run("negotiates the compression without threshold", func(t *testing.T) {
+		h := NewHub()
+		h.CompressStreams = []string{"*.ob-inc"}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			NewClient(h, w, r)
+		}))
+		defer srv.Close()
+
+		dialer := websocket.Dialer{EnableCompression: true}
+		conn, res, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Contains(t, res.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	})
+}
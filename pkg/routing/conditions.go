@@ -0,0 +1,62 @@
+package routing
+
+import (
+	msg "github.com/openware/rango/pkg/message"
+)
+
+// matchCondition returns true if the numeric field of a message body compares
+// to the condition value, messages without the field never match.
+func matchCondition(c *msg.Condition, body interface{}) bool {
+	m, ok := body.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	v, ok := toFloat(m[c.Field])
+	if !ok {
+		return false
+	}
+
+	switch c.Op {
+	case ">":
+		return v > c.Value
+	case ">=":
+		return v >= c.Value
+	case "<":
+		return v < c.Value
+	case "<=":
+		return v <= c.Value
+	case "==":
+		return v == c.Value
+	case "!=":
+		return v != c.Value
+	default:
+		return false
+	}
+}
+
+// setCondition replaces the delivery condition of a subscriber, nil removes
+// it.
+func (t *Topic) setCondition(c IClient, cond *msg.Condition) {
+	current := t.conditions.Load().(map[IClient]*msg.Condition)
+	if _, ok := current[c]; !ok && cond == nil {
+		return
+	}
+
+	conditions := make(map[IClient]*msg.Condition, len(current)+1)
+	for client, cc := range current {
+		conditions[client] = cc
+	}
+	if cond == nil {
+		delete(conditions, c)
+	} else {
+		conditions[c] = cond
+	}
+	t.conditions.Store(conditions)
+}
+
+// matches returns true if a message body meets the delivery condition of a
+// subscriber, messages are always delivered to subscribers without condition.
+func (t *Topic) matches(c IClient, body interface{}) bool {
+	cond, ok := t.conditions.Load().(map[IClient]*msg.Condition)[c]
+	return !ok || matchCondition(cond, body)
+}
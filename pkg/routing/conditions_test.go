@@ -0,0 +1,109 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchCondition(t *testing.T) {
+	body := map[string]interface{}{"price": 50000.0, "last": "49000.5"}
+
+	tests := []struct {
+		cond  message.Condition
+		match bool
+	}{
+		{message.Condition{Field: "price", Op: ">", Value: 40000}, true},
+		{message.Condition{Field: "price", Op: ">", Value: 50000}, false},
+		{message.Condition{Field: "price", Op: ">=", Value: 50000}, true},
+		{message.Condition{Field: "price", Op: "<", Value: 50000}, false},
+		{message.Condition{Field: "price", Op: "<=", Value: 50000}, true},
+		{message.Condition{Field: "price", Op: "==", Value: 50000}, true},
+		{message.Condition{Field: "price", Op: "!=", Value: 50000}, false},
+		{message.Condition{Field: "last", Op: "<", Value: 49001}, true},
+		{message.Condition{Field: "volume", Op: ">", Value: 0}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.match, matchCondition(&tt.cond, body), "%s %s %v", tt.cond.Field, tt.cond.Op, tt.cond.Value)
+	}
+
+	assert.False(t, matchCondition(&message.Condition{Field: "price", Op: ">", Value: 0}, []interface{}{1}))
+}
+
+func TestConditionalSubscription(t *testing.T) {
+	h := NewHub()
+
+	subscribe := func(t *testing.T, req string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return("UIDABC00001")
+		c.On("GetSubscriptions").Return([]string{"btcusd.tickers"})
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+
+		parsed, err := message.ParseRequest([]byte(req))
+		require.NoError(t, err)
+		h.handleSubscribe(&Request{client: c, Request: parsed})
+		return c
+	}
+
+	ticker := func(price interface{}) {
+		h.routeMessage(&Event{
+			Scope:  "public",
+			Stream: "btcusd",
+			Type:   "tickers",
+			Topic:  "btcusd.tickers",
+			Body:   map[string]interface{}{"price": price},
+		})
+	}
+
+	conditional := subscribe(t, `{"event":"subscribe","streams":[{"stream":"btcusd.tickers","when":{"field":"price","op":">","value":50000}}]}`)
+	plain := subscribe(t, `{"event":"subscribe","streams":["btcusd.tickers"]}`)
+
+	t.Run("delivers only the messages meeting the condition", func(t *testing.T) {
+		ticker(49000.0)
+		ticker(51000.0)
+		ticker("52000.5")
+		ticker("n/a")
+
+		conditional.AssertNotCalled(t, "SendStream", "btcusd.tickers", `{"btcusd.tickers":{"price":49000}}`)
+		conditional.AssertCalled(t, "SendStream", "btcusd.tickers", `{"btcusd.tickers":{"price":51000}}`)
+		conditional.AssertCalled(t, "SendStream", "btcusd.tickers", `{"btcusd.tickers":{"price":"52000.5"}}`)
+		conditional.AssertNotCalled(t, "SendStream", "btcusd.tickers", `{"btcusd.tickers":{"price":"n/a"}}`)
+		plain.AssertNumberOfCalls(t, "SendStream", 4)
+	})
+
+	t.Run("subscribing again without condition removes it", func(t *testing.T) {
+		h.handleSubscribe(&Request{client: conditional, Request: message.Request{Streams: []string{"btcusd.tickers"}}})
+		ticker(1.0)
+		conditional.AssertCalled(t, "SendStream", "btcusd.tickers", `{"btcusd.tickers":{"price":1}}`)
+	})
+
+	t.Run("applies to private streams", func(t *testing.T) {
+		c := subscribe(t, `{"event":"subscribe","streams":[{"stream":"order","when":{"field":"volume","op":">=","value":10}}]}`)
+		order := func(volume float64) {
+			h.routeMessage(&Event{Scope: "private", Stream: "UIDABC00001", Type: "order", Topic: "order", Body: map[string]interface{}{"volume": volume}})
+		}
+		order(5)
+		order(10)
+
+		c.AssertNotCalled(t, "SendStream", "order", `{"order":{"volume":5}}`)
+		c.AssertCalled(t, "SendStream", "order", `{"order":{"volume":10}}`)
+	})
+
+	t.Run("rejects invalid conditions", func(t *testing.T) {
+		for _, when := range []string{
+			`"price>1"`,
+			`{"op":">","value":1}`,
+			`{"field":"price","op":"~","value":1}`,
+			`{"field":"price","op":">","value":"1"}`,
+		} {
+			_, err := message.ParseRequest([]byte(`{"event":"subscribe","streams":[{"stream":"btcusd.tickers","when":` + when + `}]}`))
+			assert.Error(t, err, when)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package routing
+
+import "context"
+
+// clientKey is the context key of the connection a context belongs to.
+type clientKey struct{}
+
+// Context returns the context of the connection, passed to the pluggable
+// hooks of the hub. It carries the connection metadata read with ConnUID,
+// ConnActor, ConnID and ConnTag, and is done once the connection is closed or
+// the hub shuts down.
+func (c *Client) Context() context.Context {
+	if c.ctx == nil {
+		return context.WithValue(context.Background(), clientKey{}, c)
+	}
+	return c.ctx
+}
+
+// clientContext returns the context of the connection of a client or session,
+// the background context for other clients.
+func clientContext(client IClient) context.Context {
+	if c, ok := churnClient(client).(*Client); ok {
+		return c.Context()
+	}
+	return context.Background()
+}
+
+func contextClient(ctx context.Context) *Client {
+	c, _ := ctx.Value(clientKey{}).(*Client)
+	return c
+}
+
+// ConnUID returns the UID of the connection of the context, empty if it is
+// anonymous or the context has no connection.
+func ConnUID(ctx context.Context) string {
+	if c := contextClient(ctx); c != nil {
+		return c.GetUID()
+	}
+	return ""
+}
+
+// ConnActor returns the UID of the account acting on behalf of ConnUID, empty
+// if the connection is not delegated.
+func ConnActor(ctx context.Context) string {
+	if c := contextClient(ctx); c != nil {
+		return c.actorUID
+	}
+	return ""
+}
+
+// ConnID returns the random identifier of the connection of the context.
+func ConnID(ctx context.Context) string {
+	if c := contextClient(ctx); c != nil {
+		return c.connID
+	}
+	return ""
+}
+
+// ConnTag returns the value of a tag of the connection of the context, like
+// its region, empty if the tag was not captured.
+func ConnTag(ctx context.Context, tag string) string {
+	if c := contextClient(ctx); c != nil {
+		return c.tags[tag]
+	}
+	return ""
+}
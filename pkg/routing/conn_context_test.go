@@ -0,0 +1,72 @@
+package routing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// regionAuthorizer is a StreamAuthorizer allowing the private streams to the
+// connections of a region only.
+type regionAuthorizer struct {
+	region string
+	ctx    chan context.Context
+}
+
+func (a *regionAuthorizer) CanSubscribe(ctx context.Context, uid, stream string) bool {
+	a.ctx <- ctx
+	return ConnUID(ctx) == uid && ConnTag(ctx, "region") == a.region
+}
+
+func TestConnContext(t *testing.T) {
+	a := &regionAuthorizer{region: "eu", ctx: make(chan context.Context, 10)}
+	h := NewHub()
+	h.TagHeaders = map[string]string{"region": "X-Region"}
+	h.StreamAuthorizer = a
+	go h.ListenWebsocketEvents()
+	defer h.Shutdown()
+
+	subscribed := func(uid string) bool {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		_, ok := h.PrivateTopics[uid]["order"]
+		return ok
+	}
+
+	t.Run("the authorizer reads the connection tags", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/?stream=order", http.Header{"JwtUID": {"UIDABC00001"}, "X-Region": {"eu"}})
+		defer teardown()
+		assert.Contains(t, readJSON(t, conn), "success")
+
+		ctx := <-a.ctx
+		assert.Equal(t, "UIDABC00001", ConnUID(ctx))
+		assert.Equal(t, "eu", ConnTag(ctx, "region"))
+		assert.Len(t, ConnID(ctx), 16)
+		assert.Equal(t, "", ConnActor(ctx))
+		assert.True(t, subscribed("UIDABC00001"))
+
+		teardown()
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("context not canceled on close")
+		}
+	})
+
+	t.Run("the authorizer rejects the other regions", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/?stream=order", http.Header{"JwtUID": {"UIDABC00002"}, "X-Region": {"us"}})
+		defer teardown()
+		assert.Contains(t, readJSON(t, conn), "success")
+
+		assert.Equal(t, "us", ConnTag(<-a.ctx, "region"))
+		assert.False(t, subscribed("UIDABC00002"))
+	})
+
+	t.Run("contexts without connection have no metadata", func(t *testing.T) {
+		assert.Equal(t, "", ConnUID(context.Background()))
+		assert.Equal(t, "", ConnTag(context.Background(), "region"))
+	})
+}
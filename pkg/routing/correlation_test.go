@@ -0,0 +1,74 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCorrelationID(t *testing.T) {
+	h := NewHub()
+	h.AckStreams = []string{"trade"}
+
+	c := &MockedClient{}
+	c.On("GetUID").Return("UIDABC00001")
+	c.On("GetSubscriptions").Return([]string{"btcusd.trades", "btcusd.ob-inc", "order", "trade"})
+	c.On("GetResumeID").Return("")
+	c.On("SubscribePublic", mock.Anything).Return()
+	c.On("SubscribePrivate", mock.Anything).Return()
+	c.On("Send", mock.Anything).Return()
+	c.On("SendStream", mock.Anything, mock.Anything).Return()
+	h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"btcusd.trades", "btcusd.ob-inc", "order", "trade"}}})
+
+	received := func(stream string) []string {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+
+		var bodies []string
+		for _, call := range c.Calls {
+			if call.Method == "SendStream" && call.Arguments[0] == stream {
+				bodies = append(bodies, call.Arguments[1].(string))
+			}
+		}
+		return bodies
+	}
+
+	t.Run("forwards the correlation ID of the source messages", func(t *testing.T) {
+		deliveries := make(chan amqp.Delivery, 3)
+		go h.ListenAMQP(deliveries)
+
+		deliveries <- amqp.Delivery{RoutingKey: "public.btcusd.trades", CorrelationId: "trace-1", Body: []byte(`{"id":1}`)}
+		deliveries <- amqp.Delivery{RoutingKey: "private.UIDABC00001.order", CorrelationId: "trace-2", Body: []byte(`{"id":2}`)}
+		deliveries <- amqp.Delivery{RoutingKey: "public.btcusd.trades", Body: []byte(`{"id":3}`)}
+
+		waitFor(t, func() bool { return len(received("btcusd.trades")) == 2 })
+		assert.Equal(t, []string{
+			`{"btcusd.trades":{"id":1},"correlation_id":"trace-1"}`,
+			`{"btcusd.trades":{"id":3}}`,
+		}, received("btcusd.trades"))
+		assert.Equal(t, []string{`{"correlation_id":"trace-2","order":{"id":2}}`}, received("order"))
+	})
+
+	t.Run("forwards the correlation ID of published messages", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		PublishHandler(h)(w, httptest.NewRequest(http.MethodPost, "/publish", strings.NewReader(`{"stream":"trade","uid":"UIDABC00001","message":{"id":4},"correlation_id":"trace-4"}`)))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, []string{`{"correlation_id":"trace-4","trade":{"id":4}}`}, received("trade"))
+	})
+
+	t.Run("keeps the correlation ID of increments", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "ob-snap", Topic: "btcusd.ob-inc", Body: []interface{}{1}, CorrelationID: "trace-5"})
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "ob-inc", Topic: "btcusd.ob-inc", Body: []interface{}{2}, CorrelationID: "trace-6"})
+		assert.Equal(t, []string{`{"btcusd.ob-inc":[2],"correlation_id":"trace-6"}`}, received("btcusd.ob-inc"))
+
+		o := h.IncrementalObjects["btcusd.ob-inc"]
+		assert.Equal(t, `{"btcusd.ob-snap":[1],"correlation_id":"trace-5"}`, o.Snapshot)
+		assert.Equal(t, []string{`{"btcusd.ob-inc":[2],"correlation_id":"trace-6"}`}, o.Increments)
+	})
+}
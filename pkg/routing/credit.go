@@ -0,0 +1,47 @@
+package routing
+
+import (
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// grantCredits allows the writer of the client to write n more stream
+// messages. Once a client granted credits, its stream messages wait in the
+// send buffer while it has none left, the slow client policy applies if the
+// buffer fills up. It runs in the client reader.
+func (c *Client) grantCredits(n int64) {
+	if atomic.SwapInt32(&c.creditFlow, 1) == 0 {
+		log.Debug().Msgf("Credit based flow control enabled (%s)", c.GetUID())
+	}
+	atomic.AddInt64(&c.credits, n)
+	select {
+	case c.credited <- struct{}{}:
+	default:
+	}
+}
+
+// hasCredit returns true if the writer may write a stream message, always
+// without credit based flow control.
+func (c *Client) hasCredit() bool {
+	return atomic.LoadInt32(&c.creditFlow) == 0 || atomic.LoadInt64(&c.credits) > 0
+}
+
+// replyLane returns the send buffer of the messages of the client which are
+// not stream messages, like the responses to its requests. Under credit based
+// flow control they take the priority lane, so that they do not wait behind
+// the paused stream messages.
+func (c *Client) replyLane() chan outbound {
+	if c.priority != nil && atomic.LoadInt32(&c.creditFlow) == 1 {
+		return c.priority
+	}
+	return c.send
+}
+
+// spendCredit counts a stream message written under credit based flow
+// control.
+func (c *Client) spendCredit() {
+	if atomic.LoadInt32(&c.creditFlow) == 1 {
+		atomic.AddInt64(&c.credits, -1)
+	}
+}
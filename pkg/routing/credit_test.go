@@ -0,0 +1,83 @@
+package routing
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreditFlowControl(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+	defer h.Shutdown()
+
+	conn, teardown := dial(t, h, "/?stream=eurusd.trades", nil)
+	defer teardown()
+	assert.Contains(t, readJSON(t, conn), "success")
+
+	var c *Client
+	h.mutex.Lock()
+	for client := range h.connections {
+		c = client
+	}
+	h.mutex.Unlock()
+
+	trades := func(from, to int) {
+		for i := from; i <= to; i++ {
+			h.routeMessage(&Event{Scope: "public", Stream: "eurusd", Type: "trades", Topic: "eurusd.trades", Body: i})
+		}
+	}
+	receive := func(t *testing.T, from, to int) {
+		for i := from; i <= to; i++ {
+			assert.Equal(t, map[string]interface{}{"eurusd.trades": float64(i)}, readJSON(t, conn))
+		}
+	}
+
+	t.Run("delivers without credits by default", func(t *testing.T) {
+		trades(1, 3)
+		receive(t, 1, 3)
+	})
+
+	t.Run("pauses the delivery at zero credit", func(t *testing.T) {
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "credit", "n": 2}))
+		waitFor(t, func() bool { return atomic.LoadInt32(&c.creditFlow) == 1 })
+
+		trades(4, 8)
+		receive(t, 4, 5)
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, 3, len(c.send))
+		assert.False(t, c.hasCredit())
+	})
+
+	t.Run("answers the requests at zero credit", func(t *testing.T) {
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "subscribe", "streams": []string{"btcusd.trades"}}))
+		assert.Contains(t, readJSON(t, conn), "success")
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "whoami"}))
+		assert.Contains(t, readJSON(t, conn), "conn_id")
+		assert.Equal(t, 3, len(c.send))
+	})
+
+	t.Run("resumes when credits are granted", func(t *testing.T) {
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "credit", "n": 10}))
+		receive(t, 6, 8)
+
+		trades(9, 9)
+		receive(t, 9, 9)
+		waitFor(t, func() bool { return len(c.send) == 0 })
+	})
+
+	t.Run("rejects invalid credits", func(t *testing.T) {
+		for _, n := range []string{`0`, `-1`, `1.5`, `"5"`, `1e12`} {
+			_, err := message.ParseRequest([]byte(fmt.Sprintf(`{"event":"credit","n":%s}`, n)))
+			assert.Error(t, err, n)
+		}
+		req, err := message.ParseRequest([]byte(`{"event":"credit","n":100}`))
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), req.Credits)
+	})
+}
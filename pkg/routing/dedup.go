@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"time"
+
+	"github.com/openware/rango/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// dedupEntry is a message hash remembered by the deduplication of the hub.
+type dedupEntry struct {
+	hash uint64
+	at   time.Time
+}
+
+// duplicate returns true if the same message of the same stream was routed
+// during the deduplication window, the hub mutex must be held. At most
+// DedupSize hashes are remembered, the oldest are forgotten first.
+func (h *Hub) duplicate(msg *Event) bool {
+	if h.DedupWindow <= 0 || h.DedupSize <= 0 || !contains(h.DedupStreams, msg.Topic) {
+		return false
+	}
+
+	body, err := json.Marshal(msg.Body)
+	if err != nil {
+		return false
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(msg.Scope + "." + msg.Stream + "." + msg.Type))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	sum := hash.Sum64()
+
+	now := h.Clock.Now()
+	for len(h.dedupOrder) != 0 && now.Sub(h.dedupOrder[0].at) >= h.DedupWindow {
+		h.forgetOldestHash()
+	}
+
+	if _, ok := h.dedupSeen[sum]; ok {
+		log.Debug().Msgf("Dropping duplicate %s message", msg.Topic)
+		metrics.RecordDuplicateMessage(h.streamLabel(msg.Topic))
+		return true
+	}
+
+	if len(h.dedupOrder) >= h.DedupSize {
+		h.forgetOldestHash()
+	}
+	h.dedupSeen[sum] = now
+	h.dedupOrder = append(h.dedupOrder, dedupEntry{hash: sum, at: now})
+	return false
+}
+
+func (h *Hub) forgetOldestHash() {
+	oldest := h.dedupOrder[0]
+	h.dedupOrder[0] = dedupEntry{}
+	h.dedupOrder = h.dedupOrder[1:]
+	delete(h.dedupSeen, oldest.hash)
+}
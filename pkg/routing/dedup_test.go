@@ -0,0 +1,87 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDedup(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.DedupStreams = []string{"btcusd.trades", "order"}
+	h.DedupWindow = time.Second
+	h.DedupSize = 3
+
+	c := &MockedClient{}
+	c.On("GetUID").Return("UIDABC00001")
+	c.On("GetSubscriptions").Return([]string{"btcusd.trades", "ethusd.trades", "order"})
+	c.On("SubscribePublic", mock.Anything).Return()
+	c.On("SubscribePrivate", mock.Anything).Return()
+	c.On("Send", mock.Anything).Return()
+	c.On("SendStream", mock.Anything, mock.Anything).Return()
+	h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"btcusd.trades", "ethusd.trades", "order"}}})
+
+	trade := func(market string, id int) {
+		h.routeMessage(&Event{Scope: "public", Stream: market, Type: "trades", Topic: market + ".trades", Body: map[string]interface{}{"id": id}})
+	}
+	deliveries := func(stream, body string) int {
+		n := 0
+		for _, call := range c.Calls {
+			if call.Method == "SendStream" && call.Arguments[0] == stream && call.Arguments[1] == body {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("drops a duplicate within the window", func(t *testing.T) {
+		trade("btcusd", 1)
+		trade("btcusd", 1)
+		assert.Equal(t, 1, deliveries("btcusd.trades", `{"btcusd.trades":{"id":1}}`))
+	})
+
+	t.Run("delivers a distinct message", func(t *testing.T) {
+		trade("btcusd", 2)
+		assert.Equal(t, 1, deliveries("btcusd.trades", `{"btcusd.trades":{"id":2}}`))
+	})
+
+	t.Run("delivers a duplicate after the window", func(t *testing.T) {
+		clock.Advance(time.Second)
+		trade("btcusd", 1)
+		assert.Equal(t, 2, deliveries("btcusd.trades", `{"btcusd.trades":{"id":1}}`))
+	})
+
+	t.Run("ignores other streams", func(t *testing.T) {
+		trade("ethusd", 1)
+		trade("ethusd", 1)
+		assert.Equal(t, 2, deliveries("ethusd.trades", `{"ethusd.trades":{"id":1}}`))
+	})
+
+	t.Run("forgets the oldest hashes beyond the size", func(t *testing.T) {
+		for id := 10; id < 14; id++ {
+			trade("btcusd", id)
+		}
+		assert.Len(t, h.dedupSeen, 3)
+		assert.Len(t, h.dedupOrder, 3)
+
+		trade("btcusd", 10)
+		assert.Equal(t, 2, deliveries("btcusd.trades", `{"btcusd.trades":{"id":10}}`))
+		trade("btcusd", 13)
+		assert.Equal(t, 1, deliveries("btcusd.trades", `{"btcusd.trades":{"id":13}}`))
+	})
+
+	t.Run("distinguishes the users of private streams", func(t *testing.T) {
+		order := func(uid string) {
+			h.routeMessage(&Event{Scope: "private", Stream: uid, Type: "order", Topic: "order", Body: map[string]interface{}{"id": 1}})
+		}
+		order("UIDABC00002")
+		order("UIDABC00001")
+		order("UIDABC00001")
+		assert.Equal(t, 1, deliveries("order", `{"order":{"id":1}}`))
+	})
+}
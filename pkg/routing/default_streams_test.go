@@ -0,0 +1,51 @@
+package routing
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultStreams(t *testing.T) {
+	h := NewHub()
+	h.DefaultStreams = []string{"system.status", "notifications"}
+	go h.ListenWebsocketEvents()
+
+	t.Run("subscribes a new connection to the default streams", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/?stream=btcusd.trades", http.Header{"JwtUID": []string{"UIDABC00001"}})
+		defer teardown()
+		res := readJSON(t, conn)
+		assert.Equal(t, []interface{}{"btcusd.trades", "system.status", "notifications"}, res["success"].(map[string]interface{})["streams"])
+
+		h.routeMessage(&Event{Scope: "public", Stream: "system", Type: "status", Topic: "system.status", Body: "ok"})
+		assert.Equal(t, map[string]interface{}{"system.status": "ok"}, readJSON(t, conn))
+
+		h.routeMessage(&Event{Scope: "private", Stream: "UIDABC00001", Type: "notifications", Topic: "notifications", Body: 1.0})
+		assert.Equal(t, map[string]interface{}{"notifications": 1.0}, readJSON(t, conn))
+	})
+
+	t.Run("skips the private default streams of an anonymous connection", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/", nil)
+		defer teardown()
+		res := readJSON(t, conn)
+		assert.Equal(t, []interface{}{"system.status"}, res["success"].(map[string]interface{})["streams"])
+	})
+
+	t.Run("default streams do not exempt from the subscribe deadline", func(t *testing.T) {
+		h.SubscribeDeadline = 50 * time.Millisecond
+		defer func() { h.SubscribeDeadline = 0 }()
+
+		conn, teardown := dial(t, h, "/", nil)
+		defer teardown()
+		readJSON(t, conn)
+		assert.Equal(t, map[string]interface{}{"event": "disconnect", "reason": "no subscription received"}, readJSON(t, conn))
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err := conn.ReadMessage()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no subscription received")
+	})
+}
@@ -0,0 +1,54 @@
+package routing
+
+import (
+	"context"
+	"net/http"
+)
+
+// Authorizer decides whether an authenticated account may act on behalf of
+// another user. The context is the one of the connection, or of the
+// connection request while it is upgraded.
+type Authorizer interface {
+	CanImpersonate(ctx context.Context, actor, target string) bool
+}
+
+// Delegations is an Authorizer listing the users each service account may act
+// on behalf of, "*" allows any user.
+type Delegations map[string][]string
+
+func (d Delegations) CanImpersonate(ctx context.Context, actor, target string) bool {
+	for _, uid := range d[actor] {
+		if uid == target || uid == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// canImpersonate returns true if the actor is authenticated and allowed to
+// act on behalf of the target.
+func (h *Hub) canImpersonate(ctx context.Context, actor, target string) bool {
+	h.mutex.Lock()
+	authorizer := h.Authorizer
+	h.mutex.Unlock()
+
+	return actor != "" && authorizer != nil && authorizer.CanImpersonate(ctx, actor, target)
+}
+
+// RequestUID returns the UID of a connection request from the first non-empty
+// of the UID headers, or else from its verified client certificate. Only the
+// JwtUID header set from the token is read without UID headers, the others
+// must be set by a trusted proxy.
+func (h *Hub) RequestUID(r *http.Request) string {
+	if len(h.UIDHeaders) == 0 {
+		if uid := r.Header.Get("JwtUID"); uid != "" {
+			return uid
+		}
+	}
+	for _, name := range h.UIDHeaders {
+		if uid := r.Header.Get(name); uid != "" {
+			return uid
+		}
+	}
+	return h.certificateUID(r)
+}
@@ -0,0 +1,151 @@
+package routing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegations(t *testing.T) {
+	d := Delegations{
+		"UIDSVC00001": []string{"UIDABC00001"},
+		"UIDSVC00002": []string{"*"},
+	}
+	ctx := context.Background()
+
+	assert.True(t, d.CanImpersonate(ctx, "UIDSVC00001", "UIDABC00001"))
+	assert.False(t, d.CanImpersonate(ctx, "UIDSVC00001", "UIDABC00002"))
+	assert.True(t, d.CanImpersonate(ctx, "UIDSVC00002", "UIDABC00002"))
+	assert.False(t, d.CanImpersonate(ctx, "UIDABC00001", "UIDSVC00001"))
+}
+
+func TestDelegatedConnection(t *testing.T) {
+	h := NewHub()
+	h.Authorizer = Delegations{"UIDSVC00001": []string{"UIDABC00001"}}
+	go h.ListenWebsocketEvents()
+
+	header := func(target string) http.Header {
+		return http.Header{
+			"JwtUID":        []string{"UIDSVC00001"},
+			"JwtOnBehalfOf": []string{target},
+		}
+	}
+	order := func(uid string, id int) {
+		h.routeMessage(&Event{
+			Scope:  "private",
+			Stream: uid,
+			Type:   "order",
+			Topic:  "order",
+			Body:   map[string]interface{}{"id": id},
+		})
+	}
+
+	t.Run("routes private streams of the target when authorized", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/?stream=order", header("UIDABC00001"))
+		defer teardown()
+		assert.Contains(t, readJSON(t, conn), "success")
+
+		order("UIDSVC00001", 1)
+		order("UIDABC00001", 2)
+		assert.Equal(t, map[string]interface{}{"order": map[string]interface{}{"id": 2.0}}, readJSON(t, conn))
+	})
+
+	t.Run("rejects the connection when not authorized", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			NewClient(h, w, r)
+		}))
+		defer srv.Close()
+
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?stream=order"
+		for _, hd := range []http.Header{
+			header("UIDABC00002"),
+			{"JwtOnBehalfOf": []string{"UIDABC00001"}},
+		} {
+			conn, res, err := websocket.DefaultDialer.Dial(url, hd)
+			require.Error(t, err)
+			assert.Nil(t, conn)
+			assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		}
+	})
+}
+
+func TestRequestUID(t *testing.T) {
+	h := NewHub()
+	request := func(header http.Header) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header = header
+		return r
+	}
+
+	t.Run("reads JwtUID by default", func(t *testing.T) {
+		assert.Equal(t, "UIDABC00001", h.RequestUID(request(http.Header{"Jwtuid": {"UIDABC00001"}})))
+		assert.Equal(t, "", h.RequestUID(request(http.Header{"X-Auth-Uid": {"UIDABC00002"}})))
+	})
+
+	h.UIDHeaders = []string{"JwtUID", "X-Auth-UID"}
+
+	t.Run("prefers the first header", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("JwtUID", "UIDABC00001")
+		header.Set("X-Auth-UID", "UIDABC00002")
+		assert.Equal(t, "UIDABC00001", h.RequestUID(request(header)))
+	})
+
+	t.Run("falls back to the next header when the first is empty", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("JwtUID", "")
+		header.Set("X-Auth-UID", "UIDABC00002")
+		assert.Equal(t, "UIDABC00002", h.RequestUID(request(header)))
+	})
+
+	t.Run("authenticates a connection from the fallback header", func(t *testing.T) {
+		go h.ListenWebsocketEvents()
+		conn, teardown := dial(t, h, "/?stream=order", http.Header{"X-Auth-UID": {"UIDABC00002"}})
+		defer teardown()
+		assert.Contains(t, readJSON(t, conn), "success")
+
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "whoami"}))
+		assert.Equal(t, "UIDABC00002", readJSON(t, conn)["uid"])
+	})
+}
+
+func TestRequireAuth(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+	defer h.Shutdown()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/"
+
+	t.Run("accepts anonymous connections by default", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Contains(t, readJSON(t, conn), "success")
+	})
+
+	h.RequireAuth = true
+
+	t.Run("rejects anonymous connections", func(t *testing.T) {
+		conn, res, err := websocket.DefaultDialer.Dial(url, nil)
+		require.Error(t, err)
+		assert.Nil(t, conn)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("accepts authenticated connections", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"JwtUID": {"UIDABC00001"}})
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Contains(t, readJSON(t, conn), "success")
+	})
+}
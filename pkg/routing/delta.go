@@ -0,0 +1,152 @@
+package routing
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// deltaState is what a subscriber receiving deltas was sent, its fields are
+// guarded by the hub mutex.
+type deltaState struct {
+	// Last message bodies sent by stream
+	last map[string]interface{}
+
+	// Messages dropped for the subscriber before the last one was sent
+	drops int64
+}
+
+// setDelta makes a subscriber receive deltas between its consecutive
+// messages, or full messages again if not enabled. Enabling it again makes
+// the next message full.
+func (t *Topic) setDelta(c IClient, enabled bool) {
+	current := t.deltas.Load().(map[IClient]*deltaState)
+	if _, ok := current[c]; !ok && !enabled {
+		return
+	}
+
+	deltas := make(map[IClient]*deltaState, len(current)+1)
+	for client, d := range current {
+		deltas[client] = d
+	}
+	if enabled {
+		deltas[c] = &deltaState{last: make(map[string]interface{}), drops: droppedMessages(c)}
+	} else {
+		delete(deltas, c)
+	}
+	t.deltas.Store(deltas)
+}
+
+// deliver sends a message of a stream of the topic to a subscriber meeting
+// its delivery condition, as a delta if it asked for them. Once a message was
+// dropped for the subscriber, the next one is full again since it may not
+// have received the last body.
+func (t *Topic) deliver(c IClient, stream string, p *payload, data interface{}) {
+	if !t.matches(c, data) {
+		return
+	}
+	d, ok := t.deltas.Load().(map[IClient]*deltaState)[c]
+	if !ok {
+		p.send(c, stream)
+		return
+	}
+
+	if drops := droppedMessages(c); drops != d.drops {
+		d.last, d.drops = make(map[string]interface{}), drops
+	}
+	if body := t.hub.delta(d.last, stream, p.text, data); body != p.text {
+		c.SendStream(stream, body)
+		return
+	}
+	p.send(c, stream)
+}
+
+// droppedMessages returns the number of messages dropped for a slow client,
+// zero for the clients not counting them.
+func droppedMessages(client IClient) int64 {
+	if c, ok := churnClient(client).(*Client); ok {
+		return atomic.LoadInt64(&c.drops)
+	}
+	return 0
+}
+
+// delta returns the message of a stream for a subscriber receiving deltas,
+// given the last message bodies sent to it by stream. It is the JSON merge
+// patch from the last body on the stream suffixed by .delta, like
+// {"btcusd.tickers.delta":{"last":"9121.0"}}, or the full message if it is
+// the first one or the patch cannot express it. The hub mutex must be held.
+func (h *Hub) delta(last map[string]interface{}, stream, full string, data interface{}) string {
+	prev, sent := last[stream]
+	last[stream] = data
+	if !sent {
+		return full
+	}
+
+	patch, ok := mergePatch(prev, data)
+	if !ok {
+		return full
+	}
+	b, err := h.encode(stream+".delta", patch)
+	if err != nil {
+		return full
+	}
+	return b
+}
+
+// mergePatch returns the JSON merge patch (RFC 7386) turning prev into cur, ok
+// is false if cur is not an object or has null values in objects, which a
+// merge patch cannot set.
+func mergePatch(prev, cur interface{}) (map[string]interface{}, bool) {
+	curObj, ok := cur.(map[string]interface{})
+	if !ok || hasNull(curObj) {
+		return nil, false
+	}
+	prevObj, ok := prev.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return diffObjects(prevObj, curObj), true
+}
+
+func diffObjects(prev, cur map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for k, v := range cur {
+		p, ok := prev[k]
+		if !ok {
+			patch[k] = v
+			continue
+		}
+		pObj, pIsObj := p.(map[string]interface{})
+		vObj, vIsObj := v.(map[string]interface{})
+		if pIsObj && vIsObj {
+			if sub := diffObjects(pObj, vObj); len(sub) != 0 {
+				patch[k] = sub
+			}
+			continue
+		}
+		if !reflect.DeepEqual(p, v) {
+			patch[k] = v
+		}
+	}
+	for k := range prev {
+		if _, ok := cur[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
+
+// hasNull returns true if an object or one of its nested objects has a null
+// value, arrays are replaced as a whole by a patch and may have some.
+func hasNull(obj map[string]interface{}) bool {
+	for _, v := range obj {
+		switch v := v.(type) {
+		case nil:
+			return true
+		case map[string]interface{}:
+			if hasNull(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
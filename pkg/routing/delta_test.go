@@ -0,0 +1,189 @@
+package routing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// applyPatch applies a JSON merge patch to an object like a client would.
+func applyPatch(target, patch map[string]interface{}) map[string]interface{} {
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(target, k)
+		case map[string]interface{}:
+			sub, ok := target[k].(map[string]interface{})
+			if !ok {
+				sub = map[string]interface{}{}
+			}
+			target[k] = applyPatch(sub, v)
+		default:
+			target[k] = v
+		}
+	}
+	return target
+}
+
+func TestMergePatch(t *testing.T) {
+	prev := map[string]interface{}{
+		"last": "9120.0",
+		"vol":  "10.5",
+		"at":   1588000000.0,
+		"book": map[string]interface{}{"bid": "9119.0", "ask": "9121.0"},
+		"tags": []interface{}{"a"},
+	}
+
+	t.Run("contains the changed fields only", func(t *testing.T) {
+		cur := map[string]interface{}{
+			"last": "9122.0",
+			"vol":  "10.5",
+			"book": map[string]interface{}{"bid": "9119.0", "ask": "9123.0"},
+			"tags": []interface{}{"a", nil},
+			"high": "9200.0",
+		}
+		patch, ok := mergePatch(prev, cur)
+		require.True(t, ok)
+		assert.Equal(t, map[string]interface{}{
+			"last": "9122.0",
+			"at":   nil,
+			"book": map[string]interface{}{"ask": "9123.0"},
+			"tags": []interface{}{"a", nil},
+			"high": "9200.0",
+		}, patch)
+	})
+
+	t.Run("is empty without change", func(t *testing.T) {
+		patch, ok := mergePatch(prev, prev)
+		require.True(t, ok)
+		assert.Empty(t, patch)
+	})
+
+	t.Run("cannot express other values", func(t *testing.T) {
+		for _, cur := range []interface{}{
+			[]interface{}{1},
+			"9120.0",
+			map[string]interface{}{"last": nil},
+			map[string]interface{}{"book": map[string]interface{}{"bid": nil}},
+		} {
+			_, ok := mergePatch(prev, cur)
+			assert.False(t, ok, "%v", cur)
+		}
+		_, ok := mergePatch([]interface{}{1}, prev)
+		assert.False(t, ok)
+	})
+}
+
+func TestDeltaSubscription(t *testing.T) {
+	h := NewHub()
+
+	var received []string
+	c := &MockedClient{}
+	c.On("GetUID").Return("UIDABC00001")
+	c.On("GetSubscriptions").Return([]string{"btcusd.tickers"})
+	c.On("SubscribePublic", mock.Anything).Return()
+	c.On("Send", mock.Anything).Return()
+	c.On("SendStream", "btcusd.tickers", mock.Anything).Run(func(args mock.Arguments) {
+		received = append(received, args.String(1))
+	}).Return()
+
+	plain := &MockedClient{}
+	plain.On("GetUID").Return("")
+	plain.On("GetSubscriptions").Return([]string{"btcusd.tickers"})
+	plain.On("SubscribePublic", mock.Anything).Return()
+	plain.On("Send", mock.Anything).Return()
+	plain.On("SendStream", mock.Anything, mock.Anything).Return()
+
+	subscribe := func(client IClient, req string) {
+		parsed, err := message.ParseRequest([]byte(req))
+		require.NoError(t, err)
+		h.handleSubscribe(&Request{client: client, Request: parsed})
+	}
+	ticker := func(body map[string]interface{}) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "tickers", Topic: "btcusd.tickers", Body: body})
+	}
+
+	subscribe(c, `{"event":"subscribe","streams":[{"stream":"btcusd.tickers","delta":true}]}`)
+	subscribe(plain, `{"event":"subscribe","streams":["btcusd.tickers"]}`)
+
+	states := []map[string]interface{}{
+		{"last": "9120.0", "vol": "10.5", "book": map[string]interface{}{"bid": "9119.0", "ask": "9121.0"}},
+		{"last": "9121.0", "vol": "10.5", "book": map[string]interface{}{"bid": "9119.0", "ask": "9122.0"}},
+		{"last": "9121.0", "vol": "11.0", "book": map[string]interface{}{"bid": "9120.0", "ask": "9122.0"}},
+		{"last": "9118.0", "book": map[string]interface{}{"bid": "9117.0", "ask": "9122.0"}},
+	}
+	for _, s := range states {
+		ticker(s)
+	}
+
+	t.Run("receives a full message then deltas", func(t *testing.T) {
+		require.Len(t, received, 4)
+		assert.JSONEq(t, `{"btcusd.tickers":{"last":"9120.0","vol":"10.5","book":{"bid":"9119.0","ask":"9121.0"}}}`, received[0])
+		assert.JSONEq(t, `{"btcusd.tickers.delta":{"last":"9121.0","book":{"ask":"9122.0"}}}`, received[1])
+		assert.JSONEq(t, `{"btcusd.tickers.delta":{"vol":"11.0","book":{"bid":"9120.0"}}}`, received[2])
+		assert.JSONEq(t, `{"btcusd.tickers.delta":{"last":"9118.0","vol":null,"book":{"bid":"9117.0"}}}`, received[3])
+	})
+
+	t.Run("can reconstruct the current state", func(t *testing.T) {
+		var state map[string]interface{}
+		for i, m := range received {
+			var v map[string]map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(m), &v))
+			if full, ok := v["btcusd.tickers"]; ok {
+				state = full
+			} else {
+				state = applyPatch(state, v["btcusd.tickers.delta"])
+			}
+			assert.Equal(t, states[i], state)
+		}
+	})
+
+	t.Run("does not change the messages of other subscribers", func(t *testing.T) {
+		plain.AssertCalled(t, "SendStream", "btcusd.tickers", `{"btcusd.tickers":{"book":{"ask":"9122.0","bid":"9117.0"},"last":"9118.0"}}`)
+		plain.AssertNumberOfCalls(t, "SendStream", 4)
+	})
+
+	t.Run("sends a full message after subscribing again", func(t *testing.T) {
+		subscribe(c, `{"event":"subscribe","streams":[{"stream":"btcusd.tickers","delta":true}]}`)
+		ticker(states[0])
+		assert.JSONEq(t, `{"btcusd.tickers":{"last":"9120.0","vol":"10.5","book":{"bid":"9119.0","ask":"9121.0"}}}`, received[4])
+	})
+
+	t.Run("sends a full message the patch cannot express", func(t *testing.T) {
+		ticker(map[string]interface{}{"last": nil})
+		assert.JSONEq(t, `{"btcusd.tickers":{"last":null}}`, received[5])
+	})
+}
+
+func TestDeltaAfterDrop(t *testing.T) {
+	h := NewHub()
+	h.SlowClientPolicy = SlowClientDrop
+	c := &Client{
+		hub:     h,
+		send:    make(chan outbound, 1),
+		pubSub:  []string{},
+		privSub: []string{},
+	}
+	parsed, err := message.ParseRequest([]byte(`{"event":"subscribe","streams":[{"stream":"btcusd.tickers","delta":true}]}`))
+	require.NoError(t, err)
+	h.handleSubscribe(&Request{client: c, Request: parsed})
+	<-c.send
+
+	ticker := func(last string) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "tickers", Topic: "btcusd.tickers", Body: map[string]interface{}{"last": last, "vol": "10.5"}})
+	}
+	ticker("9120.0")
+	ticker("9121.0")
+	assert.Equal(t, `{"btcusd.tickers":{"last":"9120.0","vol":"10.5"}}`, string((<-c.send).data))
+
+	// The second ticker was dropped, a delta from it would not apply.
+	ticker("9122.0")
+	assert.Equal(t, `{"btcusd.tickers":{"last":"9122.0","vol":"10.5"}}`, string((<-c.send).data))
+
+	ticker("9123.0")
+	assert.Equal(t, `{"btcusd.tickers.delta":{"last":"9123.0"}}`, string((<-c.send).data))
+}
@@ -0,0 +1,65 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// SubscribedStreams returns the public streams with at least one subscriber in
+// alphabetical order, so that the source may only produce them.
+func (h *Hub) SubscribedStreams() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	streams := make([]string, 0, len(h.PublicTopics))
+	for stream, topic := range h.PublicTopics {
+		if topic.len() != 0 {
+			streams = append(streams, stream)
+		}
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+// demandChanged calls the StreamDemand callback when a public stream gains its
+// first or loses its last subscriber. The hub mutex must be held.
+func (h *Hub) demandChanged(stream string, subscribed bool) {
+	if h.StreamDemand != nil {
+		h.StreamDemand(stream, subscribed)
+	}
+}
+
+// demandReleased notifies the source once of the public streams which lost
+// their last subscriber together, like on disconnect, with the StreamsReleased
+// callback, or with StreamDemand for each stream if it is not set. The hub
+// mutex must be held.
+func (h *Hub) demandReleased(streams []string) {
+	if len(streams) == 0 {
+		return
+	}
+	sort.Strings(streams)
+	if h.StreamsReleased == nil {
+		for _, stream := range streams {
+			h.demandChanged(stream, false)
+		}
+		return
+	}
+	h.StreamsReleased(streams)
+}
+
+// DemandHandler returns an HTTP handler serving the public streams with
+// subscribers, like {"streams":["btcusd.trades"]}, for sources polling them.
+func DemandHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"streams": h.SubscribedStreams(),
+		})
+	}
+}
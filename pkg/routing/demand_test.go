@@ -0,0 +1,107 @@
+package routing
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStreamDemand(t *testing.T) {
+	h := NewHub()
+	var events []string
+	h.StreamDemand = func(stream string, subscribed bool) {
+		events = append(events, fmt.Sprintf("%s:%t", stream, subscribed))
+	}
+	newClient := func(uid string, streams ...string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return(uid)
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("UnsubscribePublic", mock.Anything).Return()
+		c.On("UnsubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+		return c
+	}
+	unsubscribe := func(c IClient, streams ...string) {
+		h.handleUnsubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+	}
+
+	t.Run("fires on the first subscriber", func(t *testing.T) {
+		c1 := newClient("UIDABC00001", "btcusd.trades", "order")
+		assert.Equal(t, []string{"btcusd.trades:true"}, events)
+
+		c2 := newClient("", "btcusd.trades", "ethusd.trades")
+		assert.Equal(t, []string{"btcusd.trades:true", "ethusd.trades:true"}, events)
+		assert.Equal(t, []string{"btcusd.trades", "ethusd.trades"}, h.SubscribedStreams())
+
+		w := httptest.NewRecorder()
+		DemandHandler(h)(w, httptest.NewRequest(http.MethodGet, "/admin/demand", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"streams":["btcusd.trades","ethusd.trades"]}`, w.Body.String())
+
+		t.Run("fires on the last unsubscriber", func(t *testing.T) {
+			events = nil
+			unsubscribe(c1, "btcusd.trades")
+			assert.Empty(t, events)
+
+			unsubscribe(c2, "btcusd.trades")
+			assert.Equal(t, []string{"btcusd.trades:false"}, events)
+			assert.Equal(t, []string{"ethusd.trades"}, h.SubscribedStreams())
+		})
+
+		t.Run("fires when the last subscriber disconnects", func(t *testing.T) {
+			events = nil
+			h.unsubscribeAll(c1)
+			assert.Empty(t, events)
+
+			h.unsubscribeAll(c2)
+			assert.Equal(t, []string{"ethusd.trades:false"}, events)
+			assert.Equal(t, []string{}, h.SubscribedStreams())
+		})
+	})
+
+	t.Run("batches the streams released on disconnect", func(t *testing.T) {
+		var batches [][]string
+		h.StreamsReleased = func(streams []string) {
+			batches = append(batches, streams)
+		}
+		defer func() { h.StreamsReleased = nil }()
+
+		streams := make([]string, 0, 20)
+		for i := 0; i < 20; i++ {
+			streams = append(streams, fmt.Sprintf("market%02d.trades", i))
+		}
+		c1 := newClient("UIDABC00001", streams...)
+		c2 := newClient("", streams[:10]...)
+		events = nil
+
+		h.unsubscribeAll(c1)
+		assert.Equal(t, [][]string{streams[10:]}, batches)
+		h.unsubscribeAll(c2)
+		assert.Equal(t, [][]string{streams[10:], streams[:10]}, batches)
+		assert.Empty(t, events)
+
+		t.Run("single unsubscriptions are not batched", func(t *testing.T) {
+			c := newClient("", "btcusd.trades")
+			unsubscribe(c, "btcusd.trades")
+			assert.Equal(t, []string{"btcusd.trades:true", "btcusd.trades:false"}, events)
+			assert.Len(t, batches, 2)
+		})
+	})
+
+	t.Run("fires when a stream is retired", func(t *testing.T) {
+		newClient("", "xyzusd.trades")
+		newClient("", "xyzusd.trades")
+		events = nil
+		h.RetireStream("xyzusd.trades")
+		assert.Equal(t, []string{"xyzusd.trades:false"}, events)
+	})
+}
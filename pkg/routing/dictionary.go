@@ -0,0 +1,86 @@
+package routing
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// Subprotocol of the clients receiving their messages compressed with the
+// preset dictionary of the hub, only offered when the hub has one.
+const subprotocolDict = "rango.dict"
+
+// Response header of the handshake giving the ID of the preset dictionary.
+const dictionaryHeader = "Rango-Dictionary"
+
+// upgradeSubprotocols returns the subprotocols offered to a connection, in
+// order of preference.
+func (h *Hub) upgradeSubprotocols() []string {
+	if len(h.CompressionDict) == 0 {
+		return subprotocols
+	}
+	return append(subprotocols[:len(subprotocols):len(subprotocols)], subprotocolDict)
+}
+
+// DictionaryID returns the ID of the preset compression dictionary of the hub,
+// the start of its SHA-256 in hexadecimal, empty without dictionary.
+func (h *Hub) DictionaryID() string {
+	if len(h.CompressionDict) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(h.CompressionDict)
+	return hex.EncodeToString(sum[:8])
+}
+
+// upgradeHeader returns the response headers of the handshake of a connection,
+// the ID of the preset dictionary if the hub has one.
+func (h *Hub) upgradeHeader() http.Header {
+	id := h.DictionaryID()
+	if id == "" {
+		return nil
+	}
+	return http.Header{dictionaryHeader: []string{id}}
+}
+
+// newDeflater returns the compressor of the messages of a client which
+// negotiated rango.dict.
+func newDeflater(dict []byte) *flate.Writer {
+	w, err := flate.NewWriterDict(nil, flate.DefaultCompression, dict)
+	if err != nil {
+		panic(err.Error())
+	}
+	return w
+}
+
+// deflate compresses a message of a client which negotiated rango.dict into a
+// raw DEFLATE stream with the preset dictionary, each message on its own. It
+// runs in the writer of the client, the result is valid until the next call.
+func (c *Client) deflate(message []byte) []byte {
+	c.deflated.Reset()
+	c.deflater.Reset(&c.deflated)
+	c.deflater.Write(message)
+	c.deflater.Close()
+	return c.deflated.Bytes()
+}
+
+// DictionaryHandler returns an HTTP handler serving the preset compression
+// dictionary of the hub, e.g. GET /dictionary, with its ID as ETag.
+func DictionaryHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if len(h.CompressionDict) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("ETag", `"`+h.DictionaryID()+`"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(h.CompressionDict))
+	}
+}
@@ -0,0 +1,94 @@
+package routing
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDictionary = []byte(`{"btcusd.tickers":{"at":,"avg_price":"","high":"","last":"","low":"","open":"","price_change_percent":"","volume":""}}`)
+
+func inflate(t *testing.T, dict, data []byte) string {
+	r := flate.NewReaderDict(bytes.NewReader(data), dict)
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestCompressionDictionary(t *testing.T) {
+	h := NewHub()
+	h.CompressionDict = testDictionary
+	go h.ListenWebsocketEvents()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?stream=btcusd.tickers"
+
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocolDict}}
+	conn, res, err := dialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	read := func(t *testing.T) []byte {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		typ, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, websocket.BinaryMessage, typ)
+		return data
+	}
+
+	t.Run("negotiates the dictionary", func(t *testing.T) {
+		assert.Equal(t, subprotocolDict, conn.Subprotocol())
+		assert.Equal(t, h.DictionaryID(), res.Header.Get(dictionaryHeader))
+		assert.Len(t, h.DictionaryID(), 16)
+	})
+
+	t.Run("messages round-trip", func(t *testing.T) {
+		assert.Equal(t, `{"success":{"message":"subscribed","streams":["btcusd.tickers"]}}`, inflate(t, testDictionary, read(t)))
+
+		ticker := map[string]interface{}{"at": 1588000000, "avg_price": "9500.0", "high": "9800.0", "last": "9700.0", "low": "9400.0", "open": "9450.0", "price_change_percent": "+2.65%", "volume": "150.5"}
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "tickers", Topic: "btcusd.tickers", Body: ticker})
+		data := read(t)
+		plain, err := h.encode("btcusd.tickers", ticker)
+		require.NoError(t, err)
+		assert.Equal(t, plain, inflate(t, testDictionary, data))
+
+		// The dictionary compresses better than deflate alone.
+		var generic bytes.Buffer
+		w, err := flate.NewWriter(&generic, flate.DefaultCompression)
+		require.NoError(t, err)
+		w.Write([]byte(plain))
+		w.Close()
+		assert.Less(t, len(data), generic.Len())
+	})
+
+	t.Run("serves the dictionary", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		DictionaryHandler(h)(w, httptest.NewRequest(http.MethodGet, "/dictionary", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, testDictionary, w.Body.Bytes())
+		assert.Equal(t, `"`+h.DictionaryID()+`"`, w.Header().Get("ETag"))
+	})
+
+	t.Run("is not offered without dictionary", func(t *testing.T) {
+		plain, teardown := dial(t, NewHub(), "/", nil)
+		defer teardown()
+		assert.Equal(t, "", plain.Subprotocol())
+
+		w := httptest.NewRecorder()
+		DictionaryHandler(NewHub())(w, httptest.NewRequest(http.MethodGet, "/dictionary", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,20 @@
+package routing
+
+import (
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+)
+
+// disconnectMessage returns the message telling a client why the server
+// closes its connection, like {"event":"disconnect","reason":"token expired"}.
+func disconnectMessage(reason string) []byte {
+	b, err := json.Marshal(map[string]interface{}{
+		"event":  "disconnect",
+		"reason": reason,
+	})
+	if err != nil {
+		log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+	}
+	return b
+}
@@ -0,0 +1,56 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DrainStream unsubscribes all the clients of a stream under maintenance, like
+// the streams of a market whose upstream feed is being fixed, and notifies them
+// with a maintenance event if notify is true. Unlike RetireStream, the stored
+// snapshot is kept and the clients may subscribe again. It returns the number
+// of unsubscribed clients.
+func (h *Hub) DrainStream(stream string, notify bool) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var body []byte
+	if notify {
+		var err error
+		body, err = json.Marshal(map[string]interface{}{
+			"event":  "maintenance",
+			"stream": stream,
+		})
+		if err != nil {
+			log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+			return 0
+		}
+	}
+
+	count := h.removeSubscribers(stream, body)
+	log.Info().Msgf("Stream %s drained, %d subscribers removed", stream, count)
+	return count
+}
+
+// DrainHandler returns an HTTP handler draining the stream of the stream query
+// parameter, its subscribers are not notified with notify=false.
+func DrainHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		stream := r.URL.Query().Get("stream")
+		if stream == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "missing stream")
+			return
+		}
+		notify := r.URL.Query().Get("notify") != "false"
+		fmt.Fprintf(w, "%d subscribers drained\n", h.DrainStream(stream, notify))
+	}
+}
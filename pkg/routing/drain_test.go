@@ -0,0 +1,79 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDrainStream(t *testing.T) {
+	h := NewHub()
+	newClient := func(uid string, streams ...string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return(uid)
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("UnsubscribePublic", mock.Anything).Return()
+		c.On("UnsubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+		return c
+	}
+	notice := `{"event":"maintenance","stream":"btcusd.trades"}`
+
+	c1 := newClient("", "btcusd.trades", "ethusd.trades")
+	c2 := newClient("UIDABC00001", "btcusd.trades", "order")
+	c3 := newClient("UIDABC00002", "ethusd.trades")
+
+	t.Run("notifies and unsubscribes only the subscribers of the stream", func(t *testing.T) {
+		assert.Equal(t, 2, h.DrainStream("btcusd.trades", true))
+
+		for _, c := range []*MockedClient{c1, c2} {
+			c.AssertCalled(t, "Send", notice)
+			c.AssertCalled(t, "UnsubscribePublic", "btcusd.trades")
+		}
+		c3.AssertNotCalled(t, "Send", notice)
+		c3.AssertNotCalled(t, "UnsubscribePublic", mock.Anything)
+		c1.AssertNotCalled(t, "UnsubscribePublic", "ethusd.trades")
+		assert.NotContains(t, h.PublicTopics, "btcusd.trades")
+		assert.Contains(t, h.PrivateTopics["UIDABC00001"], "order")
+		assert.Equal(t, 3, h.subscriptions)
+
+		h.routeMessage(&Event{Scope: "public", Stream: "ethusd", Type: "trades", Topic: "ethusd.trades", Body: "trade"})
+		c1.AssertCalled(t, "SendStream", "ethusd.trades", `{"ethusd.trades":"trade"}`)
+	})
+
+	t.Run("keeps the snapshot of the stream", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "ob-snap", Topic: "btcusd.ob-snap", Body: "snapshot"})
+		c4 := newClient("", "btcusd.ob-inc")
+		h.DrainStream("btcusd.ob-inc", true)
+		c4.AssertCalled(t, "Send", `{"event":"maintenance","stream":"btcusd.ob-inc"}`)
+		assert.Len(t, h.IncrementalObjects, 1)
+	})
+
+	t.Run("unsubscribes silently without notice", func(t *testing.T) {
+		assert.Equal(t, 1, h.DrainStream("order", false))
+		c2.AssertCalled(t, "UnsubscribePrivate", "order")
+		c2.AssertNotCalled(t, "Send", `{"event":"maintenance","stream":"order"}`)
+		assert.NotContains(t, h.PrivateTopics, "UIDABC00001")
+	})
+
+	t.Run("drains over HTTP", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		DrainHandler(h)(w, httptest.NewRequest(http.MethodPost, "/admin/drain?stream=ethusd.trades&notify=false", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2 subscribers drained\n", w.Body.String())
+		c3.AssertNotCalled(t, "Send", `{"event":"maintenance","stream":"ethusd.trades"}`)
+		assert.Equal(t, 0, h.subscriptions)
+
+		w = httptest.NewRecorder()
+		DrainHandler(h)(w, httptest.NewRequest(http.MethodPost, "/admin/drain", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
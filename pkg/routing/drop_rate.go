@@ -0,0 +1,87 @@
+package routing
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/openware/rango/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// MonitorDropRate periodically measures the ratio of the messages dropped for
+// not fitting in the send buffer of a client, the hub is overloaded while it
+// exceeds MaxDropRate.
+func (h *Hub) MonitorDropRate() {
+	if h.MaxDropRate <= 0 || h.DropRateWindow <= 0 {
+		return
+	}
+
+	ticker := h.Clock.NewTicker(h.DropRateWindow)
+	defer ticker.Stop()
+
+	for range ticker.C() {
+		h.measureDropRate()
+	}
+}
+
+// measureDropRate computes the drop ratio of the window and starts a new one.
+func (h *Hub) measureDropRate() {
+	buffered := atomic.SwapInt64(&h.buffered, 0)
+	dropped := atomic.SwapInt64(&h.dropped, 0)
+
+	rate := 0.0
+	if total := buffered + dropped; total > 0 {
+		rate = float64(dropped) / float64(total)
+	}
+	atomic.StoreUint64(&h.dropRate, math.Float64bits(rate))
+
+	overloaded := rate > h.MaxDropRate
+	var flag int32
+	if overloaded {
+		flag = 1
+	}
+	if previous := atomic.SwapInt32(&h.overloaded, flag); previous != flag {
+		if overloaded {
+			log.Warn().Msgf("Hub overloaded, %.1f%% of the messages dropped", rate*100)
+		} else {
+			log.Info().Msgf("Hub recovered, %.1f%% of the messages dropped", rate*100)
+		}
+	}
+	metrics.RecordDropRate(rate, overloaded)
+}
+
+// Overloaded returns true if the drop ratio of the last window exceeds
+// MaxDropRate.
+func (h *Hub) Overloaded() bool {
+	return atomic.LoadInt32(&h.overloaded) == 1
+}
+
+// DropRate returns the drop ratio of the last window.
+func (h *Hub) DropRate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&h.dropRate))
+}
+
+// ReadinessHandler returns an HTTP handler reporting whether the hub accepts
+// more load, it responds with a 503 status while it is overloaded, like
+// {"status":"overloaded","drop_rate":0.12}.
+func ReadinessHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		status := "ok"
+		w.Header().Set("Content-Type", "application/json")
+		if h.Overloaded() {
+			status = "overloaded"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    status,
+			"drop_rate": h.DropRate(),
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDropRate(t *testing.T) {
+	h := NewHub()
+	h.SlowClientPolicy = SlowClientDrop
+	h.MaxDropRate = 0.1
+	c := &Client{hub: h, send: make(chan outbound, 2)}
+	readiness := func(t *testing.T) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		ReadinessHandler(h)(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		var res map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return w.Code, res
+	}
+	drain := func() {
+		for len(c.send) > 0 {
+			<-c.send
+		}
+	}
+
+	t.Run("ready without drops", func(t *testing.T) {
+		c.Send("{}")
+		drain()
+		h.measureDropRate()
+		assert.False(t, h.Overloaded())
+
+		code, res := readiness(t)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, map[string]interface{}{"status": "ok", "drop_rate": 0.0}, res)
+	})
+
+	t.Run("not ready above the threshold", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			c.Send("{}")
+		}
+		drain()
+		h.measureDropRate()
+		assert.True(t, h.Overloaded())
+
+		code, res := readiness(t)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, map[string]interface{}{"status": "overloaded", "drop_rate": 0.8}, res)
+	})
+
+	t.Run("stays ready under the threshold", func(t *testing.T) {
+		for i := 0; i < 19; i++ {
+			c.Send("{}")
+			drain()
+		}
+		c.Send("{}")
+		c.Send("{}")
+		c.Send("{}")
+		drain()
+		h.measureDropRate()
+		assert.InDelta(t, 1.0/22, h.DropRate(), 1e-9)
+		assert.False(t, h.Overloaded())
+
+		code, _ := readiness(t)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("an idle window is not overloaded", func(t *testing.T) {
+		h.measureDropRate()
+		assert.Equal(t, 0.0, h.DropRate())
+		assert.False(t, h.Overloaded())
+	})
+}
@@ -0,0 +1,72 @@
+package routing
+
+import (
+	"sort"
+
+	msg "github.com/openware/rango/pkg/message"
+	"github.com/rs/zerolog/log"
+)
+
+// Behaviors of the TokenExpiry hub setting.
+const (
+	// TokenExpiryAnonymous unsubscribes the client from its private streams
+	// and makes it anonymous, or closes it like TokenExpiryClose if the hub
+	// requires authentication.
+	TokenExpiryAnonymous = "anonymous"
+
+	// TokenExpiryClose closes the connection of the client.
+	TokenExpiryClose = "close"
+)
+
+// expireToken applies the token expiry behavior of the hub to the client, it
+// returns false if the connection must be closed. It runs in the client
+// writer.
+func (c *Client) expireToken() bool {
+	behavior := c.hub.TokenExpiry
+	// The hub never accepts anonymous clients with RequireAuth.
+	if behavior == TokenExpiryAnonymous && c.hub.RequireAuth {
+		behavior = TokenExpiryClose
+	}
+
+	switch behavior {
+	case TokenExpiryClose:
+		log.Info().Msgf("Token expired, closing (%s)", c.GetUID())
+		c.CloseWithCode(closeTokenExpired, "token expired")
+		return false
+	case TokenExpiryAnonymous:
+		log.Info().Msgf("Token expired, downgrading to anonymous (%s)", c.GetUID())
+		// The sessions are unsubscribed from the private streams before the
+		// client identity changes.
+		for _, s := range c.listSessions() {
+			c.hub.sendRequest(Request{client: s, Request: msg.Request{Method: "expire"}})
+		}
+		c.hub.sendRequest(Request{client: c, Request: msg.Request{Method: "expire"}})
+	}
+	return true
+}
+
+// handleExpire stops the firehose of the client and unsubscribes it from its
+// private streams, then makes it anonymous.
+func (h *Hub) handleExpire(req *Request) {
+	uid := req.client.GetUID()
+	if uid == "" {
+		return
+	}
+
+	h.mutex.Lock()
+	h.stopFirehose(req.client)
+	streams := []string{}
+	for t, topic := range h.PrivateTopics[uid] {
+		if topic.has(req.client) {
+			streams = append(streams, t)
+		}
+	}
+	h.mutex.Unlock()
+	sort.Strings(streams)
+
+	h.handleUnsubscribe(&Request{
+		client:  req.client,
+		Request: msg.Request{Method: "unsubscribe", Streams: streams},
+	})
+	req.client.Downgrade()
+}
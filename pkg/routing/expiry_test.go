@@ -0,0 +1,172 @@
+package routing
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenExpiry(t *testing.T) {
+	// connect dials with a token expiring in 10 seconds and subscribes to a
+	// private and a public stream.
+	connect := func(t *testing.T, behavior string) (*Hub, *fakeClock, *websocket.Conn, func()) {
+		clock := newFakeClock()
+		h := NewHub()
+		h.Clock = clock
+		h.TokenExpiry = behavior
+		go h.ListenWebsocketEvents()
+
+		header := http.Header{
+			"JwtUID":    []string{"UIDABC00001"},
+			"JwtExpiry": []string{strconv.FormatInt(clock.Now().Add(10*time.Second).Unix(), 10)},
+		}
+		conn, teardown := dial(t, h, "/?stream=order,eurusd.trades", header)
+		assert.Equal(t, map[string]interface{}{
+			"success": map[string]interface{}{
+				"message": "subscribed",
+				"streams": []interface{}{"eurusd.trades", "order"},
+			},
+		}, readJSON(t, conn))
+
+		// The writer waits on its ping ticker and expiry timer if any.
+		if behavior == "" {
+			clock.WaitForWaiters(t, 1)
+		} else {
+			clock.WaitForWaiters(t, 2)
+		}
+		return h, clock, conn, teardown
+	}
+	order := func(h *Hub, id int) {
+		h.routeMessage(&Event{
+			Scope:  "private",
+			Stream: "UIDABC00001",
+			Type:   "order",
+			Topic:  "order",
+			Body:   map[string]interface{}{"id": id},
+		})
+	}
+	trade := func(h *Hub, id int) {
+		h.routeMessage(&Event{
+			Scope:  "public",
+			Stream: "eurusd",
+			Type:   "trades",
+			Topic:  "eurusd.trades",
+			Body:   map[string]interface{}{"id": id},
+		})
+	}
+
+	t.Run("downgrades the connection to anonymous", func(t *testing.T) {
+		h, clock, conn, teardown := connect(t, TokenExpiryAnonymous)
+		defer teardown()
+
+		clock.Advance(11 * time.Second)
+		assert.Equal(t, map[string]interface{}{
+			"success": map[string]interface{}{
+				"message": "unsubscribed",
+				"streams": []interface{}{"eurusd.trades"},
+			},
+		}, readJSON(t, conn))
+
+		order(h, 1)
+		trade(h, 2)
+		assert.Equal(t, map[string]interface{}{"eurusd.trades": map[string]interface{}{"id": 2.0}}, readJSON(t, conn))
+
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "subscribe", "streams": []string{"order"}}))
+		assert.Equal(t, map[string]interface{}{
+			"success": map[string]interface{}{
+				"message": "subscribed",
+				"streams": []interface{}{"eurusd.trades"},
+			},
+		}, readJSON(t, conn))
+	})
+
+	t.Run("stops the firehose", func(t *testing.T) {
+		h, clock, conn, teardown := connect(t, TokenExpiryAnonymous)
+		defer teardown()
+		h.mutex.Lock()
+		h.Authorizer = Delegations{"UIDABC00001": {"*"}}
+		h.mutex.Unlock()
+
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "firehose"}))
+		assert.Equal(t, map[string]interface{}{"success": map[string]interface{}{"message": "firehose started"}}, readJSON(t, conn))
+
+		clock.Advance(11 * time.Second)
+		assert.Equal(t, map[string]interface{}{"event": "firehose_revoked"}, readJSON(t, conn))
+		assert.Equal(t, "unsubscribed", readJSON(t, conn)["success"].(map[string]interface{})["message"])
+
+		order(h, 4)
+		trade(h, 5)
+		assert.Equal(t, map[string]interface{}{"eurusd.trades": map[string]interface{}{"id": 5.0}}, readJSON(t, conn))
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, _, err := conn.ReadMessage()
+		assert.Error(t, err)
+	})
+
+	t.Run("closes the connection", func(t *testing.T) {
+		_, clock, conn, teardown := connect(t, TokenExpiryClose)
+		defer teardown()
+
+		clock.Advance(11 * time.Second)
+		assert.Equal(t, map[string]interface{}{"event": "disconnect", "reason": "token expired"}, readJSON(t, conn))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err := conn.ReadMessage()
+		assert.Equal(t, &websocket.CloseError{Code: closeTokenExpired, Text: "token expired"}, err)
+	})
+
+	t.Run("closes the connection when authentication is required", func(t *testing.T) {
+		h, clock, conn, teardown := connect(t, TokenExpiryAnonymous)
+		defer teardown()
+		h.RequireAuth = true
+
+		clock.Advance(11 * time.Second)
+		assert.Equal(t, map[string]interface{}{"event": "disconnect", "reason": "token expired"}, readJSON(t, conn))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err := conn.ReadMessage()
+		assert.Equal(t, &websocket.CloseError{Code: closeTokenExpired, Text: "token expired"}, err)
+	})
+
+	t.Run("keeps the connection without behavior", func(t *testing.T) {
+		h, clock, conn, teardown := connect(t, "")
+		defer teardown()
+
+		clock.Advance(11 * time.Second)
+		order(h, 3)
+		assert.Equal(t, map[string]interface{}{"order": map[string]interface{}{"id": 3.0}}, readJSON(t, conn))
+	})
+}
+
+func TestExpiryAfterUnregister(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+	defer h.Shutdown()
+
+	c := &Client{
+		hub:     h,
+		UID:     "UIDABC00001",
+		send:    make(chan outbound, maxBufferedMessages),
+		pubSub:  []string{},
+		privSub: []string{},
+	}
+	require.True(t, h.unregister(c))
+	waitFor(t, func() bool {
+		select {
+		case _, ok := <-c.send:
+			return !ok
+		default:
+			return false
+		}
+	})
+
+	// The expiry of the token raced with the closing of the reader, the hub
+	// must not answer on the closed send channel.
+	assert.NotPanics(t, func() {
+		h.handleRequest(&Request{client: c, Request: message.Request{Method: "expire"}})
+	})
+	assert.Equal(t, "UIDABC00001", c.GetUID())
+}
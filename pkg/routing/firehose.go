@@ -0,0 +1,122 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// firehoseWindow counts the messages copied to a firehose client during one
+// second, and the ones dropped above the rate.
+type firehoseWindow struct {
+	start   time.Time
+	count   int
+	dropped int
+}
+
+// canFirehose returns true if the user may receive the firehose, only the
+// accounts the authorizer allows to act on behalf of any user may.
+func (h *Hub) canFirehose(client IClient, uid string) bool {
+	return h.canImpersonate(clientContext(client), uid, "*")
+}
+
+// handleFirehose makes the client receive a copy of every routed message.
+func (h *Hub) handleFirehose(req *Request) {
+	uid := req.client.GetUID()
+	if !h.canFirehose(req.client, uid) {
+		log.Warn().Msgf("Firehose rejected (%s)", uid)
+		req.client.Send(responseMust(errors.New("firehose not authorized"), nil))
+		return
+	}
+
+	h.mutex.Lock()
+	if _, ok := h.firehose[req.client]; !ok {
+		log.Info().Msgf("Starting firehose (%s)", uid)
+		h.firehose[req.client] = &firehoseWindow{start: h.Clock.Now()}
+	}
+	h.mutex.Unlock()
+
+	req.client.Send(responseMust(nil, map[string]interface{}{
+		"message": "firehose started",
+	}))
+}
+
+// stopFirehose stops the firehose of a client which may no longer receive it
+// and tells it so with {"event":"firehose_revoked"}. The hub mutex must be
+// held.
+func (h *Hub) stopFirehose(client IClient) {
+	if _, ok := h.firehose[client]; !ok {
+		return
+	}
+	log.Info().Msgf("Firehose revoked (%s)", client.GetUID())
+	delete(h.firehose, client)
+	client.Send(`{"event":"firehose_revoked"}`)
+}
+
+// reauthorizeFirehose evaluates again the firehose clients after a change of
+// the authorizer or of an authorization, and stops the firehose of the ones
+// no longer allowed. The hub mutex must be held.
+func (h *Hub) reauthorizeFirehose() {
+	for client := range h.firehose {
+		uid := client.GetUID()
+		if uid != "" && h.Authorizer != nil && h.Authorizer.CanImpersonate(clientContext(client), uid, "*") {
+			continue
+		}
+		h.stopFirehose(client)
+	}
+}
+
+// removeFirehose stops the firehose of a client.
+func (h *Hub) removeFirehose(client IClient) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.firehose, client)
+}
+
+// copyToFirehose sends a routed message to the firehose clients, tagged with
+// its scope, stream and user for private messages, like
+// {"firehose":{"scope":"public","stream":"btcusd.trades","data":...}}. Each
+// client gets at most FirehoseRate messages per second, the count of the
+// dropped ones is sent when the next second starts. The hub mutex must be held.
+func (h *Hub) copyToFirehose(msg *Event) {
+	if len(h.firehose) == 0 {
+		return
+	}
+
+	tagged := map[string]interface{}{
+		"scope":  msg.Scope,
+		"stream": msg.Topic,
+		"data":   msg.Body,
+	}
+	if msg.Scope == "private" {
+		tagged["uid"] = msg.Stream
+	}
+	if msg.CorrelationID != "" {
+		tagged["correlation_id"] = msg.CorrelationID
+	}
+	b, err := json.Marshal(map[string]interface{}{"firehose": tagged})
+	if err != nil {
+		log.Error().Msgf("Firehose encoding failed: %s", err.Error())
+		return
+	}
+
+	now := h.Clock.Now()
+	for client, w := range h.firehose {
+		if now.Sub(w.start) >= time.Second {
+			if w.dropped > 0 {
+				client.Send(fmt.Sprintf(`{"event":"firehose_dropped","count":%d}`, w.dropped))
+			}
+			*w = firehoseWindow{start: now}
+		}
+		if h.FirehoseRate > 0 && w.count >= h.FirehoseRate {
+			w.dropped++
+			continue
+		}
+		w.count++
+		client.Send(string(b))
+	}
+}
@@ -0,0 +1,100 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFirehose(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.Authorizer = Delegations{"UIDADMIN0001": {"*"}, "UIDSERVICE00": {"UIDABC00001"}}
+
+	newClient := func(uid string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return(uid)
+		c.On("GetSubscriptions").Return([]string{})
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		return c
+	}
+	firehose := func(c IClient) {
+		h.handleRequest(&Request{client: c, Request: message.Request{Method: "firehose"}})
+	}
+
+	subscriber := newClient("UIDABC00001")
+	h.handleSubscribe(&Request{client: subscriber, Request: message.Request{Streams: []string{"btcusd.trades", "order"}}})
+
+	admin := newClient("UIDADMIN0001")
+	firehose(admin)
+	admin.AssertCalled(t, "Send", `{"success":{"message":"firehose started"}}`)
+
+	t.Run("rejects unauthorized users", func(t *testing.T) {
+		for _, uid := range []string{"", "UIDABC00001", "UIDSERVICE00"} {
+			c := newClient(uid)
+			firehose(c)
+			c.AssertCalled(t, "Send", `{"error":"firehose not authorized"}`)
+		}
+		assert.Len(t, h.firehose, 1)
+	})
+
+	t.Run("receives a copy of every stream", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: 1})
+		h.routeMessage(&Event{Scope: "public", Stream: "ethusd", Type: "tickers", Topic: "ethusd.tickers", Body: 2})
+		h.routeMessage(&Event{Scope: "private", Stream: "UIDABC00001", Type: "order", Topic: "order", Body: 3})
+
+		admin.AssertCalled(t, "Send", `{"firehose":{"data":1,"scope":"public","stream":"btcusd.trades"}}`)
+		admin.AssertCalled(t, "Send", `{"firehose":{"data":2,"scope":"public","stream":"ethusd.tickers"}}`)
+		admin.AssertCalled(t, "Send", `{"firehose":{"data":3,"scope":"private","stream":"order","uid":"UIDABC00001"}}`)
+		admin.AssertNotCalled(t, "SendStream", mock.Anything, mock.Anything)
+	})
+
+	t.Run("does not affect the subscribers", func(t *testing.T) {
+		subscriber.AssertCalled(t, "SendStream", "btcusd.trades", `{"btcusd.trades":1}`)
+		subscriber.AssertCalled(t, "SendStream", "order", `{"order":3}`)
+		subscriber.AssertNumberOfCalls(t, "SendStream", 2)
+	})
+
+	t.Run("limits the rate", func(t *testing.T) {
+		h.FirehoseRate = 2
+		clock.Advance(time.Second)
+		for i := 10; i < 15; i++ {
+			h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: i})
+		}
+		admin.AssertCalled(t, "Send", `{"firehose":{"data":11,"scope":"public","stream":"btcusd.trades"}}`)
+		admin.AssertNotCalled(t, "Send", `{"firehose":{"data":12,"scope":"public","stream":"btcusd.trades"}}`)
+
+		clock.Advance(time.Second)
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: 20})
+		admin.AssertCalled(t, "Send", `{"event":"firehose_dropped","count":3}`)
+		admin.AssertCalled(t, "Send", `{"firehose":{"data":20,"scope":"public","stream":"btcusd.trades"}}`)
+		subscriber.AssertNumberOfCalls(t, "SendStream", 8)
+	})
+
+	t.Run("stops once the account is no longer allowed", func(t *testing.T) {
+		service := newClient("UIDSERVICE00")
+		h.Authorizer = Delegations{"UIDADMIN0001": {"*"}, "UIDSERVICE00": {"*"}}
+		firehose(service)
+		assert.Len(t, h.firehose, 2)
+
+		h.Reauthorize("UIDSERVICE00")
+		assert.Len(t, h.firehose, 2)
+
+		h.Reload(Config{Authorizer: Delegations{"UIDADMIN0001": {"*"}}})
+		assert.Len(t, h.firehose, 1)
+		service.AssertCalled(t, "Send", `{"event":"firehose_revoked"}`)
+		admin.AssertNotCalled(t, "Send", `{"event":"firehose_revoked"}`)
+	})
+
+	t.Run("stops with the connection", func(t *testing.T) {
+		h.removeFirehose(admin)
+		assert.Empty(t, h.firehose)
+	})
+}
@@ -0,0 +1,51 @@
+package routing
+
+import "time"
+
+// frameLimiter caps the number of frames written to a connection during each
+// second at the MaxFramesPerSecond of the hub. Above it the writer stops
+// reading the send buffers until the next second, the messages accumulate in
+// them, are batched for clients in batch mode, and the slow client policy
+// applies once they are full.
+type frameLimiter struct {
+	clock Clock
+	max   int
+	start time.Time
+	count int
+	timer Timer
+}
+
+// newFrameLimiter returns the frame limiter of the client, nil if the frame
+// rate is unlimited.
+func (c *Client) newFrameLimiter() *frameLimiter {
+	if c.hub.MaxFramesPerSecond <= 0 {
+		return nil
+	}
+	return &frameLimiter{clock: c.hub.Clock, max: c.hub.MaxFramesPerSecond}
+}
+
+// throttle counts a written frame, it returns a channel firing when the next
+// frame may be written if the cap of the current second is reached, nil
+// otherwise.
+func (l *frameLimiter) throttle() <-chan time.Time {
+	if l == nil {
+		return nil
+	}
+
+	now := l.clock.Now()
+	if now.Sub(l.start) >= time.Second {
+		l.start, l.count = now, 0
+	}
+	l.count++
+	if l.count < l.max {
+		return nil
+	}
+	l.timer = l.clock.NewTimer(l.start.Add(time.Second).Sub(now))
+	return l.timer.C()
+}
+
+func (l *frameLimiter) stop() {
+	if l != nil && l.timer != nil {
+		l.timer.Stop()
+	}
+}
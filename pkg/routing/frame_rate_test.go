@@ -0,0 +1,109 @@
+package routing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFrames reads the frames of the connection in the background, the
+// returned function returns the frames received until the writer stops.
+func readFrames(conn *websocket.Conn) func() []string {
+	frames := make(chan string, 100)
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				close(frames)
+				return
+			}
+			frames <- string(data)
+		}
+	}()
+	return func() []string {
+		var received []string
+		for {
+			select {
+			case f := <-frames:
+				received = append(received, f)
+			case <-time.After(100 * time.Millisecond):
+				return received
+			}
+		}
+	}
+}
+
+func TestMaxFramesPerSecond(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.MaxFramesPerSecond = 5
+
+	conn, teardown := serveClient(t, func(conn *websocket.Conn) *Client {
+		c := &Client{
+			hub:      h,
+			conn:     conn,
+			send:     make(chan outbound, maxBufferedMessages),
+			priority: make(chan outbound, maxBufferedMessages),
+			lastPong: clock.Now().UnixNano(),
+		}
+		for i := 0; i < 100; i++ {
+			c.Send(fmt.Sprintf(`{"n":%d}`, i))
+		}
+		return c
+	})
+	defer teardown()
+
+	second := readFrames(conn)
+
+	assert.Equal(t, []string{`{"n":0}`, `{"n":1}`, `{"n":2}`, `{"n":3}`, `{"n":4}`}, second())
+	for i := 1; i < 3; i++ {
+		clock.Advance(time.Second)
+		received := second()
+		assert.Len(t, received, 5)
+		assert.Equal(t, fmt.Sprintf(`{"n":%d}`, i*5), received[0])
+	}
+}
+
+func TestMaxFramesPerSecondSpilled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rango-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.MaxFramesPerSecond = 5
+
+	conn, teardown := serveClient(t, func(conn *websocket.Conn) *Client {
+		c := &Client{
+			hub:      h,
+			conn:     conn,
+			send:     make(chan outbound, maxBufferedMessages),
+			priority: make(chan outbound, maxBufferedMessages),
+			spill:    newSpillQueue(dir, 1024),
+			lastPong: clock.Now().UnixNano(),
+		}
+		for i := 1; i < 12; i++ {
+			_, err := c.spill.push(true, []byte(fmt.Sprintf(`{"n":%d}`, i)))
+			require.NoError(t, err)
+		}
+		c.Send(`{"n":0}`)
+		return c
+	})
+	defer teardown()
+	second := readFrames(conn)
+
+	// The spilled messages count in the frame rate.
+	assert.Equal(t, []string{`{"n":0}`, `{"n":1}`, `{"n":2}`, `{"n":3}`, `{"n":4}`}, second())
+	clock.Advance(time.Second)
+	assert.Equal(t, []string{`{"n":5}`, `{"n":6}`, `{"n":7}`, `{"n":8}`, `{"n":9}`}, second())
+	clock.Advance(time.Second)
+	assert.Equal(t, []string{`{"n":10}`, `{"n":11}`}, second())
+}
@@ -0,0 +1,73 @@
+package routing
+
+import "github.com/rs/zerolog/log"
+
+// touchStream records a message of a stream holding state, the hub mutex must
+// be held.
+func (h *Hub) touchStream(stream string) {
+	if h.IdleStreamTTL > 0 {
+		h.streamActivity[stream] = h.Clock.Now()
+	}
+}
+
+// CollectIdleStreams periodically drops the snapshot, candle, recent
+// messages, staleness and latest ticker of the streams without subscribers
+// which received no message for IdleStreamTTL, and the ingress windows of the
+// streams without message for IdleStreamTTL.
+func (h *Hub) CollectIdleStreams() {
+	if h.IdleStreamTTL <= 0 {
+		return
+	}
+
+	ticker := h.Clock.NewTicker(h.IdleStreamTTL / 2)
+	defer ticker.Stop()
+
+	for range ticker.C() {
+		h.collectIdleStreams()
+	}
+}
+
+func (h *Hub) collectIdleStreams() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.Clock.Now()
+	for stream, last := range h.streamActivity {
+		if now.Sub(last) < h.IdleStreamTTL {
+			continue
+		}
+		if h.hasSubscribers(stream) {
+			continue
+		}
+
+		delete(h.IncrementalObjects, stream)
+		delete(h.candles, stream)
+		delete(h.replay, stream)
+		delete(h.lastMessage, stream)
+		delete(h.stale, stream)
+		delete(h.tickers, stream)
+		delete(h.streamActivity, stream)
+		log.Debug().Msgf("Idle stream %s collected", stream)
+	}
+
+	// The ingress windows are dropped once they hold no message.
+	for stream, w := range h.ingress {
+		if w.pending == nil && now.Sub(w.start) >= h.IdleStreamTTL {
+			delete(h.ingress, stream)
+		}
+	}
+}
+
+// hasSubscribers returns true if a public stream or a group containing it has
+// subscribers.
+func (h *Hub) hasSubscribers(stream string) bool {
+	if topic, ok := h.PublicTopics[stream]; ok && topic.len() != 0 {
+		return true
+	}
+	for _, g := range h.groupsByStream[stream] {
+		if topic, ok := h.PublicTopics[g]; ok && topic.len() != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIdleStreamCollection(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.IdleStreamTTL = time.Minute
+	h.CandleIntervals = []time.Duration{time.Minute}
+
+	snapshot := func(stream string) {
+		h.routeMessage(&Event{Scope: "public", Stream: stream, Type: "ob-snap", Topic: stream + ".ob-inc", Body: 1})
+	}
+	increment := func(stream string) {
+		h.routeMessage(&Event{Scope: "public", Stream: stream, Type: "ob-inc", Topic: stream + ".ob-inc", Body: 2})
+	}
+
+	t.Run("reclaims a stream without subscribers after the TTL", func(t *testing.T) {
+		snapshot("btcusd")
+		clock.Advance(30 * time.Second)
+		h.collectIdleStreams()
+		assert.Contains(t, h.IncrementalObjects, "btcusd.ob-inc")
+
+		clock.Advance(30 * time.Second)
+		h.collectIdleStreams()
+		assert.NotContains(t, h.IncrementalObjects, "btcusd.ob-inc")
+		assert.Empty(t, h.streamActivity)
+	})
+
+	t.Run("retains a stream receiving messages", func(t *testing.T) {
+		snapshot("ethusd")
+		for i := 0; i < 3; i++ {
+			clock.Advance(50 * time.Second)
+			increment("ethusd")
+			h.collectIdleStreams()
+		}
+		assert.Contains(t, h.IncrementalObjects, "ethusd.ob-inc")
+
+		clock.Advance(time.Minute)
+		h.collectIdleStreams()
+		assert.NotContains(t, h.IncrementalObjects, "ethusd.ob-inc")
+	})
+
+	t.Run("retains a subscribed stream", func(t *testing.T) {
+		c := &MockedClient{}
+		c.On("GetUID").Return("")
+		c.On("GetSubscriptions").Return([]string{"xrpusd.ob-inc"})
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("UnsubscribePublic", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"xrpusd.ob-inc"}}})
+
+		snapshot("xrpusd")
+		clock.Advance(5 * time.Minute)
+		h.collectIdleStreams()
+		assert.Contains(t, h.IncrementalObjects, "xrpusd.ob-inc")
+
+		teardown(h, c, []string{"xrpusd.ob-inc"})
+		h.collectIdleStreams()
+		assert.NotContains(t, h.IncrementalObjects, "xrpusd.ob-inc")
+	})
+
+	t.Run("reclaims candles", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: map[string]interface{}{
+			"trades": []interface{}{map[string]interface{}{"price": "9120.0", "amount": "0.1", "date": 1588000000.0}},
+		}})
+		assert.Contains(t, h.candles, "btcusd.kline-1m")
+
+		clock.Advance(time.Minute)
+		h.collectIdleStreams()
+		assert.Empty(t, h.candles)
+	})
+
+	t.Run("reclaims the staleness and the tickers", func(t *testing.T) {
+		h.StaleThreshold = time.Minute
+		h.AllTickersInterval = time.Second
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "tickers", Topic: "btcusd.tickers", Body: map[string]interface{}{"last": "9120.0"}})
+		h.stale["btcusd.tickers"] = true
+		assert.Contains(t, h.lastMessage, "btcusd.tickers")
+		assert.Contains(t, h.tickers, "btcusd.tickers")
+
+		clock.Advance(time.Minute)
+		h.collectIdleStreams()
+		assert.Empty(t, h.lastMessage)
+		assert.Empty(t, h.stale)
+		assert.Empty(t, h.tickers)
+		h.StaleThreshold, h.AllTickersInterval = 0, 0
+	})
+
+	t.Run("collects periodically", func(t *testing.T) {
+		snapshot("btcusd")
+		go h.CollectIdleStreams()
+		clock.WaitForWaiters(t, 1)
+
+		clock.Advance(time.Minute)
+		waitFor(t, func() bool {
+			h.mutex.Lock()
+			defer h.mutex.Unlock()
+			return len(h.IncrementalObjects) == 0
+		})
+	})
+}
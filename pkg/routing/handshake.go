@@ -0,0 +1,17 @@
+package routing
+
+import (
+	"net/http"
+	"time"
+)
+
+// NewServer returns an HTTP server dropping the connections which do not
+// send the headers of their request, the websocket handshake included, within
+// the handshake timeout. A timeout of 0 means unlimited.
+func NewServer(addr string, handler http.Handler, handshakeTimeout time.Duration) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: handshakeTimeout,
+	}
+}
@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshakeTimeout(t *testing.T) {
+	h := NewHub()
+	h.HandshakeTimeout = 50 * time.Millisecond
+	go h.ListenWebsocketEvents()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := NewServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}), h.HandshakeTimeout)
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	dropped := func(t *testing.T, data string) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		if data != "" {
+			_, err = conn.Write([]byte(data))
+			require.NoError(t, err)
+		}
+
+		start := time.Now()
+		conn.SetReadDeadline(start.Add(time.Second))
+		_, err = conn.Read(make([]byte, 512))
+		require.Error(t, err)
+		netErr, ok := err.(net.Error)
+		assert.False(t, ok && netErr.Timeout(), "the connection was not dropped")
+		assert.True(t, time.Since(start) >= 25*time.Millisecond, "the connection was dropped too early")
+	}
+
+	t.Run("drops a connection sending no handshake", func(t *testing.T) {
+		dropped(t, "")
+	})
+
+	t.Run("drops a connection stalling during the handshake", func(t *testing.T) {
+		dropped(t, "GET /public HTTP/1.1\r\nHost: localhost\r\n")
+	})
+
+	t.Run("accepts a connection completing the handshake", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/public", nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Contains(t, readJSON(t, conn), "success")
+	})
+}
@@ -0,0 +1,23 @@
+package routing
+
+// Pseudo public stream receiving periodic keepalive messages from the hub.
+const heartbeatStream = "heartbeat"
+
+// SendHeartbeats broadcasts the current time to the subscribers of the
+// heartbeat stream every HeartbeatInterval.
+func (h *Hub) SendHeartbeats() {
+	if h.HeartbeatInterval <= 0 {
+		return
+	}
+
+	ticker := h.Clock.NewTicker(h.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for t := range ticker.C() {
+		body := string(h.eventMust(heartbeatStream, t.Unix()))
+
+		h.mutex.Lock()
+		h.broadcastPublic(heartbeatStream, body, t.Unix())
+		h.mutex.Unlock()
+	}
+}
@@ -0,0 +1,43 @@
+package routing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHeartbeat(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.HeartbeatInterval = 5 * time.Second
+
+	newClient := func(streams ...string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return("")
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+		return c
+	}
+	subscriber := newClient("heartbeat")
+	other := newClient("eurusd.trades")
+
+	go h.SendHeartbeats()
+	clock.WaitForWaiters(t, 1)
+
+	for i := 1; i <= 2; i++ {
+		clock.Advance(h.HeartbeatInterval)
+		expected := fmt.Sprintf(`{"heartbeat":%d}`, clock.Now().Unix())
+
+		waitFor(t, func() bool {
+			return subscriber.isCalled("SendStream", "heartbeat", expected)
+		})
+	}
+	other.AssertNotCalled(t, "SendStream", "heartbeat", mock.Anything)
+}
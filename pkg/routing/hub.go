@@ -1,11 +1,13 @@
 package routing
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	msg "github.com/openware/rango/pkg/message"
 	"github.com/openware/rango/pkg/metrics"
@@ -17,6 +19,21 @@ import (
 type Request struct {
 	client IClient
 	msg.Request
+
+	// Streams of a consolidated subscription which failed and the reason
+	failed map[string]string
+}
+
+// fail records the reason the subscription of a consolidated request to the
+// stream failed.
+func (r *Request) fail(stream, reason string) {
+	if !r.Consolidated {
+		return
+	}
+	if r.failed == nil {
+		r.failed = make(map[string]string)
+	}
+	r.failed[stream] = reason
 }
 
 // Hub maintains the set of active clients and broadcasts messages to the
@@ -37,6 +54,380 @@ type Hub struct {
 	// Storage for incremental objects
 	IncrementalObjects map[string]*IncrementalObject
 
+	// Streams every client is subscribed to on connect, the private ones for
+	// authenticated clients only
+	DefaultStreams []string
+
+	// Group streams and their member streams
+	Groups map[string][]string
+
+	// Groups a public stream is member of
+	groupsByStream map[string][]string
+
+	// Request headers giving the UID of a connection, the first non-empty one
+	// wins, JwtUID if empty
+	UIDHeaders []string
+
+	// Reject the upgrade of the connections without UID with 401 instead of
+	// accepting them as anonymous
+	RequireAuth bool
+
+	// Authorizer of the connections acting on behalf of another user, no
+	// delegation is allowed if nil
+	Authorizer Authorizer
+
+	// Authorizer of the subscriptions to private streams, they are all allowed
+	// if nil, see Reauthorize
+	StreamAuthorizer StreamAuthorizer
+
+	// Duration during which a decision of the StreamAuthorizer is reused for
+	// the subscriptions of the same user to the same stream from connections
+	// with the same actor and tags, 0 asks it on every subscription. See
+	// InvalidateAuthorization
+	AuthorizationTTL time.Duration
+
+	// Cached decisions of the StreamAuthorizer by user, stream and connection
+	// identity, and the time the expired ones were last forgotten
+	authDecisions map[string]map[authKey]authDecision
+	authPruned    time.Time
+
+	// Origins allowed to open websocket connections, like
+	// https://app.example.com, only the host itself if empty, "*" allows any
+	AllowedOrigins []string
+
+	// Behavior when the token of a client expires, TokenExpiryAnonymous or
+	// TokenExpiryClose, nothing happens if empty
+	TokenExpiry string
+
+	// Maximum duration of the websocket handshake of client connections, 0
+	// means unlimited
+	HandshakeTimeout time.Duration
+
+	// Maximum lifetime of client connections, 0 means unlimited
+	MaxConnLifetime time.Duration
+
+	// Builds the payload of the pings sent to the clients, they are empty if
+	// nil
+	PingPayload PingPayload
+
+	// Number of recent messages of each public stream kept for the
+	// subscribers asking for the last messages, 0 disables the replay
+	ReplaySize int
+
+	// Generator of the snapshots of the incremental streams the hub has none
+	// for, they are only received from the source if nil
+	Snapshotter Snapshotter
+
+	// Minimum duration between two generations of the snapshot of a stream,
+	// the subscribers in between wait for the next one
+	SnapshotInterval time.Duration
+
+	// Snapshot generations of the incremental streams, the finished ones are
+	// pruned once SnapshotInterval elapsed
+	snapshotFetches map[string]*snapshotFetch
+	snapshotsPruned time.Time
+
+	// Send {"event":"caught_up","stream":...} to the subscribers of a public
+	// stream once its replayed messages and snapshot are sent, before its
+	// live messages
+	CaughtUp bool
+
+	// Include the subscription counts of the client in the subscribe and
+	// unsubscribe acknowledgements, in total, by scope and against each of
+	// the StreamQuotas
+	SubscriptionCounts bool
+
+	// Recent messages of the public streams, only used when ReplaySize is set
+	replay map[string]*replayBuffer
+
+	// Maximum number of frames written to a connection per second, the
+	// messages above wait in the send buffer, 0 means unlimited
+	MaxFramesPerSecond int
+
+	// Duration given to clients without initial streams to subscribe, 0 means unlimited
+	SubscribeDeadline time.Duration
+
+	// Maximum duration of a write to a client and without pong from it, shorter
+	// than the defaults to detect half-open connections faster, 0 uses the defaults
+	HalfOpenTimeout time.Duration
+
+	// Interval of the messages of the heartbeat stream, 0 disables them
+	HeartbeatInterval time.Duration
+
+	// Interval of the messages of the allTickers stream, carrying the latest
+	// ticker of every market, 0 disables them
+	AllTickersInterval time.Duration
+
+	// Latest ticker body by tickers stream
+	tickers map[string]interface{}
+
+	// Log one received message out of LogSampleRate, all if lower than 2
+	LogSampleRate int
+
+	// Maximum size of a logged message, 0 means no limit
+	LogMaxSize int
+
+	receivedSampler logSampler
+
+	// Source of time for the hub and its clients
+	Clock Clock
+
+	// Intervals of the candles built from the trades of each market, in
+	// seconds at least, none are built if empty
+	CandleIntervals []time.Duration
+
+	// Current candle by candle stream
+	candles map[string]*candle
+
+	// Duration after which the state of a stream without subscribers nor
+	// messages is dropped, 0 keeps it forever
+	IdleStreamTTL time.Duration
+
+	// Duration without message after which the subscribers of a public
+	// stream are told it is stale, 0 disables the detection
+	StaleThreshold time.Duration
+
+	// Ratio of the messages dropped for not fitting in the send buffer of a
+	// client during DropRateWindow above which the hub reports itself not
+	// ready, 0 disables the check
+	MaxDropRate float64
+
+	// Duration over which the drop ratio is measured
+	DropRateWindow time.Duration
+
+	// Messages buffered for and dropped by the clients during the current
+	// window, and the drop ratio and overload flag of the last window, they
+	// are accessed atomically
+	buffered   int64
+	dropped    int64
+	dropRate   uint64
+	overloaded int32
+
+	// Time of the last message of the public streams and streams flagged as
+	// stale, only used when StaleThreshold is set
+	lastMessage map[string]time.Time
+	stale       map[string]bool
+
+	// Public streams always listed by the streams request
+	ListedStreams []string
+
+	// Duration without message after which a public stream is no longer
+	// listed by the streams request, 0 lists it forever
+	ListedStreamTTL time.Duration
+
+	// Time of the last message of the public streams
+	streamSeen map[string]time.Time
+
+	// Time of the last message of the streams holding state
+	streamActivity map[string]time.Time
+
+	// Private streams whose messages must be acknowledged by clients
+	AckStreams []string
+
+	// Duration during which unacknowledged messages are redelivered
+	AckWindow time.Duration
+
+	// Maximum number of subscriptions across all clients, 0 means unlimited
+	MaxSubscriptions int
+
+	// Number of active subscriptions across all clients
+	subscriptions int
+
+	// Maximum number of subscribe and unsubscribe requests per second of a
+	// client, 0 means unlimited
+	MaxSubscribeRate int
+
+	// Connections of a user receiving its private messages,
+	// PrivateDeliveryAll or PrivateDeliveryLatest, all of them if empty
+	PrivateDelivery string
+
+	// Behavior when the send buffer of a client is full, SlowClientDisconnect
+	// or SlowClientDrop, the client is disconnected if empty
+	SlowClientPolicy string
+
+	// Maximum size in bytes of the messages buffered for a client, the slow
+	// client policy applies above, 0 means unlimited
+	MaxBufferedBytes int64
+
+	// Maximum number of distinct streams of a subscribe request, 0 means
+	// unlimited
+	MaxRequestStreams int
+
+	// Policy for the subscribe requests above MaxRequestStreams,
+	// StreamsOverflowReject or StreamsOverflowTruncate, they are rejected if
+	// empty
+	StreamsOverflow string
+
+	// Maximum number of subscriptions of a client to the streams matching each
+	// pattern, like *.ob-inc, the subscriptions above are rejected. Patterns
+	// follow path.Match, a stream matching several patterns must fit them all
+	StreamQuotas map[string]int
+
+	// Called when a public stream gains its first subscriber with subscribed
+	// true, and when it loses its last one with subscribed false, so that the
+	// source may only produce the streams with subscribers. It is called with
+	// the hub mutex held and must neither block nor call the hub
+	StreamDemand func(stream string, subscribed bool)
+
+	// Called once with the public streams a disconnecting client was the last
+	// subscriber of, in alphabetical order, instead of calling StreamDemand for
+	// each of them. When nil StreamDemand is called for each stream. It is
+	// called with the hub mutex held and must neither block nor call the hub
+	StreamsReleased func(streams []string)
+
+	// Subscription changes of the clients, only used by ListenWebsocketEvents
+	churn map[IClient]*churnWindow
+
+	// Maximum number of messages per second copied to a firehose client, 0
+	// means unlimited
+	FirehoseRate int
+
+	// Clients receiving a copy of every routed message
+	firehose map[IClient]*firehoseWindow
+
+	// Duration during which the messages of the clients in batch mode are
+	// accumulated, 0 disables the batch mode
+	BatchWindow time.Duration
+
+	// Minimum number of accumulated messages sent as a compressed batch,
+	// fewer messages are sent one by one
+	BatchMinSize int
+
+	// Minimum size in bytes of the messages compressed for the clients
+	// negotiating permessage-deflate, smaller ones are sent uncompressed, 0
+	// only compresses the batches
+	CompressionThreshold int
+
+	// Streams whose messages are always compressed for the clients negotiating
+	// permessage-deflate, and streams whose messages never are, whatever their
+	// size and the CompressionThreshold. Patterns follow path.Match, like
+	// *.ob-inc, a stream matching both is not compressed
+	CompressStreams     []string
+	UncompressedStreams []string
+
+	// Maximum size of the message bodies by event type, like tickers, other
+	// types are not limited
+	MessageSizeLimits map[string]int
+
+	// Streams whose messages are dropped if the same message was routed during
+	// the DedupWindow, 0 disables the deduplication
+	DedupStreams []string
+	DedupWindow  time.Duration
+
+	// Maximum number of message hashes remembered for the deduplication
+	DedupSize int
+
+	// Hashes of the recently routed messages and their order
+	dedupSeen  map[uint64]time.Time
+	dedupOrder []dedupEntry
+
+	// Maximum number of messages per second of each public or global stream
+	// received from the source, the messages above are handled according to
+	// the IngressPolicy, 0 means unlimited
+	IngressRate int
+
+	// Handling of the messages above the IngressRate, IngressDrop or
+	// IngressConflate, they are dropped if empty
+	IngressPolicy string
+
+	// Messages received during the current second by stream
+	ingress map[string]*ingressWindow
+
+	// Maintenance mode, see SetMaintenance
+	maintenance maintenance
+
+	// Request headers captured as connection tags by tag name, like
+	// "region": "X-Region"
+	TagHeaders map[string]string
+
+	// Fields of the verified TLS client certificate captured as connection
+	// tags by tag name, like "service": "ou", see certificateField
+	CertTags map[string]string
+
+	// Field of the verified TLS client certificate giving the UID of the
+	// connections without UID header, like cn, the certificate is ignored if
+	// empty
+	CertUIDField string
+
+	// Maximum number of distinct values of a tag, later values are counted as
+	// "other", 0 means unlimited
+	MaxTagValues int
+
+	// Distinct values and number of connections by tag and value
+	tagValues map[string]map[string]struct{}
+	tagCounts map[string]map[string]int
+
+	// Streams whose messages are written to clients before the others
+	PriorityStreams []string
+
+	// Streams whose messages are spilled to disk when a client send buffer is full
+	SpillStreams []string
+
+	// Directory for spilled messages, the default temporary directory if empty
+	SpillDir string
+
+	// Maximum size on disk of the spilled messages of a client
+	SpillMaxBytes int64
+
+	// Imported streams by resume identity waiting for the clients to reconnect
+	restored map[string][]string
+
+	// Unacknowledged messages by resume identity
+	unacked          map[string][]unackedMessage
+	lastMsgID        uint64
+	lastUnackedPrune time.Time
+
+	// Connected clients
+	connections map[*Client]struct{}
+
+	// Handling of the connections presenting the resume identity of a live
+	// connection, DuplicateResumeRejectNew or DuplicateResumeCloseOld, they
+	// are all accepted if empty
+	DuplicateResume string
+
+	// Live connection of each resume identity, tracked only with a
+	// DuplicateResume policy
+	resumers map[string]*Client
+
+	// Ingestion time of the message being routed, zero if unknown
+	ingested time.Time
+
+	// Maximum number of streams whose delivery latency is recorded with their
+	// own label, the latency of the others is recorded as other
+	LatencyStreams int
+
+	// Maximum number of streams of each type with the most subscriptions
+	// whose subscriptions are exported with their own label, the others are
+	// summed as other, 0 means unlimited
+	SubscriptionStreams int
+
+	// Streams always having their own label in the latency and subscription
+	// metrics, in addition to the LatencyStreams and SubscriptionStreams
+	MetricStreams []string
+
+	// Streams having their own label in the per-stream metrics
+	labelledStreams map[string]struct{}
+
+	// Number of messages by stream since the last ranking of the labels
+	streamMessages map[string]int
+
+	// Preset dictionary compressing the messages of the clients negotiating
+	// rango.dict, like the common field names of the messages, the
+	// subprotocol is not offered if empty
+	CompressionDict []byte
+
+	// Shape of the outbound messages of the streams
+	Envelope msg.EnvelopeEncoder
+
+	// Done once the hub is shutting down, the clients stop queuing requests
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Closed once the hub drained the requests queue to half its capacity,
+	// created by the first reader paused on it
+	drained      chan struct{}
+	drainedMutex sync.Mutex
+
 	mutex sync.Mutex
 }
 
@@ -46,6 +437,9 @@ type Event struct {
 	Type   string      // event type
 	Topic  string      // topic routing key (stream.type)
 	Body   interface{} // event json body
+	At     time.Time   // ingestion time, zero if unknown
+
+	CorrelationID string // identifier given by the source, forwarded to the clients
 }
 
 type IncrementalObject struct {
@@ -54,12 +448,62 @@ type IncrementalObject struct {
 }
 
 func NewHub() *Hub {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Hub{
-		Requests:           make(chan Request),
+		ctx:                ctx,
+		cancel:             cancel,
+		Requests:           make(chan Request, maxQueuedRequests),
 		Unregister:         make(chan IClient),
 		PublicTopics:       make(map[string]*Topic, 100),
 		PrivateTopics:      make(map[string]map[string]*Topic, 1000),
 		IncrementalObjects: make(map[string]*IncrementalObject, 5),
+		Groups:             make(map[string][]string),
+		groupsByStream:     make(map[string][]string),
+		Clock:              realClock{},
+		Envelope:           msg.ObjectEnvelope{},
+		AckWindow:          time.Minute,
+		unacked:            make(map[string][]unackedMessage),
+		restored:           make(map[string][]string),
+		churn:              make(map[IClient]*churnWindow),
+		firehose:           make(map[IClient]*firehoseWindow),
+		candles:            make(map[string]*candle),
+		tickers:            make(map[string]interface{}),
+		streamActivity:     make(map[string]time.Time),
+		streamSeen:         make(map[string]time.Time),
+		dedupSeen:          make(map[uint64]time.Time),
+		ingress:            make(map[string]*ingressWindow),
+		authDecisions:      make(map[string]map[authKey]authDecision),
+		connections:        make(map[*Client]struct{}),
+		resumers:           make(map[string]*Client),
+		labelledStreams:    make(map[string]struct{}),
+		streamMessages:     make(map[string]int),
+		replay:             make(map[string]*replayBuffer),
+		snapshotFetches:    make(map[string]*snapshotFetch),
+		lastMessage:        make(map[string]time.Time),
+		stale:              make(map[string]bool),
+		tagValues:          make(map[string]map[string]struct{}),
+		tagCounts:          make(map[string]map[string]int),
+	}
+}
+
+// SetGroup defines the member streams of a group stream, replacing any
+// previous definition. An empty list of members removes the group.
+// Groups and their members must be public streams.
+func (h *Hub) SetGroup(name string, members []string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(members) == 0 {
+		delete(h.Groups, name)
+	} else {
+		h.Groups[name] = members
+	}
+
+	h.groupsByStream = make(map[string][]string, len(h.groupsByStream))
+	for g, streams := range h.Groups {
+		for _, s := range streams {
+			h.groupsByStream[s] = append(h.groupsByStream[s], g)
+		}
 	}
 }
 
@@ -71,12 +515,22 @@ func isSnapshotObject(s string) bool {
 	return strings.HasSuffix(s, "-snap")
 }
 
+// logLevel returns the minimum level of the emitted logs, the global level
+// can be changed at runtime.
+func logLevel() zerolog.Level {
+	level := log.Logger.GetLevel()
+	if global := zerolog.GlobalLevel(); global > level {
+		return global
+	}
+	return level
+}
+
 func isDebug() bool {
-	return log.Logger.GetLevel() <= zerolog.DebugLevel
+	return logLevel() <= zerolog.DebugLevel
 }
 
 func isTrace() bool {
-	return log.Logger.GetLevel() <= zerolog.TraceLevel
+	return logLevel() <= zerolog.TraceLevel
 }
 
 func getTopic(scope, stream, typ string) string {
@@ -92,23 +546,67 @@ func getTopic(scope, stream, typ string) string {
 func (h *Hub) ListenWebsocketEvents() {
 	for {
 		select {
+		case <-h.ctx.Done():
+			log.Info().Msg("Hub shut down, stopped listening to clients")
+			return
+
 		case req := <-h.Requests:
+			h.requestDequeued()
+			metrics.RecordRequestsQueueDepth(len(h.Requests))
 			h.handleRequest(&req)
 
 		case client := <-h.Unregister:
+			// The requests queued by the client before it unregistered must be
+			// handled first, so they do not subscribe it again.
+			for n := len(h.Requests); n > 0; n-- {
+				req := <-h.Requests
+				h.requestDequeued()
+				h.handleRequest(&req)
+			}
 			log.Info().Msgf("Unregistering client (%s)", client.GetUID())
 			h.unsubscribeAll(client)
+			h.removeFirehose(client)
+			delete(h.churn, client)
+			h.markUnregistered(client)
 			client.Close()
 		}
 	}
 }
 
+// newEvent builds an event from a source routing key and a message body.
+func newEvent(routingKey string, body interface{}) (*Event, error) {
+	s := strings.Split(routingKey, ".")
+
+	switch len(s) {
+	case 2:
+		return &Event{
+			Scope:  s[0],
+			Stream: "",
+			Type:   s[1],
+			Topic:  getTopic(s[0], s[0], s[1]),
+			Body:   body,
+		}, nil
+
+	case 3:
+		return &Event{
+			Scope:  s[0],
+			Stream: s[1],
+			Type:   s[2],
+			Topic:  getTopic(s[0], s[1], s[2]),
+			Body:   body,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("Bad routing key: %s", routingKey)
+	}
+}
+
 func (h *Hub) ListenAMQP(q <-chan amqp.Delivery) {
 	for delivery := range q {
+		at := h.Clock.Now()
 		if isTrace() {
 			log.Trace().Msgf("AMQP msg received: %s -> %s", delivery.RoutingKey, delivery.Body)
 		}
-		s := strings.Split(delivery.RoutingKey, ".")
 
 		var o interface{}
 		err := json.Unmarshal(delivery.Body, &o)
@@ -119,31 +617,13 @@ func (h *Hub) ListenAMQP(q <-chan amqp.Delivery) {
 			continue
 		}
 
-		switch len(s) {
-		case 2:
-			msg := Event{
-				Scope:  s[0],
-				Stream: "",
-				Type:   s[1],
-				Topic:  getTopic(s[0], s[0], s[1]),
-				Body:   o,
-			}
-
-			h.routeMessage(&msg)
-
-		case 3:
-			msg := Event{
-				Scope:  s[0],
-				Stream: s[1],
-				Type:   s[2],
-				Topic:  getTopic(s[0], s[1], s[2]),
-				Body:   o,
-			}
-
-			h.routeMessage(&msg)
-
-		default:
-			log.Error().Msgf("Bad routing key: %s", delivery.RoutingKey)
+		msg, err := newEvent(delivery.RoutingKey, o)
+		if err != nil {
+			log.Error().Msg(err.Error())
+		} else {
+			msg.At = at
+			msg.CorrelationID = delivery.CorrelationId
+			h.routeMessage(msg)
 		}
 		delivery.Ack(true)
 	}
@@ -153,10 +633,7 @@ func (h *Hub) ListenAMQP(q <-chan amqp.Delivery) {
 
 func (h *Hub) handleSnapshot(msg *Event) (string, error) {
 	topic := msg.Stream + "." + msg.Type
-	body, err := json.Marshal(map[string]interface{}{
-		topic: msg.Body,
-	})
-
+	body, err := h.encodeEvent(topic, msg)
 	if err != nil {
 		return "", err
 	}
@@ -166,17 +643,15 @@ func (h *Hub) handleSnapshot(msg *Event) (string, error) {
 		o = &IncrementalObject{}
 		h.IncrementalObjects[msg.Topic] = o
 	}
-	o.Snapshot = string(body)
+	o.Snapshot = body
 	o.Increments = []string{}
+	h.touchStream(msg.Topic)
 
-	return string(body), nil
+	return body, nil
 }
 
 func (h *Hub) handleIncrement(msg *Event) (string, error) {
-	body, err := json.Marshal(map[string]interface{}{
-		msg.Topic: msg.Body,
-	})
-
+	body, err := h.encodeEvent(msg.Topic, msg)
 	if err != nil {
 		return "", err
 	}
@@ -185,22 +660,41 @@ func (h *Hub) handleIncrement(msg *Event) (string, error) {
 	if !ok {
 		return "", fmt.Errorf("No snapshot received before the increment for topic %s, ignoring", msg.Topic)
 	}
-	o.Increments = append(o.Increments, string(body))
-	return string(body), nil
+	o.Increments = append(o.Increments, body)
+	h.touchStream(msg.Topic)
+	return body, nil
 
 }
 
 func (h *Hub) routeMessage(msg *Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.route(msg)
+}
+
+// route delivers a message to the subscribed clients, the hub mutex must be
+// held.
+func (h *Hub) route(msg *Event) {
 	if isTrace() {
 		log.Trace().Msgf("Routing message %v", msg)
 	}
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
+	h.countStreamMessage(msg.Topic)
+	if h.oversized(msg) || h.duplicate(msg) || h.overRate(msg) {
+		return
+	}
+	// Messages derived from another one keep its ingestion time.
+	if !msg.At.IsZero() {
+		ingested := h.ingested
+		h.ingested = msg.At
+		defer func() { h.ingested = ingested }()
+	}
+	h.copyToFirehose(msg)
 
 	switch msg.Scope {
 	case "public", "global":
-		topic, ok := h.PublicTopics[msg.Topic]
-
+		h.recordFresh(msg.Topic)
+		h.streamSeen[msg.Topic] = h.Clock.Now()
 		switch {
 		case isIncrementObject(msg.Type):
 			rm, err := h.handleIncrement(msg)
@@ -208,9 +702,7 @@ func (h *Hub) routeMessage(msg *Event) {
 				log.Error().Msgf("handleIncrement failed: %s", err.Error())
 				return
 			}
-			if ok {
-				topic.broadcastRaw(msg.Topic, rm)
-			}
+			h.broadcastPublic(msg.Topic, rm, msg.Body)
 			return
 		case isSnapshotObject(msg.Type):
 			_, err := h.handleSnapshot(msg)
@@ -221,22 +713,38 @@ func (h *Hub) routeMessage(msg *Event) {
 			return
 		}
 
-		if ok {
-			topic.broadcast(msg)
-		} else {
+		body, err := h.encodeEvent(msg.Topic, msg)
+		if err != nil {
+			log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+			return
+		}
+		h.recordReplay(msg.Topic, body, msg.Body)
+
+		if !h.broadcastPublic(msg.Topic, body, msg.Body) {
 			if isTrace() {
 				log.Trace().Msgf("No public registration to %s", msg.Topic)
 				log.Trace().Msgf("Public topics: %v", h.PublicTopics)
 			}
 		}
 
+		if msg.Scope == "public" && msg.Type == "trades" {
+			h.aggregateTrades(msg)
+		}
+		if msg.Scope == "public" && msg.Type == "tickers" {
+			h.recordTicker(msg)
+		}
+
 	case "private":
 		uid := msg.Stream
 		uTopic, ok := h.PrivateTopics[uid]
 		if ok {
 			topic, ok := uTopic[msg.Topic]
 			if ok {
-				topic.broadcast(msg)
+				if h.isAckStream(msg.Topic) {
+					h.broadcastAcked(topic, msg)
+				} else {
+					topic.broadcast(msg)
+				}
 				break
 			}
 		}
@@ -251,18 +759,61 @@ func (h *Hub) routeMessage(msg *Event) {
 
 }
 
+// broadcastPublic sends a message of a public stream to the subscribers of the
+// stream and to the subscribers of the groups containing the stream.
+// Each client receives the message once, it returns false if nobody did.
+// The data of the message is evaluated against the delivery conditions.
+func (h *Hub) broadcastPublic(stream, body string, data interface{}) bool {
+	p := newPayload(body)
+	topic, ok := h.PublicTopics[stream]
+	if ok {
+		topic.broadcastRaw(stream, p, data)
+	}
+
+	groups := h.groupsByStream[stream]
+	if len(groups) == 0 {
+		return ok
+	}
+
+	sent := make(map[IClient]struct{})
+	if ok {
+		for _, client := range topic.snapshot() {
+			sent[client] = struct{}{}
+		}
+	}
+
+	for _, g := range groups {
+		gTopic, found := h.PublicTopics[g]
+		if !found {
+			continue
+		}
+		gTopic.fanOut(gTopic.snapshot(), func(client IClient) {
+			if _, done := sent[client]; done {
+				return
+			}
+			sent[client] = struct{}{}
+			gTopic.deliver(client, stream, p, data)
+		})
+	}
+
+	return len(sent) != 0
+}
+
 func (h *Hub) unsubscribeAll(client IClient) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
+	var released []string
 	for t, topic := range h.PublicTopics {
 		if topic.unsubscribe(client) {
-			metrics.RecordHubUnsubscription("public", t)
+			h.subscriptions--
 		}
 		if topic.len() == 0 {
 			delete(h.PublicTopics, t)
+			released = append(released, t)
 		}
 	}
+	h.demandReleased(released)
 
 	uid := client.GetUID()
 	topics, ok := h.PrivateTopics[uid]
@@ -272,7 +823,7 @@ func (h *Hub) unsubscribeAll(client IClient) {
 
 	for t, topic := range topics {
 		if topic.unsubscribe(client) {
-			metrics.RecordHubUnsubscription("private", t)
+			h.subscriptions--
 		}
 		if topic.len() == 0 {
 			delete(topics, t)
@@ -295,29 +846,97 @@ func responseMust(e error, r interface{}) string {
 }
 
 func isPrivateStream(s string) bool {
-	return strings.Count(s, ".") == 0
+	return s != heartbeatStream && s != allTickersStream && strings.Count(s, ".") == 0
 }
 
 func (h *Hub) handleRequest(req *Request) {
+	if h.isUnregistered(req.client) {
+		log.Debug().Msgf("Request of an unregistered client ignored (%s)", req.client.GetUID())
+		return
+	}
+
 	switch req.Method {
 	case "subscribe":
-		h.handleSubscribe(req)
+		if h.allowChurn(req) && h.capStreams(req) {
+			h.handleSubscribe(req)
+		}
 	case "unsubscribe":
-		h.handleUnsubscribe(req)
+		if h.allowChurn(req) {
+			h.handleUnsubscribe(req)
+		}
+	case "set":
+		if h.allowChurn(req) && h.capStreams(req) {
+			h.handleSet(req)
+		}
+	case "resync":
+		if h.allowChurn(req) {
+			h.handleResync(req)
+		}
+	case "limits":
+		h.handleLimits(req)
+	case "firehose":
+		h.handleFirehose(req)
+	case "streams":
+		h.handleStreams(req)
+	case "ack":
+		h.handleAck(req)
+	case "expire":
+		h.handleExpire(req)
+	case "close_session":
+		h.handleCloseSession(req)
 	default:
 		req.client.Send(responseMust(errors.New("unsupported method"), nil))
 	}
 }
 
+// atCapacity returns true if no more subscriptions can be added to the hub.
+func (h *Hub) atCapacity() bool {
+	return h.MaxSubscriptions > 0 && h.subscriptions >= h.MaxSubscriptions
+}
+
 func (h *Hub) handleSubscribe(req *Request) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
+	if h.subscribe(req) && !req.Consolidated {
+		req.client.Send(responseMust(errors.New("server at capacity"), nil))
+	}
+
+	req.client.Send(h.subscriptionAck(req, "subscribed"))
+}
+
+// subscribe subscribes the client of a request to its streams, it returns true
+// if some were rejected because the hub is at capacity. The hub mutex must be
+// held.
+func (h *Hub) subscribe(req *Request) bool {
+	rejected := false
 	for _, t := range req.Streams {
+		if !tokenAllows(req.client, t) {
+			log.Warn().Msgf("Subscription of %s to %s not allowed by token", req.client.GetUID(), t)
+			req.fail(t, "not allowed by token")
+			continue
+		}
 		if isPrivateStream(t) {
 			uid := req.client.GetUID()
 			if uid == "" {
 				log.Error().Msgf("Anonymous user tried to subscribe to private stream %s", t)
+				req.fail(t, "authentication required")
+				continue
+			}
+			if !h.mayReceive(req.client, uid, t) {
+				log.Warn().Msgf("Subscription of %s to %s not authorized", uid, t)
+				req.fail(t, "not authorized")
+				continue
+			}
+			if pattern := h.exceededQuota(req.client, t); pattern != "" {
+				h.rejectQuota(req, pattern, t)
+				continue
+			}
+
+			if topic, ok := h.PrivateTopics[uid][t]; h.atCapacity() && !(ok && topic.has(req.client)) {
+				log.Warn().Msgf("Subscription to %s rejected, server at capacity", t)
+				req.fail(t, "server at capacity")
+				rejected = true
 				continue
 			}
 
@@ -334,46 +953,142 @@ func (h *Hub) handleSubscribe(req *Request) {
 			}
 
 			if topic.subscribe(req.client) {
-				metrics.RecordHubSubscription("private", t)
+				h.subscriptions++
 				req.client.SubscribePrivate(t)
 			}
+			topic.setCondition(req.client, req.Conditions[t])
+			topic.setDelta(req.client, contains(req.Delta, t))
 		} else {
+			if pattern := h.exceededQuota(req.client, t); pattern != "" {
+				h.rejectQuota(req, pattern, t)
+				continue
+			}
+			if topic, ok := h.PublicTopics[t]; h.atCapacity() && !(ok && topic.has(req.client)) {
+				log.Warn().Msgf("Subscription to %s rejected, server at capacity", t)
+				req.fail(t, "server at capacity")
+				rejected = true
+				continue
+			}
+
 			topic, ok := h.PublicTopics[t]
 			if !ok {
 				topic = NewTopic(h)
 				h.PublicTopics[t] = topic
 			}
 
-			if topic.subscribe(req.client) {
-				metrics.RecordHubSubscription("public", t)
+			subscribed := topic.subscribe(req.client)
+			if subscribed {
+				h.subscriptions++
 				req.client.SubscribePublic(t)
+				if topic.len() == 1 {
+					h.demandChanged(t, true)
+				}
+			}
+			topic.setCondition(req.client, req.Conditions[t])
+			topic.setDelta(req.client, contains(req.Delta, t))
+			// A client subscribed already received the replayed messages.
+			if subscribed {
+				h.sendReplay(req.client, topic, t, req.Last[t])
 			}
 
-			if isIncrementObject(t) {
-				o, ok := h.IncrementalObjects[t]
-				if ok && o.Snapshot != "" {
-					req.client.Send(o.Snapshot)
-					for _, inc := range o.Increments {
-						req.client.Send(inc)
-					}
+			caughtUp := true
+			if !contains(req.NoSnapshot, t) {
+				caughtUp = h.sendSnapshot(req.client, t)
+				for _, m := range h.Groups[t] {
+					h.sendSnapshot(req.client, m)
 				}
 			}
+			if caughtUp {
+				h.sendCaughtUp(req.client, t)
+			}
 		}
 	}
 
+	return rejected
+}
+
+// sendSnapshot sends the current snapshot and the following increments of an
+// incremental stream to the client. Without snapshot it is generated with the
+// Snapshotter, if any, and false is returned: the snapshot is sent once
+// generated, followed by the caught up marker.
+func (h *Hub) sendSnapshot(client IClient, stream string) bool {
+	messages := h.snapshotMessages(stream)
+	if messages == nil && h.Snapshotter != nil && isIncrementObject(stream) {
+		h.requestSnapshot(client, stream)
+		return false
+	}
+	for _, m := range messages {
+		client.SendStream(stream, m)
+	}
+	return true
+}
+
+// snapshotMessages returns the current snapshot and the following increments
+// of an incremental stream, nil if no snapshot was received.
+func (h *Hub) snapshotMessages(stream string) []string {
+	if !isIncrementObject(stream) {
+		return nil
+	}
+
+	o, ok := h.IncrementalObjects[stream]
+	if !ok || o.Snapshot == "" {
+		return nil
+	}
+	return append([]string{o.Snapshot}, o.Increments...)
+}
+
+// handleResync sends again the current snapshot and the following increments
+// of an incremental stream the client is subscribed to. The hub mutex orders
+// them before the next increments.
+func (h *Hub) handleResync(req *Request) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	stream := req.Streams[0]
+	if !h.isSubscribedPublic(req.client, stream) {
+		req.client.Send(responseMust(errors.New("not subscribed to stream"), nil))
+		return
+	}
+
+	messages := h.snapshotMessages(stream)
+	if messages == nil {
+		req.client.Send(responseMust(errors.New("no snapshot for stream"), nil))
+		return
+	}
+	for _, m := range messages {
+		req.client.SendStream(stream, m)
+	}
 	req.client.Send(responseMust(nil, map[string]interface{}{
-		"message": "subscribed",
-		"streams": req.client.GetSubscriptions(),
+		"message": "resynced",
+		"stream":  stream,
 	}))
 }
 
+// isSubscribedPublic returns true if the client is subscribed to a public
+// stream or to a group containing it.
+func (h *Hub) isSubscribedPublic(client IClient, stream string) bool {
+	for _, name := range append([]string{stream}, h.groupsByStream[stream]...) {
+		if topic, ok := h.PublicTopics[name]; ok && topic.has(client) {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *Hub) handleUnsubscribe(req *Request) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	for _, t := range req.Streams {
+	h.unsubscribe(req.client, req.Streams)
+	req.client.Send(h.subscriptionAck(req, "unsubscribed"))
+}
+
+// unsubscribe unsubscribes the client from the streams, the hub mutex must be
+// held.
+func (h *Hub) unsubscribe(client IClient, streams []string) {
+	for _, t := range streams {
 		if isPrivateStream(t) {
-			uid := req.client.GetUID()
+			uid := client.GetUID()
 			if uid == "" {
 				continue
 			}
@@ -384,9 +1099,9 @@ func (h *Hub) handleUnsubscribe(req *Request) {
 
 			topic, ok := uTopics[t]
 			if ok {
-				if topic.unsubscribe(req.client) {
-					metrics.RecordHubUnsubscription("private", t)
-					req.client.UnsubscribePrivate(t)
+				if topic.unsubscribe(client) {
+					h.subscriptions--
+					client.UnsubscribePrivate(t)
 				}
 
 				if topic.len() == 0 {
@@ -402,20 +1117,16 @@ func (h *Hub) handleUnsubscribe(req *Request) {
 		} else {
 			topic, ok := h.PublicTopics[t]
 			if ok {
-				if topic.unsubscribe(req.client) {
-					metrics.RecordHubUnsubscription("public", t)
-					req.client.UnsubscribePublic(t)
+				if topic.unsubscribe(client) {
+					h.subscriptions--
+					client.UnsubscribePublic(t)
 				}
 
 				if topic.len() == 0 {
 					delete(h.PublicTopics, t)
+					h.demandChanged(t, false)
 				}
 			}
 		}
 	}
-
-	req.client.Send(responseMust(nil, map[string]interface{}{
-		"message": "unsubscribed",
-		"streams": req.client.GetSubscriptions(),
-	}))
 }
@@ -2,6 +2,7 @@ package routing
 
 import (
 	"testing"
+	"time"
 
 	"github.com/openware/rango/pkg/message"
 	"github.com/stretchr/testify/assert"
@@ -17,14 +18,31 @@ func (c *MockedClient) Send(m string) {
 	c.Called(m)
 }
 
+func (c *MockedClient) SendStream(stream, m string) {
+	c.Called(stream, m)
+}
+
 func (c *MockedClient) Close() {
 }
 
+func (c *MockedClient) CloseWithCode(code int, reason string) {
+	c.Called(code, reason)
+}
+
+func (c *MockedClient) Downgrade() {
+	c.Called()
+}
+
 func (c *MockedClient) GetUID() string {
 	args := c.Called()
 	return args.String(0)
 }
 
+func (c *MockedClient) GetResumeID() string {
+	args := c.Called()
+	return args.String(0)
+}
+
 func (c *MockedClient) GetSubscriptions() []string {
 	args := c.Called()
 	return args.Get(0).([]string)
@@ -46,6 +64,29 @@ func (c *MockedClient) UnsubscribePrivate(s string) {
 	c.Called(s)
 }
 
+// quietT discards assertion failures, it allows to poll mocks.
+type quietT struct{}
+
+func (quietT) Logf(string, ...interface{})   {}
+func (quietT) Errorf(string, ...interface{}) {}
+func (quietT) FailNow()                      {}
+
+// isCalled returns true if the method was called with the arguments.
+func (c *MockedClient) isCalled(method string, args ...interface{}) bool {
+	return c.AssertCalled(quietT{}, method, args...)
+}
+
+// waitFor fails the test if the condition is not met within a second.
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func setup(c *MockedClient, streams []string) *Hub {
 	h := NewHub()
 	h.handleSubscribe(&Request{
@@ -330,3 +371,183 @@ func TestIncrementalObjectStorage(t *testing.T) {
 	require.Equal(t, 0, len(o.Increments))
 	require.Equal(t, `{"abc.count-snap":{"data":[2,3,4,5,6],"sequence":14}}`, o.Snapshot)
 }
+
+func TestSubscribeSnapshotOption(t *testing.T) {
+	snapshot := `{"abc.count-snap":{"data":[2,3,4],"sequence":12}}`
+	increment := `{"abc.count-inc":{"data":5,"sequence":13}}`
+
+	subscribe := func(t *testing.T, req string) *MockedClient {
+		h := NewHub()
+		h.IncrementalObjects["abc.count-inc"] = &IncrementalObject{
+			Snapshot:   snapshot,
+			Increments: []string{increment},
+		}
+
+		c := &MockedClient{}
+		c.On("GetUID").Return("")
+		c.On("GetSubscriptions").Return([]string{"abc.count-inc"})
+		c.On("SubscribePublic", "abc.count-inc").Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+
+		parsed, err := message.ParseRequest([]byte(req))
+		require.NoError(t, err)
+		h.handleSubscribe(&Request{client: c, Request: parsed})
+
+		c.AssertCalled(t, "SubscribePublic", "abc.count-inc")
+		return c
+	}
+
+	t.Run("delivers the snapshot by default", func(t *testing.T) {
+		c := subscribe(t, `{"event":"subscribe","streams":["abc.count-inc"]}`)
+		c.AssertCalled(t, "SendStream", "abc.count-inc", snapshot)
+		c.AssertCalled(t, "SendStream", "abc.count-inc", increment)
+	})
+
+	t.Run("delivers the snapshot with snapshot true", func(t *testing.T) {
+		c := subscribe(t, `{"event":"subscribe","streams":[{"stream":"abc.count-inc","snapshot":true}]}`)
+		c.AssertCalled(t, "SendStream", "abc.count-inc", snapshot)
+		c.AssertCalled(t, "SendStream", "abc.count-inc", increment)
+	})
+
+	t.Run("skips the snapshot with snapshot false", func(t *testing.T) {
+		c := subscribe(t, `{"event":"subscribe","streams":[{"stream":"abc.count-inc","snapshot":false}]}`)
+		c.AssertNotCalled(t, "SendStream", mock.Anything, mock.Anything)
+	})
+
+	t.Run("rejects an invalid snapshot option", func(t *testing.T) {
+		_, err := message.ParseRequest([]byte(`{"event":"subscribe","streams":[{"stream":"abc.count-inc","snapshot":"no"}]}`))
+		assert.Error(t, err)
+	})
+}
+
+func TestGroups(t *testing.T) {
+	h := NewHub()
+	h.SetGroup("top2.trades", []string{"btcusd.trades", "ethusd.trades"})
+
+	c := &MockedClient{}
+	c.On("GetUID").Return("")
+	c.On("GetSubscriptions").Return([]string{"top2.trades"})
+	c.On("SubscribePublic", "top2.trades").Return()
+	c.On("UnsubscribePublic", "top2.trades").Return()
+	c.On("Send", mock.Anything).Return()
+	c.On("SendStream", mock.Anything, mock.Anything).Return()
+
+	h.handleSubscribe(&Request{
+		client:  c,
+		Request: message.Request{Streams: []string{"top2.trades"}},
+	})
+
+	trade := func(market string, body int) {
+		h.routeMessage(&Event{
+			Scope:  "public",
+			Stream: market,
+			Type:   "trades",
+			Topic:  market + ".trades",
+			Body:   body,
+		})
+	}
+
+	t.Run("delivers messages of all members", func(t *testing.T) {
+		trade("btcusd", 1)
+		trade("ethusd", 2)
+		trade("xrpusd", 3)
+
+		c.AssertCalled(t, "SendStream", "btcusd.trades", `{"btcusd.trades":1}`)
+		c.AssertCalled(t, "SendStream", "ethusd.trades", `{"ethusd.trades":2}`)
+		c.AssertNotCalled(t, "SendStream", "xrpusd.trades", `{"xrpusd.trades":3}`)
+	})
+
+	t.Run("follows runtime membership updates", func(t *testing.T) {
+		h.SetGroup("top2.trades", []string{"btcusd.trades", "xrpusd.trades"})
+		trade("ethusd", 4)
+		trade("xrpusd", 5)
+
+		c.AssertNotCalled(t, "SendStream", "ethusd.trades", `{"ethusd.trades":4}`)
+		c.AssertCalled(t, "SendStream", "xrpusd.trades", `{"xrpusd.trades":5}`)
+	})
+
+	t.Run("stops delivery after unsubscribe", func(t *testing.T) {
+		teardown(h, c, []string{"top2.trades"})
+		trade("btcusd", 6)
+		trade("xrpusd", 7)
+
+		c.AssertNotCalled(t, "SendStream", "btcusd.trades", `{"btcusd.trades":6}`)
+		c.AssertNotCalled(t, "SendStream", "xrpusd.trades", `{"xrpusd.trades":7}`)
+		assert.Equal(t, 0, len(h.PublicTopics))
+	})
+}
+
+func TestEnvelope(t *testing.T) {
+	h := NewHub()
+	h.Envelope = message.ArrayEnvelope{}
+
+	c := &MockedClient{}
+	c.On("GetUID").Return("UIDABC00001")
+	c.On("GetSubscriptions").Return([]string{"btcusd.trades", "order"})
+	c.On("SubscribePublic", mock.Anything).Return()
+	c.On("SubscribePrivate", mock.Anything).Return()
+	c.On("Send", mock.Anything).Return()
+	c.On("SendStream", mock.Anything, mock.Anything).Return()
+
+	h.handleSubscribe(&Request{
+		client:  c,
+		Request: message.Request{Streams: []string{"btcusd.trades", "order"}},
+	})
+
+	h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: 1})
+	h.routeMessage(&Event{Scope: "private", Stream: "UIDABC00001", Type: "order", Topic: "order", Body: 2})
+
+	c.AssertCalled(t, "SendStream", "btcusd.trades", `["btcusd.trades",1]`)
+	c.AssertCalled(t, "SendStream", "order", `["order",2]`)
+}
+
+func TestMaxSubscriptions(t *testing.T) {
+	h := NewHub()
+	h.MaxSubscriptions = 2
+
+	c1 := &MockedClient{}
+	c1.On("GetUID").Return("UIDABC00001")
+	c1.On("GetSubscriptions").Return([]string{})
+	c1.On("SubscribePublic", mock.Anything).Return()
+	c1.On("SubscribePrivate", mock.Anything).Return()
+	c1.On("UnsubscribePublic", mock.Anything).Return()
+	c1.On("Send", mock.Anything).Return()
+
+	c2 := &MockedClient{}
+	c2.On("GetUID").Return("")
+	c2.On("GetSubscriptions").Return([]string{})
+	c2.On("SubscribePublic", mock.Anything).Return()
+	c2.On("Send", mock.Anything).Return()
+
+	subscribe := func(c *MockedClient, streams ...string) {
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+	}
+
+	subscribe(c1, "eurusd.trades", "trades")
+	c1.AssertNotCalled(t, "Send", `{"error":"server at capacity"}`)
+	assert.Equal(t, 2, h.subscriptions)
+
+	t.Run("rejects subscriptions at the limit", func(t *testing.T) {
+		subscribe(c2, "eurusd.trades")
+		c2.AssertCalled(t, "Send", `{"error":"server at capacity"}`)
+		c2.AssertNotCalled(t, "SubscribePublic", "eurusd.trades")
+		assert.Equal(t, 2, h.subscriptions)
+	})
+
+	t.Run("accepts already active subscriptions at the limit", func(t *testing.T) {
+		subscribe(c1, "eurusd.trades")
+		c1.AssertNotCalled(t, "Send", `{"error":"server at capacity"}`)
+	})
+
+	t.Run("accepts subscriptions after some are released", func(t *testing.T) {
+		teardown(h, c1, []string{"eurusd.trades"})
+		assert.Equal(t, 1, h.subscriptions)
+
+		c2.Calls = nil
+		subscribe(c2, "eurusd.trades")
+		c2.AssertNotCalled(t, "Send", `{"error":"server at capacity"}`)
+		c2.AssertCalled(t, "SubscribePublic", "eurusd.trades")
+		assert.Equal(t, 2, h.subscriptions)
+	})
+}
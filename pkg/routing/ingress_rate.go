@@ -0,0 +1,95 @@
+package routing
+
+import (
+	"time"
+
+	"github.com/openware/rango/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Policies of the IngressPolicy hub setting.
+const (
+	// IngressDrop drops the messages of a stream above the ingress rate.
+	IngressDrop = "drop"
+
+	// IngressConflate keeps the latest message of a stream above the ingress
+	// rate and routes it when the next second starts.
+	IngressConflate = "conflate"
+)
+
+// ingressWindow counts the messages of a stream received during one second,
+// and holds the latest one above the rate when conflating.
+type ingressWindow struct {
+	start   time.Time
+	count   int
+	pending *Event
+}
+
+// overRate returns true if the message of a public or global stream exceeds
+// the IngressRate of the hub during the current second. It is then dropped,
+// or held until the next second with the IngressConflate policy, replacing the
+// message held before. The incremental streams are not limited, a missing
+// increment would corrupt the state of their subscribers. The hub mutex must
+// be held.
+func (h *Hub) overRate(msg *Event) bool {
+	if h.IngressRate <= 0 || msg.Scope == "private" || isIncrementObject(msg.Topic) {
+		return false
+	}
+
+	now := h.Clock.Now()
+	w, ok := h.ingress[msg.Topic]
+	if !ok {
+		w = &ingressWindow{start: now}
+		h.ingress[msg.Topic] = w
+	}
+	if now.Sub(w.start) >= time.Second {
+		// The held message is superseded by this one.
+		if w.pending != nil {
+			metrics.RecordIngressDrop(h.streamLabel(msg.Topic))
+		}
+		*w = ingressWindow{start: now}
+	}
+	if w.count < h.IngressRate {
+		w.count++
+		return false
+	}
+
+	if w.count == h.IngressRate {
+		w.count++
+		log.Warn().Msgf("Stream %s exceeds the ingress rate of %d messages per second", msg.Topic, h.IngressRate)
+	}
+	if h.IngressPolicy != IngressConflate {
+		metrics.RecordIngressDrop(h.streamLabel(msg.Topic))
+		return true
+	}
+	if w.pending != nil {
+		metrics.RecordIngressDrop(h.streamLabel(msg.Topic))
+	} else {
+		go h.releaseConflated(msg.Topic, w.start, w.start.Add(time.Second).Sub(now))
+	}
+	w.pending = msg
+	return true
+}
+
+// releaseConflated routes the message of the stream held during the window
+// starting at start once it ends, unless a newer message superseded it.
+func (h *Hub) releaseConflated(stream string, start time.Time, wait time.Duration) {
+	timer := h.Clock.NewTimer(wait)
+	select {
+	case <-timer.C():
+	case <-h.ctx.Done():
+		timer.Stop()
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	w, ok := h.ingress[stream]
+	if !ok || !w.start.Equal(start) || w.pending == nil {
+		return
+	}
+	msg := w.pending
+	*w = ingressWindow{start: h.Clock.Now()}
+	h.route(msg)
+}
@@ -0,0 +1,142 @@
+package routing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIngressRate(t *testing.T) {
+	setup := func(policy string) (*Hub, *fakeClock, *MockedClient) {
+		clock := newFakeClock()
+		h := NewHub()
+		h.Clock = clock
+		h.IngressRate = 3
+		h.IngressPolicy = policy
+
+		c := &MockedClient{}
+		c.On("GetUID").Return("UIDABC00001")
+		c.On("GetSubscriptions").Return([]string{"btcusd.trades", "ethusd.trades", "order"})
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		c.On("UnsubscribePublic", mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"btcusd.trades", "ethusd.trades", "order"}}})
+		return h, clock, c
+	}
+	trade := func(h *Hub, market string, id int) {
+		h.routeMessage(&Event{Scope: "public", Stream: market, Type: "trades", Topic: market + ".trades", Body: map[string]interface{}{"id": id}})
+	}
+	deliveries := func(c *MockedClient, stream string) []string {
+		var bodies []string
+		for _, call := range c.Calls {
+			if call.Method == "SendStream" && call.Arguments[0] == stream {
+				bodies = append(bodies, call.Arguments[1].(string))
+			}
+		}
+		return bodies
+	}
+	ids := func(market string, ids ...int) []string {
+		bodies := make([]string, 0, len(ids))
+		for _, id := range ids {
+			bodies = append(bodies, fmt.Sprintf(`{"%s.trades":{"id":%d}}`, market, id))
+		}
+		return bodies
+	}
+
+	t.Run("drops the messages above the rate", func(t *testing.T) {
+		h, clock, c := setup(IngressDrop)
+		for id := 1; id <= 10; id++ {
+			trade(h, "btcusd", id)
+		}
+		trade(h, "ethusd", 1)
+		trade(h, "ethusd", 2)
+		assert.Equal(t, ids("btcusd", 1, 2, 3), deliveries(c, "btcusd.trades"))
+		assert.Equal(t, ids("ethusd", 1, 2), deliveries(c, "ethusd.trades"))
+
+		t.Run("accepts messages again the next second", func(t *testing.T) {
+			clock.Advance(time.Second)
+			trade(h, "btcusd", 11)
+			assert.Equal(t, ids("btcusd", 1, 2, 3, 11), deliveries(c, "btcusd.trades"))
+		})
+
+		t.Run("does not limit private streams", func(t *testing.T) {
+			for id := 1; id <= 5; id++ {
+				h.routeMessage(&Event{Scope: "private", Stream: "UIDABC00001", Type: "order", Topic: "order", Body: map[string]interface{}{"id": id}})
+			}
+			assert.Len(t, deliveries(c, "order"), 5)
+		})
+
+		t.Run("does not limit incremental streams", func(t *testing.T) {
+			h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"btcusd.ob-inc"}}})
+			h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "ob-snap", Topic: "btcusd.ob-inc", Body: 0})
+			for id := 1; id <= 5; id++ {
+				h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "ob-inc", Topic: "btcusd.ob-inc", Body: id})
+			}
+			assert.Len(t, deliveries(c, "btcusd.ob-inc"), 5)
+		})
+
+		t.Run("forgets the windows of idle and retired streams", func(t *testing.T) {
+			h.IdleStreamTTL = time.Minute
+			h.mutex.Lock()
+			assert.Contains(t, h.ingress, "ethusd.trades")
+			h.mutex.Unlock()
+
+			h.RetireStream("ethusd.trades")
+			h.mutex.Lock()
+			assert.NotContains(t, h.ingress, "ethusd.trades")
+			assert.Contains(t, h.ingress, "btcusd.trades")
+			h.mutex.Unlock()
+
+			clock.Advance(time.Minute)
+			h.collectIdleStreams()
+			assert.Empty(t, h.ingress)
+		})
+	})
+
+	t.Run("conflates the messages above the rate", func(t *testing.T) {
+		h, clock, c := setup(IngressConflate)
+		for id := 1; id <= 10; id++ {
+			trade(h, "btcusd", id)
+		}
+		trade(h, "ethusd", 1)
+		assert.Equal(t, ids("btcusd", 1, 2, 3), deliveries(c, "btcusd.trades"))
+		assert.Equal(t, ids("ethusd", 1), deliveries(c, "ethusd.trades"))
+
+		clock.WaitForWaiters(t, 1)
+		clock.Advance(time.Second)
+		waitFor(t, func() bool {
+			h.mutex.Lock()
+			defer h.mutex.Unlock()
+			return len(deliveries(c, "btcusd.trades")) == 4
+		})
+		assert.Equal(t, ids("btcusd", 1, 2, 3, 10), deliveries(c, "btcusd.trades"))
+
+		t.Run("the released message counts in the next second", func(t *testing.T) {
+			trade(h, "btcusd", 11)
+			trade(h, "btcusd", 12)
+			trade(h, "btcusd", 13)
+			assert.Equal(t, ids("btcusd", 1, 2, 3, 10, 11, 12), deliveries(c, "btcusd.trades"))
+		})
+
+		t.Run("a newer message supersedes the held one", func(t *testing.T) {
+			clock.WaitForWaiters(t, 1)
+			h.mutex.Lock()
+			h.ingress["btcusd.trades"].start = clock.Now().Add(-time.Second)
+			h.mutex.Unlock()
+			trade(h, "btcusd", 14)
+			assert.Equal(t, ids("btcusd", 1, 2, 3, 10, 11, 12, 14), deliveries(c, "btcusd.trades"))
+
+			clock.Advance(time.Second)
+			time.Sleep(10 * time.Millisecond)
+			h.mutex.Lock()
+			defer h.mutex.Unlock()
+			assert.Len(t, deliveries(c, "btcusd.trades"), 7)
+		})
+	})
+}
@@ -0,0 +1,92 @@
+package routing
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/openware/rango/pkg/metrics"
+)
+
+// outbound is a message in a send buffer of a client, with the ingestion time
+// of its source message and its stream for the delivery latency. The ingestion
+// time is zero if the latency is not measured.
+type outbound struct {
+	data     []byte
+	ingested time.Time
+	stream   string
+	topic    string
+}
+
+// stamp returns the outbound message of a stream with the ingestion time of
+// the message being routed, the hub mutex must be held.
+func (h *Hub) stamp(stream string, data []byte) outbound {
+	if h.ingested.IsZero() {
+		return outbound{data: data, topic: stream}
+	}
+	return outbound{data: data, ingested: h.ingested, stream: h.streamLabel(stream), topic: stream}
+}
+
+// countStreamMessage counts a message of a stream for the ranking of the
+// stream labels, the hub mutex must be held.
+func (h *Hub) countStreamMessage(stream string) {
+	if h.LatencyStreams > 0 {
+		h.streamMessages[stream]++
+	}
+}
+
+// streamLabel returns the label of a stream in the per-stream metrics, like the
+// delivery latency and the dropped messages. The MetricStreams and the
+// LatencyStreams streams ranked by rankStreamLabels have their own label, the
+// others share otherStreamLabel. The labels left free by the ranking go to the
+// first streams seen. The hub mutex must be held.
+func (h *Hub) streamLabel(stream string) string {
+	if _, ok := h.labelledStreams[stream]; ok || contains(h.MetricStreams, stream) {
+		return stream
+	}
+	if len(h.labelledStreams) >= h.LatencyStreams {
+		return otherStreamLabel
+	}
+	h.labelledStreams[stream] = struct{}{}
+	return stream
+}
+
+// rankStreamLabels gives their own label to the LatencyStreams streams with the
+// most messages since the last ranking, see topStreams, so that a busy stream
+// takes the label of an idle one. The series of the streams losing their label
+// are deleted, so that the number of series stays bounded. It returns these
+// streams. The hub mutex must be held.
+func (h *Hub) rankStreamLabels() []string {
+	labelled := make(map[string]struct{}, h.LatencyStreams)
+	if h.LatencyStreams > 0 {
+		for stream := range h.topStreams(h.streamMessages, h.LatencyStreams) {
+			if stream != otherStreamLabel && !contains(h.MetricStreams, stream) {
+				labelled[stream] = struct{}{}
+			}
+		}
+	}
+
+	var forgotten []string
+	for stream := range h.labelledStreams {
+		if _, ok := labelled[stream]; !ok {
+			metrics.ForgetStream(stream)
+			forgotten = append(forgotten, stream)
+		}
+	}
+	sort.Strings(forgotten)
+
+	h.labelledStreams = labelled
+	h.streamMessages = make(map[string]int)
+	return forgotten
+}
+
+// recordLatency records the time elapsed between the ingestion and the write of
+// a message, it runs in the writer of the client.
+func (c *Client) recordLatency(m outbound) {
+	if m.ingested.IsZero() {
+		return
+	}
+	latency := c.hub.Clock.Now().Sub(m.ingested)
+	atomic.StoreInt64(&c.latency, int64(latency))
+	metrics.RecordDeliveryLatency(m.stream, latency)
+}
@@ -0,0 +1,85 @@
+package routing
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveryLatency(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.LatencyStreams = 1
+
+	clients := make(chan *Client, 1)
+	conn, teardown := serveClient(t, func(conn *websocket.Conn) *Client {
+		c := &Client{
+			hub:      h,
+			conn:     conn,
+			send:     make(chan outbound, maxBufferedMessages),
+			priority: make(chan outbound, maxBufferedMessages),
+			pubSub:   []string{},
+			privSub:  []string{},
+			lastPong: h.Clock.Now().UnixNano(),
+		}
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"btcusd.trades", "ethusd.trades"}}})
+		clients <- c
+		return c
+	})
+	defer teardown()
+	c := <-clients
+
+	read := func(t *testing.T) string {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		return string(data)
+	}
+	latency := func() time.Duration {
+		return time.Duration(atomic.LoadInt64(&c.latency))
+	}
+	assert.Contains(t, read(t), "subscribed")
+
+	t.Run("measures the time between ingestion and write", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: 1, At: clock.Now().Add(-250 * time.Millisecond)})
+		assert.Equal(t, `{"btcusd.trades":1}`, read(t))
+		waitFor(t, func() bool { return latency() == 250*time.Millisecond })
+	})
+
+	t.Run("does not measure messages without ingestion time", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: 2})
+		assert.Equal(t, `{"btcusd.trades":2}`, read(t))
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: 3, At: clock.Now().Add(-time.Second)})
+		assert.Equal(t, `{"btcusd.trades":3}`, read(t))
+		waitFor(t, func() bool { return latency() == time.Second })
+	})
+
+	t.Run("limits the streams with their own label", func(t *testing.T) {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		assert.Equal(t, map[string]struct{}{"btcusd.trades": {}}, h.labelledStreams)
+		assert.Equal(t, "btcusd.trades", h.streamLabel("btcusd.trades"))
+		assert.Equal(t, otherStreamLabel, h.streamLabel("ethusd.trades"))
+	})
+}
+
+func TestIngestionTime(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+
+	c := &Client{hub: h, send: make(chan outbound, maxBufferedMessages), pubSub: []string{}, privSub: []string{}}
+	h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"btcusd.trades"}}})
+	<-c.send
+
+	require.NoError(t, h.BroadcastBatch([]Message{{RoutingKey: "public.btcusd.trades", Body: 1}}))
+	m := <-c.send
+	assert.Equal(t, clock.Now(), m.ingested)
+	assert.Equal(t, otherStreamLabel, m.stream)
+}
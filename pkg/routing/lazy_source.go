@@ -0,0 +1,174 @@
+package routing
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Source is an upstream delivering the messages of the routing keys it is
+// subscribed to, like the bindings of an AMQP queue.
+type Source interface {
+	Subscribe(key string) error
+	Unsubscribe(key string) error
+}
+
+// sourceOp is a pending subscription change of a routing key.
+type sourceOp struct {
+	key       string
+	subscribe bool
+}
+
+// LazySource subscribes the source to the routing keys of the public streams
+// only while they have subscribers. Private and global messages are not
+// affected, the source must deliver them unconditionally.
+type LazySource struct {
+	hub    *Hub
+	source Source
+
+	// Routing keys of the streams with subscribers and the number of streams
+	// using each key, guarded by the hub mutex
+	keys map[string][]string
+	refs map[string]int
+
+	// Changes not applied to the source yet, in order
+	mutex   sync.Mutex
+	ops     []sourceOp
+	pending chan struct{}
+}
+
+// NewLazySource returns a lazy source set up as the StreamDemand and
+// StreamsReleased of the hub, the changes are applied to the source by Run.
+func NewLazySource(h *Hub, source Source) *LazySource {
+	l := &LazySource{
+		hub:     h,
+		source:  source,
+		keys:    make(map[string][]string),
+		refs:    make(map[string]int),
+		pending: make(chan struct{}, 1),
+	}
+	h.StreamDemand = l.demand
+	h.StreamsReleased = l.release
+	return l
+}
+
+// Run applies the subscription changes to the source as they happen.
+func (l *LazySource) Run() {
+	for range l.pending {
+		l.flush()
+	}
+}
+
+// flush applies the pending changes to the source, the failed ones are
+// logged.
+func (l *LazySource) flush() {
+	l.mutex.Lock()
+	ops := l.ops
+	l.ops = nil
+	l.mutex.Unlock()
+
+	for _, op := range ops {
+		if op.subscribe {
+			if err := l.source.Subscribe(op.key); err != nil {
+				log.Error().Msgf("Source subscription to %s failed: %s", op.key, err.Error())
+			}
+		} else if err := l.source.Unsubscribe(op.key); err != nil {
+			log.Error().Msgf("Source unsubscription from %s failed: %s", op.key, err.Error())
+		}
+	}
+}
+
+// demand counts the streams using the routing keys of a stream, and queues
+// their subscription when the first stream uses them and their unsubscription
+// when the last one leaves. The hub mutex must be held.
+func (l *LazySource) demand(stream string, subscribed bool) {
+	var ops []sourceOp
+	if subscribed {
+		keys := l.hub.sourceKeys(stream)
+		l.keys[stream] = keys
+		for _, k := range keys {
+			if l.refs[k]++; l.refs[k] == 1 {
+				ops = append(ops, sourceOp{k, true})
+			}
+		}
+	} else {
+		ops = l.unref(ops, stream)
+	}
+	l.queue(ops)
+}
+
+// release queues the unsubscription of the routing keys no longer used once
+// the streams left, in a single batch. The hub mutex must be held.
+func (l *LazySource) release(streams []string) {
+	var ops []sourceOp
+	for _, stream := range streams {
+		ops = l.unref(ops, stream)
+	}
+	l.queue(ops)
+}
+
+// unref releases the routing keys of a stream and appends the unsubscription
+// of the ones no stream uses anymore to ops.
+func (l *LazySource) unref(ops []sourceOp, stream string) []sourceOp {
+	for _, k := range l.keys[stream] {
+		if l.refs[k]--; l.refs[k] == 0 {
+			delete(l.refs, k)
+			ops = append(ops, sourceOp{k, false})
+		}
+	}
+	delete(l.keys, stream)
+	return ops
+}
+
+// queue adds the changes to the pending ones and wakes Run up.
+func (l *LazySource) queue(ops []sourceOp) {
+	if len(ops) == 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	l.ops = append(l.ops, ops...)
+	l.mutex.Unlock()
+	select {
+	case l.pending <- struct{}{}:
+	default:
+	}
+}
+
+// sourceKeys returns the routing keys of the public messages of a stream: the
+// snapshots of an incremental stream, the trades of a candle stream, the
+// members of a group, and the tickers of every market for the allTickers
+// stream. The hub mutex must be held.
+func (h *Hub) sourceKeys(stream string) []string {
+	if stream == allTickersStream {
+		if h.AllTickersInterval <= 0 {
+			return nil
+		}
+		return []string{"public.*.tickers"}
+	}
+
+	var keys []string
+	add := func(stream string) {
+		s := strings.SplitN(stream, ".", 2)
+		if len(s) != 2 || s[0] == "global" || isPrivateStream(stream) {
+			return
+		}
+		keys = append(keys, "public."+stream)
+		if isIncrementObject(s[1]) {
+			keys = append(keys, "public."+strings.TrimSuffix(stream, "-inc")+"-snap")
+		}
+		for _, interval := range h.CandleIntervals {
+			if candleStream(s[0], interval) == stream {
+				keys = append(keys, "public."+s[0]+".trades")
+				break
+			}
+		}
+	}
+
+	add(stream)
+	for _, m := range h.Groups[stream] {
+		add(m)
+	}
+	return keys
+}
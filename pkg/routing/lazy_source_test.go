@@ -0,0 +1,155 @@
+package routing
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeSource records the subscription changes of the routing keys.
+type fakeSource struct {
+	mutex   sync.Mutex
+	changes []string
+	fail    bool
+}
+
+func (s *fakeSource) Subscribe(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.changes = append(s.changes, "+"+key)
+	if s.fail {
+		return errors.New("binding failed")
+	}
+	return nil
+}
+
+func (s *fakeSource) Unsubscribe(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.changes = append(s.changes, "-"+key)
+	return nil
+}
+
+func TestLazySource(t *testing.T) {
+	h := NewHub()
+	h.CandleIntervals = []time.Duration{time.Minute}
+	h.SetGroup("majors.trades", []string{"btcusd.trades", "ethusd.trades"})
+	source := &fakeSource{}
+	l := NewLazySource(h, source)
+
+	newClient := func(streams ...string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return("UIDABC00001")
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("UnsubscribePublic", mock.Anything).Return()
+		c.On("UnsubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+		return c
+	}
+	unsubscribe := func(c IClient, streams ...string) {
+		h.handleUnsubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+	}
+	changes := func() []string {
+		l.flush()
+		c := source.changes
+		source.changes = nil
+		return c
+	}
+
+	t.Run("subscribes upstream on the first subscriber", func(t *testing.T) {
+		c1 := newClient("btcusd.trades", "order", "global.tickers")
+		assert.Equal(t, []string{"+public.btcusd.trades"}, changes())
+
+		c2 := newClient("btcusd.trades")
+		assert.Empty(t, changes())
+
+		t.Run("unsubscribes upstream when the last subscriber leaves", func(t *testing.T) {
+			unsubscribe(c1, "btcusd.trades")
+			assert.Empty(t, changes())
+
+			h.unsubscribeAll(c2)
+			assert.Equal(t, []string{"-public.btcusd.trades"}, changes())
+		})
+	})
+
+	t.Run("subscribes the snapshots of incremental streams", func(t *testing.T) {
+		c := newClient("btcusd.ob-inc")
+		assert.Equal(t, []string{"+public.btcusd.ob-inc", "+public.btcusd.ob-snap"}, changes())
+		h.unsubscribeAll(c)
+		assert.Equal(t, []string{"-public.btcusd.ob-inc", "-public.btcusd.ob-snap"}, changes())
+	})
+
+	t.Run("shares the keys of candles and groups", func(t *testing.T) {
+		c1 := newClient("btcusd.kline-1m")
+		assert.Equal(t, []string{"+public.btcusd.kline-1m", "+public.btcusd.trades"}, changes())
+
+		c2 := newClient("majors.trades")
+		assert.Equal(t, []string{"+public.majors.trades", "+public.ethusd.trades"}, changes())
+
+		h.unsubscribeAll(c1)
+		assert.Equal(t, []string{"-public.btcusd.kline-1m"}, changes())
+		h.unsubscribeAll(c2)
+		assert.ElementsMatch(t, []string{"-public.majors.trades", "-public.btcusd.trades", "-public.ethusd.trades"}, changes())
+	})
+
+	t.Run("releases the keys of a disconnecting client at once", func(t *testing.T) {
+		c := newClient("btcusd.ob-inc", "ethusd.trades", "xrpusd.trades")
+		changes()
+
+		h.unsubscribeAll(c)
+		assert.Equal(t, []sourceOp{
+			{"public.btcusd.ob-inc", false}, {"public.btcusd.ob-snap", false},
+			{"public.ethusd.trades", false}, {"public.xrpusd.trades", false},
+		}, l.ops)
+		changes()
+	})
+
+	t.Run("a failed subscription does not stop the next changes", func(t *testing.T) {
+		source.fail = true
+		c := newClient("xrpusd.trades")
+		assert.Equal(t, []string{"+public.xrpusd.trades"}, changes())
+		source.fail = false
+		h.unsubscribeAll(c)
+		assert.Equal(t, []string{"-public.xrpusd.trades"}, changes())
+
+		newClient("xrpusd.trades")
+		assert.Equal(t, []string{"+public.xrpusd.trades"}, changes())
+	})
+
+	t.Run("subscribes the tickers of every market for allTickers", func(t *testing.T) {
+		h.AllTickersInterval = time.Second
+		defer func() { h.AllTickersInterval = 0 }()
+
+		c := newClient("allTickers", "ethusd.tickers")
+		assert.Equal(t, []string{"+public.*.tickers", "+public.ethusd.tickers"}, changes())
+
+		// The tickers of the markets without subscribers are delivered too.
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "tickers", Topic: "btcusd.tickers", Body: map[string]interface{}{"last": "9120.0"}})
+		h.routeMessage(&Event{Scope: "public", Stream: "ethusd", Type: "tickers", Topic: "ethusd.tickers", Body: map[string]interface{}{"last": "201.5"}})
+		h.mutex.Lock()
+		assert.Len(t, h.allTickers(), 2)
+		h.mutex.Unlock()
+
+		h.unsubscribeAll(c)
+		assert.Equal(t, []string{"-public.*.tickers", "-public.ethusd.tickers"}, changes())
+	})
+
+	t.Run("runs in the background", func(t *testing.T) {
+		go l.Run()
+		newClient("ltcusd.trades")
+		waitFor(t, func() bool {
+			source.mutex.Lock()
+			defer source.mutex.Unlock()
+			return contains(source.changes, "+public.ltcusd.trades")
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/openware/rango/pkg/metrics"
+)
+
+// recordLiveness records the time of a pong from the client.
+func (c *Client) recordLiveness(now time.Time) {
+	atomic.StoreInt64(&c.lastPong, now.UnixNano())
+	metrics.RecordPong(now)
+}
+
+// LastSeen returns the time of the last pong from the client, or of its
+// connection if none was received yet.
+func (c *Client) LastSeen() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastPong))
+}
+
+// LivenessHandler returns an HTTP handler serving the time of the last pong of
+// each connection in milliseconds and the time elapsed since, like
+// [{"conn_id":"9f86d081884c7d65","uid":"UIDABC00001","last_seen":1588000000000,"idle_ms":1500}].
+func LivenessHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		now := h.Clock.Now()
+		h.mutex.Lock()
+		list := make([]map[string]interface{}, 0, len(h.connections))
+		for c := range h.connections {
+			seen := c.LastSeen()
+			list = append(list, map[string]interface{}{
+				"conn_id":   c.connID,
+				"uid":       c.GetUID(),
+				"last_seen": seen.UnixNano() / int64(time.Millisecond),
+				"idle_ms":   now.Sub(seen).Milliseconds(),
+			})
+		}
+		h.mutex.Unlock()
+
+		sort.Slice(list, func(i, j int) bool {
+			return list[i]["conn_id"].(string) < list[j]["conn_id"].(string)
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
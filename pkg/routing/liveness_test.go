@@ -0,0 +1,70 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordLiveness(t *testing.T) {
+	clock := newFakeClock()
+	c := &Client{hub: NewHub()}
+
+	c.recordLiveness(clock.Now())
+	assert.True(t, clock.Now().Equal(c.LastSeen()))
+
+	clock.Advance(time.Minute)
+	c.recordLiveness(clock.Now())
+	assert.True(t, clock.Now().Equal(c.LastSeen()))
+}
+
+func TestPongLiveness(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	go h.ListenWebsocketEvents()
+
+	conn, teardown := dial(t, h, "/", http.Header{"JwtUID": []string{"UIDABC00001"}})
+	defer teardown()
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	liveness := func() []map[string]interface{} {
+		w := httptest.NewRecorder()
+		LivenessHandler(h)(w, httptest.NewRequest(http.MethodGet, "/admin/liveness", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var list []map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		return list
+	}
+	millis := func(t time.Time) float64 {
+		return float64(t.UnixNano() / int64(time.Millisecond))
+	}
+
+	clock.WaitForWaiters(t, 1)
+	connected := clock.Now()
+	list := liveness()
+	require.Len(t, list, 1)
+	assert.Equal(t, "UIDABC00001", list[0]["uid"])
+	assert.Equal(t, millis(connected), list[0]["last_seen"])
+
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, 30000.0, liveness()[0]["idle_ms"])
+
+	require.NoError(t, conn.WriteControl(websocket.PongMessage, nil, time.Now().Add(writeWait)))
+	waitFor(t, func() bool {
+		list := liveness()
+		return len(list) == 1 && list[0]["last_seen"] == millis(clock.Now()) && list[0]["idle_ms"] == 0.0
+	})
+}
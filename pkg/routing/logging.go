@@ -0,0 +1,36 @@
+package routing
+
+import (
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// logSampler lets through one call out of every rate calls.
+type logSampler struct {
+	count uint64
+}
+
+func (s *logSampler) sample(rate int) bool {
+	if rate <= 1 {
+		return true
+	}
+	return atomic.AddUint64(&s.count, 1)%uint64(rate) == 1
+}
+
+// truncate shortens a message to max bytes, 0 means no limit.
+func truncate(message []byte, max int) string {
+	if max <= 0 || len(message) <= max {
+		return string(message)
+	}
+	return string(message[:max]) + "..."
+}
+
+// logReceived logs at debug level a sample of the messages received from
+// clients.
+func (h *Hub) logReceived(message []byte) {
+	if !isDebug() || !h.receivedSampler.sample(h.LogSampleRate) {
+		return
+	}
+	log.Debug().Msgf("Received message %s", truncate(message, h.LogMaxSize))
+}
@@ -0,0 +1,129 @@
+package routing
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a buffer safe for concurrent use by loggers and tests.
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Len()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.buf.Reset()
+}
+
+// logSink receives the logs of the package tests, it writes them to stderr
+// unless they are captured. The logger is never swapped as the goroutines of
+// other tests may still be logging.
+type logSink struct {
+	mutex sync.Mutex
+	buf   *syncBuffer
+	level zerolog.Level
+}
+
+var testLogs = &logSink{}
+
+func init() {
+	log.Logger = log.Output(testLogs)
+}
+
+func (s *logSink) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (s *logSink) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.buf == nil {
+		return os.Stderr.Write(p)
+	}
+	if level >= s.level {
+		s.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// captureLogs captures the logs of the given level and above until restored.
+func captureLogs(level zerolog.Level) (*syncBuffer, func()) {
+	buf := &syncBuffer{}
+	testLogs.mutex.Lock()
+	testLogs.buf, testLogs.level = buf, level
+	testLogs.mutex.Unlock()
+
+	return buf, func() {
+		testLogs.mutex.Lock()
+		testLogs.buf = nil
+		testLogs.mutex.Unlock()
+	}
+}
+
+func TestLogReceived(t *testing.T) {
+	buf, restore := captureLogs(zerolog.DebugLevel)
+	defer restore()
+
+	t.Run("logs one message out of the sample rate", func(t *testing.T) {
+		buf.Reset()
+		h := NewHub()
+		h.LogSampleRate = 10
+		for i := 0; i < 100; i++ {
+			h.logReceived([]byte(`{"event":"subscribe","streams":["eurusd.trades"]}`))
+		}
+		assert.Equal(t, 10, strings.Count(buf.String(), "\n"))
+	})
+
+	t.Run("logs every message without sampling", func(t *testing.T) {
+		buf.Reset()
+		h := NewHub()
+		for i := 0; i < 10; i++ {
+			h.logReceived([]byte("ping"))
+		}
+		assert.Equal(t, 10, strings.Count(buf.String(), "\n"))
+	})
+
+	t.Run("truncates long messages", func(t *testing.T) {
+		buf.Reset()
+		h := NewHub()
+		h.LogMaxSize = 8
+		h.logReceived([]byte(`{"event":"subscribe"}`))
+		assert.Contains(t, buf.String(), `Received message {\"event\"...`)
+	})
+
+	t.Run("logs nothing above debug level", func(t *testing.T) {
+		buf.Reset()
+		defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		NewHub().logReceived([]byte("ping"))
+		assert.Equal(t, 0, buf.Len())
+	})
+}
@@ -0,0 +1,107 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maintenance is the maintenance mode of the hub, guarded by the hub mutex.
+type maintenance struct {
+	on      bool
+	message string
+}
+
+// SetMaintenance turns the maintenance mode on or off. While it is on, new
+// connections receive {"event":"maintenance","message":"..."} and are closed.
+// With drain the live connections are told and closed as well, otherwise they
+// continue. It returns the number of drained connections.
+func (h *Hub) SetMaintenance(on bool, message string, drain bool) int {
+	h.mutex.Lock()
+	h.maintenance = maintenance{on: on, message: message}
+	var drained []*Client
+	if on && drain {
+		for c := range h.connections {
+			drained = append(drained, c)
+		}
+	}
+	h.mutex.Unlock()
+
+	if on {
+		log.Info().Msgf("Maintenance mode on, %d connections drained", len(drained))
+	} else {
+		log.Info().Msg("Maintenance mode off")
+	}
+	notice := maintenanceNotice(message)
+	for _, c := range drained {
+		c.closeMaintenance(notice)
+	}
+	return len(drained)
+}
+
+// Maintenance returns true and the message of the notice while the
+// maintenance mode is on.
+func (h *Hub) Maintenance() (bool, string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.maintenance.on, h.maintenance.message
+}
+
+// maintenanceNotice returns the notice sent to the connections closed during
+// maintenance.
+func maintenanceNotice(message string) []byte {
+	b, err := json.Marshal(map[string]interface{}{
+		"event":   "maintenance",
+		"message": message,
+	})
+	if err != nil {
+		log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+	}
+	return b
+}
+
+// closeMaintenance writes the maintenance notice to the peer, ahead of the
+// messages buffered for it, and closes the connection.
+func (c *Client) closeMaintenance(notice []byte) {
+	c.writeFrame(c.frame("", notice), false)
+	c.CloseWithCode(closeMaintenance, "maintenance")
+}
+
+// MaintenanceHandler returns an HTTP handler serving the maintenance mode,
+// like {"maintenance":true,"message":"Back at 10:00 UTC"}, and turning it on
+// or off on POST with the on, message and drain query parameters, e.g.
+// POST /admin/maintenance?on=true&message=Back+at+10:00+UTC&drain=false.
+func MaintenanceHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			on, message := h.Maintenance()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"maintenance": on,
+				"message":     message,
+			})
+		case http.MethodPost:
+			query := r.URL.Query()
+			on, err := strconv.ParseBool(query.Get("on"))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintln(w, "invalid on")
+				return
+			}
+			drain := query.Get("drain") == "true"
+			count := h.SetMaintenance(on, query.Get("message"), drain)
+			if on {
+				fmt.Fprintf(w, "maintenance on, %d connections drained\n", count)
+			} else {
+				fmt.Fprintln(w, "maintenance off")
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenance(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+	defer h.Shutdown()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+	defer srv.Close()
+	connect := func(t *testing.T) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/?stream=eurusd.trades", nil)
+		require.NoError(t, err)
+		return conn
+	}
+	closed := func(t *testing.T, conn *websocket.Conn) {
+		assert.Equal(t, map[string]interface{}{"event": "maintenance", "message": "Back at 10:00 UTC"}, readJSON(t, conn))
+		assert.Equal(t, map[string]interface{}{"event": "disconnect", "reason": "maintenance"}, readJSON(t, conn))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err := conn.ReadMessage()
+		assert.Equal(t, &websocket.CloseError{Code: closeMaintenance, Text: "maintenance"}, err)
+	}
+	admin := func(method, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		MaintenanceHandler(h)(w, httptest.NewRequest(method, "/admin/maintenance?"+query, nil))
+		return w
+	}
+
+	existing := connect(t)
+	defer existing.Close()
+	assert.Contains(t, readJSON(t, existing), "success")
+	waitFor(t, func() bool {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		return len(h.connections) == 1
+	})
+
+	t.Run("closes new connections with the notice", func(t *testing.T) {
+		w := admin(http.MethodPost, "on=true&message=Back+at+10:00+UTC")
+		assert.Equal(t, "maintenance on, 0 connections drained\n", w.Body.String())
+		assert.JSONEq(t, `{"maintenance":true,"message":"Back at 10:00 UTC"}`, admin(http.MethodGet, "").Body.String())
+
+		conn := connect(t)
+		defer conn.Close()
+		closed(t, conn)
+	})
+
+	t.Run("existing connections continue", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "eurusd", Type: "trades", Topic: "eurusd.trades", Body: 1})
+		assert.Equal(t, map[string]interface{}{"eurusd.trades": 1.0}, readJSON(t, existing))
+	})
+
+	t.Run("drains existing connections on demand", func(t *testing.T) {
+		w := admin(http.MethodPost, "on=true&message=Back+at+10:00+UTC&drain=true")
+		assert.Equal(t, "maintenance on, 1 connections drained\n", w.Body.String())
+		closed(t, existing)
+	})
+
+	t.Run("accepts connections again once off", func(t *testing.T) {
+		assert.Equal(t, "maintenance off\n", admin(http.MethodPost, "on=false").Body.String())
+		conn := connect(t)
+		defer conn.Close()
+		assert.Contains(t, readJSON(t, conn), "success")
+	})
+
+	t.Run("rejects an invalid toggle", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, admin(http.MethodPost, "on=maybe").Code)
+	})
+}
@@ -0,0 +1,93 @@
+package routing
+
+import (
+	"sort"
+	"time"
+
+	"github.com/openware/rango/pkg/metrics"
+)
+
+// Label of the streams aggregated in the per-stream metrics.
+const otherStreamLabel = "other"
+
+// subscriptionMetricsInterval is the interval of the export of the number of
+// subscriptions by stream.
+const subscriptionMetricsInterval = 10 * time.Second
+
+// RecordSubscriptionMetrics periodically exports the number of subscriptions of
+// the streams, see subscriptionCounts, and ranks the stream labels of the other
+// metrics, see rankStreamLabels.
+func (h *Hub) RecordSubscriptionMetrics() {
+	ticker := h.Clock.NewTicker(subscriptionMetricsInterval)
+	defer ticker.Stop()
+
+	for range ticker.C() {
+		h.mutex.Lock()
+		counts := h.subscriptionCounts()
+		h.rankStreamLabels()
+		h.mutex.Unlock()
+		metrics.RecordHubSubscriptions(counts)
+	}
+}
+
+// subscriptionCounts returns the number of subscriptions of the public and
+// private streams by type with bounded labels: the MetricStreams and the
+// SubscriptionStreams streams of each type with the most subscriptions have
+// their own label, the others are summed as other. The hub mutex must be held.
+func (h *Hub) subscriptionCounts() map[string]map[string]int {
+	public := make(map[string]int, len(h.PublicTopics))
+	for stream, topic := range h.PublicTopics {
+		public[stream] = topic.len()
+	}
+	private := map[string]int{}
+	for _, topics := range h.PrivateTopics {
+		for stream, topic := range topics {
+			private[stream] += topic.len()
+		}
+	}
+
+	return map[string]map[string]int{
+		"public":  h.topStreams(public, h.SubscriptionStreams),
+		"private": h.topStreams(private, h.SubscriptionStreams),
+	}
+}
+
+// topStreams keeps the counts of the MetricStreams and of the n other streams
+// with the highest counts, the others are summed as other. All the streams
+// are kept if n is not positive.
+func (h *Hub) topStreams(counts map[string]int, n int) map[string]int {
+	if n <= 0 {
+		return counts
+	}
+
+	streams := make([]string, 0, len(counts))
+	for stream := range counts {
+		if !contains(h.MetricStreams, stream) {
+			streams = append(streams, stream)
+		}
+	}
+	if len(streams) <= n {
+		return counts
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		if counts[streams[i]] == counts[streams[j]] {
+			return streams[i] < streams[j]
+		}
+		return counts[streams[i]] > counts[streams[j]]
+	})
+
+	top := make(map[string]int, n+len(h.MetricStreams)+1)
+	for _, stream := range h.MetricStreams {
+		if count, ok := counts[stream]; ok {
+			top[stream] = count
+		}
+	}
+	for i, stream := range streams {
+		if i < n {
+			top[stream] = counts[stream]
+		} else {
+			top[otherStreamLabel] += counts[stream]
+		}
+	}
+	return top
+}
@@ -0,0 +1,94 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMetricLabels(t *testing.T) {
+	h := NewHub()
+	h.SubscriptionStreams = 2
+	h.LatencyStreams = 1
+	h.MetricStreams = []string{"xrpusd.trades"}
+	subscribe := func(uid string, streams ...string) {
+		c := &MockedClient{}
+		c.On("GetUID").Return(uid)
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+	}
+
+	subscribe("UIDABC00001", "btcusd.trades", "ethusd.trades", "ltcusd.trades", "order")
+	subscribe("UIDABC00002", "btcusd.trades", "ethusd.trades", "dotusd.trades", "order", "trade")
+	subscribe("UIDABC00003", "btcusd.trades", "xrpusd.trades", "custom1")
+	subscribe("", "bchusd.trades")
+
+	t.Run("only the top streams have their own subscription label", func(t *testing.T) {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		assert.Equal(t, map[string]map[string]int{
+			"public": {
+				"btcusd.trades": 3,
+				"ethusd.trades": 2,
+				"xrpusd.trades": 1,
+				"other":         3,
+			},
+			"private": {
+				"order": 2,
+				// Ties are broken in alphabetical order.
+				"custom1": 1,
+				"other":   1,
+			},
+		}, h.subscriptionCounts())
+	})
+
+	t.Run("all the streams below the limit have their own label", func(t *testing.T) {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		h.SubscriptionStreams = 0
+		assert.Len(t, h.subscriptionCounts()["public"], 6)
+		h.SubscriptionStreams = 10
+		assert.NotContains(t, h.subscriptionCounts()["public"], "other")
+	})
+
+	t.Run("listed streams always have their own latency label", func(t *testing.T) {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		assert.Equal(t, "xrpusd.trades", h.streamLabel("xrpusd.trades"))
+		assert.Equal(t, "btcusd.trades", h.streamLabel("btcusd.trades"))
+		assert.Equal(t, otherStreamLabel, h.streamLabel("ethusd.trades"))
+		assert.Equal(t, "xrpusd.trades", h.streamLabel("xrpusd.trades"))
+	})
+
+	t.Run("a busy stream takes the latency label of an idle one", func(t *testing.T) {
+		h := NewHub()
+		h.LatencyStreams = 2
+		h.MetricStreams = []string{"xrpusd.trades"}
+		route := func(market string, n int) {
+			for i := 0; i < n; i++ {
+				h.routeMessage(&Event{Scope: "public", Stream: market, Type: "trades", Topic: market + ".trades", Body: i})
+			}
+		}
+		route("btcusd", 1)
+		route("ltcusd", 1)
+		route("ethusd", 5)
+		route("dotusd", 3)
+		route("xrpusd", 10)
+
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		assert.Equal(t, "btcusd.trades", h.streamLabel("btcusd.trades"))
+		assert.Equal(t, "ltcusd.trades", h.streamLabel("ltcusd.trades"))
+		assert.Equal(t, otherStreamLabel, h.streamLabel("ethusd.trades"))
+		assert.Equal(t, []string{"btcusd.trades", "ltcusd.trades"}, h.rankStreamLabels())
+		assert.Equal(t, "ethusd.trades", h.streamLabel("ethusd.trades"))
+		assert.Equal(t, "dotusd.trades", h.streamLabel("dotusd.trades"))
+		assert.Equal(t, otherStreamLabel, h.streamLabel("btcusd.trades"))
+		assert.Equal(t, "xrpusd.trades", h.streamLabel("xrpusd.trades"))
+	})
+}
@@ -0,0 +1,29 @@
+package routing
+
+// payload is the encoded message of a broadcast, shared by its subscribers.
+// The message is converted to bytes once, on the first subscriber taking
+// them, so that a fan-out to many connections does not copy it for each of
+// them. A payload is used by a single broadcast, it is not safe for concurrent
+// use.
+type payload struct {
+	text  string
+	bytes []byte
+}
+
+func newPayload(text string) *payload {
+	return &payload{text: text}
+}
+
+// send sends the payload as a message of the stream to the client, the
+// connections share its bytes, other clients like sessions get the text.
+func (p *payload) send(client IClient, stream string) {
+	c, ok := client.(*Client)
+	if !ok {
+		client.SendStream(stream, p.text)
+		return
+	}
+	if p.bytes == nil {
+		p.bytes = []byte(p.text)
+	}
+	c.sendStreamBytes(stream, p.bytes)
+}
@@ -0,0 +1,76 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// maxControlPayload is the maximum size of the payload of a control frame.
+const maxControlPayload = 125
+
+// Kinds of ping payloads of NewPingPayload.
+const (
+	// PingPayloadTime carries the server time in milliseconds, like
+	// {"time":1588000000000}.
+	PingPayloadTime = "time"
+
+	// PingPayloadMetadata also carries the sequence number of the last
+	// protobuf frame of the connection, like {"time":1588000000000,"seq":42}.
+	PingPayloadMetadata = "metadata"
+)
+
+// PingPayload builds the payload of the pings sent to a client, so capable
+// clients can use it without a separate application message. Clients echo the
+// payload in their pongs.
+type PingPayload interface {
+	Payload(c *Client) []byte
+}
+
+// NewPingPayload returns the ping payload of the kind, nil for empty pings if
+// the kind is empty.
+func NewPingPayload(kind string) (PingPayload, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case PingPayloadTime:
+		return pingTime{}, nil
+	case PingPayloadMetadata:
+		return pingMetadata{}, nil
+	default:
+		return nil, fmt.Errorf("unknown ping payload %s", kind)
+	}
+}
+
+type pingTime struct{}
+
+func (pingTime) Payload(c *Client) []byte {
+	b, _ := json.Marshal(map[string]int64{
+		"time": c.hub.Clock.Now().UnixNano() / int64(time.Millisecond),
+	})
+	return b
+}
+
+type pingMetadata struct{}
+
+func (pingMetadata) Payload(c *Client) []byte {
+	b, _ := json.Marshal(map[string]interface{}{
+		"time": c.hub.Clock.Now().UnixNano() / int64(time.Millisecond),
+		"seq":  atomic.LoadUint64(&c.frameSeq),
+	})
+	return b
+}
+
+// pingPayload returns the payload of the next ping of the client, empty if the
+// hub has no PingPayload or if it exceeds the size of a control frame.
+func (c *Client) pingPayload() []byte {
+	if c.hub.PingPayload == nil {
+		return nil
+	}
+	b := c.hub.PingPayload.Payload(c)
+	if len(b) > maxControlPayload {
+		return nil
+	}
+	return b
+}
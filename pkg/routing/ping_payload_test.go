@@ -0,0 +1,100 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedPayload []byte
+
+func (p fixedPayload) Payload(*Client) []byte { return p }
+
+func TestPingPayload(t *testing.T) {
+	ping := func(t *testing.T, payload PingPayload) (string, *Hub, func()) {
+		clock := newFakeClock()
+		h := NewHub()
+		h.Clock = clock
+		h.PingPayload = payload
+		go h.ListenWebsocketEvents()
+
+		conn, teardown := dial(t, h, "/", http.Header{"JwtUID": []string{"UIDABC00001"}})
+
+		pings := make(chan string, 1)
+		conn.SetPingHandler(func(data string) error {
+			clock.Advance(10 * time.Millisecond)
+			pings <- data
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeWait))
+		})
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		clock.WaitForWaiters(t, 1)
+		clock.Advance(pingPeriod)
+		select {
+		case data := <-pings:
+			return data, h, teardown
+		case <-time.After(time.Second):
+			teardown()
+			t.Fatal("no ping received")
+			return "", nil, nil
+		}
+	}
+	rtt := func(h *Hub) time.Duration {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		for c := range h.connections {
+			return c.RTT()
+		}
+		return 0
+	}
+
+	t.Run("pings are empty by default", func(t *testing.T) {
+		data, _, teardown := ping(t, nil)
+		defer teardown()
+		assert.Equal(t, "", data)
+	})
+
+	t.Run("sends the configured payload", func(t *testing.T) {
+		data, h, teardown := ping(t, fixedPayload(`{"region":"eu"}`))
+		defer teardown()
+		assert.Equal(t, `{"region":"eu"}`, data)
+		waitFor(t, func() bool { return rtt(h) == 10*time.Millisecond })
+	})
+
+	t.Run("carries the server time and sequence", func(t *testing.T) {
+		payload, err := NewPingPayload(PingPayloadMetadata)
+		require.NoError(t, err)
+		data, h, teardown := ping(t, payload)
+		defer teardown()
+
+		var res map[string]int64
+		require.NoError(t, json.Unmarshal([]byte(data), &res))
+		assert.Equal(t, h.Clock.Now().Add(-10*time.Millisecond).UnixNano()/int64(time.Millisecond), res["time"])
+		assert.Equal(t, int64(0), res["seq"])
+		waitFor(t, func() bool { return rtt(h) == 10*time.Millisecond })
+	})
+
+	t.Run("oversized payloads are not sent", func(t *testing.T) {
+		data, h, teardown := ping(t, fixedPayload(strings.Repeat("x", maxControlPayload+1)))
+		defer teardown()
+		assert.Equal(t, "", data)
+		waitFor(t, func() bool { return rtt(h) == 10*time.Millisecond })
+	})
+
+	t.Run("rejects unknown kinds", func(t *testing.T) {
+		_, err := NewPingPayload("watermark")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,58 @@
+package routing
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Modes of the PrivateDelivery hub setting.
+const (
+	// PrivateDeliveryAll delivers a private message to every connection of
+	// the user subscribed to its stream.
+	PrivateDeliveryAll = "all"
+
+	// PrivateDeliveryLatest delivers a private message only to the most
+	// recently active connection of the user subscribed to its stream.
+	PrivateDeliveryLatest = "latest"
+)
+
+// recordActivity records a message or a pong received from the client.
+func (c *Client) recordActivity(now time.Time) {
+	atomic.StoreInt64(&c.lastActive, now.UnixNano())
+}
+
+// activeAt returns the time in nanoseconds of the last activity of the
+// connection of a client, 0 if unknown.
+func activeAt(client IClient) int64 {
+	if c, ok := churnClient(client).(*Client); ok {
+		return atomic.LoadInt64(&c.lastActive)
+	}
+	return 0
+}
+
+// privateRecipients returns the subscribers of a private topic receiving its
+// messages, each once. With PrivateDeliveryLatest, they are the subscribers of
+// the most recently active connection only, the connection itself and its
+// sessions, the first subscribed connection wins ties.
+func (h *Hub) privateRecipients(topic *Topic) []IClient {
+	subscribers := topic.snapshot()
+	if h.PrivateDelivery != PrivateDeliveryLatest || len(subscribers) < 2 {
+		return subscribers
+	}
+
+	var latest IClient
+	var latestAt int64
+	for _, client := range subscribers {
+		if at := activeAt(client); latest == nil || at > latestAt {
+			latest, latestAt = churnClient(client), at
+		}
+	}
+
+	recipients := make([]IClient, 0, 1)
+	for _, client := range subscribers {
+		if churnClient(client) == latest {
+			recipients = append(recipients, client)
+		}
+	}
+	return recipients
+}
@@ -0,0 +1,96 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivateDelivery(t *testing.T) {
+	setup := func(t *testing.T, delivery string) (*Hub, *fakeClock, []*Client) {
+		clock := newFakeClock()
+		h := NewHub()
+		h.Clock = clock
+		h.PrivateDelivery = delivery
+		h.DedupStreams = []string{"order"}
+		h.DedupWindow = time.Minute
+		h.DedupSize = 100
+
+		conns := make([]*Client, 3)
+		for i := range conns {
+			conns[i] = &Client{
+				hub:      h,
+				UID:      "UIDABC00001",
+				send:     make(chan outbound, maxBufferedMessages),
+				priority: make(chan outbound, maxBufferedMessages),
+				pubSub:   []string{},
+				privSub:  []string{},
+			}
+			conns[i].recordActivity(clock.Now())
+			clock.Advance(time.Second)
+			h.handleSubscribe(&Request{client: conns[i], Request: message.Request{Streams: []string{"order"}}})
+			<-conns[i].send
+		}
+		return h, clock, conns
+	}
+	order := func(h *Hub, id int) {
+		h.routeMessage(&Event{Scope: "private", Stream: "UIDABC00001", Type: "order", Topic: "order", Body: id})
+	}
+	received := func(c *Client) []string {
+		list := []string{}
+		for len(c.send) != 0 {
+			list = append(list, string((<-c.send).data))
+		}
+		return list
+	}
+
+	t.Run("delivers once to every connection", func(t *testing.T) {
+		h, _, conns := setup(t, PrivateDeliveryAll)
+		order(h, 1)
+		order(h, 1)
+		order(h, 2)
+		for _, c := range conns {
+			assert.Equal(t, []string{`{"order":1}`, `{"order":2}`}, received(c))
+		}
+	})
+
+	t.Run("delivers to the most recently active connection only", func(t *testing.T) {
+		h, clock, conns := setup(t, PrivateDeliveryLatest)
+		order(h, 1)
+		assert.Empty(t, received(conns[0]))
+		assert.Empty(t, received(conns[1]))
+		assert.Equal(t, []string{`{"order":1}`}, received(conns[2]))
+
+		conns[0].recordActivity(clock.Now())
+		order(h, 2)
+		order(h, 2)
+		assert.Equal(t, []string{`{"order":2}`}, received(conns[0]))
+		assert.Empty(t, received(conns[2]))
+	})
+
+	t.Run("the sessions of the latest connection receive the messages", func(t *testing.T) {
+		h, _, conns := setup(t, PrivateDeliveryLatest)
+		s, err := conns[1].session("a")
+		require.NoError(t, err)
+		h.handleSubscribe(&Request{client: s, Request: message.Request{Streams: []string{"order"}}})
+		<-conns[1].send
+
+		order(h, 1)
+		assert.Empty(t, received(conns[1]))
+		assert.Equal(t, []string{`{"order":1}`}, received(conns[2]))
+
+		conns[1].recordActivity(h.Clock.Now().Add(time.Second))
+		order(h, 2)
+		assert.ElementsMatch(t, []string{`{"order":2}`, `{"session":"a","message":{"order":2}}`}, received(conns[1]))
+	})
+
+	t.Run("falls back to the next connection once the latest left", func(t *testing.T) {
+		h, _, conns := setup(t, PrivateDeliveryLatest)
+		h.unsubscribeAll(conns[2])
+		order(h, 1)
+		assert.Equal(t, []string{`{"order":1}`}, received(conns[1]))
+	})
+}
@@ -0,0 +1,80 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtobufClient(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+
+	conn, teardown := dial(t, h, "/", http.Header{"Sec-WebSocket-Protocol": {"rango.proto"}})
+	defer teardown()
+	require.Equal(t, "rango.proto", conn.Subprotocol())
+
+	readFrame := func(t *testing.T) (message.Frame, map[string]interface{}) {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		typ, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.BinaryMessage, typ)
+
+		f, err := message.DecodeFrame(data)
+		require.NoError(t, err)
+		var payload map[string]interface{}
+		require.NoError(t, json.Unmarshal(f.Payload, &payload))
+		return f, payload
+	}
+	request := func(t *testing.T, event string, streams ...string) {
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, message.EncodeProtoRequest(event, streams, 0, "")))
+	}
+
+	f, payload := readFrame(t)
+	assert.Equal(t, uint64(1), f.Seq)
+	assert.Contains(t, payload, "success")
+
+	t.Run("round-trips a subscribe", func(t *testing.T) {
+		request(t, "subscribe", "btcusd.trades")
+		f, payload := readFrame(t)
+		assert.Equal(t, uint64(2), f.Seq)
+		assert.Equal(t, "", f.Stream)
+		assert.Equal(t, map[string]interface{}{
+			"success": map[string]interface{}{"message": "subscribed", "streams": []interface{}{"btcusd.trades"}},
+		}, payload)
+	})
+
+	t.Run("receives broadcasts as protobuf frames", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: 1})
+		f, payload := readFrame(t)
+		assert.Equal(t, uint64(3), f.Seq)
+		assert.Equal(t, "btcusd.trades", f.Stream)
+		assert.Equal(t, map[string]interface{}{"btcusd.trades": 1.0}, payload)
+	})
+
+	t.Run("rejects JSON requests", func(t *testing.T) {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"subscribe","streams":["ethusd.trades"]}`)))
+		_, payload := readFrame(t)
+		assert.Contains(t, payload, "error")
+	})
+}
+
+func TestJSONClientIgnoresProtobuf(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+
+	conn, teardown := dial(t, h, "/?stream=btcusd.trades", http.Header{"Sec-WebSocket-Protocol": {"rango.v1"}})
+	defer teardown()
+	assert.Equal(t, "rango.v1", conn.Subprotocol())
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	typ, _, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, typ)
+}
@@ -0,0 +1,81 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// PublishRequest is the body of a request to the publish endpoint, UID is
+// required for private streams only.
+type PublishRequest struct {
+	Stream        string      `json:"stream"`
+	Message       interface{} `json:"message"`
+	UID           string      `json:"uid"`
+	CorrelationID string      `json:"correlation_id"`
+}
+
+// routingKey returns the source routing key of the published stream.
+func (p *PublishRequest) routingKey() (string, error) {
+	if p.Stream == "" {
+		return "", errors.New("missing stream")
+	}
+
+	if isPrivateStream(p.Stream) {
+		if p.UID == "" {
+			return "", errors.New("missing uid for private stream")
+		}
+		return "private." + p.UID + "." + p.Stream, nil
+	}
+
+	if p.UID != "" {
+		return "", errors.New("uid given for public stream")
+	}
+	return "public." + p.Stream, nil
+}
+
+// PublishHandler returns an HTTP handler broadcasting a posted message to the
+// hub clients the same way a message from the source is.
+func PublishHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		at := h.Clock.Now()
+
+		var req PublishRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		key, err := req.routingKey()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		msg, err := newEvent(key, req.Message)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if isTrace() {
+			log.Trace().Msgf("HTTP msg published: %s -> %v", key, req.Message)
+		}
+		msg.At = at
+		msg.CorrelationID = req.CorrelationID
+		h.routeMessage(msg)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(responseMust(err, nil)))
+}
@@ -0,0 +1,62 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPublishHandler(t *testing.T) {
+	h := NewHub()
+	handler := PublishHandler(h)
+
+	newClient := func(uid string, streams ...string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return(uid)
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+		return c
+	}
+	c1 := newClient("UIDABC00001", "eurusd.trades", "order")
+	c2 := newClient("UIDABC00002", "order")
+
+	publish := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/publish", strings.NewReader(body)))
+		return w
+	}
+
+	t.Run("delivers a public message to subscribers", func(t *testing.T) {
+		w := publish(`{"stream":"eurusd.trades","message":{"price":"1.1"}}`)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		c1.AssertCalled(t, "SendStream", "eurusd.trades", `{"eurusd.trades":{"price":"1.1"}}`)
+		c2.AssertNotCalled(t, "SendStream", "eurusd.trades", `{"eurusd.trades":{"price":"1.1"}}`)
+	})
+
+	t.Run("delivers a private message to the target UID only", func(t *testing.T) {
+		w := publish(`{"stream":"order","uid":"UIDABC00002","message":{"id":1}}`)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		c2.AssertCalled(t, "SendStream", "order", `{"order":{"id":1}}`)
+		c1.AssertNotCalled(t, "SendStream", "order", `{"order":{"id":1}}`)
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, publish(`{"stream":"order","message":1}`).Code)
+		assert.Equal(t, http.StatusBadRequest, publish(`{"stream":"eurusd.trades","uid":"UIDABC00001"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, publish(`{"message":1}`).Code)
+		assert.Equal(t, http.StatusBadRequest, publish(`not json`).Code)
+
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/publish", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
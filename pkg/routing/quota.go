@@ -0,0 +1,65 @@
+package routing
+
+import (
+	"encoding/json"
+	"path"
+
+	"github.com/rs/zerolog/log"
+)
+
+// exceededQuota returns the pattern of the first quota of StreamQuotas the
+// client would exceed by subscribing to the stream, empty if it may subscribe.
+// The streams the client is already subscribed to are always allowed.
+func (h *Hub) exceededQuota(client IClient, stream string) string {
+	if len(h.StreamQuotas) == 0 {
+		return ""
+	}
+
+	subs := client.GetSubscriptions()
+	if contains(subs, stream) {
+		return ""
+	}
+	for pattern, max := range h.StreamQuotas {
+		if ok, _ := path.Match(pattern, stream); !ok {
+			continue
+		}
+		if quotaCount(pattern, subs) >= max {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// quotaCount returns the number of streams matching the pattern of a quota.
+func quotaCount(pattern string, streams []string) int {
+	count := 0
+	for _, s := range streams {
+		if ok, _ := path.Match(pattern, s); ok {
+			count++
+		}
+	}
+	return count
+}
+
+// rejectQuota tells the client of the request its subscription to the stream
+// is rejected by the quota of the pattern, like
+// {"error":"quota exceeded","quota":"*.ob-inc","stream":"btcusd.ob-inc"}, or
+// lists it in the response of a consolidated request.
+func (h *Hub) rejectQuota(req *Request, pattern, stream string) {
+	client := req.client
+	log.Warn().Msgf("Subscription to %s rejected, quota of %s exceeded (%s)", stream, pattern, client.GetUID())
+	if req.Consolidated {
+		req.fail(stream, "quota exceeded")
+		return
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"error":  "quota exceeded",
+		"quota":  pattern,
+		"stream": stream,
+	})
+	if err != nil {
+		log.Error().Msgf("Quota response encoding failed: %s", err.Error())
+		return
+	}
+	client.Send(string(b))
+}
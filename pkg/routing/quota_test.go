@@ -0,0 +1,74 @@
+package routing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamQuotas(t *testing.T) {
+	h := NewHub()
+	h.StreamQuotas = map[string]int{"*.ob-inc": 2, "*.tickers": 100}
+	c := &Client{
+		hub:      h,
+		send:     make(chan outbound, maxBufferedMessages),
+		priority: make(chan outbound, maxBufferedMessages),
+		pubSub:   []string{},
+		privSub:  []string{},
+	}
+	subscribe := func(t *testing.T, streams ...string) []map[string]interface{} {
+		b, err := json.Marshal(map[string]interface{}{"event": "subscribe", "streams": streams})
+		require.NoError(t, err)
+		parsed, err := message.ParseRequest(b)
+		require.NoError(t, err)
+		h.handleRequest(&Request{client: c, Request: parsed})
+
+		var responses []map[string]interface{}
+		for len(c.send) > 0 {
+			var res map[string]interface{}
+			require.NoError(t, json.Unmarshal((<-c.send).data, &res))
+			responses = append(responses, res)
+		}
+		return responses
+	}
+
+	t.Run("rejects the order books above the quota", func(t *testing.T) {
+		res := subscribe(t, "btcusd.ob-inc", "ethusd.ob-inc", "xrpusd.ob-inc", "btcusd.trades")
+		require.Len(t, res, 2)
+		assert.Equal(t, map[string]interface{}{"error": "quota exceeded", "quota": "*.ob-inc", "stream": "xrpusd.ob-inc"}, res[0])
+		assert.ElementsMatch(t, []string{"btcusd.ob-inc", "ethusd.ob-inc", "btcusd.trades"}, c.GetSubscriptions())
+	})
+
+	t.Run("counts the tickers independently", func(t *testing.T) {
+		var tickers []string
+		for _, m := range []string{"btcusd", "ethusd", "xrpusd", "ltcusd", "bchusd", "dotusd"} {
+			tickers = append(tickers, m+".tickers")
+		}
+		res := subscribe(t, tickers...)
+		require.Len(t, res, 1)
+		assert.Contains(t, res[0], "success")
+		assert.Len(t, c.GetSubscriptions(), 9)
+
+		res = subscribe(t, "ltcusd.ob-inc")
+		assert.Equal(t, "ltcusd.ob-inc", res[0]["stream"])
+	})
+
+	t.Run("resubscribing within the quota is allowed", func(t *testing.T) {
+		res := subscribe(t, "btcusd.ob-inc")
+		require.Len(t, res, 1)
+		assert.Contains(t, res[0], "success")
+	})
+
+	t.Run("frees the quota on unsubscribe", func(t *testing.T) {
+		h.handleUnsubscribe(&Request{client: c, Request: message.Request{Streams: []string{"btcusd.ob-inc"}}})
+		<-c.send
+
+		res := subscribe(t, "xrpusd.ob-inc")
+		require.Len(t, res, 1)
+		assert.Contains(t, c.GetSubscriptions(), "xrpusd.ob-inc")
+		assert.NotContains(t, c.GetSubscriptions(), "btcusd.ob-inc")
+	})
+}
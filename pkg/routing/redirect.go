@@ -0,0 +1,114 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Grace period of the redirected connections when RedirectHandler is not
+// given one.
+const defaultRedirectGrace = 10 * time.Second
+
+// Redirect tells the connected clients selected by match, or all the clients
+// if match is nil, to reconnect to another instance, like
+// {"event":"redirect","url":"wss://other"}, and closes their connections once
+// the grace period elapsed. It returns the number of redirected clients. The
+// match function is called with the hub mutex held.
+func (h *Hub) Redirect(url string, grace time.Duration, match func(*Client) bool) int {
+	body, err := json.Marshal(map[string]interface{}{
+		"event": "redirect",
+		"url":   url,
+	})
+	if err != nil {
+		log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+		return 0
+	}
+
+	// The notices are sent with the hub mutex held, so that the send buffers
+	// of the clients leaving meanwhile are not closed yet.
+	h.mutex.Lock()
+	var clients []*Client
+	for c := range h.connections {
+		if match == nil || match(c) {
+			c.Send(string(body))
+			clients = append(clients, c)
+		}
+	}
+	h.mutex.Unlock()
+
+	if len(clients) != 0 {
+		log.Info().Msgf("%d clients redirected to %s", len(clients), url)
+		go h.closeRedirected(clients, grace)
+	}
+	return len(clients)
+}
+
+// closeRedirected closes the connections of the redirected clients once the
+// grace period elapsed, the clients which left earlier are already closed.
+func (h *Hub) closeRedirected(clients []*Client, grace time.Duration) {
+	if grace > 0 {
+		timer := h.Clock.NewTimer(grace)
+		select {
+		case <-timer.C():
+		case <-h.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+	for _, c := range clients {
+		c.CloseWithCode(closeRedirected, "redirected to another instance")
+	}
+}
+
+// RedirectHandler returns an HTTP handler redirecting clients to the instance
+// of the url query parameter, all of them unless the uid or tag parameters
+// select them, closing them after the grace parameter or
+// defaultRedirectGrace, e.g.
+// POST /admin/redirect?url=wss://rango-1&tag=region=eu&grace=30s.
+func RedirectHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		url := query.Get("url")
+		if url == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "missing url")
+			return
+		}
+		grace := defaultRedirectGrace
+		if s := query.Get("grace"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintln(w, "invalid grace")
+				return
+			}
+			grace = d
+		}
+		uid := query.Get("uid")
+		var tag, value string
+		if s := query.Get("tag"); s != "" {
+			kv := strings.SplitN(s, "=", 2)
+			if len(kv) != 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintln(w, "invalid tag, expected name=value")
+				return
+			}
+			tag, value = kv[0], kv[1]
+		}
+
+		count := h.Redirect(url, grace, func(c *Client) bool {
+			return (uid == "" || c.GetUID() == uid) && (tag == "" || c.tags[tag] == value)
+		})
+		fmt.Fprintf(w, "%d clients redirected\n", count)
+	}
+}
@@ -0,0 +1,71 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirect(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.TagHeaders = map[string]string{"region": "X-Region"}
+	go h.ListenWebsocketEvents()
+	defer h.Shutdown()
+
+	eu, teardown := dial(t, h, "/", http.Header{"X-Region": {"eu"}})
+	defer teardown()
+	us, teardown := dial(t, h, "/", http.Header{"X-Region": {"us"}})
+	defer teardown()
+	assert.Contains(t, readJSON(t, eu), "success")
+	assert.Contains(t, readJSON(t, us), "success")
+	waitFor(t, func() bool {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		return len(h.connections) == 2
+	})
+
+	redirect := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		RedirectHandler(h)(w, httptest.NewRequest(http.MethodPost, "/admin/redirect?"+query, nil))
+		return w
+	}
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, redirect("grace=1s").Code)
+		assert.Equal(t, http.StatusBadRequest, redirect("url=wss://rango-1&grace=soon").Code)
+		assert.Equal(t, http.StatusBadRequest, redirect("url=wss://rango-1&tag=eu").Code)
+	})
+
+	t.Run("redirects the selected clients", func(t *testing.T) {
+		w := redirect("url=wss://rango-1&tag=region=eu&grace=5s")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1 clients redirected\n", w.Body.String())
+		assert.Equal(t, map[string]interface{}{"event": "redirect", "url": "wss://rango-1"}, readJSON(t, eu))
+
+		t.Run("closes them after the grace period", func(t *testing.T) {
+			clock.WaitForWaiters(t, 1)
+			clock.Advance(4 * time.Second)
+			require.NoError(t, eu.WriteJSON(map[string]interface{}{"event": "whoami"}))
+			assert.Contains(t, readJSON(t, eu), "uid", "closed before the grace period")
+
+			clock.Advance(time.Second)
+			assert.Equal(t, map[string]interface{}{"event": "disconnect", "reason": "redirected to another instance"}, readJSON(t, eu))
+			eu.SetReadDeadline(time.Now().Add(time.Second))
+			_, _, err := eu.ReadMessage()
+			assert.Equal(t, &websocket.CloseError{Code: closeRedirected, Text: "redirected to another instance"}, err)
+		})
+	})
+
+	t.Run("leaves the other clients connected", func(t *testing.T) {
+		require.NoError(t, us.WriteJSON(map[string]interface{}{"event": "whoami"}))
+		res := readJSON(t, us)
+		assert.Equal(t, map[string]interface{}{"region": "us"}, res["tags"])
+	})
+}
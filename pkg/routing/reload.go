@@ -0,0 +1,63 @@
+package routing
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Config holds the settings of the hub which can be changed while it runs.
+type Config struct {
+	MaxSubscriptions  int
+	MaxSubscribeRate  int
+	MessageSizeLimits map[string]int
+	Authorizer        Authorizer
+	AllowedOrigins    []string
+}
+
+// Reload applies a config to the running hub. The clients keep their
+// connection, the new settings apply from their next request or message. The
+// firehose clients the new authorizer no longer allows are stopped.
+func (h *Hub) Reload(cfg Config) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.MaxSubscriptions = cfg.MaxSubscriptions
+	h.MaxSubscribeRate = cfg.MaxSubscribeRate
+	h.MessageSizeLimits = cfg.MessageSizeLimits
+	h.Authorizer = cfg.Authorizer
+	h.AllowedOrigins = cfg.AllowedOrigins
+	h.reauthorizeFirehose()
+}
+
+// subscribeRate returns the subscription rate limit of the clients.
+func (h *Hub) subscribeRate() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.MaxSubscribeRate
+}
+
+// checkOrigin returns true if the origin of a websocket request is allowed.
+// Without allowed origins only the requests from the host itself are, "*"
+// allows any origin.
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	h.mutex.Lock()
+	allowed := h.AllowedOrigins
+	h.mutex.Unlock()
+
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
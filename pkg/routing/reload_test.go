@@ -0,0 +1,106 @@
+package routing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	h := NewHub()
+	h.Clock = newFakeClock()
+	h.MaxSubscribeRate = 1
+	go h.ListenWebsocketEvents()
+
+	conn, teardown := dial(t, h, "/", nil)
+	defer teardown()
+	assert.Contains(t, readJSON(t, conn), "success")
+
+	subscribe := func(t *testing.T, stream string) map[string]interface{} {
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "subscribe", "streams": []string{stream}}))
+		return readJSON(t, conn)
+	}
+
+	assert.Contains(t, subscribe(t, "btcusd.trades"), "success")
+	assert.Equal(t, "subscription rate limit exceeded", subscribe(t, "ethusd.trades")["error"])
+
+	t.Run("applies new limits to connected clients", func(t *testing.T) {
+		h.Reload(Config{MaxSubscribeRate: 3, MessageSizeLimits: map[string]int{"trades": 8}})
+
+		assert.Contains(t, subscribe(t, "ethusd.trades"), "success")
+
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: "too large for the limit"})
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: 1})
+		assert.Equal(t, map[string]interface{}{"btcusd.trades": 1.0}, readJSON(t, conn))
+	})
+
+	t.Run("keeps the connections open", func(t *testing.T) {
+		h.Reload(Config{})
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "whoami"}))
+		assert.Contains(t, readJSON(t, conn), "conn_id")
+
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		assert.Len(t, h.PublicTopics, 2)
+	})
+}
+
+func TestReloadDelegations(t *testing.T) {
+	h := NewHub()
+	ctx := context.Background()
+	assert.False(t, h.canImpersonate(ctx, "UIDSERVICE00", "UIDABC00001"))
+
+	h.Reload(Config{Authorizer: Delegations{"UIDSERVICE00": {"UIDABC00001"}}})
+	assert.True(t, h.canImpersonate(ctx, "UIDSERVICE00", "UIDABC00001"))
+	assert.False(t, h.canImpersonate(ctx, "UIDSERVICE00", "UIDABC00002"))
+}
+
+func TestCheckOrigin(t *testing.T) {
+	h := NewHub()
+	request := func(origin string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://ws.example.com/", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+
+	t.Run("allows the host itself by default", func(t *testing.T) {
+		assert.True(t, h.checkOrigin(request("")))
+		assert.True(t, h.checkOrigin(request("https://ws.example.com")))
+		assert.False(t, h.checkOrigin(request("https://app.example.com")))
+	})
+
+	t.Run("allows the configured origins", func(t *testing.T) {
+		h.Reload(Config{AllowedOrigins: []string{"https://app.example.com"}})
+		assert.True(t, h.checkOrigin(request("https://APP.example.com")))
+		assert.False(t, h.checkOrigin(request("https://ws.example.com")))
+	})
+
+	t.Run("allows any origin with a wildcard", func(t *testing.T) {
+		h.Reload(Config{AllowedOrigins: []string{"*"}})
+		assert.True(t, h.checkOrigin(request("https://evil.example.org")))
+	})
+
+	t.Run("rejects the upgrade of a disallowed origin", func(t *testing.T) {
+		h.Reload(Config{AllowedOrigins: []string{"https://app.example.com"}})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			NewClient(h, w, r)
+		}))
+		defer srv.Close()
+
+		url := "ws" + strings.TrimPrefix(srv.URL, "http")
+		_, res, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.org"}})
+		assert.Error(t, err)
+		require.NotNil(t, res)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+}
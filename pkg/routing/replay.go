@@ -0,0 +1,70 @@
+package routing
+
+// replayed is a recent message of a public stream, with its body for the
+// delivery conditions.
+type replayed struct {
+	message string
+	body    interface{}
+}
+
+// replayBuffer is a ring buffer of the recent messages of a stream.
+type replayBuffer struct {
+	messages []replayed
+	next     int
+}
+
+// push adds a message to the buffer, the oldest one is replaced once it holds
+// size messages.
+func (b *replayBuffer) push(m replayed, size int) {
+	if len(b.messages) < size {
+		b.messages = append(b.messages, m)
+		return
+	}
+	b.messages[b.next] = m
+	b.next = (b.next + 1) % len(b.messages)
+}
+
+// last returns up to n of the most recent messages, oldest first.
+func (b *replayBuffer) last(n int) []replayed {
+	if n > len(b.messages) {
+		n = len(b.messages)
+	}
+	list := make([]replayed, 0, n)
+	for i := len(b.messages) - n; i < len(b.messages); i++ {
+		list = append(list, b.messages[(b.next+i)%len(b.messages)])
+	}
+	return list
+}
+
+// recordReplay keeps a routed message of a public stream for the subscribers
+// asking for the last messages, the ReplaySize most recent messages of each
+// stream are kept. The increments are not, the snapshot sent to the new
+// subscribers of an incremental stream is followed by the increments since.
+// The hub mutex must be held.
+func (h *Hub) recordReplay(stream, message string, body interface{}) {
+	if h.ReplaySize <= 0 || isIncrementObject(stream) {
+		return
+	}
+	b, ok := h.replay[stream]
+	if !ok {
+		b = &replayBuffer{}
+		h.replay[stream] = b
+	}
+	b.push(replayed{message, body}, h.ReplaySize)
+	h.touchStream(stream)
+}
+
+// sendReplay sends up to n of the most recent messages of the stream to a
+// subscriber of the topic, oldest first, the ones not meeting its delivery
+// condition are skipped. The hub mutex must be held.
+func (h *Hub) sendReplay(client IClient, topic *Topic, stream string, n int) {
+	b, ok := h.replay[stream]
+	if !ok || n <= 0 {
+		return
+	}
+	for _, m := range b.last(n) {
+		if topic.matches(client, m.body) {
+			client.SendStream(stream, m.message)
+		}
+	}
+}
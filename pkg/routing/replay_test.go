@@ -0,0 +1,106 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayLast(t *testing.T) {
+	h := NewHub()
+	h.ReplaySize = 4
+	for i := 1; i <= 6; i++ {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: map[string]interface{}{"tid": float64(i)}})
+	}
+	newClient := func() *Client {
+		return &Client{
+			hub:      h,
+			send:     make(chan outbound, maxBufferedMessages),
+			priority: make(chan outbound, maxBufferedMessages),
+			pubSub:   []string{},
+			privSub:  []string{},
+		}
+	}
+	// subscribeClient returns the messages the client received during the
+	// request.
+	subscribeClient := func(t *testing.T, c *Client, req string) []string {
+		parsed, err := message.ParseRequest([]byte(req))
+		require.NoError(t, err)
+		h.handleRequest(&Request{client: c, Request: parsed})
+
+		var messages []string
+		for len(c.send) > 0 {
+			messages = append(messages, string((<-c.send).data))
+		}
+		return messages
+	}
+	subscribe := func(t *testing.T, req string) []string {
+		return subscribeClient(t, newClient(), req)
+	}
+	trade := func(tid int) string {
+		return fmt.Sprintf(`{"btcusd.trades":{"tid":%d}}`, tid)
+	}
+
+	t.Run("replays the last messages in order", func(t *testing.T) {
+		messages := subscribe(t, `{"event":"subscribe","streams":[{"stream":"btcusd.trades","last":2}]}`)
+		require.Len(t, messages, 3)
+		assert.Equal(t, []string{trade(5), trade(6)}, messages[:2])
+		assert.Contains(t, messages[2], "subscribed")
+	})
+
+	t.Run("caps the replay at the buffer size", func(t *testing.T) {
+		messages := subscribe(t, `{"event":"subscribe","streams":[{"stream":"btcusd.trades","last":100}]}`)
+		assert.Equal(t, []string{trade(3), trade(4), trade(5), trade(6)}, messages[:len(messages)-1])
+	})
+
+	t.Run("skips the messages not meeting the condition", func(t *testing.T) {
+		messages := subscribe(t, `{"event":"subscribe","streams":[{"stream":"btcusd.trades","last":4,"when":{"field":"tid","op":"<","value":5}}]}`)
+		assert.Equal(t, []string{trade(3), trade(4)}, messages[:len(messages)-1])
+	})
+
+	t.Run("replays nothing by default", func(t *testing.T) {
+		assert.Len(t, subscribe(t, `{"event":"subscribe","streams":["btcusd.trades","ethusd.trades"]}`), 1)
+		assert.Len(t, subscribe(t, `{"event":"subscribe","streams":[{"stream":"ethusd.trades","last":5}]}`), 1)
+	})
+
+	t.Run("replays nothing to a subscribed client", func(t *testing.T) {
+		c := newClient()
+		req := `{"event":"subscribe","streams":[{"stream":"btcusd.trades","last":2}]}`
+		assert.Len(t, subscribeClient(t, c, req), 3)
+		assert.Len(t, subscribeClient(t, c, req), 1)
+	})
+
+	t.Run("replays nothing on incremental streams", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "ob-snap", Topic: "btcusd.ob-inc", Body: []interface{}{1}})
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "ob-inc", Topic: "btcusd.ob-inc", Body: []interface{}{2}})
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "ob-inc", Topic: "btcusd.ob-inc", Body: []interface{}{3}})
+
+		messages := subscribe(t, `{"event":"subscribe","streams":[{"stream":"btcusd.ob-inc","last":5}]}`)
+		assert.Equal(t, []string{
+			`{"btcusd.ob-snap":[1]}`,
+			`{"btcusd.ob-inc":[2]}`,
+			`{"btcusd.ob-inc":[3]}`,
+		}, messages[:len(messages)-1])
+	})
+
+	t.Run("rejects an invalid last", func(t *testing.T) {
+		for _, last := range []string{`-1`, `1.5`, `"5"`} {
+			_, err := message.ParseRequest([]byte(`{"event":"subscribe","streams":[{"stream":"btcusd.trades","last":` + last + `}]}`))
+			assert.Error(t, err, last)
+		}
+	})
+
+	t.Run("live messages follow the replay", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: map[string]interface{}{"tid": 7.0}})
+		messages := subscribe(t, `{"event":"subscribe","streams":[{"stream":"btcusd.trades","last":1}]}`)
+		assert.Equal(t, trade(7), messages[0])
+
+		var res map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(messages[1]), &res))
+		assert.Contains(t, res, "success")
+	})
+}
@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Policies of the StreamsOverflow hub setting.
+const (
+	// StreamsOverflowReject rejects a subscribe request with too many streams.
+	StreamsOverflowReject = "reject"
+
+	// StreamsOverflowTruncate subscribes to the first streams of a subscribe
+	// request up to the maximum and ignores the others.
+	StreamsOverflowTruncate = "truncate"
+)
+
+// capStreams applies the maximum number of distinct streams of a subscribe
+// request, it returns false if the request is rejected. The client is told
+// about the ignored streams of a truncated request before the subscription
+// response.
+func (h *Hub) capStreams(req *Request) bool {
+	if h.MaxRequestStreams <= 0 {
+		return true
+	}
+
+	var streams, ignored []string
+	for _, s := range req.Streams {
+		switch {
+		case contains(streams, s):
+		case len(streams) < h.MaxRequestStreams:
+			streams = append(streams, s)
+		default:
+			if !contains(ignored, s) {
+				ignored = append(ignored, s)
+			}
+		}
+	}
+	if len(ignored) == 0 {
+		return true
+	}
+
+	res := map[string]interface{}{"error": "too many streams in request"}
+	if h.StreamsOverflow == StreamsOverflowTruncate {
+		log.Warn().Msgf("Ignoring %d streams above the request limit (%s)", len(ignored), req.client.GetUID())
+		res["ignored"] = ignored
+		req.Streams = streams
+	} else {
+		log.Warn().Msgf("Subscribe request of %d streams rejected (%s)", len(streams)+len(ignored), req.client.GetUID())
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		log.Error().Msgf("Response encoding failed: %s", err.Error())
+		return false
+	}
+	req.client.Send(string(b))
+	return h.StreamsOverflow == StreamsOverflowTruncate
+}
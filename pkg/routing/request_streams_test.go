@@ -0,0 +1,61 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMaxRequestStreams(t *testing.T) {
+	h := NewHub()
+	h.MaxRequestStreams = 2
+
+	newClient := func() *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return("")
+		c.On("GetSubscriptions").Return([]string{})
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("UnsubscribePublic", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		return c
+	}
+	subscribe := func(c IClient, streams ...string) {
+		h.handleRequest(&Request{client: c, Request: message.Request{Method: "subscribe", Streams: streams}})
+	}
+
+	t.Run("subscribes to distinct streams up to the maximum", func(t *testing.T) {
+		c := newClient()
+		subscribe(c, "btcusd.trades", "ethusd.trades", "btcusd.trades")
+		c.AssertNumberOfCalls(t, "SubscribePublic", 2)
+		c.AssertNotCalled(t, "Send", `{"error":"too many streams in request"}`)
+		teardown(h, c, []string{"btcusd.trades", "ethusd.trades"})
+	})
+
+	t.Run("rejects a request above the maximum", func(t *testing.T) {
+		c := newClient()
+		subscribe(c, "btcusd.trades", "ethusd.trades", "xrpusd.trades")
+		c.AssertNotCalled(t, "SubscribePublic", mock.Anything)
+		c.AssertCalled(t, "Send", `{"error":"too many streams in request"}`)
+		c.AssertNumberOfCalls(t, "Send", 1)
+		assert.Empty(t, h.PublicTopics)
+	})
+
+	t.Run("truncates a request above the maximum", func(t *testing.T) {
+		h.StreamsOverflow = StreamsOverflowTruncate
+		c := newClient()
+		subscribe(c, "btcusd.trades", "ethusd.trades", "xrpusd.trades", "ethusd.trades", "ltcusd.trades")
+		c.AssertCalled(t, "SubscribePublic", "btcusd.trades")
+		c.AssertCalled(t, "SubscribePublic", "ethusd.trades")
+		c.AssertNumberOfCalls(t, "SubscribePublic", 2)
+		c.AssertCalled(t, "Send", `{"error":"too many streams in request","ignored":["xrpusd.trades","ltcusd.trades"]}`)
+		assert.Len(t, h.PublicTopics, 2)
+	})
+
+	t.Run("does not limit the internal subscriptions", func(t *testing.T) {
+		c := newClient()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"a.trades", "b.trades", "c.trades"}}})
+		c.AssertNumberOfCalls(t, "SubscribePublic", 3)
+	})
+}
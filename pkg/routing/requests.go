@@ -0,0 +1,65 @@
+package routing
+
+import (
+	"github.com/openware/rango/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Capacity of the requests queue of a new hub.
+var maxQueuedRequests = 1000
+
+// queueRequest queues a client request for the hub. Once the queue is 90%
+// full the reader is paused until the hub drained it to half its capacity,
+// so requests do not build up while the hub is slow. It returns false if the
+// hub is shutting down and the request was dropped.
+func (h *Hub) queueRequest(req Request) bool {
+	if capacity := cap(h.Requests); capacity != 0 && len(h.Requests) >= capacity*9/10 {
+		log.Debug().Msgf("Requests queue near capacity, pausing reads (%s)", req.client.GetUID())
+		for {
+			drained := h.queueDrained()
+			// The hub may have drained the queue before the channel was created.
+			if len(h.Requests) <= capacity/2 {
+				break
+			}
+			select {
+			case <-drained:
+			case <-h.ctx.Done():
+				return false
+			}
+		}
+	}
+
+	if !h.sendRequest(req) {
+		return false
+	}
+	metrics.RecordRequestsQueueDepth(len(h.Requests))
+	return true
+}
+
+// queueDrained returns the channel closed once the hub drained the requests
+// queue to half its capacity.
+func (h *Hub) queueDrained() <-chan struct{} {
+	h.drainedMutex.Lock()
+	defer h.drainedMutex.Unlock()
+
+	if h.drained == nil {
+		h.drained = make(chan struct{})
+	}
+	return h.drained
+}
+
+// requestDequeued resumes the paused readers once a request taken from the
+// queue left it at half its capacity or below.
+func (h *Hub) requestDequeued() {
+	if len(h.Requests) > cap(h.Requests)/2 {
+		return
+	}
+
+	h.drainedMutex.Lock()
+	defer h.drainedMutex.Unlock()
+
+	if h.drained != nil {
+		close(h.drained)
+		h.drained = nil
+	}
+}
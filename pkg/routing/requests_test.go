@@ -0,0 +1,121 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestsBackpressure(t *testing.T) {
+	h := NewHub()
+	h.Requests = make(chan Request, 10)
+
+	conn, teardown := dial(t, h, "/", nil)
+	defer teardown()
+	assert.Contains(t, readJSON(t, conn), "success")
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "subscribe", "streams": []string{"eurusd.trades"}}))
+	}
+	// take dequeues a request like the hub.
+	take := func() {
+		<-h.Requests
+		h.requestDequeued()
+	}
+
+	t.Run("pauses reads once the queue is near capacity", func(t *testing.T) {
+		waitFor(t, func() bool { return len(h.Requests) == 9 })
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, 9, len(h.Requests))
+	})
+
+	t.Run("resumes reads once the queue is drained to half", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			take()
+		}
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, 6, len(h.Requests))
+
+		take()
+		waitFor(t, func() bool { return len(h.Requests) == 9 })
+	})
+
+	t.Run("delivers all the requests", func(t *testing.T) {
+		received := 4
+		for received < 20 {
+			select {
+			case <-h.Requests:
+				h.requestDequeued()
+				received++
+			case <-time.After(time.Second):
+				t.Fatalf("only %d requests received", received)
+			}
+			assert.True(t, len(h.Requests) <= 9)
+		}
+	})
+}
+
+func TestUnregisterAfterQueuedRequests(t *testing.T) {
+	h := NewHub()
+	c := &MockedClient{}
+	c.On("GetUID").Return("")
+	c.On("GetSubscriptions").Return([]string{"eurusd.trades"})
+	c.On("SubscribePublic", mock.Anything).Return()
+	c.On("Send", mock.Anything).Return()
+
+	h.Requests <- Request{client: c, Request: message.Request{Method: "subscribe", Streams: []string{"eurusd.trades"}}}
+	go h.ListenWebsocketEvents()
+	h.Unregister <- c
+
+	// Once unregistered, the client must not be left subscribed.
+	waitFor(t, func() bool {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		return c.isCalled("SubscribePublic", "eurusd.trades") && len(h.PublicTopics) == 0
+	})
+}
+
+func TestPipelinedSubscriptionChanges(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+
+	subscribed := func() bool {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		topic, ok := h.PublicTopics["btcusd.trades"]
+		return ok && topic.len() == 1
+	}
+	pipeline := func(t *testing.T, path string, events ...string) ([]interface{}, func()) {
+		conn, teardown := dial(t, h, path, nil)
+		assert.Contains(t, readJSON(t, conn), "success")
+
+		for i := 0; i < 50; i++ {
+			for _, event := range events {
+				require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": event, "streams": []string{"btcusd.trades"}}))
+			}
+		}
+		var res map[string]interface{}
+		for i := 0; i < 50*len(events); i++ {
+			res = readJSON(t, conn)
+		}
+		return res["success"].(map[string]interface{})["streams"].([]interface{}), teardown
+	}
+
+	t.Run("subscribe then unsubscribe leaves no subscription", func(t *testing.T) {
+		streams, teardown := pipeline(t, "/", "subscribe", "unsubscribe")
+		defer teardown()
+		assert.Empty(t, streams)
+		assert.False(t, subscribed())
+	})
+
+	t.Run("unsubscribe then subscribe leaves one subscription", func(t *testing.T) {
+		streams, teardown := pipeline(t, "/?stream=btcusd.trades", "unsubscribe", "subscribe")
+		defer teardown()
+		assert.Equal(t, []interface{}{"btcusd.trades"}, streams)
+		assert.True(t, subscribed())
+	})
+}
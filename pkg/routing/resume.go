@@ -0,0 +1,81 @@
+package routing
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Policies of the DuplicateResume hub setting.
+const (
+	// DuplicateResumeRejectNew rejects the connections presenting the resume
+	// identity of a live connection.
+	DuplicateResumeRejectNew = "reject-new"
+
+	// DuplicateResumeCloseOld closes the live connection with the resume
+	// identity of a new connection.
+	DuplicateResumeCloseOld = "close-old"
+)
+
+// resumeTaken returns true if a new connection with the resume identity must
+// be rejected, it is checked before the upgrade to answer 409.
+func (h *Hub) resumeTaken(resumeID string) bool {
+	if resumeID == "" || h.DuplicateResume != DuplicateResumeRejectNew {
+		return false
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	_, ok := h.resumers[resumeID]
+	return ok
+}
+
+// claimResume makes the client the live connection of its resume identity
+// following the DuplicateResume policy. It returns false if the client must be
+// rejected, when another connection with the identity got there first.
+func (h *Hub) claimResume(c *Client) bool {
+	if c.resumeID == "" || h.DuplicateResume == "" {
+		return true
+	}
+
+	h.mutex.Lock()
+	old, ok := h.resumers[c.resumeID]
+	if ok && h.DuplicateResume == DuplicateResumeRejectNew {
+		h.mutex.Unlock()
+		return false
+	}
+	h.resumers[c.resumeID] = c
+	h.mutex.Unlock()
+
+	// The close frame is written without the hub mutex, the previous
+	// connection may be slow.
+	if ok {
+		log.Warn().Msgf("Duplicate resume identity, closing the previous connection (%s)", c.UID)
+		old.CloseWithCode(closeDuplicateResume, "resumed by another connection")
+	}
+	return true
+}
+
+// releaseResume frees the resume identity of a closed client, unless another
+// connection claimed it since.
+func (h *Hub) releaseResume(c *Client) {
+	if c.resumeID == "" {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.resumers[c.resumeID] == c {
+		delete(h.resumers, c.resumeID)
+	}
+}
+
+// rejectDuplicateResume answers the upgrade request of a connection whose
+// resume identity belongs to a live connection.
+func rejectDuplicateResume(w http.ResponseWriter, uid string) {
+	log.Warn().Msgf("Duplicate resume identity, connection rejected (%s)", uid)
+	writeError(w, http.StatusConflict, errors.New("resume identity in use"))
+}
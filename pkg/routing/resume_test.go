@@ -0,0 +1,154 @@
+package routing
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicateResume(t *testing.T) {
+	connect := func(t *testing.T, policy string) (func(uid, resume string) (*websocket.Conn, *http.Response, error), func()) {
+		h := NewHub()
+		h.DuplicateResume = policy
+		go h.ListenWebsocketEvents()
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			NewClient(h, w, r)
+		}))
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?resume="
+		dial := func(uid, resume string) (*websocket.Conn, *http.Response, error) {
+			return websocket.DefaultDialer.Dial(url+resume, http.Header{"JwtUID": {uid}})
+		}
+		return dial, func() {
+			srv.Close()
+			h.Shutdown()
+		}
+	}
+
+	t.Run("rejects the new connection", func(t *testing.T) {
+		dial, teardown := connect(t, DuplicateResumeRejectNew)
+		defer teardown()
+
+		first, _, err := dial("UIDABC00001", "device1")
+		require.NoError(t, err)
+		defer first.Close()
+		assert.Contains(t, readJSON(t, first), "success")
+
+		conn, res, err := dial("UIDABC00001", "device1")
+		require.Error(t, err)
+		assert.Nil(t, conn)
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+
+		t.Run("accepts other identities", func(t *testing.T) {
+			for _, id := range [][]string{{"UIDABC00001", "device2"}, {"UIDABC00002", "device1"}} {
+				conn, _, err := dial(id[0], id[1])
+				require.NoError(t, err)
+				assert.Contains(t, readJSON(t, conn), "success")
+				conn.Close()
+			}
+		})
+
+		t.Run("accepts the identity once the connection closed", func(t *testing.T) {
+			first.Close()
+			var conn *websocket.Conn
+			waitFor(t, func() bool {
+				conn, _, err = dial("UIDABC00001", "device1")
+				return err == nil
+			})
+			defer conn.Close()
+			assert.Contains(t, readJSON(t, conn), "success")
+		})
+	})
+
+	t.Run("closes the old connection", func(t *testing.T) {
+		dial, teardown := connect(t, DuplicateResumeCloseOld)
+		defer teardown()
+
+		old, _, err := dial("UIDABC00001", "device1")
+		require.NoError(t, err)
+		defer old.Close()
+		assert.Contains(t, readJSON(t, old), "success")
+
+		conn, _, err := dial("UIDABC00001", "device1")
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Contains(t, readJSON(t, conn), "success")
+
+		assert.Equal(t, map[string]interface{}{"event": "disconnect", "reason": "resumed by another connection"}, readJSON(t, old))
+		old.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err = old.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, closeDuplicateResume), err)
+
+		t.Run("keeps the new connection", func(t *testing.T) {
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("ping")))
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, data, err := conn.ReadMessage()
+			require.NoError(t, err)
+			assert.Equal(t, "pong", string(data))
+		})
+	})
+
+	t.Run("accepts duplicates without policy", func(t *testing.T) {
+		dial, teardown := connect(t, "")
+		defer teardown()
+
+		for i := 0; i < 2; i++ {
+			conn, _, err := dial("UIDABC00001", "device1")
+			require.NoError(t, err)
+			defer conn.Close()
+			assert.Contains(t, readJSON(t, conn), "success")
+		}
+	})
+}
+
+// racingWriter lets another connection claim the resume identity while the
+// connection is upgraded, after the early duplicate check.
+type racingWriter struct {
+	http.ResponseWriter
+	claim func()
+}
+
+func (w racingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.claim()
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func TestDuplicateResumeRace(t *testing.T) {
+	h := NewHub()
+	h.DuplicateResume = DuplicateResumeRejectNew
+	h.TagHeaders = map[string]string{"service": "X-Service"}
+	go h.ListenWebsocketEvents()
+	defer h.Shutdown()
+
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		NewClient(h, racingWriter{w, func() {
+			h.mutex.Lock()
+			h.resumers[resumeIdentity("UIDABC00001", "device1")] = &Client{}
+			h.mutex.Unlock()
+		}}, r)
+	}))
+	defer srv.Close()
+
+	header := http.Header{"JwtUID": {"UIDABC00001"}, "X-Service": {"market-maker"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/?resume=device1", header)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, map[string]interface{}{"event": "disconnect", "reason": "resume identity in use"}, readJSON(t, conn))
+	<-done
+
+	// The tags of the rejected connection are released.
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	assert.Empty(t, h.tagCounts["service"])
+}
@@ -0,0 +1,82 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResync(t *testing.T) {
+	h := NewHub()
+
+	newClient := func(streams ...string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return("")
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+		return c
+	}
+	route := func(typ string, body int) {
+		h.routeMessage(&Event{Scope: "public", Stream: "abc", Type: typ, Topic: "abc.count-inc", Body: body})
+	}
+	resync := func(c *MockedClient, req string) {
+		parsed, err := message.ParseRequest([]byte(req))
+		require.NoError(t, err)
+		h.handleRequest(&Request{client: c, Request: parsed})
+	}
+	streamed := func(c *MockedClient) []string {
+		list := []string{}
+		for _, call := range c.Calls {
+			if call.Method == "SendStream" {
+				list = append(list, call.Arguments[1].(string))
+			}
+		}
+		return list
+	}
+
+	c := newClient("abc.count-inc", "xyz.trades")
+	route("count-snap", 1)
+	route("count-inc", 2)
+
+	t.Run("redelivers the snapshot before the next increments", func(t *testing.T) {
+		resync(c, `{"event":"resync","stream":"abc.count-inc"}`)
+		c.AssertCalled(t, "Send", `{"success":{"message":"resynced","stream":"abc.count-inc"}}`)
+
+		route("count-inc", 3)
+		assert.Equal(t, []string{
+			`{"abc.count-inc":2}`,
+			`{"abc.count-snap":1}`, `{"abc.count-inc":2}`,
+			`{"abc.count-inc":3}`,
+		}, streamed(c))
+	})
+
+	t.Run("redelivers the increments received since the snapshot", func(t *testing.T) {
+		g := newClient("abc.count-inc")
+		g.Calls = nil
+		resync(g, `{"event":"resync","stream":"abc.count-inc"}`)
+		assert.Equal(t, []string{`{"abc.count-snap":1}`, `{"abc.count-inc":2}`, `{"abc.count-inc":3}`}, streamed(g))
+	})
+
+	t.Run("rejects a stream the client is not subscribed to", func(t *testing.T) {
+		other := newClient("xyz.trades")
+		resync(other, `{"event":"resync","stream":"abc.count-inc"}`)
+		other.AssertCalled(t, "Send", `{"error":"not subscribed to stream"}`)
+		other.AssertNotCalled(t, "SendStream", "abc.count-inc", mock.Anything)
+	})
+
+	t.Run("rejects a stream without snapshot", func(t *testing.T) {
+		resync(c, `{"event":"resync","stream":"xyz.trades"}`)
+		c.AssertCalled(t, "Send", `{"error":"no snapshot for stream"}`)
+	})
+
+	t.Run("rejects a request without stream", func(t *testing.T) {
+		_, err := message.ParseRequest([]byte(`{"event":"resync"}`))
+		assert.Error(t, err)
+	})
+}
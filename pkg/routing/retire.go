@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RetireStream unsubscribes all the clients of a stream permanently gone, like
+// the streams of a delisted market, and notifies them with a stream_closed
+// event. The stored snapshot of the stream is dropped.
+func (h *Hub) RetireStream(stream string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"event":  "stream_closed",
+		"stream": stream,
+	})
+	if err != nil {
+		log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+		return
+	}
+	h.removeSubscribers(stream, body)
+
+	delete(h.IncrementalObjects, stream)
+	delete(h.streamActivity, stream)
+	delete(h.lastMessage, stream)
+	delete(h.stale, stream)
+	delete(h.replay, stream)
+	delete(h.tickers, stream)
+	delete(h.ingress, stream)
+	if f, ok := h.snapshotFetches[stream]; ok && !f.fetching {
+		delete(h.snapshotFetches, stream)
+	}
+	log.Info().Msgf("Stream %s retired", stream)
+}
+
+// removeSubscribers unsubscribes all the clients of a stream and sends them the
+// body if not nil, it returns the number of unsubscribed clients. The hub
+// mutex must be held.
+func (h *Hub) removeSubscribers(stream string, body []byte) int {
+	count := 0
+	if isPrivateStream(stream) {
+		for uid, topics := range h.PrivateTopics {
+			topic, ok := topics[stream]
+			if !ok {
+				continue
+			}
+			for _, client := range topic.snapshot() {
+				topic.unsubscribe(client)
+				h.subscriptions--
+				count++
+				client.UnsubscribePrivate(stream)
+				if body != nil {
+					client.Send(string(body))
+				}
+			}
+			delete(topics, stream)
+			if len(topics) == 0 {
+				delete(h.PrivateTopics, uid)
+			}
+		}
+	} else if topic, ok := h.PublicTopics[stream]; ok {
+		for _, client := range topic.snapshot() {
+			topic.unsubscribe(client)
+			h.subscriptions--
+			count++
+			client.UnsubscribePublic(stream)
+			if body != nil {
+				client.Send(string(body))
+			}
+		}
+		delete(h.PublicTopics, stream)
+		h.demandChanged(stream, false)
+	}
+	return count
+}
@@ -0,0 +1,72 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRetireStream(t *testing.T) {
+	h := NewHub()
+	newClient := func(uid string, streams ...string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return(uid)
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("UnsubscribePublic", mock.Anything).Return()
+		c.On("UnsubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+		return c
+	}
+	trade := func(market string) {
+		h.routeMessage(&Event{
+			Scope:  "public",
+			Stream: market,
+			Type:   "trades",
+			Topic:  market + ".trades",
+			Body:   "trade",
+		})
+	}
+
+	c1 := newClient("", "xyzusd.trades", "eurusd.trades")
+	c2 := newClient("UIDABC00001", "xyzusd.trades", "order")
+	c3 := newClient("UIDABC00002", "order")
+
+	t.Run("notifies and unsubscribes the subscribers of a public stream", func(t *testing.T) {
+		h.RetireStream("xyzusd.trades")
+
+		for _, c := range []*MockedClient{c1, c2} {
+			c.AssertCalled(t, "Send", `{"event":"stream_closed","stream":"xyzusd.trades"}`)
+			c.AssertCalled(t, "UnsubscribePublic", "xyzusd.trades")
+		}
+		c3.AssertNotCalled(t, "Send", `{"event":"stream_closed","stream":"xyzusd.trades"}`)
+		assert.NotContains(t, h.PublicTopics, "xyzusd.trades")
+		assert.Equal(t, 3, h.subscriptions)
+
+		trade("xyzusd")
+		trade("eurusd")
+		c1.AssertNotCalled(t, "SendStream", "xyzusd.trades", `{"xyzusd.trades":"trade"}`)
+		c1.AssertCalled(t, "SendStream", "eurusd.trades", `{"eurusd.trades":"trade"}`)
+	})
+
+	t.Run("notifies and unsubscribes the subscribers of a private stream", func(t *testing.T) {
+		h.RetireStream("order")
+
+		for _, c := range []*MockedClient{c2, c3} {
+			c.AssertCalled(t, "Send", `{"event":"stream_closed","stream":"order"}`)
+			c.AssertCalled(t, "UnsubscribePrivate", "order")
+		}
+		assert.Equal(t, 0, len(h.PrivateTopics))
+		assert.Equal(t, 1, h.subscriptions)
+	})
+
+	t.Run("ignores an unknown stream", func(t *testing.T) {
+		h.RetireStream("abcusd.trades")
+		assert.Equal(t, 1, h.subscriptions)
+	})
+}
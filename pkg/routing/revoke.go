@@ -0,0 +1,107 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+)
+
+// StreamAuthorizer decides whether a user may subscribe to a private stream.
+// The context is the one of the subscribing connection, see ConnTag.
+type StreamAuthorizer interface {
+	CanSubscribe(ctx context.Context, uid, stream string) bool
+}
+
+// mayReceive returns true if the client may be subscribed to the private
+// stream of the user: the stream authorizer must allow it, and the delegation
+// of a client acting on behalf of the user must still be allowed. The hub
+// mutex must be held.
+func (h *Hub) mayReceive(client IClient, uid, stream string) bool {
+	if h.StreamAuthorizer != nil && !h.canSubscribe(client, uid, stream) {
+		return false
+	}
+	if c, ok := churnClient(client).(*Client); ok && c.actorUID != "" {
+		return h.Authorizer != nil && h.Authorizer.CanImpersonate(clientContext(client), c.actorUID, uid)
+	}
+	return true
+}
+
+// Reauthorize evaluates again the private subscriptions of the connections of
+// a user after a change of its authorization, the cached decisions of the
+// user are forgotten first. The clients are unsubscribed from the streams they
+// may no longer receive and told so, like
+// {"event":"revoked","streams":["order"]}. The firehose clients are
+// evaluated again too. It returns the number of revoked subscriptions.
+func (h *Hub) Reauthorize(uid string) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.invalidateAuthorization(uid)
+	h.reauthorizeFirehose()
+
+	uTopics, ok := h.PrivateTopics[uid]
+	if !ok {
+		return 0
+	}
+
+	revoked := make(map[IClient][]string)
+	for stream, topic := range uTopics {
+		for _, client := range topic.snapshot() {
+			if h.mayReceive(client, uid, stream) {
+				continue
+			}
+			if topic.unsubscribe(client) {
+				h.subscriptions--
+				client.UnsubscribePrivate(stream)
+				revoked[client] = append(revoked[client], stream)
+			}
+		}
+		if topic.len() == 0 {
+			delete(uTopics, stream)
+		}
+	}
+	if len(uTopics) == 0 {
+		delete(h.PrivateTopics, uid)
+	}
+
+	count := 0
+	for client, streams := range revoked {
+		count += len(streams)
+		sort.Strings(streams)
+		log.Info().Msgf("Subscriptions of %s to %v revoked", uid, streams)
+		b, err := json.Marshal(map[string]interface{}{
+			"event":   "revoked",
+			"streams": streams,
+		})
+		if err != nil {
+			log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+			continue
+		}
+		client.Send(string(b))
+	}
+	return count
+}
+
+// ReauthorizeHandler returns an HTTP handler evaluating again the private
+// subscriptions of the user given with the uid query parameter, e.g.
+// POST /admin/reauthorize?uid=UIDABC00001.
+func ReauthorizeHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		uid := r.URL.Query().Get("uid")
+		if uid == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "missing uid")
+			return
+		}
+		fmt.Fprintf(w, "%d subscriptions revoked\n", h.Reauthorize(uid))
+	}
+}
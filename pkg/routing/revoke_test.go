@@ -0,0 +1,129 @@
+package routing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// grants is a StreamAuthorizer allowing each user its listed private streams.
+type grants struct {
+	mutex   sync.Mutex
+	streams map[string][]string
+}
+
+func (g *grants) CanSubscribe(ctx context.Context, uid, stream string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return contains(g.streams[uid], stream)
+}
+
+func (g *grants) set(uid string, streams ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.streams[uid] = streams
+}
+
+func TestReauthorize(t *testing.T) {
+	g := &grants{streams: map[string][]string{"UIDABC00001": {"order", "trade"}}}
+	h := NewHub()
+	h.StreamAuthorizer = g
+
+	subscribe := func(t *testing.T, uid, req string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return(uid)
+		c.On("GetSubscriptions").Return([]string{})
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("UnsubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+
+		parsed, err := message.ParseRequest([]byte(req))
+		require.NoError(t, err)
+		h.handleSubscribe(&Request{client: c, Request: parsed})
+		return c
+	}
+	order := func(uid string, id int) {
+		h.routeMessage(&Event{Scope: "private", Stream: uid, Type: "order", Topic: "order", Body: id})
+	}
+
+	first := subscribe(t, "UIDABC00001", `{"event":"subscribe","streams":["order","trade"]}`)
+	second := subscribe(t, "UIDABC00001", `{"event":"subscribe","streams":["order"]}`)
+
+	t.Run("subscribes only to the authorized streams", func(t *testing.T) {
+		other := subscribe(t, "UIDABC00002", `{"event":"subscribe","streams":["order"]}`)
+		other.AssertNotCalled(t, "SubscribePrivate", "order")
+		assert.NotContains(t, h.PrivateTopics, "UIDABC00002")
+	})
+
+	t.Run("keeps the streams still authorized", func(t *testing.T) {
+		assert.Equal(t, 0, h.Reauthorize("UIDABC00001"))
+		order("UIDABC00001", 1)
+		first.AssertCalled(t, "SendStream", "order", `{"order":1}`)
+		second.AssertCalled(t, "SendStream", "order", `{"order":1}`)
+	})
+
+	t.Run("unsubscribes and notifies the connections of a revoked stream", func(t *testing.T) {
+		g.set("UIDABC00001", "trade")
+		assert.Equal(t, 2, h.Reauthorize("UIDABC00001"))
+
+		for _, c := range []*MockedClient{first, second} {
+			c.AssertCalled(t, "UnsubscribePrivate", "order")
+			c.AssertCalled(t, "Send", `{"event":"revoked","streams":["order"]}`)
+		}
+		first.AssertNotCalled(t, "UnsubscribePrivate", "trade")
+
+		order("UIDABC00001", 2)
+		first.AssertNotCalled(t, "SendStream", "order", `{"order":2}`)
+		second.AssertNotCalled(t, "SendStream", "order", `{"order":2}`)
+		assert.NotContains(t, h.PrivateTopics["UIDABC00001"], "order")
+		assert.Equal(t, 1, h.subscriptions)
+	})
+
+	t.Run("serves revocations over HTTP", func(t *testing.T) {
+		g.set("UIDABC00001")
+		w := httptest.NewRecorder()
+		ReauthorizeHandler(h)(w, httptest.NewRequest(http.MethodPost, "/admin/reauthorize?uid=UIDABC00001", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1 subscriptions revoked\n", w.Body.String())
+		first.AssertCalled(t, "Send", `{"event":"revoked","streams":["trade"]}`)
+		assert.NotContains(t, h.PrivateTopics, "UIDABC00001")
+
+		w = httptest.NewRecorder()
+		ReauthorizeHandler(h)(w, httptest.NewRequest(http.MethodPost, "/admin/reauthorize", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestReauthorizeDelegation(t *testing.T) {
+	h := NewHub()
+	h.Authorizer = Delegations{"UIDSVC00001": {"UIDABC00001"}}
+	go h.ListenWebsocketEvents()
+
+	delegated, teardown := dial(t, h, "/?stream=order", http.Header{
+		"JwtUID":        []string{"UIDSVC00001"},
+		"JwtOnBehalfOf": []string{"UIDABC00001"},
+	})
+	defer teardown()
+	assert.Contains(t, readJSON(t, delegated), "success")
+
+	owner, teardownOwner := dial(t, h, "/?stream=order", http.Header{"JwtUID": []string{"UIDABC00001"}})
+	defer teardownOwner()
+	assert.Contains(t, readJSON(t, owner), "success")
+
+	h.Reload(Config{})
+	assert.Equal(t, 1, h.Reauthorize("UIDABC00001"))
+	assert.Equal(t, map[string]interface{}{"event": "revoked", "streams": []interface{}{"order"}}, readJSON(t, delegated))
+
+	h.routeMessage(&Event{Scope: "private", Stream: "UIDABC00001", Type: "order", Topic: "order", Body: 1})
+	assert.Equal(t, map[string]interface{}{"order": 1.0}, readJSON(t, owner))
+}
@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/openware/rango/pkg/metrics"
+)
+
+// recordPing records the time a ping is sent to the client.
+func (c *Client) recordPing() {
+	atomic.StoreInt64(&c.pingSentAt, c.hub.Clock.Now().UnixNano())
+}
+
+// recordPong computes the round-trip time of the last ping when its pong is
+// received, unsolicited pongs are ignored.
+func (c *Client) recordPong(now time.Time) {
+	sent := atomic.SwapInt64(&c.pingSentAt, 0)
+	if sent == 0 {
+		return
+	}
+	rtt := now.Sub(time.Unix(0, sent))
+	atomic.StoreInt64(&c.rtt, int64(rtt))
+	metrics.RecordPingRTT(rtt)
+}
+
+// RTT returns the last measured round-trip time of a ping to the client, 0 if
+// none was measured yet.
+func (c *Client) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.rtt))
+}
+
+func (h *Hub) addConnection(c *Client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.connections[c] = struct{}{}
+}
+
+func (h *Hub) removeConnection(c *Client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.connections, c)
+}
+
+// RTTHandler returns an HTTP handler serving the last ping round-trip time of
+// each connection, like [{"conn_id":"9f86d081884c7d65","uid":"UIDABC00001","rtt_ms":12.5}].
+// Connections without measure yet have no rtt_ms.
+func RTTHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.mutex.Lock()
+		list := make([]map[string]interface{}, 0, len(h.connections))
+		for c := range h.connections {
+			item := map[string]interface{}{
+				"conn_id": c.connID,
+				"uid":     c.GetUID(),
+			}
+			if rtt := c.RTT(); rtt > 0 {
+				item["rtt_ms"] = float64(rtt) / float64(time.Millisecond)
+			}
+			list = append(list, item)
+		}
+		h.mutex.Unlock()
+
+		sort.Slice(list, func(i, j int) bool {
+			return list[i]["conn_id"].(string) < list[j]["conn_id"].(string)
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
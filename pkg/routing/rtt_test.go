@@ -0,0 +1,76 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPingRTT(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	go h.ListenWebsocketEvents()
+
+	conn, teardown := dial(t, h, "/", http.Header{"JwtUID": []string{"UIDABC00001"}})
+	defer teardown()
+
+	// The peer answers a ping 25ms later on the hub clock.
+	conn.SetPingHandler(func(data string) error {
+		clock.Advance(25 * time.Millisecond)
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeWait))
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	rtts := func() []map[string]interface{} {
+		w := httptest.NewRecorder()
+		RTTHandler(h)(w, httptest.NewRequest(http.MethodGet, "/admin/rtt", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var list []map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		return list
+	}
+
+	clock.WaitForWaiters(t, 1)
+	list := rtts()
+	require.Len(t, list, 1)
+	assert.Equal(t, "UIDABC00001", list[0]["uid"])
+	assert.NotContains(t, list[0], "rtt_ms")
+
+	clock.Advance(pingPeriod)
+	waitFor(t, func() bool {
+		list := rtts()
+		return len(list) == 1 && list[0]["rtt_ms"] == 25.0
+	})
+}
+
+func TestRecordPong(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	c := &Client{hub: h}
+
+	c.recordPong(clock.Now())
+	assert.Equal(t, time.Duration(0), c.RTT(), "an unsolicited pong is ignored")
+
+	c.recordPing()
+	clock.Advance(40 * time.Millisecond)
+	c.recordPong(clock.Now())
+	assert.Equal(t, 40*time.Millisecond, c.RTT())
+
+	clock.Advance(time.Second)
+	c.recordPong(clock.Now())
+	assert.Equal(t, 40*time.Millisecond, c.RTT(), "a second pong is ignored")
+}
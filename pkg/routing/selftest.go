@@ -0,0 +1,152 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+)
+
+const (
+	// selftestRoutingKey is the source routing key of the loopback messages.
+	selftestRoutingKey = "public.rango.selftest"
+
+	// selftestStream is the stream subscribed by the loopback client.
+	selftestStream = "rango.selftest"
+
+	// SelftestTimeout is the maximum duration of a self-test.
+	SelftestTimeout = 2 * time.Second
+)
+
+// selftestClient is the synthetic client subscribed during a self-test, it
+// reports the messages of the self-test stream and the responses of the hub
+// on its channels.
+type selftestClient struct {
+	received  chan string
+	responses chan string
+}
+
+func (c *selftestClient) SendStream(stream, msg string) {
+	if stream != selftestStream {
+		return
+	}
+	select {
+	case c.received <- msg:
+	default:
+	}
+}
+
+func (c *selftestClient) Send(msg string) {
+	select {
+	case c.responses <- msg:
+	default:
+	}
+}
+
+func (c *selftestClient) Close()                     {}
+func (c *selftestClient) CloseWithCode(int, string)  {}
+func (c *selftestClient) Downgrade()                 {}
+func (c *selftestClient) GetUID() string             { return "" }
+func (c *selftestClient) GetResumeID() string        { return "" }
+func (c *selftestClient) GetSubscriptions() []string { return []string{selftestStream} }
+func (c *selftestClient) SubscribePublic(string)     {}
+func (c *selftestClient) SubscribePrivate(string)    {}
+func (c *selftestClient) UnsubscribePublic(string)   {}
+func (c *selftestClient) UnsubscribePrivate(string)  {}
+
+// selftestRequest queues a request of the self-test client to the self-test
+// stream like the reader of a client does, and waits for the hub to confirm
+// it until the timer fires.
+func (h *Hub) selftestRequest(client *selftestClient, method string, timer Timer) error {
+	req := Request{client: client, Request: message.Request{Method: method, Streams: []string{selftestStream}}}
+	if !h.queueRequest(req) {
+		return errors.New("hub shutting down")
+	}
+	for {
+		select {
+		case res := <-client.responses:
+			if strings.Contains(res, `"success"`) {
+				return nil
+			}
+		case <-timer.C():
+			return errors.New(method + " not handled")
+		}
+	}
+}
+
+// SelfTest subscribes a synthetic client to the self-test stream through the
+// requests queue, routes a message to it the same way a message from the
+// source is and returns the round-trip latency. It fails if the subscription
+// is not handled or the message is not delivered within the timeout.
+func (h *Hub) SelfTest(timeout time.Duration) (time.Duration, error) {
+	client := &selftestClient{received: make(chan string, 16), responses: make(chan string, 16)}
+	timer := h.Clock.NewTimer(timeout)
+	defer timer.Stop()
+
+	err := h.selftestRequest(client, "subscribe", timer)
+	defer func() {
+		unsubscribed := h.Clock.NewTimer(timeout)
+		defer unsubscribed.Stop()
+		h.selftestRequest(client, "unsubscribe", unsubscribed)
+	}()
+	if err != nil {
+		return 0, err
+	}
+
+	h.mutex.Lock()
+	topic, ok := h.PublicTopics[selftestStream]
+	subscribed := ok && topic.has(client)
+	h.mutex.Unlock()
+	if !subscribed {
+		return 0, errors.New("subscription rejected")
+	}
+
+	nonce := newConnID()
+	msg, err := newEvent(selftestRoutingKey, map[string]string{"id": nonce})
+	if err != nil {
+		return 0, err
+	}
+
+	start := h.Clock.Now()
+	h.routeMessage(msg)
+	for {
+		select {
+		case m := <-client.received:
+			if strings.Contains(m, nonce) {
+				return h.Clock.Now().Sub(start), nil
+			}
+		case <-timer.C():
+			return 0, errors.New("message not delivered")
+		}
+	}
+}
+
+// SelftestHandler returns an HTTP handler running a self-test of the hub,
+// it responds with the latency in milliseconds, or with a 503 status and the
+// reason of the failure.
+func SelftestHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		latency, err := h.SelfTest(SelftestTimeout)
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": "failed",
+				"error":  err.Error(),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     "ok",
+			"latency_ms": float64(latency) / float64(time.Millisecond),
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelftestHandler(t *testing.T) {
+	selftest := func(h *Hub) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		SelftestHandler(h)(w, httptest.NewRequest(http.MethodGet, "/selftest", nil))
+		var res map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return w, res
+	}
+
+	t.Run("passes in a healthy hub", func(t *testing.T) {
+		h := NewHub()
+		go h.ListenWebsocketEvents()
+		defer h.Shutdown()
+		w, res := selftest(h)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", res["status"])
+		assert.Contains(t, res, "latency_ms")
+
+		assert.Empty(t, h.PublicTopics)
+		assert.Equal(t, 0, h.subscriptions)
+	})
+
+	t.Run("fails when the message is not broadcast", func(t *testing.T) {
+		clock := newFakeClock()
+		h := NewHub()
+		h.Clock = clock
+		h.MessageSizeLimits = map[string]int{"selftest": 1}
+		go h.ListenWebsocketEvents()
+		defer h.Shutdown()
+
+		done := make(chan struct{})
+		var w *httptest.ResponseRecorder
+		var res map[string]interface{}
+		go func() {
+			defer close(done)
+			w, res = selftest(h)
+		}()
+		clock.WaitForWaiters(t, 1)
+		clock.Advance(SelftestTimeout)
+		<-done
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "failed", res["status"])
+		assert.Equal(t, "message not delivered", res["error"])
+		assert.Empty(t, h.PublicTopics)
+	})
+
+	t.Run("fails when the subscription is rejected", func(t *testing.T) {
+		h := NewHub()
+		h.MaxSubscriptions = 1
+		h.subscriptions = 1
+		go h.ListenWebsocketEvents()
+		defer h.Shutdown()
+		w, res := selftest(h)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "subscription rejected", res["error"])
+	})
+
+	t.Run("fails when the hub does not handle the requests", func(t *testing.T) {
+		clock := newFakeClock()
+		h := NewHub()
+		h.Clock = clock
+
+		done := make(chan struct{})
+		var w *httptest.ResponseRecorder
+		var res map[string]interface{}
+		go func() {
+			defer close(done)
+			w, res = selftest(h)
+		}()
+		clock.WaitForWaiters(t, 1)
+		clock.Advance(SelftestTimeout)
+		clock.WaitForWaiters(t, 2)
+		clock.Advance(SelftestTimeout)
+		<-done
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "subscribe not handled", res["error"])
+		assert.Len(t, h.Requests, 2)
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		SelftestHandler(NewHub())(w, httptest.NewRequest(http.MethodPost, "/selftest", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
@@ -0,0 +1,176 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of logical sessions of a connection.
+const maxSessions = 32
+
+// session is a logical session multiplexed over the connection of a client. It
+// has its own subscriptions and its messages are tagged with its ID, like
+// {"session":"w1","message":{"btcusd.trades":...}}.
+type session struct {
+	client *Client
+	id     string
+
+	subsMutex sync.Mutex
+	pubSub    []string
+	privSub   []string
+}
+
+func (s *session) tag(msg string) string {
+	id, _ := json.Marshal(s.id)
+	return `{"session":` + string(id) + `,"message":` + msg + `}`
+}
+
+func (s *session) Send(msg string) {
+	s.client.Send(s.tag(msg))
+}
+
+func (s *session) SendStream(stream, msg string) {
+	s.client.SendStream(stream, s.tag(msg))
+}
+
+// Close does nothing, the connection is closed with the client.
+func (s *session) Close() {}
+
+func (s *session) CloseWithCode(code int, reason string) {
+	s.client.CloseWithCode(code, reason)
+}
+
+// Downgrade does nothing, the session follows the identity of the client.
+func (s *session) Downgrade() {}
+
+func (s *session) GetUID() string {
+	return s.client.GetUID()
+}
+
+// GetResumeID returns no identity, the messages of a session are not
+// redelivered.
+func (s *session) GetResumeID() string {
+	return ""
+}
+
+func (s *session) GetSubscriptions() []string {
+	s.subsMutex.Lock()
+	defer s.subsMutex.Unlock()
+
+	streams := make([]string, 0, len(s.pubSub)+len(s.privSub))
+	return append(append(streams, s.pubSub...), s.privSub...)
+}
+
+func (s *session) SubscribePublic(stream string) {
+	s.subsMutex.Lock()
+	defer s.subsMutex.Unlock()
+
+	atomic.StoreInt32(&s.client.subscribed, 1)
+	if !contains(s.pubSub, stream) {
+		s.pubSub = append(s.pubSub, stream)
+	}
+}
+
+func (s *session) SubscribePrivate(stream string) {
+	s.subsMutex.Lock()
+	defer s.subsMutex.Unlock()
+
+	atomic.StoreInt32(&s.client.subscribed, 1)
+	if !contains(s.privSub, stream) {
+		s.privSub = append(s.privSub, stream)
+	}
+}
+
+func (s *session) UnsubscribePublic(stream string) {
+	s.subsMutex.Lock()
+	defer s.subsMutex.Unlock()
+
+	s.pubSub = remove(s.pubSub, stream)
+}
+
+func (s *session) UnsubscribePrivate(stream string) {
+	s.subsMutex.Lock()
+	defer s.subsMutex.Unlock()
+
+	s.privSub = remove(s.privSub, stream)
+}
+
+func remove(list []string, el string) []string {
+	l := make([]string, 0, len(list))
+	for _, s := range list {
+		if s != el {
+			l = append(l, s)
+		}
+	}
+	return l
+}
+
+// session returns the session of the client with the ID, it is created on
+// first use. It runs in the client reader.
+func (c *Client) session(id string) (*session, error) {
+	c.sessionsMutex.Lock()
+	defer c.sessionsMutex.Unlock()
+
+	if s, ok := c.sessions[id]; ok {
+		return s, nil
+	}
+	if len(c.sessions) >= maxSessions {
+		return nil, errors.New("too many sessions")
+	}
+	if c.sessions == nil {
+		c.sessions = make(map[string]*session)
+	}
+	s := &session{client: c, id: id, pubSub: []string{}, privSub: []string{}}
+	c.sessions[id] = s
+	return s, nil
+}
+
+// removeSession removes the session with the ID from the client, it returns
+// nil if the session does not exist.
+func (c *Client) removeSession(id string) *session {
+	c.sessionsMutex.Lock()
+	defer c.sessionsMutex.Unlock()
+
+	s := c.sessions[id]
+	delete(c.sessions, id)
+	return s
+}
+
+// removeSessions removes all the sessions from the client and returns them.
+func (c *Client) removeSessions() []*session {
+	c.sessionsMutex.Lock()
+	defer c.sessionsMutex.Unlock()
+
+	sessions := make([]*session, 0, len(c.sessions))
+	for _, s := range c.sessions {
+		sessions = append(sessions, s)
+	}
+	c.sessions = nil
+	return sessions
+}
+
+// listSessions returns the current sessions of the client.
+func (c *Client) listSessions() []*session {
+	c.sessionsMutex.Lock()
+	defer c.sessionsMutex.Unlock()
+
+	sessions := make([]*session, 0, len(c.sessions))
+	for _, s := range c.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// handleCloseSession unsubscribes a session from all its streams.
+func (h *Hub) handleCloseSession(req *Request) {
+	log.Debug().Msgf("Closing session (%s)", req.client.GetUID())
+	h.unsubscribeAll(req.client)
+	h.removeFirehose(req.client)
+	req.client.Send(responseMust(nil, map[string]interface{}{
+		"message": "session closed",
+	}))
+}
@@ -0,0 +1,97 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+
+	conn, teardown := dial(t, h, "/?stream=xrpusd.trades", nil)
+	defer teardown()
+	assert.Contains(t, readJSON(t, conn), "success")
+
+	readRaw := func(t *testing.T) string {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		return string(data)
+	}
+	request := func(t *testing.T, req map[string]interface{}) map[string]interface{} {
+		require.NoError(t, conn.WriteJSON(req))
+		return readJSON(t, conn)
+	}
+	trade := func(market string, body int) {
+		h.routeMessage(&Event{Scope: "public", Stream: market, Type: "trades", Topic: market + ".trades", Body: body})
+	}
+
+	t.Run("sessions keep independent subscriptions", func(t *testing.T) {
+		res := request(t, map[string]interface{}{"event": "subscribe", "session": "a", "streams": []string{"btcusd.trades"}})
+		assert.Equal(t, "a", res["session"])
+		assert.Equal(t, map[string]interface{}{
+			"success": map[string]interface{}{"message": "subscribed", "streams": []interface{}{"btcusd.trades"}},
+		}, res["message"])
+
+		res = request(t, map[string]interface{}{"event": "subscribe", "session": "b", "streams": []string{"ethusd.trades"}})
+		assert.Equal(t, "b", res["session"])
+		assert.Equal(t, map[string]interface{}{
+			"success": map[string]interface{}{"message": "subscribed", "streams": []interface{}{"ethusd.trades"}},
+		}, res["message"])
+	})
+
+	t.Run("messages are tagged with the session which wanted them", func(t *testing.T) {
+		trade("btcusd", 1)
+		assert.Equal(t, `{"session":"a","message":{"btcusd.trades":1}}`, readRaw(t))
+		trade("ethusd", 2)
+		assert.Equal(t, `{"session":"b","message":{"ethusd.trades":2}}`, readRaw(t))
+		trade("xrpusd", 3)
+		assert.Equal(t, `{"xrpusd.trades":3}`, readRaw(t))
+	})
+
+	t.Run("closing a session unsubscribes only its streams", func(t *testing.T) {
+		res := request(t, map[string]interface{}{"event": "close_session", "session": "a"})
+		assert.Equal(t, "a", res["session"])
+
+		trade("btcusd", 4)
+		trade("ethusd", 5)
+		trade("xrpusd", 6)
+		assert.Equal(t, `{"session":"b","message":{"ethusd.trades":5}}`, readRaw(t))
+		assert.Equal(t, `{"xrpusd.trades":6}`, readRaw(t))
+
+		res = request(t, map[string]interface{}{"event": "close_session", "session": "a"})
+		assert.Equal(t, "unknown session", res["error"])
+	})
+
+	t.Run("sessions are unsubscribed with the connection", func(t *testing.T) {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		waitFor(t, func() bool {
+			h.mutex.Lock()
+			defer h.mutex.Unlock()
+			return len(h.PublicTopics) == 0
+		})
+	})
+}
+
+func TestMaxSessions(t *testing.T) {
+	c := &Client{}
+	for i := 0; i < maxSessions; i++ {
+		_, err := c.session(string(rune('a' + i)))
+		require.NoError(t, err)
+	}
+	s, err := c.session("a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", s.id)
+
+	_, err = c.session("new")
+	assert.EqualError(t, err, "too many sessions")
+
+	c.removeSession("a")
+	_, err = c.session("new")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,26 @@
+package routing
+
+import "errors"
+
+// handleSet replaces the subscriptions of the client with the streams of the
+// request: it is unsubscribed from the other streams and subscribed to the
+// missing ones, like a subscribe request with its options. The response lists
+// the resulting subscriptions.
+func (h *Hub) handleSet(req *Request) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var removed []string
+	for _, s := range req.client.GetSubscriptions() {
+		if !contains(req.Streams, s) {
+			removed = append(removed, s)
+		}
+	}
+	h.unsubscribe(req.client, removed)
+
+	if h.subscribe(req) && !req.Consolidated {
+		req.client.Send(responseMust(errors.New("server at capacity"), nil))
+	}
+
+	req.client.Send(h.subscriptionAck(req, "set"))
+}
@@ -0,0 +1,64 @@
+package routing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetSubscriptions(t *testing.T) {
+	h := NewHub()
+	c := &Client{
+		hub:      h,
+		UID:      "UIDABC00001",
+		send:     make(chan outbound, maxBufferedMessages),
+		priority: make(chan outbound, maxBufferedMessages),
+		pubSub:   []string{},
+		privSub:  []string{},
+	}
+	request := func(t *testing.T, req string) map[string]interface{} {
+		parsed, err := message.ParseRequest([]byte(req))
+		require.NoError(t, err)
+		h.handleRequest(&Request{client: c, Request: parsed})
+
+		var res map[string]interface{}
+		require.NoError(t, json.Unmarshal((<-c.send).data, &res))
+		return res
+	}
+	streams := func(res map[string]interface{}) interface{} {
+		return res["success"].(map[string]interface{})["streams"]
+	}
+
+	request(t, `{"event":"subscribe","streams":["btcusd.trades","ethusd.trades","order"]}`)
+
+	t.Run("adds the missing and removes the extra streams", func(t *testing.T) {
+		res := request(t, `{"event":"set","streams":["ethusd.trades","xrpusd.trades","trade"]}`)
+		assert.Equal(t, "set", res["success"].(map[string]interface{})["message"])
+		assert.ElementsMatch(t, []interface{}{"ethusd.trades", "xrpusd.trades", "trade"}, streams(res))
+
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		assert.NotContains(t, h.PublicTopics, "btcusd.trades")
+		assert.Contains(t, h.PublicTopics, "xrpusd.trades")
+		assert.NotContains(t, h.PrivateTopics["UIDABC00001"], "order")
+		assert.Contains(t, h.PrivateTopics["UIDABC00001"], "trade")
+		assert.Equal(t, 3, h.subscriptions)
+	})
+
+	t.Run("applies the options of the streams", func(t *testing.T) {
+		res := request(t, `{"event":"set","streams":["ethusd.trades",{"stream":"xrpusd.trades","when":{"field":"price","op":">","value":1}}]}`)
+		assert.ElementsMatch(t, []interface{}{"ethusd.trades", "xrpusd.trades"}, streams(res))
+
+		h.routeMessage(&Event{Scope: "public", Stream: "xrpusd", Type: "trades", Topic: "xrpusd.trades", Body: map[string]interface{}{"price": 0.5}})
+		assert.Empty(t, c.send)
+	})
+
+	t.Run("an empty set unsubscribes from all streams", func(t *testing.T) {
+		res := request(t, `{"event":"set","streams":[]}`)
+		assert.Empty(t, streams(res))
+		assert.Equal(t, 0, h.subscriptions)
+	})
+}
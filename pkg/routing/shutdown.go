@@ -0,0 +1,65 @@
+package routing
+
+// Shutdown stops the hub: ListenWebsocketEvents returns and the readers of
+// the clients stop queuing requests and unregistering, so they exit instead of
+// blocking on channels nobody drains anymore. It may be called more than once.
+func (h *Hub) Shutdown() {
+	h.cancel()
+}
+
+// ShuttingDown returns true once Shutdown was called.
+func (h *Hub) ShuttingDown() bool {
+	return h.ctx.Err() != nil
+}
+
+// sendRequest sends a request to the hub, it returns false if the hub is
+// shutting down and the request was dropped.
+func (h *Hub) sendRequest(req Request) bool {
+	if h.ShuttingDown() {
+		return false
+	}
+	select {
+	case h.Requests <- req:
+		return true
+	case <-h.ctx.Done():
+		return false
+	}
+}
+
+// markUnregistered records that the send channel of the client is about to be
+// closed, its requests queued afterwards, like the expiry of its token, are
+// ignored.
+func (h *Hub) markUnregistered(client IClient) {
+	if c, ok := client.(*Client); ok {
+		h.mutex.Lock()
+		c.unregistered = true
+		h.mutex.Unlock()
+	}
+}
+
+// isUnregistered returns true if the client, or the client of a session, was
+// unregistered.
+func (h *Hub) isUnregistered(client IClient) bool {
+	c, ok := churnClient(client).(*Client)
+	if !ok {
+		return false
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return c.unregistered
+}
+
+// unregister sends a closing client to the hub, it returns false if the hub
+// is shutting down and the client was not unsubscribed.
+func (h *Hub) unregister(client IClient) bool {
+	if h.ShuttingDown() {
+		return false
+	}
+	select {
+	case h.Unregister <- client:
+		return true
+	case <-h.ctx.Done():
+		return false
+	}
+}
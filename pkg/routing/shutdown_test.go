@@ -0,0 +1,83 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown(t *testing.T) {
+	t.Run("stops listening to the clients", func(t *testing.T) {
+		h := NewHub()
+		done := make(chan struct{})
+		go func() {
+			h.ListenWebsocketEvents()
+			close(done)
+		}()
+
+		h.Shutdown()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("hub still listening")
+		}
+		assert.True(t, h.ShuttingDown())
+	})
+
+	t.Run("drops the requests queued after shutdown", func(t *testing.T) {
+		h := NewHub()
+		h.Requests = make(chan Request)
+		h.Shutdown()
+		h.Shutdown()
+
+		c := &Client{hub: h}
+		assert.False(t, h.queueRequest(Request{client: c}))
+		assert.False(t, h.unregister(c))
+	})
+
+	t.Run("readers blocked on the queue exit", func(t *testing.T) {
+		h := NewHub()
+		h.Requests = make(chan Request, 10)
+
+		conn, teardown := dial(t, h, "/", nil)
+		defer teardown()
+		assert.Contains(t, readJSON(t, conn), "success")
+
+		// Nobody drains the queue, the reader pauses once it is near capacity.
+		for i := 0; i < 20; i++ {
+			require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "subscribe", "streams": []string{"eurusd.trades"}}))
+		}
+		waitFor(t, func() bool { return len(h.Requests) == 9 })
+
+		h.Shutdown()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				assert.NotContains(t, err.Error(), "timeout")
+				break
+			}
+		}
+	})
+
+	t.Run("readers blocked on unregister exit", func(t *testing.T) {
+		h := NewHub()
+		c := &Client{hub: h}
+
+		// Nobody receives from Unregister, the sender blocks until shutdown.
+		unregistered := make(chan bool)
+		go func() {
+			unregistered <- h.unregister(c)
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		h.Shutdown()
+		select {
+		case ok := <-unregistered:
+			assert.False(t, ok)
+		case <-time.After(time.Second):
+			t.Fatal("reader still blocked")
+		}
+	})
+}
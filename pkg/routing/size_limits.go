@@ -0,0 +1,26 @@
+package routing
+
+import (
+	"encoding/json"
+
+	"github.com/openware/rango/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// oversized returns true if the body of the message exceeds the size limit of
+// its category, the type of the event like tickers or ob-snap.
+func (h *Hub) oversized(msg *Event) bool {
+	limit, ok := h.MessageSizeLimits[msg.Type]
+	if !ok || limit <= 0 {
+		return false
+	}
+
+	body, err := json.Marshal(msg.Body)
+	if err != nil || len(body) <= limit {
+		return false
+	}
+
+	log.Error().Msgf("Dropping %s message of %d bytes, above the %s limit of %d bytes", msg.Topic, len(body), msg.Type, limit)
+	metrics.RecordOversizedMessage(msg.Type)
+	return true
+}
@@ -0,0 +1,70 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageSizeLimits(t *testing.T) {
+	h := NewHub()
+	h.MessageSizeLimits = map[string]int{
+		"tickers": 64,
+		"ob-snap": 1 << 20,
+	}
+
+	c := &MockedClient{}
+	c.On("GetUID").Return("")
+	c.On("GetSubscriptions").Return([]string{"eurusd.tickers"})
+	c.On("SubscribePublic", mock.Anything).Return()
+	c.On("Send", mock.Anything).Return()
+	c.On("SendStream", mock.Anything, mock.Anything).Return()
+	h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"eurusd.tickers"}}})
+
+	ticker := func(last string) {
+		h.routeMessage(&Event{
+			Scope:  "public",
+			Stream: "eurusd",
+			Type:   "tickers",
+			Topic:  "eurusd.tickers",
+			Body:   map[string]interface{}{"last": last},
+		})
+	}
+
+	t.Run("drops an oversized message of a small category", func(t *testing.T) {
+		last := strings.Repeat("1", 100)
+		ticker(last)
+		c.AssertNotCalled(t, "SendStream", "eurusd.tickers", `{"eurusd.tickers":{"last":"`+last+`"}}`)
+	})
+
+	t.Run("delivers a message within the limit", func(t *testing.T) {
+		ticker("1.1")
+		c.AssertCalled(t, "SendStream", "eurusd.tickers", `{"eurusd.tickers":{"last":"1.1"}}`)
+	})
+
+	t.Run("keeps a large snapshot within its limit", func(t *testing.T) {
+		asks := make([]interface{}, 1000)
+		for i := range asks {
+			asks[i] = []interface{}{"1.1", "100.0"}
+		}
+		h.routeMessage(&Event{
+			Scope:  "public",
+			Stream: "eurusd",
+			Type:   "ob-snap",
+			Topic:  "eurusd.ob-inc",
+			Body:   map[string]interface{}{"asks": asks},
+		})
+
+		o, ok := h.IncrementalObjects["eurusd.ob-inc"]
+		require.True(t, ok)
+		assert.True(t, len(o.Snapshot) > 64)
+	})
+
+	t.Run("does not limit other categories", func(t *testing.T) {
+		assert.False(t, h.oversized(&Event{Type: "trades", Body: strings.Repeat("1", 1000)}))
+	})
+}
@@ -0,0 +1,100 @@
+package routing
+
+import (
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Policies of the SlowClientPolicy hub setting.
+const (
+	// SlowClientDisconnect closes the connection of a client whose send
+	// buffer is full.
+	SlowClientDisconnect = "disconnect"
+
+	// SlowClientDrop drops the messages not fitting in the send buffer of a
+	// client.
+	SlowClientDrop = "drop"
+)
+
+// slowConsumerWarning is sent to a client whose send buffer fills up, before
+// its messages are dropped or its connection is closed.
+var slowConsumerWarning = []byte(`{"event":"warning","code":"slow_consumer"}`)
+
+// warnSlowConsumer sends the slow consumer warning when the number of buffered
+// messages of the client crosses three quarters of the send buffer. It is sent
+// again only once the buffer has been drained below half.
+func (c *Client) warnSlowConsumer(buffered int) {
+	switch {
+	case buffered >= maxBufferedMessages*3/4:
+		if !atomic.CompareAndSwapInt32(&c.slowWarned, 0, 1) {
+			return
+		}
+		log.Debug().Msgf("Slow consumer warning (%s)", c.GetUID())
+
+		// The warning skips the queued messages when possible.
+		warning := outbound{data: c.frame("", slowConsumerWarning)}
+		atomic.AddInt64(&c.bufferedBytes, int64(len(warning.data)))
+		select {
+		case c.priority <- warning:
+		default:
+			select {
+			case c.send <- warning:
+			default:
+				c.release(warning.data)
+			}
+		}
+	case buffered < maxBufferedMessages/2:
+		atomic.StoreInt32(&c.slowWarned, 0)
+	}
+}
+
+// fits returns true if a message fits in the MaxBufferedBytes of the hub with
+// the messages already in the send buffers of the client.
+func (c *Client) fits(b []byte) bool {
+	max := c.hub.MaxBufferedBytes
+	return max <= 0 || atomic.LoadInt64(&c.bufferedBytes)+int64(len(b)) <= max
+}
+
+// reserve accounts a message added to a send buffer of the client, it returns
+// false without accounting it if the message does not fit in the
+// MaxBufferedBytes of the hub.
+func (c *Client) reserve(b []byte) bool {
+	n := atomic.AddInt64(&c.bufferedBytes, int64(len(b)))
+	if max := c.hub.MaxBufferedBytes; max > 0 && n > max {
+		c.release(b)
+		return false
+	}
+	return true
+}
+
+// release accounts a message taken from a send buffer of the client.
+func (c *Client) release(b []byte) {
+	atomic.AddInt64(&c.bufferedBytes, -int64(len(b)))
+}
+
+// reply adds a reply of the client reader to the send buffer, see replyLane,
+// it waits for room in the buffer and is not limited by MaxBufferedBytes.
+func (c *Client) reply(b []byte) {
+	atomic.AddInt64(&c.bufferedBytes, int64(len(b)))
+	c.replyLane() <- outbound{data: b}
+}
+
+// overflow applies the slow client policy to a message not fitting in a send
+// buffer of the client, it is counted in the drop ratio of the hub. The
+// connection is closed in its own goroutine, so the sender, usually the hub,
+// never waits for it.
+func (c *Client) overflow() {
+	atomic.AddInt64(&c.hub.dropped, 1)
+	atomic.AddInt64(&c.drops, 1)
+	if c.hub.SlowClientPolicy == SlowClientDrop {
+		log.Debug().Msgf("Dropping message of slow websocket connection (%s)", c.GetUID())
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&c.slowClosed, 0, 1) {
+		return
+	}
+	log.Warn().Msgf("Closing slow websocket connection (%s)", c.GetUID())
+	go c.CloseWithCode(closeSlowConsumer, "slow consumer")
+}
@@ -0,0 +1,217 @@
+package routing
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowConsumerWarning(t *testing.T) {
+	newClient := func() *Client {
+		return &Client{
+			hub:      NewHub(),
+			send:     make(chan outbound, maxBufferedMessages),
+			priority: make(chan outbound, maxBufferedMessages),
+		}
+	}
+	drain := func(c *Client, n int) {
+		for i := 0; i < n; i++ {
+			<-c.send
+		}
+	}
+	mark := maxBufferedMessages * 3 / 4
+
+	t.Run("no warning under normal conditions", func(t *testing.T) {
+		c := newClient()
+		for i := 0; i < 10*maxBufferedMessages; i++ {
+			c.Send("{}")
+			drain(c, 1)
+		}
+		assert.Empty(t, c.priority)
+	})
+
+	t.Run("warns once when the buffer fills up", func(t *testing.T) {
+		c := newClient()
+		for i := 0; i < mark; i++ {
+			c.Send("{}")
+		}
+		assert.Empty(t, c.priority)
+
+		c.Send("{}")
+		assert.Equal(t, slowConsumerWarning, (<-c.priority).data)
+
+		for i := 0; i < 10; i++ {
+			c.Send("{}")
+		}
+		assert.Empty(t, c.priority)
+		assert.Equal(t, mark+11, len(c.send))
+	})
+
+	t.Run("warns again after the buffer drained", func(t *testing.T) {
+		c := newClient()
+		for i := 0; i <= mark; i++ {
+			c.Send("{}")
+		}
+		assert.Len(t, c.priority, 1)
+		<-c.priority
+
+		drain(c, mark-maxBufferedMessages/2+2)
+		c.Send("{}")
+		for len(c.send) < mark {
+			c.Send("{}")
+		}
+		c.Send("{}")
+		assert.Len(t, c.priority, 1)
+	})
+
+	t.Run("falls back to the send buffer", func(t *testing.T) {
+		c := newClient()
+		c.priority = nil
+		for i := 0; i <= mark; i++ {
+			c.Send("{}")
+		}
+		assert.Equal(t, mark+2, len(c.send))
+		drain(c, mark)
+		assert.Equal(t, slowConsumerWarning, (<-c.send).data)
+	})
+}
+
+func TestNeverReadingClient(t *testing.T) {
+	// stalled returns a client whose messages are never written, with the
+	// peer of its connection.
+	stalled := func(t *testing.T, h *Hub) (*Client, *websocket.Conn, func()) {
+		conns := make(chan *websocket.Conn, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			require.NoError(t, err)
+			conns <- conn
+		}))
+		peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		require.NoError(t, err)
+
+		c := &Client{
+			hub:      h,
+			conn:     <-conns,
+			send:     make(chan outbound, 4),
+			priority: make(chan outbound, 4),
+			pubSub:   []string{},
+			privSub:  []string{},
+		}
+		return c, peer, func() {
+			peer.Close()
+			c.conn.Close()
+			srv.Close()
+		}
+	}
+
+	broadcast := func(t *testing.T, h *Hub) {
+		fast := &MockedClient{}
+		fast.On("GetUID").Return("")
+		fast.On("GetSubscriptions").Return([]string{"btcusd.trades"})
+		fast.On("SubscribePublic", mock.Anything).Return()
+		fast.On("Send", mock.Anything).Return()
+		fast.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: fast, Request: message.Request{Streams: []string{"btcusd.trades"}}})
+
+		start := time.Now()
+		for i := 0; i < 1000; i++ {
+			h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: i})
+		}
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+		fast.AssertNumberOfCalls(t, "SendStream", 1000)
+	}
+
+	t.Run("disconnects the client without blocking the broadcast", func(t *testing.T) {
+		h := NewHub()
+		c, peer, teardown := stalled(t, h)
+		defer teardown()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"btcusd.trades"}}})
+
+		broadcast(t, h)
+
+		assert.Equal(t, map[string]interface{}{"event": "disconnect", "reason": "slow consumer"}, readJSON(t, peer))
+		peer.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err := peer.ReadMessage()
+		require.Error(t, err)
+		nerr, ok := err.(net.Error)
+		assert.False(t, ok && nerr.Timeout(), "connection not closed: %v", err)
+		assert.True(t, websocket.IsCloseError(err, closeSlowConsumer), err)
+	})
+
+	t.Run("drops the messages without blocking the broadcast", func(t *testing.T) {
+		h := NewHub()
+		h.SlowClientPolicy = SlowClientDrop
+		c, peer, teardown := stalled(t, h)
+		defer teardown()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: []string{"btcusd.trades"}}})
+
+		broadcast(t, h)
+		assert.Len(t, c.send, 4)
+
+		peer.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, _, err := peer.ReadMessage()
+		require.Error(t, err)
+		nerr, ok := err.(net.Error)
+		assert.True(t, ok && nerr.Timeout(), "connection closed: %v", err)
+	})
+}
+
+func TestMaxBufferedBytes(t *testing.T) {
+	newClient := func() *Client {
+		h := NewHub()
+		h.MaxBufferedBytes = 4096
+		h.SlowClientPolicy = SlowClientDrop
+		return &Client{
+			hub:      h,
+			send:     make(chan outbound, maxBufferedMessages),
+			priority: make(chan outbound, maxBufferedMessages),
+		}
+	}
+	large := `"` + strings.Repeat("a", 1500) + `"`
+
+	t.Run("buffers many small messages", func(t *testing.T) {
+		c := newClient()
+		for i := 0; i < 150; i++ {
+			c.Send(`{"btcusd.tickers":1}`)
+		}
+		assert.Len(t, c.send, 150)
+	})
+
+	t.Run("drops large messages above the byte cap", func(t *testing.T) {
+		c := newClient()
+		for i := 0; i < 5; i++ {
+			c.SendStream("btcusd.ob-snap", large)
+		}
+		assert.Len(t, c.send, 2)
+		assert.Equal(t, int64(2*len(large)), c.bufferedBytes)
+	})
+
+	t.Run("buffers again once the writer took messages", func(t *testing.T) {
+		c := newClient()
+		for i := 0; i < 3; i++ {
+			c.SendStream("btcusd.ob-snap", large)
+		}
+		c.release((<-c.send).data)
+		c.SendStream("btcusd.ob-snap", large)
+		assert.Len(t, c.send, 2)
+	})
+
+	t.Run("applies to the priority lane", func(t *testing.T) {
+		c := newClient()
+		c.hub.PriorityStreams = []string{"btcusd.ob-snap"}
+		for i := 0; i < 5; i++ {
+			c.SendStream("btcusd.ob-snap", large)
+		}
+		assert.Len(t, c.priority, 2)
+	})
+
+}
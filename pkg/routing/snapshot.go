@@ -0,0 +1,57 @@
+package routing
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// SnapshotHandler returns an HTTP handler serving the current snapshot of an
+// incremental stream given with the stream query parameter. The body is a JSON
+// array of the messages a subscriber would receive first, the snapshot
+// followed by the increments, gzip compressed if the client accepts it.
+func SnapshotHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		stream := r.URL.Query().Get("stream")
+		if stream == "" {
+			writeError(w, http.StatusBadRequest, errors.New("missing stream"))
+			return
+		}
+
+		h.mutex.Lock()
+		messages := h.snapshotMessages(stream)
+		h.mutex.Unlock()
+
+		if messages == nil {
+			writeError(w, http.StatusNotFound, errors.New("no snapshot for stream"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Vary", "Accept-Encoding")
+		var out io.Writer = w
+		if acceptsGzip(r) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			out = gz
+		}
+		io.WriteString(out, "["+strings.Join(messages, ",")+"]")
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.Split(enc, ";")[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
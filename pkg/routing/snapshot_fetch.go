@@ -0,0 +1,128 @@
+package routing
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Snapshotter generates the snapshot of an incremental stream, like
+// btcusd.ob-inc, when the hub has none for a new subscriber. The context has
+// the metadata of the connection of the subscriber starting the generation,
+// and is done once the hub shuts down.
+type Snapshotter interface {
+	Snapshot(ctx context.Context, stream string) (interface{}, error)
+}
+
+// snapshotFetch is the snapshot generation of a stream shared by the
+// subscribers waiting for it.
+type snapshotFetch struct {
+	fetching bool
+	last     time.Time
+	waiters  []IClient
+}
+
+// fetchContext is done with the hub but reads the values of the context of a
+// connection, the generation shared by the subscribers outlives it.
+type fetchContext struct {
+	context.Context
+	conn context.Context
+}
+
+func (c fetchContext) Value(key interface{}) interface{} {
+	return c.conn.Value(key)
+}
+
+// requestSnapshot makes the client wait for the generation of the snapshot of
+// the stream. Concurrent subscribers share the same generation, and a stream
+// is generated at most once per SnapshotInterval. The hub mutex must be held.
+func (h *Hub) requestSnapshot(client IClient, stream string) {
+	if now := h.Clock.Now(); now.Sub(h.snapshotsPruned) >= h.SnapshotInterval {
+		h.pruneSnapshotFetches(now)
+	}
+
+	f, ok := h.snapshotFetches[stream]
+	if !ok {
+		f = &snapshotFetch{}
+		h.snapshotFetches[stream] = f
+	}
+	if !hasClient(f.waiters, client) {
+		f.waiters = append(f.waiters, client)
+	}
+	if f.fetching {
+		return
+	}
+
+	f.fetching = true
+	var wait time.Duration
+	if !f.last.IsZero() {
+		wait = h.SnapshotInterval - h.Clock.Now().Sub(f.last)
+	}
+	go h.fetchSnapshot(fetchContext{h.ctx, clientContext(client)}, stream, wait)
+}
+
+// fetchSnapshot generates the snapshot of the stream after waiting, stores it
+// like a snapshot of the source and sends it to the waiting subscribers,
+// followed by the caught up marker.
+func (h *Hub) fetchSnapshot(ctx context.Context, stream string, wait time.Duration) {
+	if wait > 0 {
+		timer := h.Clock.NewTimer(wait)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+
+	body, err := h.Snapshotter.Snapshot(ctx, stream)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	f := h.snapshotFetches[stream]
+	waiters := f.waiters
+	f.fetching, f.last, f.waiters = false, h.Clock.Now(), nil
+	if err != nil {
+		log.Error().Msgf("Generating the snapshot of %s failed: %s", stream, err.Error())
+		return
+	}
+
+	market, typ := "", stream
+	if i := strings.LastIndex(stream, "."); i >= 0 {
+		market, typ = stream[:i], stream[i+1:]
+	}
+	typ = strings.Replace(typ, "-inc", "-snap", 1)
+	if _, err := h.handleSnapshot(&Event{Scope: "public", Stream: market, Type: typ, Topic: stream, Body: body}); err != nil {
+		log.Error().Msgf("handleSnapshot failed: %s", err.Error())
+		return
+	}
+	for _, client := range waiters {
+		if h.isSubscribedPublic(client, stream) {
+			h.sendSnapshot(client, stream)
+			h.sendCaughtUp(client, stream)
+		}
+	}
+}
+
+// pruneSnapshotFetches forgets the finished generations older than the
+// SnapshotInterval, the hub mutex must be held.
+func (h *Hub) pruneSnapshotFetches(now time.Time) {
+	h.snapshotsPruned = now
+	for stream, f := range h.snapshotFetches {
+		if !f.fetching && now.Sub(f.last) >= h.SnapshotInterval {
+			delete(h.snapshotFetches, stream)
+		}
+	}
+}
+
+func hasClient(list []IClient, client IClient) bool {
+	for _, c := range list {
+		if c == client {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package routing
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSnapshotter generates numbered snapshots once released.
+type countingSnapshotter struct {
+	mutex   sync.Mutex
+	fetches int
+	last    context.Context
+	release chan struct{}
+}
+
+func (s *countingSnapshotter) Snapshot(ctx context.Context, stream string) (interface{}, error) {
+	<-s.release
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fetches++
+	s.last = ctx
+	return map[string]interface{}{"n": float64(s.fetches)}, nil
+}
+
+func (s *countingSnapshotter) context() context.Context {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.last
+}
+
+func (s *countingSnapshotter) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.fetches
+}
+
+func TestSnapshotGeneration(t *testing.T) {
+	clock := newFakeClock()
+	snapshotter := &countingSnapshotter{release: make(chan struct{}, 10)}
+	h := NewHub()
+	h.Clock = clock
+	h.CaughtUp = true
+	h.Snapshotter = snapshotter
+	h.SnapshotInterval = time.Minute
+	defer h.Shutdown()
+
+	// subscribe returns the new subscriber and the messages it received
+	// during the request.
+	subscribe := func(t *testing.T) (*Client, []string) {
+		c := &Client{
+			hub:      h,
+			send:     make(chan outbound, maxBufferedMessages),
+			priority: make(chan outbound, maxBufferedMessages),
+			pubSub:   []string{},
+			privSub:  []string{},
+		}
+		parsed, err := message.ParseRequest([]byte(`{"event":"subscribe","streams":["btcusd.ob-inc"]}`))
+		require.NoError(t, err)
+		h.handleRequest(&Request{client: c, Request: parsed})
+
+		var messages []string
+		for len(c.send) > 0 {
+			messages = append(messages, string((<-c.send).data))
+		}
+		require.NotEmpty(t, messages)
+		assert.Contains(t, messages[len(messages)-1], "subscribed")
+		return c, messages[:len(messages)-1]
+	}
+	receive := func(t *testing.T, c *Client) []string {
+		var messages []string
+		for i := 0; i < 2; i++ {
+			select {
+			case m := <-c.send:
+				messages = append(messages, string(m.data))
+			case <-time.After(time.Second):
+				t.Fatal("snapshot not received")
+			}
+		}
+		return messages
+	}
+
+	t.Run("a burst of subscribers shares one generation", func(t *testing.T) {
+		clients := make([]*Client, 10)
+		for i := range clients {
+			var messages []string
+			clients[i], messages = subscribe(t)
+			assert.Empty(t, messages)
+		}
+		snapshotter.release <- struct{}{}
+
+		for _, c := range clients {
+			assert.Equal(t, []string{
+				`{"btcusd.ob-snap":{"n":1}}`,
+				`{"event":"caught_up","stream":"btcusd.ob-inc"}`,
+			}, receive(t, c))
+		}
+		assert.Equal(t, 1, snapshotter.count())
+		assert.Equal(t, clients[0], contextClient(snapshotter.context()))
+	})
+
+	t.Run("the next subscribers get the stored snapshot", func(t *testing.T) {
+		h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "ob-inc", Topic: "btcusd.ob-inc", Body: "increment"})
+		_, messages := subscribe(t)
+		assert.Equal(t, []string{
+			`{"btcusd.ob-snap":{"n":1}}`,
+			`{"btcusd.ob-inc":"increment"}`,
+			`{"event":"caught_up","stream":"btcusd.ob-inc"}`,
+		}, messages)
+		assert.Equal(t, 1, snapshotter.count())
+	})
+
+	t.Run("generates again once the interval elapsed", func(t *testing.T) {
+		h.mutex.Lock()
+		delete(h.IncrementalObjects, "btcusd.ob-inc")
+		h.mutex.Unlock()
+
+		c, _ := subscribe(t)
+		snapshotter.release <- struct{}{}
+		clock.WaitForWaiters(t, 1)
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, 1, snapshotter.count())
+
+		clock.Advance(time.Minute)
+		assert.Equal(t, `{"btcusd.ob-snap":{"n":2}}`, receive(t, c)[0])
+		assert.Equal(t, 2, snapshotter.count())
+	})
+
+	t.Run("forgets the finished generations", func(t *testing.T) {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		h.pruneSnapshotFetches(clock.Now())
+		assert.Contains(t, h.snapshotFetches, "btcusd.ob-inc")
+
+		clock.Advance(time.Minute)
+		h.pruneSnapshotFetches(clock.Now())
+		assert.Empty(t, h.snapshotFetches)
+	})
+}
@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotHandler(t *testing.T) {
+	h := NewHub()
+	h.routeMessage(&Event{
+		Scope:  "public",
+		Stream: "abc",
+		Type:   "count-snap",
+		Topic:  "abc.count-inc",
+		Body:   map[string]interface{}{"data": []int{2, 3, 4}, "sequence": 12},
+	})
+	h.routeMessage(&Event{
+		Scope:  "public",
+		Stream: "abc",
+		Type:   "count-inc",
+		Topic:  "abc.count-inc",
+		Body:   map[string]interface{}{"data": 5, "sequence": 13},
+	})
+	handler := SnapshotHandler(h)
+	expected := `[{"abc.count-snap":{"data":[2,3,4],"sequence":12}},{"abc.count-inc":{"data":5,"sequence":13}}]`
+
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		handler(w, r)
+		return w
+	}
+
+	t.Run("returns the current snapshot", func(t *testing.T) {
+		w := get("/snapshot?stream=abc.count-inc", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+		assert.Equal(t, expected, w.Body.String())
+	})
+
+	t.Run("compresses the snapshot if gzip is accepted", func(t *testing.T) {
+		w := get("/snapshot?stream=abc.count-inc", http.Header{"Accept-Encoding": []string{"deflate, gzip;q=1.0"}})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+		gz, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(gz)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(body))
+	})
+
+	t.Run("returns not found without snapshot", func(t *testing.T) {
+		w := get("/snapshot?stream=xyz.count-inc", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, `{"error":"no snapshot for stream"}`, w.Body.String())
+	})
+
+	t.Run("rejects a missing stream", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get("/snapshot", nil).Code)
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/snapshot?stream=abc.count-inc", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
@@ -0,0 +1,119 @@
+package routing
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+var errSpillFull = errors.New("spill queue full")
+
+// spillQueue is a bounded on-disk FIFO queue holding the messages of a client
+// which could not fit in its send buffer. The file is created on the first
+// push and truncated each time the queue is emptied.
+type spillQueue struct {
+	mutex    sync.Mutex
+	dir      string
+	maxBytes int64
+	file     *os.File
+	readOff  int64
+	writeOff int64
+	count    int
+	closed   bool
+}
+
+func newSpillQueue(dir string, maxBytes int64) *spillQueue {
+	return &spillQueue{
+		dir:      dir,
+		maxBytes: maxBytes,
+	}
+}
+
+// push appends a message to the queue if force is true or if the queue is
+// not empty, to preserve the order of the messages once spilling started.
+// It returns false if the message was not queued.
+func (q *spillQueue) push(force bool, msg []byte) (bool, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return false, os.ErrClosed
+	}
+	if !force && q.count == 0 {
+		return false, nil
+	}
+
+	size := int64(len(msg) + 4)
+	if q.writeOff+size > q.maxBytes {
+		return false, errSpillFull
+	}
+
+	if q.file == nil {
+		f, err := ioutil.TempFile(q.dir, "rango-spill-")
+		if err != nil {
+			return false, err
+		}
+		q.file = f
+	}
+
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record, uint32(len(msg)))
+	copy(record[4:], msg)
+	if _, err := q.file.WriteAt(record, q.writeOff); err != nil {
+		return false, err
+	}
+
+	q.writeOff += size
+	q.count++
+	return true, nil
+}
+
+// pop removes the oldest message of the queue, it returns false if the queue
+// is empty.
+func (q *spillQueue) pop() ([]byte, bool, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed || q.count == 0 {
+		return nil, false, nil
+	}
+
+	header := make([]byte, 4)
+	if _, err := q.file.ReadAt(header, q.readOff); err != nil {
+		return nil, false, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := q.file.ReadAt(msg, q.readOff+4); err != nil {
+		return nil, false, err
+	}
+
+	q.readOff += int64(len(msg) + 4)
+	q.count--
+	if q.count == 0 {
+		q.readOff, q.writeOff = 0, 0
+		if err := q.file.Truncate(0); err != nil {
+			return msg, true, err
+		}
+	}
+	return msg, true, nil
+}
+
+func (q *spillQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.count
+}
+
+// close removes the queue file, messages still queued are lost.
+func (q *spillQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	if q.file != nil {
+		q.file.Close()
+		os.Remove(q.file.Name())
+	}
+}
@@ -0,0 +1,105 @@
+package routing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpillQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rango-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	q := newSpillQueue(dir, 24)
+
+	t.Run("does not queue when empty unless forced", func(t *testing.T) {
+		spilled, err := q.push(false, []byte("a"))
+		require.NoError(t, err)
+		assert.False(t, spilled)
+		assert.Equal(t, 0, q.len())
+	})
+
+	t.Run("keeps messages in order up to the size limit", func(t *testing.T) {
+		for _, m := range []string{"one", "two", "six"} {
+			spilled, err := q.push(m == "one", []byte(m))
+			require.NoError(t, err)
+			assert.True(t, spilled)
+		}
+		_, err := q.push(false, []byte("four"))
+		assert.Equal(t, errSpillFull, err)
+
+		for _, expected := range []string{"one", "two", "six"} {
+			m, ok, err := q.pop()
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, expected, string(m))
+		}
+		_, ok, err := q.pop()
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("reclaims the space once emptied", func(t *testing.T) {
+		spilled, err := q.push(true, []byte("four"))
+		require.NoError(t, err)
+		assert.True(t, spilled)
+	})
+
+	t.Run("removes the file on close", func(t *testing.T) {
+		q.close()
+		files, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, files, 0)
+	})
+}
+
+func TestClientSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rango-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	h := NewHub()
+	h.SpillStreams = []string{"order"}
+	total := maxBufferedMessages + 10
+
+	spilled := make(chan int, 1)
+	conn, teardown := serveClient(t, func(conn *websocket.Conn) *Client {
+		c := &Client{
+			hub:   h,
+			conn:  conn,
+			send:  make(chan outbound, maxBufferedMessages),
+			spill: newSpillQueue(dir, 1024),
+		}
+		// The writer is not running yet, messages beyond the buffer are spilled.
+		for i := 0; i < total; i++ {
+			c.SendStream("order", fmt.Sprintf(`{"order":%d}`, i))
+		}
+		spilled <- c.spill.len()
+		return c
+	})
+	defer teardown()
+
+	// The slow consumer warning takes a slot of the buffer.
+	assert.Equal(t, 11, <-spilled)
+
+	warnings := 0
+	for i := 0; i < total; i++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, m, err := conn.ReadMessage()
+		require.NoError(t, err)
+		if string(m) == string(slowConsumerWarning) {
+			warnings++
+			i--
+			continue
+		}
+		assert.Equal(t, fmt.Sprintf(`{"order":%d}`, i), string(m))
+	}
+	assert.Equal(t, 1, warnings)
+}
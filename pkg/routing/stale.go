@@ -0,0 +1,93 @@
+package routing
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+)
+
+// recordFresh records a message of a public stream, the subscribers of a stream
+// flagged as stale are notified it is fresh again first. The hub mutex must be
+// held.
+func (h *Hub) recordFresh(stream string) {
+	if h.StaleThreshold <= 0 {
+		return
+	}
+
+	h.lastMessage[stream] = h.Clock.Now()
+	h.touchStream(stream)
+	if h.stale[stream] {
+		delete(h.stale, stream)
+		log.Info().Msgf("Stream %s is fresh again", stream)
+		h.notifyPublic(stream, "fresh")
+	}
+}
+
+// DetectStaleStreams periodically notifies the subscribers of the public
+// streams without message for StaleThreshold that their data may be stale.
+func (h *Hub) DetectStaleStreams() {
+	if h.StaleThreshold <= 0 {
+		return
+	}
+
+	ticker := h.Clock.NewTicker(h.StaleThreshold / 2)
+	defer ticker.Stop()
+
+	for range ticker.C() {
+		h.detectStaleStreams()
+	}
+}
+
+func (h *Hub) detectStaleStreams() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.Clock.Now()
+	streams := make([]string, 0)
+	for stream, last := range h.lastMessage {
+		if h.stale[stream] || now.Sub(last) < h.StaleThreshold {
+			continue
+		}
+		if !h.hasSubscribers(stream) {
+			// Subscribers joining later get the staleness from the next check.
+			continue
+		}
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+
+	for _, stream := range streams {
+		h.stale[stream] = true
+		log.Warn().Msgf("Stream %s is stale", stream)
+		h.notifyPublic(stream, "stale")
+	}
+}
+
+// notifyPublic sends an event about a public stream to its subscribers and to
+// the subscribers of the groups containing it, once to each client.
+func (h *Hub) notifyPublic(stream, event string) {
+	body, err := json.Marshal(map[string]interface{}{
+		"event":  event,
+		"stream": stream,
+	})
+	if err != nil {
+		log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
+		return
+	}
+
+	sent := make(map[IClient]struct{})
+	for _, name := range append([]string{stream}, h.groupsByStream[stream]...) {
+		topic, ok := h.PublicTopics[name]
+		if !ok {
+			continue
+		}
+		for _, client := range topic.snapshot() {
+			if _, done := sent[client]; done {
+				continue
+			}
+			sent[client] = struct{}{}
+			client.Send(string(body))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStaleStreams(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.StaleThreshold = 10 * time.Second
+	h.SetGroup("top.trades", []string{"btcusd.trades"})
+
+	newClient := func(streams ...string) *MockedClient {
+		c := &MockedClient{}
+		c.On("GetUID").Return("")
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		c.On("SendStream", mock.Anything, mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+		return c
+	}
+	c := newClient("btcusd.trades", "ethusd.trades")
+	g := newClient("top.trades")
+
+	trade := func(market string) {
+		h.routeMessage(&Event{Scope: "public", Stream: market, Type: "trades", Topic: market + ".trades", Body: 1})
+	}
+	events := func(c *MockedClient, event string) int {
+		n := 0
+		for _, call := range c.Calls {
+			if call.Method == "Send" && call.Arguments[0] == event {
+				n++
+			}
+		}
+		return n
+	}
+	stale := `{"event":"stale","stream":"btcusd.trades"}`
+	fresh := `{"event":"fresh","stream":"btcusd.trades"}`
+
+	trade("btcusd")
+	trade("ethusd")
+
+	t.Run("no event while messages flow", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			clock.Advance(9 * time.Second)
+			trade("btcusd")
+			trade("ethusd")
+			h.detectStaleStreams()
+		}
+		assert.Equal(t, 0, events(c, stale))
+	})
+
+	t.Run("stale after the silence threshold", func(t *testing.T) {
+		clock.Advance(5 * time.Second)
+		trade("ethusd")
+		h.detectStaleStreams()
+		assert.Equal(t, 0, events(c, stale))
+
+		clock.Advance(5 * time.Second)
+		trade("ethusd")
+		h.detectStaleStreams()
+		h.detectStaleStreams()
+		assert.Equal(t, 1, events(c, stale))
+		assert.Equal(t, 1, events(g, stale))
+		assert.Equal(t, 0, events(c, `{"event":"stale","stream":"ethusd.trades"}`))
+	})
+
+	t.Run("fresh when data resumes", func(t *testing.T) {
+		trade("btcusd")
+		assert.Equal(t, 1, events(c, fresh))
+		assert.Equal(t, 1, events(g, fresh))
+
+		trade("btcusd")
+		assert.Equal(t, 1, events(c, fresh))
+	})
+
+	t.Run("stale again after another silence", func(t *testing.T) {
+		go h.DetectStaleStreams()
+		clock.WaitForWaiters(t, 1)
+		clock.Advance(10 * time.Second)
+		waitFor(t, func() bool {
+			h.mutex.Lock()
+			defer h.mutex.Unlock()
+			return h.stale["btcusd.trades"]
+		})
+		h.mutex.Lock()
+		assert.Equal(t, 2, events(c, stale))
+		h.mutex.Unlock()
+	})
+}
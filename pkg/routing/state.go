@@ -0,0 +1,74 @@
+package routing
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// SubscriptionState is the subscription registry of a hub, the streams of
+// the clients by resume identity.
+type SubscriptionState struct {
+	Clients map[string][]string `json:"clients"`
+}
+
+// ExportState serializes the subscriptions of the clients having a resume
+// identity, so they can be restored by another hub with ImportState.
+func (h *Hub) ExportState() ([]byte, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	state := SubscriptionState{Clients: make(map[string][]string)}
+	add := func(stream string, topic *Topic) {
+		for _, client := range topic.snapshot() {
+			if id := client.GetResumeID(); id != "" {
+				state.Clients[id] = append(state.Clients[id], stream)
+			}
+		}
+	}
+
+	for stream, topic := range h.PublicTopics {
+		add(stream, topic)
+	}
+	for _, topics := range h.PrivateTopics {
+		for stream, topic := range topics {
+			add(stream, topic)
+		}
+	}
+	for _, streams := range state.Clients {
+		sort.Strings(streams)
+	}
+
+	return json.Marshal(state)
+}
+
+// ImportState loads an exported subscription registry, clients reconnecting
+// with a resume identity of the registry are subscribed again to their streams.
+func (h *Hub) ImportState(data []byte) error {
+	state := SubscriptionState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for id, streams := range state.Clients {
+		h.restored[id] = streams
+	}
+	return nil
+}
+
+// restoredStreams returns the imported streams of a resume identity, they are
+// returned only once.
+func (h *Hub) restoredStreams(resumeID string) []string {
+	if resumeID == "" {
+		return nil
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	streams := h.restored[resumeID]
+	delete(h.restored, resumeID)
+	return streams
+}
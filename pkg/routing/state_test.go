@@ -0,0 +1,112 @@
+package routing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportState(t *testing.T) {
+	h := NewHub()
+
+	newClient := func(uid, resumeID string, streams ...string) {
+		c := &MockedClient{}
+		c.On("GetUID").Return(uid)
+		c.On("GetResumeID").Return(resumeID)
+		c.On("GetSubscriptions").Return(streams)
+		c.On("SubscribePublic", mock.Anything).Return()
+		c.On("SubscribePrivate", mock.Anything).Return()
+		c.On("Send", mock.Anything).Return()
+		h.handleSubscribe(&Request{client: c, Request: message.Request{Streams: streams}})
+	}
+	newClient("UIDABC00001", "UIDABC00001:r1", "eurusd.trades", "order")
+	newClient("UIDABC00002", "UIDABC00002:r1", "trade")
+	newClient("", "", "eurusd.trades")
+
+	data, err := h.ExportState()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"clients":{"UIDABC00001:r1":["eurusd.trades","order"],"UIDABC00002:r1":["trade"]}}`, string(data))
+
+	restored := NewHub()
+	require.NoError(t, restored.ImportState(data))
+	go restored.ListenWebsocketEvents()
+
+	t.Run("restores the subscriptions of a reconnecting client", func(t *testing.T) {
+		conn, teardown := dial(t, restored, "/?resume=r1", http.Header{"JwtUID": []string{"UIDABC00001"}})
+		defer teardown()
+
+		ack := readJSON(t, conn)
+		assert.Equal(t, map[string]interface{}{
+			"message": "subscribed",
+			"streams": []interface{}{"eurusd.trades", "order"},
+			"failed":  map[string]interface{}{},
+		}, ack["success"])
+
+		restored.routeMessage(&Event{Scope: "private", Stream: "UIDABC00001", Type: "order", Topic: "order", Body: 1})
+		assert.Equal(t, map[string]interface{}{"order": 1.0}, readJSON(t, conn))
+	})
+
+	t.Run("restores the subscriptions only once", func(t *testing.T) {
+		conn, teardown := dial(t, restored, "/?resume=r1", http.Header{"JwtUID": []string{"UIDABC00001"}})
+		defer teardown()
+
+		ack := readJSON(t, conn)
+		assert.Equal(t, map[string]interface{}{"message": "subscribed", "streams": []interface{}{}}, ack["success"])
+	})
+
+	t.Run("does not restore another identity", func(t *testing.T) {
+		conn, teardown := dial(t, restored, "/?resume=r1", http.Header{"JwtUID": []string{"UIDABC00003"}})
+		defer teardown()
+
+		ack := readJSON(t, conn)
+		assert.Equal(t, map[string]interface{}{"message": "subscribed", "streams": []interface{}{}}, ack["success"])
+	})
+}
+
+func TestConsolidatedSubscription(t *testing.T) {
+	h := NewHub()
+	h.StreamQuotas = map[string]int{"*.ob-inc": 1}
+	require.NoError(t, h.ImportState([]byte(`{"clients":{"UIDABC00001:r1":["btcusd.ob-inc","ethusd.ob-inc","eurusd.trades","order"]}}`)))
+	go h.ListenWebsocketEvents()
+
+	t.Run("confirms the restored subscriptions at once", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/?resume=r1", http.Header{"JwtUID": []string{"UIDABC00001"}})
+		defer teardown()
+
+		assert.Equal(t, map[string]interface{}{
+			"message": "subscribed",
+			"streams": []interface{}{"btcusd.ob-inc", "eurusd.trades", "order"},
+			"failed":  map[string]interface{}{"ethusd.ob-inc": "quota exceeded"},
+		}, readJSON(t, conn)["success"])
+
+		h.routeMessage(&Event{Scope: "public", Stream: "eurusd", Type: "trades", Topic: "eurusd.trades", Body: 1})
+		assert.Equal(t, map[string]interface{}{"eurusd.trades": 1.0}, readJSON(t, conn), "a single confirmation is sent")
+	})
+
+	t.Run("confirms a consolidated subscribe request at once", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/", nil)
+		defer teardown()
+		readJSON(t, conn)
+
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{
+			"event":        "subscribe",
+			"streams":      []string{"btcusd.ob-inc", "ethusd.ob-inc", "order", "eurusd.trades"},
+			"consolidated": true,
+		}))
+		assert.Equal(t, map[string]interface{}{
+			"message": "subscribed",
+			"streams": []interface{}{"btcusd.ob-inc", "eurusd.trades"},
+			"failed": map[string]interface{}{
+				"ethusd.ob-inc": "quota exceeded",
+				"order":         "authentication required",
+			},
+		}, readJSON(t, conn)["success"])
+
+		h.routeMessage(&Event{Scope: "public", Stream: "eurusd", Type: "trades", Topic: "eurusd.trades", Body: 2})
+		assert.Equal(t, map[string]interface{}{"eurusd.trades": 2.0}, readJSON(t, conn), "a single confirmation is sent")
+	})
+}
@@ -0,0 +1,69 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+)
+
+// knownStreams returns the sorted names of the ListedStreams and of the public
+// streams which received a message during the ListedStreamTTL, the others are
+// forgotten. Private streams are never listed. The hub mutex must be held.
+func (h *Hub) knownStreams() []string {
+	now := h.Clock.Now()
+	streams := make([]string, 0, len(h.ListedStreams)+len(h.streamSeen))
+	for _, s := range h.ListedStreams {
+		if !isPrivateStream(s) && !contains(streams, s) {
+			streams = append(streams, s)
+		}
+	}
+	for s, last := range h.streamSeen {
+		if h.ListedStreamTTL > 0 && now.Sub(last) >= h.ListedStreamTTL {
+			delete(h.streamSeen, s)
+			continue
+		}
+		if !contains(h.ListedStreams, s) {
+			streams = append(streams, s)
+		}
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+// handleStreams replies with the known public streams, like
+// {"event":"streams","streams":["btcusd.trades","ethusd.trades"]}.
+func (h *Hub) handleStreams(req *Request) {
+	h.mutex.Lock()
+	streams := h.knownStreams()
+	h.mutex.Unlock()
+
+	b, err := json.Marshal(map[string]interface{}{
+		"event":   "streams",
+		"streams": streams,
+	})
+	if err != nil {
+		log.Error().Msgf("Streams encoding failed: %s", err.Error())
+		return
+	}
+	req.client.Send(string(b))
+}
+
+// StreamsHandler returns an HTTP handler serving the known public streams as
+// a JSON array, e.g. GET /streams.
+func StreamsHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.mutex.Lock()
+		streams := h.knownStreams()
+		h.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(streams)
+	}
+}
@@ -0,0 +1,59 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnownStreams(t *testing.T) {
+	clock := newFakeClock()
+	h := NewHub()
+	h.Clock = clock
+	h.ListedStreams = []string{"xrpusd.trades", "order", "btcusd.trades"}
+	h.ListedStreamTTL = time.Minute
+
+	h.routeMessage(&Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: 1})
+	h.routeMessage(&Event{Scope: "public", Stream: "ethusd", Type: "trades", Topic: "ethusd.trades", Body: 2})
+	h.routeMessage(&Event{Scope: "global", Stream: "global", Type: "tickers", Topic: "global.tickers", Body: 3})
+	h.routeMessage(&Event{Scope: "private", Stream: "UIDABC00001", Type: "trade", Topic: "trade", Body: 4})
+
+	streams := func() string {
+		w := httptest.NewRecorder()
+		StreamsHandler(h)(w, httptest.NewRequest(http.MethodGet, "/streams", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	t.Run("lists the active and listed public streams", func(t *testing.T) {
+		assert.Equal(t, `["btcusd.trades","ethusd.trades","global.tickers","xrpusd.trades"]`+"\n", streams())
+	})
+
+	t.Run("replies to the streams request", func(t *testing.T) {
+		c := &MockedClient{}
+		c.On("Send", mock.Anything).Return()
+		parsed, err := message.ParseRequest([]byte(`{"event":"streams"}`))
+		require.NoError(t, err)
+		h.handleRequest(&Request{client: c, Request: parsed})
+		c.AssertCalled(t, "Send", `{"event":"streams","streams":["btcusd.trades","ethusd.trades","global.tickers","xrpusd.trades"]}`)
+	})
+
+	t.Run("forgets the streams without recent message", func(t *testing.T) {
+		clock.Advance(30 * time.Second)
+		h.routeMessage(&Event{Scope: "public", Stream: "ethusd", Type: "trades", Topic: "ethusd.trades", Body: 5})
+		clock.Advance(30 * time.Second)
+		assert.Equal(t, `["btcusd.trades","ethusd.trades","xrpusd.trades"]`+"\n", streams())
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		StreamsHandler(h)(w, httptest.NewRequest(http.MethodPost, "/streams", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
@@ -0,0 +1,45 @@
+package routing
+
+// subscriptionAck returns the acknowledgement of a subscribe or unsubscribe
+// request listing the streams of the client, and the streams which failed if
+// the request is consolidated. With SubscriptionCounts it also counts them,
+// like
+// {"success":{"message":"subscribed","streams":[...],"count":3,
+// "counts":{"public":2,"private":1},"quotas":{"*.ob-inc":{"count":1,"max":5}}}}.
+// The hub mutex must be held.
+func (h *Hub) subscriptionAck(req *Request, message string) string {
+	streams := req.client.GetSubscriptions()
+	res := map[string]interface{}{
+		"message": message,
+		"streams": streams,
+	}
+	if req.Consolidated {
+		failed := req.failed
+		if failed == nil {
+			failed = map[string]string{}
+		}
+		res["failed"] = failed
+	}
+	if !h.SubscriptionCounts {
+		return responseMust(nil, res)
+	}
+
+	public, private := 0, 0
+	for _, s := range streams {
+		if isPrivateStream(s) {
+			private++
+		} else {
+			public++
+		}
+	}
+	res["count"] = len(streams)
+	res["counts"] = map[string]int{"public": public, "private": private}
+	if len(h.StreamQuotas) != 0 {
+		quotas := make(map[string]interface{}, len(h.StreamQuotas))
+		for pattern, max := range h.StreamQuotas {
+			quotas[pattern] = map[string]int{"count": quotaCount(pattern, streams), "max": max}
+		}
+		res["quotas"] = quotas
+	}
+	return responseMust(nil, res)
+}
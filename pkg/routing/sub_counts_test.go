@@ -0,0 +1,75 @@
+package routing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionCounts(t *testing.T) {
+	h := NewHub()
+	h.SubscriptionCounts = true
+	h.StreamQuotas = map[string]int{"*.ob-inc": 2}
+	c := &Client{
+		hub:      h,
+		send:     make(chan outbound, maxBufferedMessages),
+		priority: make(chan outbound, maxBufferedMessages),
+		pubSub:   []string{},
+		privSub:  []string{},
+		UID:      "UIDABC00001",
+	}
+	request := func(t *testing.T, event string, streams ...string) map[string]interface{} {
+		b, err := json.Marshal(map[string]interface{}{"event": event, "streams": streams})
+		require.NoError(t, err)
+		parsed, err := message.ParseRequest(b)
+		require.NoError(t, err)
+		h.handleRequest(&Request{client: c, Request: parsed})
+
+		var res map[string]interface{}
+		for len(c.send) > 0 {
+			require.NoError(t, json.Unmarshal((<-c.send).data, &res))
+		}
+		require.Contains(t, res, "success")
+		return res["success"].(map[string]interface{})
+	}
+	counts := func(res map[string]interface{}) []interface{} {
+		return []interface{}{res["count"], res["counts"], res["quotas"]}
+	}
+
+	t.Run("counts the subscriptions after a subscribe", func(t *testing.T) {
+		res := request(t, "subscribe", "btcusd.ob-inc", "btcusd.trades", "order", "trade")
+		assert.Equal(t, "subscribed", res["message"])
+		assert.Equal(t, []interface{}{
+			4.0,
+			map[string]interface{}{"public": 2.0, "private": 2.0},
+			map[string]interface{}{"*.ob-inc": map[string]interface{}{"count": 1.0, "max": 2.0}},
+		}, counts(res))
+	})
+
+	t.Run("follows the next operations", func(t *testing.T) {
+		request(t, "subscribe", "ethusd.ob-inc", "xrpusd.ob-inc")
+		res := request(t, "unsubscribe", "btcusd.trades", "trade")
+		assert.Equal(t, "unsubscribed", res["message"])
+		assert.Equal(t, []interface{}{
+			3.0,
+			map[string]interface{}{"public": 2.0, "private": 1.0},
+			map[string]interface{}{"*.ob-inc": map[string]interface{}{"count": 2.0, "max": 2.0}},
+		}, counts(res))
+
+		res = request(t, "unsubscribe", "btcusd.ob-inc", "ethusd.ob-inc", "order")
+		assert.Equal(t, []interface{}{
+			0.0,
+			map[string]interface{}{"public": 0.0, "private": 0.0},
+			map[string]interface{}{"*.ob-inc": map[string]interface{}{"count": 0.0, "max": 2.0}},
+		}, counts(res))
+	})
+
+	t.Run("omits the counts when disabled", func(t *testing.T) {
+		h.SubscriptionCounts = false
+		res := request(t, "subscribe", "btcusd.trades")
+		assert.Equal(t, map[string]interface{}{"message": "subscribed", "streams": []interface{}{"btcusd.trades"}}, res)
+	})
+}
@@ -0,0 +1,48 @@
+package routing
+
+import (
+	"sync/atomic"
+
+	msg "github.com/openware/rango/pkg/message"
+)
+
+const (
+	// Subprotocol of the clients accepting the default message sizes.
+	subprotocolV1 = "rango.v1"
+
+	// Subprotocol of the clients accepting larger messages.
+	subprotocolV2 = "rango.v2"
+
+	// Subprotocol of the clients exchanging protobuf messages in binary
+	// frames, see pkg/message/rango.proto.
+	subprotocolProto = "rango.proto"
+
+	// Maximum message size allowed from peers negotiating rango.v2.
+	maxMessageSizeV2 = 4096
+)
+
+// subprotocols are the subprotocols supported by the server, in order of
+// preference.
+var subprotocols = []string{subprotocolV2, subprotocolV1, subprotocolProto}
+
+// readLimit returns the maximum message size allowed from a peer, depending
+// on the negotiated subprotocol.
+func readLimit(subprotocol string) int64 {
+	if subprotocol == subprotocolV2 {
+		return maxMessageSizeV2
+	}
+	return maxMessageSize
+}
+
+// frame returns a message of the stream as written to the client: a protobuf
+// frame if the client negotiated rango.proto, the message itself otherwise.
+func (c *Client) frame(stream string, message []byte) []byte {
+	if !c.protobuf {
+		return message
+	}
+	return msg.EncodeFrame(msg.Frame{
+		Stream:  stream,
+		Seq:     atomic.AddUint64(&c.frameSeq, 1),
+		Payload: message,
+	})
+}
@@ -0,0 +1,58 @@
+package routing
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLimit(t *testing.T) {
+	assert.Equal(t, int64(maxMessageSizeV2), readLimit(subprotocolV2))
+	assert.Equal(t, int64(maxMessageSize), readLimit(subprotocolV1))
+	assert.Equal(t, int64(maxMessageSize), readLimit(""))
+}
+
+func TestSubprotocolReadLimit(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+
+	// A whoami request larger than the default limit and smaller than the v2 one.
+	large := map[string]interface{}{
+		"event":   "whoami",
+		"padding": strings.Repeat("x", 2*maxMessageSize),
+	}
+
+	connect := func(t *testing.T, protocols ...string) (*websocket.Conn, func()) {
+		var header http.Header
+		if len(protocols) != 0 {
+			header = http.Header{"Sec-WebSocket-Protocol": protocols}
+		}
+		conn, teardown := dial(t, h, "/", header)
+		assert.Contains(t, readJSON(t, conn), "success")
+		return conn, teardown
+	}
+
+	t.Run("a v2 client gets a higher read limit", func(t *testing.T) {
+		conn, teardown := connect(t, "rango.v2, rango.v1")
+		defer teardown()
+		assert.Equal(t, subprotocolV2, conn.Subprotocol())
+
+		require.NoError(t, conn.WriteJSON(large))
+		assert.Contains(t, readJSON(t, conn), "conn_id")
+	})
+
+	for name, protocols := range map[string][]string{"a v1 client": {"rango.v1"}, "a client without subprotocol": nil} {
+		t.Run(name+" gets the default read limit", func(t *testing.T) {
+			conn, teardown := connect(t, protocols...)
+			defer teardown()
+
+			require.NoError(t, conn.WriteJSON(large))
+			_, _, err := conn.ReadMessage()
+			assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), "unexpected error: %v", err)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package routing
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	msg "github.com/openware/rango/pkg/message"
+)
+
+// Maximum size of the decoded subscribe request in the body of a connection
+// request.
+const maxSubscribeBodySize = 256 * 1024
+
+var errSubscribeBodyTooLarge = errors.New("subscribe body too large")
+
+// parseSubscribeBody parses the subscribe request in the body of a connection
+// request, like {"event":"subscribe","streams":["btcusd.trades"]}, for initial
+// stream lists too long for the URL. The body is decompressed if its
+// Content-Encoding is gzip. It returns an empty request without body.
+func parseSubscribeBody(r *http.Request) (msg.Request, error) {
+	if r.Body == nil || r.ContentLength == 0 {
+		return msg.Request{}, nil
+	}
+
+	var body io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return msg.Request{}, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxSubscribeBodySize+1))
+	if err != nil {
+		return msg.Request{}, err
+	}
+	if len(data) > maxSubscribeBodySize {
+		return msg.Request{}, errSubscribeBodyTooLarge
+	}
+	if len(data) == 0 {
+		return msg.Request{}, nil
+	}
+
+	req, err := msg.ParseRequest(data)
+	if err != nil {
+		return msg.Request{}, err
+	}
+	if req.Method != "subscribe" {
+		return msg.Request{}, errors.New("subscribe request expected")
+	}
+	return req, nil
+}
@@ -0,0 +1,159 @@
+package routing
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	_, err := gz.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return b.Bytes()
+}
+
+func TestParseSubscribeBody(t *testing.T) {
+	body := `{"event":"subscribe","streams":["btcusd.trades",{"stream":"btcusd.ob-inc","snapshot":false}]}`
+
+	t.Run("decodes gzip bodies", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", bytes.NewReader(gzipped(t, body)))
+		r.Header.Set("Content-Encoding", "gzip")
+		req, err := parseSubscribeBody(r)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"btcusd.trades", "btcusd.ob-inc"}, req.Streams)
+		assert.Equal(t, []string{"btcusd.ob-inc"}, req.NoSnapshot)
+	})
+
+	t.Run("reads plain bodies", func(t *testing.T) {
+		req, err := parseSubscribeBody(httptest.NewRequest(http.MethodGet, "/", strings.NewReader(body)))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"btcusd.trades", "btcusd.ob-inc"}, req.Streams)
+	})
+
+	t.Run("returns no stream without body", func(t *testing.T) {
+		req, err := parseSubscribeBody(httptest.NewRequest(http.MethodGet, "/", nil))
+		require.NoError(t, err)
+		assert.Empty(t, req.Streams)
+	})
+
+	t.Run("rejects invalid bodies", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", strings.NewReader(body))
+		r.Header.Set("Content-Encoding", "gzip")
+		_, err := parseSubscribeBody(r)
+		assert.Error(t, err)
+
+		_, err = parseSubscribeBody(httptest.NewRequest(http.MethodGet, "/", strings.NewReader(`{"event":"whoami"}`)))
+		assert.EqualError(t, err, "subscribe request expected")
+
+		huge := `{"event":"subscribe","streams":["` + strings.Repeat("a", maxSubscribeBodySize) + `"]}`
+		r = httptest.NewRequest(http.MethodGet, "/", bytes.NewReader(gzipped(t, huge)))
+		r.Header.Set("Content-Encoding", "gzip")
+		_, err = parseSubscribeBody(r)
+		assert.Equal(t, errSubscribeBodyTooLarge, err)
+	})
+}
+
+func TestSubscribeBodyConnection(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+	defer srv.Close()
+
+	conn := dialSubscribeBody(t, srv.URL, 300)
+	defer conn.Close()
+
+	waitFor(t, func() bool {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		return len(h.PublicTopics) == 301
+	})
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	assert.Contains(t, h.PublicTopics, "btcusd.trades")
+	assert.Contains(t, h.PublicTopics, "market299.trades")
+}
+
+func TestSubscribeBodyMaxRequestStreams(t *testing.T) {
+	h := NewHub()
+	h.MaxRequestStreams = 10
+	h.DefaultStreams = []string{"global.tickers"}
+	go h.ListenWebsocketEvents()
+	defer h.Shutdown()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewClient(h, w, r)
+	}))
+	defer srv.Close()
+
+	topics := func() []string {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		var streams []string
+		for s, topic := range h.PublicTopics {
+			if topic.len() != 0 {
+				streams = append(streams, s)
+			}
+		}
+		return streams
+	}
+
+	t.Run("rejects an oversized body", func(t *testing.T) {
+		conn := dialSubscribeBody(t, srv.URL, 300)
+		defer conn.Close()
+		waitFor(t, func() bool { return len(topics()) == 1 })
+		assert.Equal(t, []string{"global.tickers"}, topics())
+	})
+
+	h.StreamsOverflow = StreamsOverflowTruncate
+
+	t.Run("truncates an oversized body", func(t *testing.T) {
+		conn := dialSubscribeBody(t, srv.URL, 300)
+		defer conn.Close()
+		waitFor(t, func() bool { return len(topics()) == 11 })
+		assert.Contains(t, topics(), "btcusd.trades")
+		assert.Contains(t, topics(), "market8.trades")
+		assert.NotContains(t, topics(), "market9.trades")
+	})
+}
+
+// dialSubscribeBody upgrades a connection subscribing to btcusd.trades in its
+// URI and to n markets in its gzip body.
+func dialSubscribeBody(t *testing.T, url string, n int) net.Conn {
+	streams := make([]string, n)
+	for i := range streams {
+		streams[i] = fmt.Sprintf(`"market%d.trades"`, i)
+	}
+	body := gzipped(t, `{"event":"subscribe","streams":[`+strings.Join(streams, ",")+`]}`)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	require.NoError(t, err)
+
+	fmt.Fprintf(conn, "GET /?stream=btcusd.trades HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n"+
+		"Content-Encoding: gzip\r\n"+
+		"Content-Length: %d\r\n\r\n", conn.RemoteAddr(), len(body))
+	_, err = conn.Write(body)
+	require.NoError(t, err)
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	return conn
+}
@@ -0,0 +1,105 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/openware/rango/pkg/metrics"
+)
+
+// Value of the tags beyond the MaxTagValues distinct values of a tag.
+const otherTagValue = "other"
+
+// captureTags returns the tags of a connection from the TagHeaders of the
+// request and the CertTags of its verified client certificate, the tags
+// without value are not set.
+func (h *Hub) captureTags(r *http.Request) map[string]string {
+	if len(h.TagHeaders) == 0 && len(h.CertTags) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(h.TagHeaders)+len(h.CertTags))
+	for tag, header := range h.TagHeaders {
+		values[tag] = r.Header.Get(header)
+	}
+	if cert := peerCertificate(r); cert != nil {
+		for tag, field := range h.CertTags {
+			if value := certificateField(cert, field); value != "" {
+				values[tag] = value
+			}
+		}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	tags := make(map[string]string, len(values))
+	for tag, value := range values {
+		if value == "" {
+			continue
+		}
+
+		known, ok := h.tagValues[tag]
+		if !ok {
+			known = make(map[string]struct{})
+			h.tagValues[tag] = known
+		}
+		if _, ok := known[value]; !ok {
+			if h.MaxTagValues > 0 && len(known) >= h.MaxTagValues {
+				value = otherTagValue
+			} else {
+				known[value] = struct{}{}
+			}
+		}
+
+		if h.tagCounts[tag] == nil {
+			h.tagCounts[tag] = make(map[string]int)
+		}
+		tags[tag] = value
+		h.tagCounts[tag][value]++
+		metrics.RecordClientTag(tag, value)
+	}
+	return tags
+}
+
+// releaseTags removes the tags of a closed connection from the counts.
+func (h *Hub) releaseTags(tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for tag, value := range tags {
+		h.tagCounts[tag][value]--
+		if h.tagCounts[tag][value] <= 0 {
+			delete(h.tagCounts[tag], value)
+		}
+		metrics.ReleaseClientTag(tag, value)
+	}
+}
+
+// TagsHandler returns an HTTP handler serving the number of connections by
+// tag and value, like {"region":{"eu":3,"us":1}}.
+func TagsHandler(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.mutex.Lock()
+		counts := make(map[string]map[string]int, len(h.TagHeaders))
+		for tag := range h.TagHeaders {
+			counts[tag] = make(map[string]int, len(h.tagCounts[tag]))
+			for value, count := range h.tagCounts[tag] {
+				counts[tag][value] = count
+			}
+		}
+		h.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(counts)
+	}
+}
@@ -0,0 +1,56 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionTags(t *testing.T) {
+	h := NewHub()
+	h.TagHeaders = map[string]string{"region": "X-Region", "tier": "X-Client-Tier"}
+	h.MaxTagValues = 2
+	go h.ListenWebsocketEvents()
+
+	tags := func() string {
+		w := httptest.NewRecorder()
+		TagsHandler(h)(w, httptest.NewRequest(http.MethodGet, "/admin/tags", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+	connect := func(region, tier string) func() {
+		header := http.Header{"X-Region": []string{region}}
+		if tier != "" {
+			header.Set("X-Client-Tier", tier)
+		}
+		conn, teardown := dial(t, h, "/", header)
+		assert.Contains(t, readJSON(t, conn), "success")
+		return teardown
+	}
+
+	t.Run("captures the tags of a connection", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/", http.Header{"X-Region": []string{"eu"}, "X-Client-Tier": []string{"premium"}})
+		defer teardown()
+		assert.Contains(t, readJSON(t, conn), "success")
+
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"event": "whoami"}))
+		assert.Equal(t, map[string]interface{}{"region": "eu", "tier": "premium"}, readJSON(t, conn)["tags"])
+		assert.Equal(t, `{"region":{"eu":1},"tier":{"premium":1}}`+"\n", tags())
+	})
+
+	t.Run("releases the tags of closed connections", func(t *testing.T) {
+		waitFor(t, func() bool { return tags() == `{"region":{},"tier":{}}`+"\n" })
+	})
+
+	t.Run("counts values beyond the maximum as other", func(t *testing.T) {
+		defer connect("eu", "")()
+		defer connect("us", "")()
+		defer connect("ap", "")()
+		defer connect("eu", "")()
+
+		assert.Equal(t, `{"region":{"eu":2,"other":1,"us":1},"tier":{}}`+"\n", tags())
+	})
+}
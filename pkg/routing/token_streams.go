@@ -0,0 +1,37 @@
+package routing
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// tokenStreamsHeader is the header set by the authentication from the streams
+// claim of the token, a comma separated list of streams.
+const tokenStreamsHeader = "JwtStreams"
+
+// requestTokenStreams returns the streams of the streams claim of the token of
+// the request, nil if the token has no streams claim.
+func requestTokenStreams(r *http.Request) []string {
+	values, ok := r.Header[textproto.CanonicalMIMEHeaderKey(tokenStreamsHeader)]
+	if !ok {
+		return nil
+	}
+
+	streams := []string{}
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" && !contains(streams, s) {
+				streams = append(streams, s)
+			}
+		}
+	}
+	return streams
+}
+
+// tokenAllows returns true if the token of the client allows subscribing to
+// the stream, clients without streams claim may subscribe to any stream.
+func tokenAllows(client IClient, stream string) bool {
+	c, ok := churnClient(client).(*Client)
+	return !ok || c.tokenStreams == nil || contains(c.tokenStreams, stream)
+}
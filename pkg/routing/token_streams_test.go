@@ -0,0 +1,58 @@
+package routing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenStreams(t *testing.T) {
+	h := NewHub()
+	go h.ListenWebsocketEvents()
+
+	subscribed := func(res map[string]interface{}) interface{} {
+		return res["success"].(map[string]interface{})["streams"]
+	}
+	header := http.Header{
+		"JwtUID":     []string{"UIDABC00001"},
+		"JwtStreams": []string{"btcusd.trades,order"},
+	}
+
+	t.Run("subscribes to the streams of the token by default", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/", header)
+		defer teardown()
+		assert.ElementsMatch(t, []interface{}{"btcusd.trades", "order"}, subscribed(readJSON(t, conn)))
+	})
+
+	t.Run("restricts the subscriptions to the streams of the token", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/?stream=btcusd.trades,ethusd.trades,trade", header)
+		defer teardown()
+		assert.Equal(t, []interface{}{"btcusd.trades"}, subscribed(readJSON(t, conn)))
+
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{
+			"event":   "subscribe",
+			"streams": []string{"ethusd.ob-inc", "order"},
+		}))
+		assert.ElementsMatch(t, []interface{}{"btcusd.trades", "order"}, subscribed(readJSON(t, conn)))
+
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		assert.NotContains(t, h.PublicTopics, "ethusd.trades")
+		assert.NotContains(t, h.PublicTopics, "ethusd.ob-inc")
+		assert.NotContains(t, h.PrivateTopics["UIDABC00001"], "trade")
+	})
+
+	t.Run("an empty claim allows no stream", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/?stream=btcusd.trades", http.Header{"JwtStreams": []string{""}})
+		defer teardown()
+		assert.Equal(t, []interface{}{}, subscribed(readJSON(t, conn)))
+	})
+
+	t.Run("tokens without claim are unrestricted", func(t *testing.T) {
+		conn, teardown := dial(t, h, "/?stream=xrpusd.trades", http.Header{"JwtUID": []string{"UIDABC00002"}})
+		defer teardown()
+		assert.Equal(t, []interface{}{"xrpusd.trades"}, subscribed(readJSON(t, conn)))
+	})
+}
@@ -1,26 +1,56 @@
 package routing
 
 import (
-	"encoding/json"
+	"sync/atomic"
 
 	msg "github.com/openware/rango/pkg/message"
 	"github.com/rs/zerolog/log"
 )
 
+// Topic is the set of clients subscribed to a stream. Subscriptions must not
+// change concurrently, broadcasts may run concurrently with them.
 type Topic struct {
 	hub     *Hub
 	clients map[IClient]struct{}
+
+	// Clients in subscription order, the slice is replaced on each change so
+	// a broadcast in progress keeps a consistent list
+	subscribers atomic.Value
+
+	// Delivery conditions of the subscribers, replaced on each change like
+	// the subscribers
+	conditions atomic.Value
+
+	// Delta states of the subscribers receiving deltas, the set is replaced
+	// on each change like the subscribers
+	deltas atomic.Value
+
+	// Number of fan-outs of the topic, it rotates the first subscriber
+	// served, accessed atomically
+	rounds uint32
 }
 
 func NewTopic(h *Hub) *Topic {
-	return &Topic{
+	t := &Topic{
 		clients: make(map[IClient]struct{}),
 		hub:     h,
 	}
+	t.subscribers.Store([]IClient{})
+	t.conditions.Store(map[IClient]*msg.Condition{})
+	t.deltas.Store(map[IClient]*deltaState{})
+	return t
 }
 
-func eventMust(method string, data interface{}) []byte {
-	ev, err := msg.PackOutgoingEvent(method, data)
+// snapshot returns the clients of the topic in subscription order, the
+// returned slice must not be modified.
+func (t *Topic) snapshot() []IClient {
+	return t.subscribers.Load().([]IClient)
+}
+
+// eventMust returns the outbound message of a stream in the shape of the hub
+// envelope.
+func (h *Hub) eventMust(stream string, data interface{}) []byte {
+	ev, err := h.Envelope.Encode(msg.Envelope{Stream: stream, Data: data})
 	if err != nil {
 		log.Panic().Msg(err.Error())
 	}
@@ -28,6 +58,20 @@ func eventMust(method string, data interface{}) []byte {
 	return ev
 }
 
+// encode returns the outbound message of a stream in the shape of the hub
+// envelope.
+func (h *Hub) encode(stream string, data interface{}) (string, error) {
+	b, err := h.Envelope.Encode(msg.Envelope{Stream: stream, Data: data})
+	return string(b), err
+}
+
+// encodeEvent returns the outbound message of an event on a stream, carrying
+// the correlation ID of the event.
+func (h *Hub) encodeEvent(stream string, ev *Event) (string, error) {
+	b, err := h.Envelope.Encode(msg.Envelope{Stream: stream, Data: ev.Body, CorrelationID: ev.CorrelationID})
+	return string(b), err
+}
+
 func contains(list []string, el string) bool {
 	for _, l := range list {
 		if l == el {
@@ -41,25 +85,45 @@ func (t *Topic) len() int {
 	return len(t.clients)
 }
 
+// broadcast sends a private message to the recipients of the topic, see
+// privateRecipients.
 func (t *Topic) broadcast(message *Event) {
-	body, err := json.Marshal(map[string]interface{}{
-		message.Topic: message.Body,
-	})
-
+	body, err := t.hub.encodeEvent(message.Topic, message)
 	if err != nil {
 		log.Error().Msgf("Fail to JSON marshal: %s", err.Error())
 		return
 	}
 
-	for client := range t.clients {
-		client.Send(string(body))
-	}
+	p := newPayload(body)
+	t.fanOut(t.hub.privateRecipients(t), func(client IClient) {
+		t.deliver(client, message.Topic, p, message.Body)
+	})
 }
 
-func (t *Topic) broadcastRaw(topic, msgBody string) {
-	for client := range t.clients {
-		client.Send(msgBody)
+func (t *Topic) broadcastRaw(topic string, p *payload, data interface{}) {
+	t.fanOut(t.snapshot(), func(client IClient) {
+		t.deliver(client, topic, p, data)
+	})
+}
+
+// fanOut calls send for each client, starting one client further at each
+// fan-out of the topic. Under write congestion the subscribers served last
+// change from one message to the next, no subscriber of a hot stream is
+// always the last one.
+func (t *Topic) fanOut(clients []IClient, send func(IClient)) {
+	n := len(clients)
+	if n == 0 {
+		return
 	}
+	start := int((atomic.AddUint32(&t.rounds, 1) - 1) % uint32(n))
+	for i := 0; i < n; i++ {
+		send(clients[(start+i)%n])
+	}
+}
+
+func (t *Topic) has(c IClient) bool {
+	_, ok := t.clients[c]
+	return ok
 }
 
 func (t *Topic) subscribe(c IClient) bool {
@@ -68,12 +132,26 @@ func (t *Topic) subscribe(c IClient) bool {
 	}
 	t.clients[c] = struct{}{}
 
+	current := t.snapshot()
+	t.subscribers.Store(append(current[:len(current):len(current)], c))
 	return true
 }
 
 func (t *Topic) unsubscribe(c IClient) bool {
-	_, ok := t.clients[c]
+	if _, ok := t.clients[c]; !ok {
+		return false
+	}
 	delete(t.clients, c)
-
-	return ok
+	t.setCondition(c, nil)
+	t.setDelta(c, false)
+
+	current := t.snapshot()
+	subscribers := make([]IClient, 0, len(current)-1)
+	for _, client := range current {
+		if client != c {
+			subscribers = append(subscribers, client)
+		}
+	}
+	t.subscribers.Store(subscribers)
+	return true
 }
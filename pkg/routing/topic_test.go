@@ -0,0 +1,153 @@
+package routing
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/openware/rango/pkg/message"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingClient counts the stream messages it receives, other methods are
+// not implemented.
+type countingClient struct {
+	IClient
+	sent int64
+}
+
+func (c *countingClient) SendStream(string, string) {
+	atomic.AddInt64(&c.sent, 1)
+}
+
+func TestTopicSnapshot(t *testing.T) {
+	h := NewHub()
+	topic := NewTopic(h)
+	c1, c2, c3 := &countingClient{}, &countingClient{}, &countingClient{}
+
+	assert.True(t, topic.subscribe(c1))
+	assert.True(t, topic.subscribe(c2))
+	assert.False(t, topic.subscribe(c1))
+	before := topic.snapshot()
+
+	assert.True(t, topic.subscribe(c3))
+	assert.True(t, topic.unsubscribe(c1))
+	assert.False(t, topic.unsubscribe(c1))
+
+	assert.Equal(t, []IClient{c1, c2}, before)
+	assert.Equal(t, []IClient{c2, c3}, topic.snapshot())
+	assert.Equal(t, 2, topic.len())
+}
+
+func TestTopicBroadcastWhileChurning(t *testing.T) {
+	h := NewHub()
+	topic := NewTopic(h)
+	stable := &countingClient{}
+	topic.subscribe(stable)
+
+	const broadcasts = 1000
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	// Subscriptions change under the hub mutex as done by the hub.
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := &countingClient{}
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				h.mutex.Lock()
+				topic.subscribe(c)
+				h.mutex.Unlock()
+				h.mutex.Lock()
+				topic.unsubscribe(c)
+				h.mutex.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < broadcasts; i++ {
+		topic.broadcastRaw("eurusd.trades", newPayload("{}"), nil)
+	}
+	close(stop)
+	wg.Wait()
+
+	assert.Equal(t, int64(broadcasts), atomic.LoadInt64(&stable.sent))
+	assert.Equal(t, []IClient{stable}, topic.snapshot())
+}
+
+// orderedClient records the order in which the clients receive messages,
+// other methods are not implemented.
+type orderedClient struct {
+	IClient
+	name  string
+	order *[]string
+}
+
+func (c *orderedClient) SendStream(string, string) {
+	*c.order = append(*c.order, c.name)
+}
+
+func TestTopicFairFanOut(t *testing.T) {
+	h := NewHub()
+	topic := NewTopic(h)
+	order := []string{}
+	names := []string{"a", "b", "c", "d"}
+	for _, name := range names {
+		topic.subscribe(&orderedClient{name: name, order: &order})
+	}
+
+	first := map[string]int{}
+	last := map[string]int{}
+	for i := 0; i < 100; i++ {
+		order = order[:0]
+		topic.broadcastRaw("eurusd.trades", newPayload(`{"eurusd.trades":{}}`), nil)
+		assert.ElementsMatch(t, names, order)
+		first[order[0]]++
+		last[order[len(order)-1]]++
+	}
+
+	for _, name := range names {
+		assert.Equal(t, 25, first[name], name)
+		assert.Equal(t, 25, last[name], name)
+	}
+}
+
+func BenchmarkFanOut(b *testing.B) {
+	h := NewHub()
+	clients := make([]*Client, 1000)
+	for i := range clients {
+		clients[i] = &Client{
+			hub:      h,
+			send:     make(chan outbound, maxBufferedMessages),
+			priority: make(chan outbound, maxBufferedMessages),
+			pubSub:   []string{},
+			privSub:  []string{},
+		}
+		h.handleSubscribe(&Request{client: clients[i], Request: message.Request{Streams: []string{"btcusd.trades"}}})
+	}
+	drain := func() {
+		for _, c := range clients {
+			for len(c.send) > 0 {
+				c.release((<-c.send).data)
+			}
+		}
+	}
+	drain()
+	trade := &Event{Scope: "public", Stream: "btcusd", Type: "trades", Topic: "btcusd.trades", Body: map[string]interface{}{"tid": 1, "price": "9120.0", "amount": "0.1"}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.routeMessage(trade)
+		b.StopTimer()
+		drain()
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(len(clients)), "subscribers")
+}
@@ -0,0 +1,69 @@
+package routing
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// UpgradeLimiter limits the number of connections being upgraded and
+// subscribed at the same time, to absorb reconnection storms.
+type UpgradeLimiter struct {
+	slots chan struct{}
+	queue chan struct{}
+	wait  time.Duration
+}
+
+// NewUpgradeLimiter returns a limiter running at most concurrency upgrades,
+// up to queue requests wait at most wait for their turn.
+func NewUpgradeLimiter(concurrency, queue int, wait time.Duration) *UpgradeLimiter {
+	return &UpgradeLimiter{
+		slots: make(chan struct{}, concurrency),
+		queue: make(chan struct{}, queue),
+		wait:  wait,
+	}
+}
+
+func (l *UpgradeLimiter) acquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	select {
+	case l.queue <- struct{}{}:
+	default:
+		return false
+	}
+	defer func() { <-l.queue }()
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (l *UpgradeLimiter) release() {
+	<-l.slots
+}
+
+// Handler runs h once a slot is available, it responds with 503 Service
+// Unavailable if the queue is full or the wait expired.
+func (l *UpgradeLimiter) Handler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !l.acquire() {
+			log.Warn().Msg("Too many concurrent upgrades, rejecting connection")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		defer l.release()
+		h(w, r)
+	}
+}
@@ -0,0 +1,72 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgradeLimiter(t *testing.T) {
+	var running, maxRunning int32
+	started := make(chan struct{}, 10)
+	unblock := make(chan struct{})
+
+	l := NewUpgradeLimiter(1, 1, time.Second)
+	handler := l.Handler(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		if n > atomic.LoadInt32(&maxRunning) {
+			atomic.StoreInt32(&maxRunning, n)
+		}
+		started <- struct{}{}
+		<-unblock
+		atomic.AddInt32(&running, -1)
+	})
+
+	codes := make(chan int, 3)
+	var wg sync.WaitGroup
+	upgrade := func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			codes <- w.Code
+		}()
+	}
+
+	// The first upgrade runs, the second waits in the queue.
+	upgrade()
+	<-started
+	upgrade()
+	waitFor(t, func() bool { return len(l.queue) == 1 })
+
+	t.Run("rejects upgrades beyond the queue depth", func(t *testing.T) {
+		upgrade()
+		assert.Equal(t, http.StatusServiceUnavailable, <-codes)
+	})
+
+	t.Run("serializes queued upgrades", func(t *testing.T) {
+		unblock <- struct{}{}
+		<-started
+		unblock <- struct{}{}
+		wg.Wait()
+
+		assert.Equal(t, http.StatusOK, <-codes)
+		assert.Equal(t, http.StatusOK, <-codes)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&maxRunning))
+	})
+
+	t.Run("rejects upgrades waiting too long", func(t *testing.T) {
+		l := NewUpgradeLimiter(1, 1, 10*time.Millisecond)
+		l.slots <- struct{}{}
+
+		w := httptest.NewRecorder()
+		l.Handler(func(w http.ResponseWriter, r *http.Request) {})(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
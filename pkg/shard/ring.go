@@ -0,0 +1,102 @@
+// Package shard assigns streams to rango instances with consistent hashing, so
+// that the subscribers of a stream are concentrated on the same instances. A
+// front proxy and the source layer build the same ring from the same instance
+// set and agree on the owners without coordination.
+package shard
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// DefaultReplicas is the number of points of each instance on the ring.
+const DefaultReplicas = 128
+
+// point is a position of an instance on the ring.
+type point struct {
+	hash     uint64
+	instance string
+}
+
+// Ring is a consistent hash ring of instances, it is safe for concurrent reads.
+// Adding or removing an instance only moves the streams it owns or will own.
+type Ring struct {
+	points    []point
+	instances int
+}
+
+// NewRing returns a ring of the instances with replicas points each, or
+// DefaultReplicas if replicas is not positive. Duplicate instances are ignored.
+func NewRing(instances []string, replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+
+	seen := make(map[string]bool, len(instances))
+	r := &Ring{points: make([]point, 0, len(instances)*replicas)}
+	for _, instance := range instances {
+		if seen[instance] {
+			continue
+		}
+		seen[instance] = true
+		r.instances++
+		for i := 0; i < replicas; i++ {
+			r.points = append(r.points, point{hash(instance + "#" + strconv.Itoa(i)), instance})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash == r.points[j].hash {
+			return r.points[i].instance < r.points[j].instance
+		}
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r
+}
+
+// Owner returns the instance owning the stream, empty if the ring is empty.
+func (r *Ring) Owner(stream string) string {
+	owners := r.Owners(stream, 1)
+	if len(owners) == 0 {
+		return ""
+	}
+	return owners[0]
+}
+
+// Owners returns up to n distinct instances owning the stream, in order of
+// preference. The next ones take over the stream when the first ones leave.
+func (r *Ring) Owners(stream string, n int) []string {
+	if n > r.instances {
+		n = r.instances
+	}
+	if n <= 0 {
+		return []string{}
+	}
+
+	h := hash(stream)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	owners := make([]string, 0, n)
+	for i := 0; len(owners) < n; i++ {
+		instance := r.points[(start+i)%len(r.points)].instance
+		if !contains(owners, instance) {
+			owners = append(owners, instance)
+		}
+	}
+	return owners
+}
+
+// hash returns a stable hash of a key, the same on every instance.
+func hash(key string) uint64 {
+	sum := sha1.Sum([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func contains(list []string, el string) bool {
+	for _, s := range list {
+		if s == el {
+			return true
+		}
+	}
+	return false
+}
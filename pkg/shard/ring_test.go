@@ -0,0 +1,67 @@
+package shard
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func streams(n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = fmt.Sprintf("market%d.trades", i)
+	}
+	return list
+}
+
+func TestRing(t *testing.T) {
+	instances := []string{"rango-0", "rango-1", "rango-2", "rango-3"}
+
+	t.Run("is stable", func(t *testing.T) {
+		a := NewRing(instances, 0)
+		b := NewRing([]string{"rango-3", "rango-1", "rango-0", "rango-2", "rango-1"}, 0)
+		for _, s := range streams(1000) {
+			assert.Equal(t, a.Owner(s), b.Owner(s), s)
+			assert.Equal(t, a.Owners(s, 2), b.Owners(s, 2), s)
+		}
+		assert.Equal(t, "rango-2", a.Owner("btcusd.trades"))
+	})
+
+	t.Run("is balanced", func(t *testing.T) {
+		r := NewRing(instances, 0)
+		counts := map[string]int{}
+		for _, s := range streams(10000) {
+			counts[r.Owner(s)]++
+		}
+		assert.Len(t, counts, len(instances))
+		for instance, count := range counts {
+			assert.InDelta(t, 2500, count, 500, instance)
+		}
+	})
+
+	t.Run("moves only the streams of a removed instance", func(t *testing.T) {
+		before := NewRing(instances, 0)
+		after := NewRing(instances[:3], 0)
+		for _, s := range streams(1000) {
+			if owner := before.Owner(s); owner != "rango-3" {
+				assert.Equal(t, owner, after.Owner(s), s)
+			} else {
+				assert.Equal(t, before.Owners(s, 2)[1], after.Owner(s), s)
+			}
+		}
+	})
+
+	t.Run("returns distinct owners", func(t *testing.T) {
+		r := NewRing(instances, 0)
+		owners := r.Owners("btcusd.trades", 10)
+		assert.ElementsMatch(t, instances, owners)
+		assert.Equal(t, r.Owner("btcusd.trades"), owners[0])
+	})
+
+	t.Run("an empty ring owns nothing", func(t *testing.T) {
+		r := NewRing(nil, 0)
+		assert.Equal(t, "", r.Owner("btcusd.trades"))
+		assert.Equal(t, []string{}, r.Owners("btcusd.trades", 2))
+	})
+}
@@ -70,6 +70,12 @@ func (session *AMQPSession) Push(ex, rt string, data []byte) error {
 // successfully processed, or delivery.Nack when it fails.
 // Ignoring this will cause data to build up on the server.
 func (session *AMQPSession) Stream(exName, qName string) (<-chan amqp.Delivery, error) {
+	return session.StreamKeys(exName, qName, []string{"#"})
+}
+
+// StreamKeys is like Stream, but the queue only receives the messages of the
+// routing keys, more of them are bound with the Bindings of the queue.
+func (session *AMQPSession) StreamKeys(exName, qName string, keys []string) (<-chan amqp.Delivery, error) {
 	_, err := session.channel.QueueDeclare(
 		qName,
 		false, // Durable
@@ -84,7 +90,11 @@ func (session *AMQPSession) Stream(exName, qName string) (<-chan amqp.Delivery,
 	}
 
 	session.channel.ExchangeDeclare(exName, "topic", false, false, false, false, nil)
-	session.channel.QueueBind(qName, "#", exName, false, nil)
+	for _, key := range keys {
+		if err := session.channel.QueueBind(qName, key, exName, false, nil); err != nil {
+			return nil, err
+		}
+	}
 
 	return session.channel.Consume(
 		qName,
@@ -97,6 +107,30 @@ func (session *AMQPSession) Stream(exName, qName string) (<-chan amqp.Delivery,
 	)
 }
 
+// Bindings binds a queue to the routing keys of an exchange on demand.
+type Bindings struct {
+	session *AMQPSession
+	exName  string
+	qName   string
+}
+
+// Bindings returns the bindings of the queue to the exchange.
+func (session *AMQPSession) Bindings(exName, qName string) *Bindings {
+	return &Bindings{session: session, exName: exName, qName: qName}
+}
+
+// Subscribe binds the queue to the routing key.
+func (b *Bindings) Subscribe(key string) error {
+	log.Debug().Msgf("Binding %s to %s", b.qName, key)
+	return b.session.channel.QueueBind(b.qName, key, b.exName, false, nil)
+}
+
+// Unsubscribe unbinds the queue from the routing key.
+func (b *Bindings) Unsubscribe(key string) error {
+	log.Debug().Msgf("Unbinding %s from %s", b.qName, key)
+	return b.session.channel.QueueUnbind(b.qName, key, b.exName, nil)
+}
+
 // Close will delete the queue, close the channel and the connection.
 func (session *AMQPSession) Close(qName string) error {
 	log.Error().Msg("Closing connection to RabbitMQ")